@@ -0,0 +1,787 @@
+// Conversion between ACI images and docker save archives.
+
+package adaptor
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ArchiveACI    = "aci"
+	ArchiveDocker = "docker"
+
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// aciManifest is the subset of the appc image manifest harbour reads and writes.
+type aciManifest struct {
+	ACKind    string        `json:"acKind"`
+	ACVersion string        `json:"acVersion"`
+	Name      string        `json:"name"`
+	Labels    []aciLabel    `json:"labels,omitempty"`
+	App       *aciApp       `json:"app,omitempty"`
+	Ann       []aciLabel    `json:"annotations,omitempty"`
+	Deps      []interface{} `json:"dependencies,omitempty"`
+}
+
+type aciLabel struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type aciApp struct {
+	Exec             []string   `json:"exec,omitempty"`
+	User             string     `json:"user"`
+	Group            string     `json:"group"`
+	WorkingDirectory string     `json:"workingDirectory,omitempty"`
+	Environment      []aciLabel `json:"environment,omitempty"`
+	MountPoints      []aciMount `json:"mountPoints,omitempty"`
+	Ports            []aciPort  `json:"ports,omitempty"`
+}
+
+type aciMount struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+}
+
+type aciPort struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Port     uint   `json:"port"`
+	Count    uint   `json:"count"`
+}
+
+// dockerImageConfig is the part of a docker image json harbour cares about.
+type dockerImageConfig struct {
+	ID           string              `json:"id,omitempty"`
+	Parent       string              `json:"parent,omitempty"`
+	Created      time.Time           `json:"created"`
+	Architecture string              `json:"architecture,omitempty"`
+	Os           string              `json:"os,omitempty"`
+	Config       *dockerRunConfig    `json:"config,omitempty"`
+	RootFS       *dockerRootFS       `json:"rootfs,omitempty"`
+	History      []map[string]string `json:"history,omitempty"`
+}
+
+type dockerRunConfig struct {
+	User         string              `json:"User"`
+	Env          []string            `json:"Env"`
+	Cmd          []string            `json:"Cmd"`
+	Entrypoint   []string            `json:"Entrypoint"`
+	WorkingDir   string              `json:"WorkingDir"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Volumes      map[string]struct{} `json:"Volumes,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+}
+
+type dockerRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type dockerManifestEntry struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// archiveImage is an ACI file on disk together with the repository tag it is
+// known by on the docker side.
+type archiveImage struct {
+	Path    string
+	RepoTag string
+}
+
+var acNameInvalid = regexp.MustCompile("[^a-z0-9._~/-]+")
+
+// detectArchiveFormat tells whether the tarball at p is an ACI or a docker
+// save archive.
+func detectArchiveFormat(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("Bad parameter: invalid image archive: %s", err)
+		}
+		switch path.Clean(hdr.Name) {
+		case "manifest", "rootfs":
+			return ArchiveACI, nil
+		case "repositories", "manifest.json":
+			return ArchiveDocker, nil
+		}
+	}
+	return "", fmt.Errorf("Bad parameter: unknown image archive format")
+}
+
+// dockerArchiveToACI converts every image of a docker save archive into an
+// ACI written under dir. Layers are squashed into a single rootfs.
+func dockerArchiveToACI(archive string, dir string) ([]archiveImage, error) {
+	src, err := ioutil.TempDir(dir, "docker-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(src)
+
+	if err := untarFlat(archive, src); err != nil {
+		return nil, err
+	}
+
+	entries, err := readDockerManifest(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []archiveImage
+	for i, entry := range entries {
+		var config dockerImageConfig
+		configPath, err := archivePath(src, entry.Config)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, err
+		}
+
+		repoTag := ""
+		if len(entry.RepoTags) > 0 {
+			repoTag = entry.RepoTags[0]
+		}
+		layers := make([]string, 0, len(entry.Layers))
+		for _, l := range entry.Layers {
+			layer, err := archivePath(src, l)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, layer)
+		}
+
+		out := filepath.Join(dir, fmt.Sprintf("image-%d.aci", i))
+		if err := writeACI(out, aciManifestFromDocker(repoTag, &config), layers); err != nil {
+			return nil, err
+		}
+		images = append(images, archiveImage{Path: out, RepoTag: repoTag})
+	}
+
+	return images, nil
+}
+
+// readDockerManifest returns the images of an extracted docker save archive,
+// falling back to the legacy repositories layout when manifest.json is absent.
+func readDockerManifest(src string) ([]dockerManifestEntry, error) {
+	var entries []dockerManifestEntry
+
+	data, err := ioutil.ReadFile(filepath.Join(src, "manifest.json"))
+	if err == nil {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+		return entries, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	data, err = ioutil.ReadFile(filepath.Join(src, "repositories"))
+	if err != nil {
+		return nil, fmt.Errorf("Bad parameter: docker archive has neither manifest.json nor repositories")
+	}
+	repositories := map[string]map[string]string{}
+	if err := json.Unmarshal(data, &repositories); err != nil {
+		return nil, err
+	}
+
+	for repo, tags := range repositories {
+		for tag, id := range tags {
+			// Walk the parent chain down to the base layer.
+			var layers []string
+			seen := map[string]bool{}
+			for cur := id; cur != ""; {
+				if seen[cur] {
+					return nil, fmt.Errorf("Bad parameter: docker archive has a loop in the parents of %s", id)
+				}
+				seen[cur] = true
+				configPath, err := archivePath(src, filepath.Join(cur, "json"))
+				if err != nil {
+					return nil, err
+				}
+				var config dockerImageConfig
+				data, err := ioutil.ReadFile(configPath)
+				if err != nil {
+					return nil, err
+				}
+				if err := json.Unmarshal(data, &config); err != nil {
+					return nil, err
+				}
+				layers = append([]string{filepath.Join(cur, "layer.tar")}, layers...)
+				cur = config.Parent
+			}
+			entries = append(entries, dockerManifestEntry{
+				Config:   filepath.Join(id, "json"),
+				RepoTags: []string{repo + ":" + tag},
+				Layers:   layers,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// archivePath returns the path of name, a file an extracted archive refers to
+// in its metadata, refusing the ones that lead out of the archive at src.
+func archivePath(src, name string) (string, error) {
+	root, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return "", err
+	}
+	if name == "" || filepath.IsAbs(name) {
+		return "", fmt.Errorf("Bad parameter: docker archive refers to invalid path %q", name)
+	}
+	p := filepath.Join(root, filepath.Clean(name))
+	if !insideDir(root, p) {
+		return "", fmt.Errorf("Bad parameter: docker archive refers to %s outside of it", name)
+	}
+	return p, nil
+}
+
+// insideDir resolves the symlinks of the longest existing prefix of p and
+// tells whether it stays under root.
+func insideDir(root string, p string) bool {
+	for {
+		resolved, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return resolved == root || strings.HasPrefix(resolved, root+"/")
+		}
+		if !os.IsNotExist(err) || p == filepath.Dir(p) {
+			return false
+		}
+		p = filepath.Dir(p)
+	}
+}
+
+func aciManifestFromDocker(repoTag string, config *dockerImageConfig) *aciManifest {
+	name, tag := splitRepoTag(repoTag)
+	if name == "" {
+		name = "harbour/imported"
+	}
+	os, arch := config.Os, config.Architecture
+	if os == "" {
+		os = "linux"
+	}
+	if arch == "" || arch == "x86_64" {
+		arch = "amd64"
+	}
+
+	m := &aciManifest{
+		ACKind:    "ImageManifest",
+		ACVersion: "0.7.1",
+		Name:      acNameInvalid.ReplaceAllString(strings.ToLower(name), "-"),
+		Labels: []aciLabel{
+			{Name: "version", Value: tag},
+			{Name: "os", Value: os},
+			{Name: "arch", Value: arch},
+		},
+	}
+
+	c := config.Config
+	if c == nil {
+		return m
+	}
+
+	app := &aciApp{
+		Exec:             append(append([]string{}, c.Entrypoint...), c.Cmd...),
+		User:             "0",
+		Group:            "0",
+		WorkingDirectory: c.WorkingDir,
+	}
+	if c.User != "" {
+		parts := strings.SplitN(c.User, ":", 2)
+		app.User = parts[0]
+		if len(parts) == 2 {
+			app.Group = parts[1]
+		}
+	}
+	for _, env := range c.Env {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) == 2 {
+			app.Environment = append(app.Environment, aciLabel{Name: kv[0], Value: kv[1]})
+		}
+	}
+	for _, p := range sortedKeys(c.ExposedPorts) {
+		port, proto := splitPortProto(p)
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			continue
+		}
+		app.Ports = append(app.Ports, aciPort{Name: port + "-" + proto, Protocol: proto, Port: uint(n), Count: 1})
+	}
+	for _, v := range sortedKeys(c.Volumes) {
+		app.MountPoints = append(app.MountPoints, aciMount{Name: acNameInvalid.ReplaceAllString(strings.Trim(v, "/"), "-"), Path: v})
+	}
+	m.App = app
+	for k, v := range c.Labels {
+		m.Ann = append(m.Ann, aciLabel{Name: k, Value: v})
+	}
+
+	return m
+}
+
+// writeACI writes an ACI holding manifest and the union of layers, applied
+// in order with docker whiteout semantics.
+func writeACI(out string, manifest *aciManifest, layers []string) error {
+	// First pass: find out which layer provides the final version of each path.
+	owner := map[string]int{}
+	for i, l := range layers {
+		err := walkTar(l, func(hdr *tar.Header, r io.Reader) error {
+			name := path.Clean(hdr.Name)
+			if outsideRootfs(name) {
+				return fmt.Errorf("Bad parameter: layer entry %s is outside of the image", hdr.Name)
+			}
+			if hdr.Typeflag == tar.TypeLink && outsideRootfs(path.Clean(hdr.Linkname)) {
+				return fmt.Errorf("Bad parameter: layer entry %s links to %s outside of the image", hdr.Name, hdr.Linkname)
+			}
+			dir, base := path.Split(name)
+			if base == whiteoutOpaque {
+				removeTree(owner, path.Clean(dir), false)
+				return nil
+			}
+			if strings.HasPrefix(base, whiteoutPrefix) {
+				removeTree(owner, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), true)
+				return nil
+			}
+			owner[name] = i
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, "manifest", data); err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "rootfs/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: time.Now()}); err != nil {
+		return err
+	}
+
+	// Second pass: copy the surviving entries under rootfs/.
+	for i, l := range layers {
+		err := walkTar(l, func(hdr *tar.Header, r io.Reader) error {
+			name := path.Clean(hdr.Name)
+			if name == "." {
+				return nil
+			}
+			if o, ok := owner[name]; !ok || o != i {
+				return nil
+			}
+			hdr.Name = path.Join("rootfs", name)
+			if hdr.Typeflag == tar.TypeDir {
+				hdr.Name += "/"
+			}
+			if hdr.Typeflag == tar.TypeLink {
+				hdr.Linkname = path.Join("rootfs", path.Clean(hdr.Linkname))
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			_, err := io.Copy(tw, r)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// outsideRootfs tells whether name, cleaned, leads out of the rootfs a layer
+// is applied to.
+func outsideRootfs(name string) bool {
+	return path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../")
+}
+
+// rewriteACIManifest rewrites the image manifest of the ACI at p in place.
+func rewriteACIManifest(p string, fn func(m *aciManifest)) error {
+	out, err := ioutil.TempFile(filepath.Dir(p), filepath.Base(p)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	found := false
+	tw := tar.NewWriter(out)
+	err = walkTar(p, func(hdr *tar.Header, r io.Reader) error {
+		if path.Clean(hdr.Name) != "manifest" {
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			_, err := io.Copy(tw, r)
+			return err
+		}
+
+		m := &aciManifest{}
+		if err := json.NewDecoder(r).Decode(m); err != nil {
+			return err
+		}
+		fn(m)
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		found = true
+		return writeTarFile(tw, hdr.Name, data)
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("Bad parameter: %s has no image manifest", p)
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), p)
+}
+
+// retagACI renames the ACI at p after a docker repository tag.
+func retagACI(p string, repoTag string) error {
+	name, tag := splitRepoTag(repoTag)
+	return rewriteACIManifest(p, func(m *aciManifest) {
+		m.Name = acNameInvalid.ReplaceAllString(strings.ToLower(name), "-")
+		for i := range m.Labels {
+			if m.Labels[i].Name == "version" {
+				m.Labels[i].Value = tag
+				return
+			}
+		}
+		m.Labels = append(m.Labels, aciLabel{Name: "version", Value: tag})
+	})
+}
+
+// aciToDockerArchive writes a docker save archive with one single-layer
+// image for each ACI.
+func aciToDockerArchive(images []archiveImage, w io.Writer, tmpDir string) error {
+	tw := tar.NewWriter(w)
+	repositories := map[string]map[string]string{}
+	var manifest []dockerManifestEntry
+
+	for _, img := range images {
+		layer, err := ioutil.TempFile(tmpDir, "layer-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(layer.Name())
+		defer layer.Close()
+
+		m, diffID, err := aciToLayer(img.Path, layer)
+		if err != nil {
+			return err
+		}
+		size, err := layer.Seek(0, os.SEEK_CUR)
+		if err != nil {
+			return err
+		}
+
+		repo, tag := splitRepoTag(img.RepoTag)
+		if repo == "" {
+			repo, tag = m.Name, labelValue(m.Labels, "version")
+			if tag == "" {
+				tag = "latest"
+			}
+		}
+		config := dockerConfigFromACI(m)
+		config.ID = diffID
+		config.RootFS = &dockerRootFS{Type: "layers", DiffIDs: []string{"sha256:" + diffID}}
+		configData, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(configData)
+		configName := hex.EncodeToString(sum[:]) + ".json"
+
+		if err := writeTarFile(tw, diffID+"/VERSION", []byte("1.0")); err != nil {
+			return err
+		}
+		if err := writeTarFile(tw, diffID+"/json", configData); err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: diffID + "/layer.tar", Mode: 0644, Size: size, ModTime: time.Now(), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		if _, err := layer.Seek(0, os.SEEK_SET); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, layer); err != nil {
+			return err
+		}
+		if err := writeTarFile(tw, configName, configData); err != nil {
+			return err
+		}
+
+		if repositories[repo] == nil {
+			repositories[repo] = map[string]string{}
+		}
+		repositories[repo][tag] = diffID
+		manifest = append(manifest, dockerManifestEntry{
+			Config:   configName,
+			RepoTags: []string{repo + ":" + tag},
+			Layers:   []string{diffID + "/layer.tar"},
+		})
+	}
+
+	data, err := json.Marshal(repositories)
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, "repositories", data); err != nil {
+		return err
+	}
+	data, err = json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, "manifest.json", data); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// aciToLayer copies the rootfs of an ACI into a layer tarball and returns the
+// image manifest together with the layer digest.
+func aciToLayer(aci string, layer io.Writer) (*aciManifest, string, error) {
+	var manifest *aciManifest
+	h := sha256.New()
+	tw := tar.NewWriter(io.MultiWriter(layer, h))
+
+	err := walkTar(aci, func(hdr *tar.Header, r io.Reader) error {
+		name := path.Clean(hdr.Name)
+		if name == "manifest" {
+			manifest = &aciManifest{}
+			return json.NewDecoder(r).Decode(manifest)
+		}
+		if !strings.HasPrefix(name, "rootfs/") {
+			return nil
+		}
+		hdr.Name = strings.TrimPrefix(name, "rootfs/")
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Name += "/"
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = strings.TrimPrefix(path.Clean(hdr.Linkname), "rootfs/")
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, "", err
+	}
+	if manifest == nil {
+		return nil, "", fmt.Errorf("Bad parameter: %s has no image manifest", aci)
+	}
+	return manifest, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func dockerConfigFromACI(m *aciManifest) *dockerImageConfig {
+	config := &dockerImageConfig{
+		Created:      time.Now().UTC(),
+		Os:           labelValue(m.Labels, "os"),
+		Architecture: labelValue(m.Labels, "arch"),
+		Config:       &dockerRunConfig{},
+	}
+	if m.App == nil {
+		return config
+	}
+
+	c := config.Config
+	c.Cmd = m.App.Exec
+	c.WorkingDir = m.App.WorkingDirectory
+	if m.App.User != "" && m.App.User != "0" {
+		c.User = m.App.User
+		if m.App.Group != "" && m.App.Group != "0" {
+			c.User += ":" + m.App.Group
+		}
+	}
+	for _, env := range m.App.Environment {
+		c.Env = append(c.Env, env.Name+"="+env.Value)
+	}
+	for _, p := range m.App.Ports {
+		if c.ExposedPorts == nil {
+			c.ExposedPorts = map[string]struct{}{}
+		}
+		c.ExposedPorts[fmt.Sprintf("%d/%s", p.Port, p.Protocol)] = struct{}{}
+	}
+	for _, mp := range m.App.MountPoints {
+		if c.Volumes == nil {
+			c.Volumes = map[string]struct{}{}
+		}
+		c.Volumes[mp.Path] = struct{}{}
+	}
+	for _, a := range m.Ann {
+		if c.Labels == nil {
+			c.Labels = map[string]string{}
+		}
+		c.Labels[a.Name] = a.Value
+	}
+	return config
+}
+
+// untarFlat extracts the regular files and directories of a tarball into
+// dir. It is only used on archives whose members are themselves archives or
+// json documents, so ownership, links and devices are ignored.
+func untarFlat(archive string, dir string) error {
+	return walkTar(archive, func(hdr *tar.Header, r io.Reader) error {
+		name := filepath.Join(dir, filepath.Clean("/"+hdr.Name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			return os.MkdirAll(name, 0755)
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				return err
+			}
+			f, err := os.Create(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(f, r)
+			return err
+		}
+		return nil
+	})
+}
+
+func walkTar(archive string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// removeTree drops p (when self is set) and everything below it.
+func removeTree(owner map[string]int, p string, self bool) {
+	if self {
+		delete(owner, p)
+	}
+	prefix := p + "/"
+	if p == "." {
+		prefix = ""
+	}
+	for name := range owner {
+		if strings.HasPrefix(name, prefix) {
+			delete(owner, name)
+		}
+	}
+}
+
+func splitRepoTag(repoTag string) (string, string) {
+	if repoTag == "" {
+		return "", ""
+	}
+	i := strings.LastIndex(repoTag, ":")
+	if i < 0 || strings.Contains(repoTag[i+1:], "/") {
+		return repoTag, "latest"
+	}
+	return repoTag[:i], repoTag[i+1:]
+}
+
+func splitPortProto(p string) (string, string) {
+	parts := strings.SplitN(p, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], "tcp"
+	}
+	return parts[0], parts[1]
+}
+
+func labelValue(labels []aciLabel, name string) string {
+	for _, l := range labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,270 @@
+package adaptor
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type tarEntry struct {
+	name string
+	body string
+	dir  bool
+	// link is the target of a hardlink.
+	link string
+}
+
+func buildTar(t *testing.T, entries []tarEntry) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.dir {
+			hdr = &tar.Header{Name: e.name, Mode: 0755, Typeflag: tar.TypeDir}
+		}
+		if e.link != "" {
+			hdr = &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeLink, Linkname: e.link}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarNames(t *testing.T, archive string) map[string]string {
+	names := map[string]string{}
+	err := walkTar(archive, func(hdr *tar.Header, r io.Reader) error {
+		data, err := ioutil.ReadAll(r)
+		names[hdr.Name] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func writeDockerArchive(t *testing.T, dir string) string {
+	base := buildTar(t, []tarEntry{
+		{name: "etc/", dir: true},
+		{name: "etc/hostname", body: "base"},
+		{name: "etc/passwd", body: "root"},
+		{name: "bin/", dir: true},
+		{name: "bin/sh", body: "shell"},
+	})
+	top := buildTar(t, []tarEntry{
+		{name: "etc/", dir: true},
+		{name: "etc/hostname", body: "top"},
+		{name: "etc/.wh.passwd"},
+	})
+	config, _ := json.Marshal(&dockerImageConfig{
+		Config: &dockerRunConfig{
+			Cmd:          []string{"/bin/sh"},
+			Env:          []string{"PATH=/bin"},
+			ExposedPorts: map[string]struct{}{"80/tcp": {}},
+		},
+	})
+	manifest, _ := json.Marshal([]dockerManifestEntry{{
+		Config:   "config.json",
+		RepoTags: []string{"busybox:1.0"},
+		Layers:   []string{"base/layer.tar", "top/layer.tar"},
+	}})
+
+	archive := filepath.Join(dir, "docker.tar")
+	data := buildTar(t, []tarEntry{
+		{name: "base/layer.tar", body: string(base)},
+		{name: "top/layer.tar", body: string(top)},
+		{name: "config.json", body: string(config)},
+		{name: "manifest.json", body: string(manifest)},
+	})
+	if err := ioutil.WriteFile(archive, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func TestDockerArchiveToACI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harbour-aci-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := writeDockerArchive(t, dir)
+	format, err := detectArchiveFormat(archive)
+	if err != nil || format != ArchiveDocker {
+		t.Fatalf("expected docker archive, got %q (%v)", format, err)
+	}
+
+	images, err := dockerArchiveToACI(archive, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].RepoTag != "busybox:1.0" {
+		t.Fatalf("unexpected images %v", images)
+	}
+	if format, _ := detectArchiveFormat(images[0].Path); format != ArchiveACI {
+		t.Fatalf("expected an ACI, got %q", format)
+	}
+
+	names := tarNames(t, images[0].Path)
+	if names["rootfs/etc/hostname"] != "top" {
+		t.Fatalf("upper layer should win, got %q", names["rootfs/etc/hostname"])
+	}
+	if _, ok := names["rootfs/etc/passwd"]; ok {
+		t.Fatal("whited out file should not be in the ACI")
+	}
+	if names["rootfs/bin/sh"] != "shell" {
+		t.Fatal("base layer file missing from the ACI")
+	}
+
+	var m aciManifest
+	if err := json.Unmarshal([]byte(names["manifest"]), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "busybox" || labelValue(m.Labels, "version") != "1.0" {
+		t.Fatalf("unexpected name %s version %s", m.Name, labelValue(m.Labels, "version"))
+	}
+	if len(m.App.Ports) != 1 || m.App.Ports[0].Port != 80 || m.App.Ports[0].Name != "80-tcp" {
+		t.Fatalf("unexpected ports %v", m.App.Ports)
+	}
+}
+
+func TestACIToDockerArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harbour-aci-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	images, err := dockerArchiveToACI(writeDockerArchive(t, dir), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "saved.tar")
+	f, err := os.Create(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := aciToDockerArchive(images, f, dir); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// Loading the result again must give back the same filesystem.
+	again, err := dockerArchiveToACI(out, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 1 || again[0].RepoTag != "busybox:1.0" {
+		t.Fatalf("unexpected images %v", again)
+	}
+
+	var before, after []string
+	for name := range tarNames(t, images[0].Path) {
+		before = append(before, name)
+	}
+	for name := range tarNames(t, again[0].Path) {
+		after = append(after, name)
+	}
+	sort.Strings(before)
+	sort.Strings(after)
+	if len(before) != len(after) {
+		t.Fatalf("round trip changed the image: %v != %v", before, after)
+	}
+	for i := range before {
+		if before[i] != after[i] {
+			t.Fatalf("round trip changed the image: %v != %v", before, after)
+		}
+	}
+}
+
+func TestDockerArchiveOutsidePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harbour-aci-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A valid configuration and layer next to the extracted archive, where
+	// none of its entries may lead.
+	config, _ := json.Marshal(&dockerImageConfig{})
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), config, 0644); err != nil {
+		t.Fatal(err)
+	}
+	layer := buildTar(t, []tarEntry{{name: "etc/shadow", body: "secret"}})
+	if err := ioutil.WriteFile(filepath.Join(dir, "layer.tar"), layer, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := func(config string, layers ...string) tarEntry {
+		data, _ := json.Marshal([]dockerManifestEntry{{Config: config, Layers: layers}})
+		return tarEntry{name: "manifest.json", body: string(data)}
+	}
+	legacy := func(id, parent string) []tarEntry {
+		data, _ := json.Marshal(&dockerImageConfig{Parent: parent})
+		return []tarEntry{
+			{name: "repositories", body: `{"busybox": {"latest": "` + id + `"}}`},
+			{name: id + "/json", body: string(data)},
+			{name: id + "/layer.tar", body: string(layer)},
+		}
+	}
+	for name, entries := range map[string][]tarEntry{
+		"relative config":  {manifest("../config.json")},
+		"absolute config":  {manifest(filepath.Join(dir, "config.json"))},
+		"relative layer":   {{name: "c.json", body: string(config)}, manifest("c.json", "../layer.tar")},
+		"absolute layer":   {{name: "c.json", body: string(config)}, manifest("c.json", filepath.Join(dir, "layer.tar"))},
+		"cleaned layer":    {{name: "c.json", body: string(config)}, manifest("c.json", "a/../../layer.tar")},
+		"relative parent":  legacy("top", "../"),
+		"absolute parent":  legacy("top", dir),
+		"parent of itself": legacy("top", "top"),
+	} {
+		archive := filepath.Join(dir, "docker.tar")
+		if err := ioutil.WriteFile(archive, buildTar(t, entries), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dockerArchiveToACI(archive, dir); err == nil || !strings.Contains(err.Error(), "Bad parameter") {
+			t.Fatalf("%s: expected the archive to be refused, got %v", name, err)
+		}
+	}
+}
+
+func TestWriteACIOutsidePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harbour-aci-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, entry := range map[string]tarEntry{
+		"relative entry": {name: "../etc/profile", body: "evil"},
+		"cleaned entry":  {name: "usr/../../etc/profile", body: "evil"},
+		"absolute entry": {name: "/etc/profile", body: "evil"},
+		"relative link":  {name: "shadow", link: "../etc/shadow"},
+		"absolute link":  {name: "shadow", link: "/etc/shadow"},
+	} {
+		layer := filepath.Join(dir, "layer.tar")
+		if err := ioutil.WriteFile(layer, buildTar(t, []tarEntry{{name: "bin/sh", body: "sh"}, entry}), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := writeACI(filepath.Join(dir, "image.aci"), &aciManifest{ACKind: "ImageManifest", Name: "busybox"}, []string{layer})
+		if err == nil || !strings.Contains(err.Error(), "Bad parameter") {
+			t.Fatalf("%s: expected the layer to be refused, got %v", name, err)
+		}
+	}
+}
@@ -2,13 +2,21 @@ package adaptor
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/api/types"
 	"github.com/huawei-openlab/harbour/utils"
 )
 
@@ -18,21 +26,16 @@ const (
 	DELETE
 )
 
-type UserConfig struct {
-	Hostname string // Hostname
-	Image    string // Name of the image as it was passed by the operator (eg. could be symbolic)
-}
-
-func Rkt_Rundockercmd(r *http.Request, method int) error {
+func Rkt_Rundockercmd(w http.ResponseWriter, r *http.Request, method int) error {
 	var err error
 
 	switch method {
 	case GET:
-		err = rkt_DockerGet(r)
+		err = rkt_DockerGet(w, r)
 	case POST:
-		err = rkt_DockerPost(r)
+		err = rkt_DockerPost(w, r)
 	case DELETE:
-		err = rkt_DockerDelete(r)
+		err = rkt_DockerDelete(w, r)
 	default:
 		logrus.Debugf("Unknown http method.")
 		err = nil
@@ -41,18 +44,36 @@ func Rkt_Rundockercmd(r *http.Request, method int) error {
 	return err
 }
 
-func rkt_DockerGet(r *http.Request) error {
+func rkt_DockerGet(w http.ResponseWriter, r *http.Request) error {
+
+	// docker events --> harbour's event log
+	eventsMatch, _ := regexp.MatchString("/events$", r.URL.Path)
+	if eventsMatch {
+		return rktCmdEvents(w, r)
+	}
 
 	// docker ps --> rkt list
 	listMatch, _ := regexp.MatchString("/containers/json", r.URL.Path)
 	if listMatch {
-		return rktCmdList(r)
+		return rktCmdList(w, r)
 	}
 
 	// docker images --> rkt image list
 	imageMatch, _ := regexp.MatchString("/images/json", r.URL.Path)
 	if imageMatch {
-		return rktCmdImage(r)
+		return rktCmdImage(w, r)
+	}
+
+	// docker volume ls --> harbour's volumes
+	volumesMatch, _ := regexp.MatchString("/volumes$", r.URL.Path)
+	if volumesMatch {
+		return rktCmdVolumeList(w, r)
+	}
+
+	// docker volume inspect --> harbour's volumes
+	volumeMatch, _ := regexp.MatchString("/volumes/[^/]+$", r.URL.Path)
+	if volumeMatch {
+		return rktCmdVolumeInspect(w, r)
 	}
 
 	// docker version --> rkt version
@@ -61,22 +82,28 @@ func rkt_DockerGet(r *http.Request) error {
 		return rktCmdVersion(r)
 	}
 
-	// docker stats --> rkt status
-	statsMatch, _ := regexp.MatchString("/stats", r.URL.Path)
+	// docker stats --> cgroups of the pod
+	statsMatch, _ := regexp.MatchString("/containers/[^/]+/stats$", r.URL.Path)
 	if statsMatch {
-		return rktCmdStats(r)
+		return rktCmdStats(w, r)
+	}
+
+	// docker logs --> json-file log of the container
+	logsMatch, _ := regexp.MatchString("/containers/[^/]+/logs$", r.URL.Path)
+	if logsMatch {
+		return rktCmdLogs(w, r)
 	}
 
-	// docker attach --> rkt enter
-	enterMatch, _ := regexp.MatchString(".*/containers/.*/json", r.URL.Path)
-	if enterMatch {
-		return rktCmdEnter(r)
+	// docker inspect --> rkt status
+	inspectMatch, _ := regexp.MatchString(".*/containers/.*/json", r.URL.Path)
+	if inspectMatch {
+		return rktCmdInspect(w, r)
 	}
 
 	// docker save --> rkt export
-	exportMatch, _ := regexp.MatchString(".*/images/.*/get", r.URL.Path)
+	exportMatch, _ := regexp.MatchString(".*/images/(.*/)?get$", r.URL.Path)
 	if exportMatch {
-		return rktCmdExport(r)
+		return rktCmdExport(w, r)
 	}
 
 	// docker inspect --> rkt image cat-manifest
@@ -88,11 +115,53 @@ func rkt_DockerGet(r *http.Request) error {
 	return nil
 }
 
-func rkt_DockerPost(r *http.Request) error {
-	// docker run --> rkt run
-	runMatch, _ := regexp.MatchString("/containers/create", r.URL.Path)
-	if runMatch {
-		return rktCmdRun(r)
+func rkt_DockerPost(w http.ResponseWriter, r *http.Request) error {
+	// docker create --> rkt prepare
+	createMatch, _ := regexp.MatchString("/containers/create", r.URL.Path)
+	if createMatch {
+		return rktCmdCreate(w, r)
+	}
+
+	// docker start --> rkt run-prepared
+	startMatch, _ := regexp.MatchString("/containers/[^/]+/start$", r.URL.Path)
+	if startMatch {
+		return rktCmdStart(w, r)
+	}
+
+	// docker stop, docker kill --> signal the pod
+	stopMatch, _ := regexp.MatchString("/containers/[^/]+/(stop|kill)$", r.URL.Path)
+	if stopMatch {
+		return rktCmdStop(w, r)
+	}
+
+	// docker restart --> stop the pod, then run a new one
+	restartMatch, _ := regexp.MatchString("/containers/[^/]+/restart$", r.URL.Path)
+	if restartMatch {
+		return rktCmdRestart(w, r)
+	}
+
+	// docker wait --> wait for the pod to exit
+	waitMatch, _ := regexp.MatchString("/containers/[^/]+/wait$", r.URL.Path)
+	if waitMatch {
+		return rktCmdWait(w, r)
+	}
+
+	// docker volume create --> a directory under the state root
+	volumeCreateMatch, _ := regexp.MatchString("/volumes/create$", r.URL.Path)
+	if volumeCreateMatch {
+		return rktCmdVolumeCreate(w, r)
+	}
+
+	// docker container prune --> rkt rm of the exited pods
+	containersPruneMatch, _ := regexp.MatchString("/containers/prune$", r.URL.Path)
+	if containersPruneMatch {
+		return rktCmdContainersPrune(w, r)
+	}
+
+	// docker image prune --> rkt image rm of the unused images
+	imagesPruneMatch, _ := regexp.MatchString("/images/prune$", r.URL.Path)
+	if imagesPruneMatch {
+		return rktCmdImagesPrune(w, r)
 	}
 
 	// docker pull --> rkt fetch
@@ -101,10 +170,26 @@ func rkt_DockerPost(r *http.Request) error {
 		return rktCmdFetch(r)
 	}
 
+	// docker build --> build tool, then rkt fetch of the result
+	buildMatch, _ := regexp.MatchString("/build$", r.URL.Path)
+	if buildMatch {
+		return rktCmdBuild(w, r)
+	}
+
+	// docker load --> rkt fetch of the uploaded ACI
+	loadMatch, _ := regexp.MatchString("/images/load", r.URL.Path)
+	if loadMatch {
+		return rktCmdLoad(w, r)
+	}
+
 	return nil
 }
 
-func rkt_DockerDelete(r *http.Request) error {
+func rkt_DockerDelete(w http.ResponseWriter, r *http.Request) error {
+	volumeRmMatch, _ := regexp.MatchString("/volumes/", r.URL.Path)
+	if volumeRmMatch {
+		return rktCmdVolumeRm(w, r)
+	}
 	rmMatch, _ := regexp.MatchString("/containers/", r.URL.Path)
 	if rmMatch {
 		return rktCmdRm(r)
@@ -117,324 +202,504 @@ func rkt_DockerDelete(r *http.Request) error {
 	return nil
 }
 
-func rktCmdRun(r *http.Request) error {
-	var cmdStr string
-	var config UserConfig
+func rktCmdCreate(w http.ResponseWriter, r *http.Request) error {
+	config := &types.ContainerConfig{}
 
 	requestBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		logrus.Errorf("Read request body error: %s", err)
 		return err
 	}
-
-	cmdStr = strings.TrimRight(string(requestBody), "\n")
-	logrus.Debugf("Transforwarding request body: %s", cmdStr)
-	json.Unmarshal([]byte(cmdStr), &config)
-
-	cmdStr = "rkt " + "--interactive " + "--insecure-skip-verify " + "--mds-register=false " + "run "
-
-	imgMatch, _ := regexp.MatchString("coreos.com", config.Image)
-	if !imgMatch {
-		cmdStr += "docker://" + config.Image
-	} else {
-		cmdStr += config.Image
+	logrus.Debugf("Transforwarding request body: %s", strings.TrimRight(string(requestBody), "\n"))
+	if err := json.Unmarshal(requestBody, config); err != nil {
+		return fmt.Errorf("Bad parameter: %s", err)
+	}
+	if config.Image == "" {
+		return fmt.Errorf("Bad parameter: no image specified")
 	}
 
-	logrus.Debugf("The operation for rkt is : %s", cmdStr)
-
-	err = utils.Run(exec.Command("/bin/sh", "-c", cmdStr))
-
-	return err
-}
-
-func rktCmdList(r *http.Request) error {
-	var cmdStr string
+	name := strings.TrimPrefix(r.URL.Query().Get("name"), "/")
+	if name != "" {
+		if c, err := store.get(name); err == nil && c.Name == name {
+			return fmt.Errorf("Conflict. The name %s is already in use by container %s", name, c.ID)
+		}
+	}
 
-	requestBody, err := ioutil.ReadAll(r.Body)
+	if _, err := rktNetwork(config.HostConfig); err != nil {
+		return err
+	}
+	if config.HostConfig != nil {
+		if err := validateRestartPolicy(config.HostConfig.RestartPolicy); err != nil {
+			return err
+		}
+	}
+	ports, warnings, err := publishedPorts(config)
 	if err != nil {
-		logrus.Errorf("Read request body error: %s", err)
 		return err
 	}
-
-	cmdStr = strings.TrimRight(string(requestBody), "\n")
-	logrus.Debugf("Transforwarding request body: %s", cmdStr)
-
-	cmdStr = "rkt list"
-
-	logrus.Debugf("The operation for rkt is : %s", cmdStr)
-
-	err = utils.Run(exec.Command("/bin/sh", "-c", cmdStr))
-
-	return err
-}
-
-func rktCmdImage(r *http.Request) error {
-	var cmdStr string
-
-	requestBody, err := ioutil.ReadAll(r.Body)
+	resources, resourceWarnings, err := resourceArgs(config.HostConfig)
 	if err != nil {
-		logrus.Errorf("Read request body error: %s", err)
 		return err
 	}
+	warnings = append(warnings, resourceWarnings...)
+	mounts, mountWarnings, err := containerMounts(config)
+	if err != nil {
+		return err
+	}
+	warnings = append(warnings, mountWarnings...)
+	if hc := config.HostConfig; hc != nil && hc.LogConfig.Type != "" && hc.LogConfig.Type != "json-file" {
+		warnings = append(warnings, fmt.Sprintf("rkt only supports the json-file log driver, log driver %s is discarded", hc.LogConfig.Type))
+		hc.LogConfig = types.LogConfig{}
+	}
 
-	cmdStr = strings.TrimRight(string(requestBody), "\n")
-	logrus.Debugf("Transforwarding request body: %s", cmdStr)
-
-	cmdStr = "rkt image list"
-
-	logrus.Debugf("The operation for rkt is : %s", cmdStr)
-
-	err = utils.Run(exec.Command("/bin/sh", "-c", cmdStr))
-
-	return err
-}
+	args := []string{"--insecure-skip-verify", "prepare", "--quiet"}
+	for _, env := range config.Env {
+		args = append(args, "--set-env="+env)
+	}
+	args = append(args, rktMountArgs(mounts)...)
+	image := rktImageRef(config.Image)
+	if len(ports) > 0 {
+		var names map[string]string
+		if image, names, err = imageWithPorts(config.Image, ports); err != nil {
+			return err
+		}
+		for port, bindings := range ports {
+			args = append(args, "--port="+names[port]+":"+bindings[0].HostPort)
+		}
+	}
+	args = append(append(args, image), resources...)
 
-func rktCmdVersion(r *http.Request) error {
-	var cmdStr string
+	cmd := append(append([]string{}, config.Entrypoint...), config.Cmd...)
+	if len(cmd) > 0 {
+		args = append(args, "--exec="+cmd[0])
+		if len(cmd) > 1 {
+			args = append(append(args, "--"), cmd[1:]...)
+		}
+	}
 
-	requestBody, err := ioutil.ReadAll(r.Body)
+	logrus.Debugf("The operation for rkt is : rkt %s", strings.Join(args, " "))
+	out, err := utils.RunOutput(exec.Command("rkt", args...))
+	if err == nil && lastLine(out) == "" {
+		err = fmt.Errorf("rkt prepare did not return a pod UUID")
+	}
 	if err != nil {
-		logrus.Errorf("Read request body error: %s", err)
+		removeAnonymousVolumes(&Container{Mounts: mounts})
 		return err
 	}
+	uuid := lastLine(out)
 
-	cmdStr = strings.TrimRight(string(requestBody), "\n")
-	logrus.Debugf("Transforwarding request body: %s", cmdStr)
+	c := &Container{
+		ID:      uuid,
+		PodID:   uuid,
+		Name:    name,
+		Image:   config.Image,
+		Created: time.Now().UTC(),
+		Config:  config,
+		Ports:   ports,
+		Mounts:  mounts,
 
-	cmdStr = "rkt version"
-
-	logrus.Debugf("The operation for rkt is : %s", cmdStr)
-
-	err = utils.Run(exec.Command("/bin/sh", "-c", cmdStr))
+		PrepareArgs: args,
+	}
+	if err := store.add(c); err != nil {
+		utils.RunOutput(exec.Command("rkt", "rm", uuid))
+		removeAnonymousVolumes(c)
+		return err
+	}
+	eventLog.Log("create", c.ID, c.Image)
 
-	return err
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(&types.ContainerCreateResponse{ID: c.ID, Warnings: warnings})
 }
 
-func rktCmdRm(r *http.Request) error {
-	var cmdStr string
-	var rktID []string
-
-	requestBody, err := ioutil.ReadAll(r.Body)
+func rktCmdStart(w http.ResponseWriter, r *http.Request) error {
+	c, err := store.get(containerRef(r.URL.Path))
 	if err != nil {
-		logrus.Errorf("Read request body error: %s", err)
 		return err
 	}
-
-	cmdStr = strings.TrimRight(string(requestBody), "\n")
-	logrus.Debugf("Transforwarding request body: %s", cmdStr)
-
-	rktID = strings.SplitAfter(r.URL.Path, "containers/")
-	if len(rktID) < 2 {
+	if store.view(c).State.Running {
+		w.WriteHeader(http.StatusNotModified)
 		return nil
 	}
 
-	if rktID[1] == "all" {
-		cmdStr = "rkt gc"
-	} else {
-		cmdStr = "rkt rm --insecure-skip-verify " + rktID[1]
+	if err := startContainer(c); err != nil {
+		return err
 	}
-
-	logrus.Debugf("The operation for rkt is : %s", cmdStr)
-
-	err = utils.Run(exec.Command("/bin/sh", "-c", cmdStr))
-
-	return err
+	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
 
-func rktCmdRmi(r *http.Request) error {
-	var cmdStr string
-	var imgID []string
+// startContainer starts c on request of the user, preparing a new pod when
+// the previous one already ran.
+func startContainer(c *Container) error {
+	restarts.cancel(c)
+	store.update(c, func(c *Container) {
+		c.ManuallyStopped = false
+	})
+	// rkt gc may have expired the prepared pod of a container that was
+	// never started.
+	v := store.view(c)
+	if _, err := podStatus(v.PodID); err == nil && v.State.StartedAt.IsZero() {
+		return startPod(c)
+	}
+	return restartPod(c, false)
+}
 
-	requestBody, err := ioutil.ReadAll(r.Body)
+func rktCmdRestart(w http.ResponseWriter, r *http.Request) error {
+	c, err := store.get(containerRef(r.URL.Path))
 	if err != nil {
-		logrus.Errorf("Read request body error: %s", err)
 		return err
 	}
-
-	cmdStr = strings.TrimRight(string(requestBody), "\n")
-	logrus.Debugf("Transforwarding request body: %s", cmdStr)
-
-	imgID = strings.SplitAfter(r.URL.Path, "images/")
-	if len(imgID) < 2 {
-		return nil
+	timeout := 10
+	if t := r.URL.Query().Get("t"); t != "" {
+		if timeout, err = strconv.Atoi(t); err != nil {
+			return fmt.Errorf("Bad parameter: invalid timeout %s", t)
+		}
 	}
 
-	if imgID[1] == "all" {
-		cmdStr = "rkt image gc"
-	} else {
-		cmdStr = "rkt image rm " + imgID[1]
+	// Keep the restart policy from racing the start below.
+	store.update(c, func(c *Container) {
+		c.ManuallyStopped = true
+	})
+	restarts.cancel(c)
+	if err := stopPod(c, time.Duration(timeout)*time.Second); err != nil {
+		return err
 	}
-
-	logrus.Debugf("The operation for rkt is : %s", cmdStr)
-
-	err = utils.Run(exec.Command("/bin/sh", "-c", cmdStr))
-
-	return err
+	if err := startContainer(c); err != nil {
+		return err
+	}
+	eventLog.Log("restart", c.ID, c.Image)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
 
-func rktCmdStats(r *http.Request) error {
-	var cmdStr string
-	var rktID []string
-
-	requestBody, err := ioutil.ReadAll(r.Body)
+func rktCmdStop(w http.ResponseWriter, r *http.Request) error {
+	c, err := store.get(containerRef(r.URL.Path))
 	if err != nil {
-		logrus.Errorf("Read request body error: %s", err)
 		return err
 	}
 
-	cmdStr = strings.TrimRight(string(requestBody), "\n")
-	logrus.Debugf("Transforwarding request body: %s", cmdStr)
-
-	rktID = strings.SplitAfter(r.URL.Path, "containers/")
-	if len(rktID) < 2 {
+	// Neither a stopped nor a killed container is brought back by its
+	// restart policy.
+	store.update(c, func(c *Container) {
+		c.ManuallyStopped = true
+	})
+	restarts.cancel(c)
+
+	if strings.HasSuffix(r.URL.Path, "/kill") {
+		sig := syscall.SIGKILL
+		if s := r.URL.Query().Get("signal"); s != "" {
+			if sig, err = parseSignal(s); err != nil {
+				return err
+			}
+		}
+		if err := signalPod(c, sig); err != nil {
+			return err
+		}
+		eventLog.Log("kill", c.ID, c.Image)
+		w.WriteHeader(http.StatusNoContent)
 		return nil
 	}
 
-	rktID = strings.Split(rktID[1], "/stats")
-	if len(rktID) < 1 {
+	if !store.view(c).State.Running {
+		w.WriteHeader(http.StatusNotModified)
 		return nil
 	}
+	timeout := 10
+	if t := r.URL.Query().Get("t"); t != "" {
+		if timeout, err = strconv.Atoi(t); err != nil {
+			return fmt.Errorf("Bad parameter: invalid timeout %s", t)
+		}
+	}
+	if err := stopPod(c, time.Duration(timeout)*time.Second); err != nil {
+		return err
+	}
+	eventLog.Log("stop", c.ID, c.Image)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
 
-	cmdStr = "rkt status " + rktID[0]
-
-	logrus.Debugf("The operation for rkt is : %s", cmdStr)
+func rktCmdWait(w http.ResponseWriter, r *http.Request) error {
+	c, err := store.get(containerRef(r.URL.Path))
+	if err != nil {
+		return err
+	}
+	<-store.view(c).waitCh
 
-	err = utils.Run(exec.Command("/bin/sh", "-c", cmdStr))
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(&types.ContainerWaitResponse{StatusCode: store.view(c).State.ExitCode})
+}
 
-	return err
+func rktCmdVersion(r *http.Request) error {
+	logrus.Debugf("The operation for rkt is : rkt version")
+	return utils.Run(exec.Command("rkt", "version"))
 }
 
-func rktCmdFetch(r *http.Request) error {
-	var cmdStr string
-	var imgID []string
-	var imgStr string
+func rktCmdRm(r *http.Request) error {
+	ref := containerRef(r.URL.Path)
+	query := r.URL.Query()
 
-	requestBody, err := ioutil.ReadAll(r.Body)
+	// Pods harbour did not create are removed as they are.
+	c, err := store.get(ref)
 	if err != nil {
-		logrus.Errorf("Read request body error: %s", err)
+		if ref == "" {
+			return err
+		}
+		logrus.Debugf("The operation for rkt is : rkt rm %s", ref)
+		if _, err := utils.RunOutput(exec.Command("rkt", "rm", ref)); err != nil {
+			return fmt.Errorf("No such container: %s: %s", ref, err)
+		}
+		eventLog.Log("destroy", ref, "")
+		return nil
+	}
+
+	force := query.Get("force") == "1" || query.Get("force") == "true"
+	volumes := query.Get("v") == "1" || query.Get("v") == "true"
+	return removeContainer(c, force, volumes)
+}
+
+// removeContainer removes c along with its pod, and its anonymous volumes
+// when asked to.
+func removeContainer(c *Container, force, volumes bool) error {
+	if v := store.view(c); v.State.Running || v.State.Restarting {
+		if !force {
+			return fmt.Errorf("Conflict, You cannot remove a running container. Stop the container before attempting removal or use -f")
+		}
+		restarts.cancel(c)
+		if err := stopPod(c, 0); err != nil {
+			return err
+		}
+	}
+
+	podID := store.view(c).PodID
+	logrus.Debugf("The operation for rkt is : rkt rm %s", podID)
+	if _, err := utils.RunOutput(exec.Command("rkt", "rm", podID)); err != nil {
+		logrus.Warnf("Failed to remove pod %s: %s", podID, err)
+	}
+	if err := store.remove(c); err != nil {
 		return err
 	}
+	eventLog.Log("destroy", c.ID, c.Image)
+	if volumes {
+		removeAnonymousVolumes(c)
+	}
 
-	cmdStr = strings.TrimRight(string(requestBody), "\n")
-	logrus.Debugf("Transforwarding request body: %s", cmdStr)
+	return nil
+}
 
+func rktCmdRmi(r *http.Request) error {
+	parts := strings.SplitN(r.URL.Path, "images/", 2)
+	if len(parts) < 2 || parts[1] == "" {
+		return fmt.Errorf("No such image: %s", r.URL.Path)
+	}
+	return removeImage(parts[1])
+}
+func rktCmdFetch(r *http.Request) error {
 	url := r.URL.Query()
-	imgID = url["fromImage"]
-
-	if len(imgID) < 1 {
+	ref := url.Get("fromImage")
+	if ref == "" {
 		return nil
-	} else {
-		imgStr = imgID[0]
 	}
+	// Docker passes digests in the tag as well.
+	if tag := url.Get("tag"); strings.Contains(tag, ":") {
+		ref += "@" + tag
+	} else if tag != "" {
+		ref += ":" + tag
+	}
+	image := rktImageRef(ref)
+	logrus.Debugf("The image for rkt is : %s", image)
 
-	urlMatch, _ := regexp.MatchString("coreos.com", imgStr)
-	if !urlMatch {
-		imgStr = "docker://" + imgStr
+	logrus.Debugf("The operation for rkt is : rkt fetch --insecure-skip-verify %s", image)
+	if err := utils.Run(exec.Command("rkt", "fetch", "--insecure-skip-verify", image)); err != nil {
+		return err
 	}
+	eventLog.LogImage("pull", ref)
+	return nil
+}
 
-	logrus.Debugf("The image for rkt is : %s", imgStr)
+// rktImageRef turns a docker image reference into one rkt fetches. Images
+// rkt names itself, by ID, URL, file or discovery name, are left as they are.
+func rktImageRef(image string) string {
+	switch {
+	case strings.HasPrefix(image, "sha512-"), strings.Contains(image, "://"),
+		strings.HasSuffix(image, ".aci"), strings.Contains(image, "coreos.com"):
+		return image
+	}
+	return "docker://" + image
+}
 
-	cmdStr = "rkt fetch --insecure-skip-verify " + imgStr
+// containerRef extracts the container ID or name from a /containers/ path.
+func containerRef(path string) string {
+	parts := strings.SplitAfter(path, "containers/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return strings.SplitN(parts[1], "/", 2)[0]
+}
 
-	logrus.Debugf("The operation for rkt is : %s", cmdStr)
+func parseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return syscall.Signal(n), nil
+	}
+	s = strings.TrimPrefix(strings.ToUpper(s), "SIG")
+	for name, sig := range map[string]syscall.Signal{
+		"HUP": syscall.SIGHUP, "INT": syscall.SIGINT, "QUIT": syscall.SIGQUIT,
+		"KILL": syscall.SIGKILL, "USR1": syscall.SIGUSR1, "USR2": syscall.SIGUSR2,
+		"TERM": syscall.SIGTERM, "STOP": syscall.SIGSTOP, "CONT": syscall.SIGCONT,
+	} {
+		if name == s {
+			return sig, nil
+		}
+	}
+	return 0, fmt.Errorf("Bad parameter: invalid signal %s", s)
+}
 
-	err = utils.Run(exec.Command("/bin/sh", "-c", cmdStr))
+func rktCmdExport(w http.ResponseWriter, r *http.Request) error {
+	var names []string
 
-	return err
-}
+	nameMatch := regexp.MustCompile("/images/(.+)/get$").FindStringSubmatch(r.URL.Path)
+	if nameMatch != nil {
+		names = []string{nameMatch[1]}
+	} else {
+		names = r.URL.Query()["names"]
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("Bad parameter: no image specified")
+	}
 
-func rktCmdEnter(r *http.Request) error {
-	var cmdStr string
-	var rktID []string
+	// docker save gets the archive it knows, the ACI of rkt is asked for
+	// with format=aci.
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = ArchiveDocker
+	}
+	if format != ArchiveACI && format != ArchiveDocker {
+		return fmt.Errorf("Bad parameter: unknown archive format %s", format)
+	}
+	if format == ArchiveACI && len(names) > 1 {
+		return fmt.Errorf("Bad parameter: only one image fits in an ACI, save several without format=aci")
+	}
 
-	requestBody, err := ioutil.ReadAll(r.Body)
+	tmpDir, err := ioutil.TempDir("", "harbour-save-")
 	if err != nil {
-		logrus.Errorf("Read request body error: %s", err)
 		return err
 	}
+	defer os.RemoveAll(tmpDir)
 
-	cmdStr = strings.TrimRight(string(requestBody), "\n")
-	logrus.Debugf("Transforwarding request body: %s", cmdStr)
+	var images []archiveImage
+	for i, name := range names {
+		aci := filepath.Join(tmpDir, fmt.Sprintf("image-%d.aci", i))
+		logrus.Debugf("The operation for rkt is : rkt image export %s %s", name, aci)
+		if _, err := utils.RunOutput(exec.Command("rkt", "image", "export", "--overwrite", name, aci)); err != nil {
+			return fmt.Errorf("No such image: %s: %s", name, err)
+		}
 
-	rktID = strings.SplitAfter(r.URL.Path, "containers/")
-	if len(rktID) < 2 {
-		return nil
+		repoTag := name
+		if strings.HasPrefix(name, "sha512-") {
+			repoTag = ""
+		}
+		images = append(images, archiveImage{Path: aci, RepoTag: repoTag})
 	}
 
-	rktID = strings.Split(rktID[1], "/json")
-	if len(rktID) < 1 {
-		return nil
+	w.Header().Set("Content-Type", "application/x-tar")
+	if format == ArchiveDocker {
+		return aciToDockerArchive(images, w, tmpDir)
 	}
 
-	cmdStr = "rkt enter " + rktID[0] + " /bin/sh"
-
-	logrus.Debugf("The operation for rkt is : %s", cmdStr)
-
-	err = utils.Run(exec.Command("/bin/sh", "-c", cmdStr))
-
+	f, err := os.Open(images[0].Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
 	return err
 }
 
-func rktCmdExport(r *http.Request) error {
-	var cmdStr string
-	var rktID []string
+func rktCmdLoad(w http.ResponseWriter, r *http.Request) error {
+	tmpDir, err := ioutil.TempDir("", "harbour-load-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
 
-	requestBody, err := ioutil.ReadAll(r.Body)
+	archive := filepath.Join(tmpDir, "archive.aci")
+	f, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r.Body)
+	f.Close()
 	if err != nil {
 		logrus.Errorf("Read request body error: %s", err)
 		return err
 	}
 
-	cmdStr = strings.TrimRight(string(requestBody), "\n")
-	logrus.Debugf("Transforwarding request body: %s", cmdStr)
-
-	rktID = strings.SplitAfter(r.URL.Path, "images/")
-	if len(rktID) < 2 {
-		return nil
+	loaded, err := importArchive(archive, tmpDir, "")
+	if err != nil {
+		return err
 	}
 
-	rktID = strings.Split(rktID[1], "/get")
-	if len(rktID) < 1 {
-		return nil
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	for _, l := range loaded {
+		if err := enc.Encode(map[string]string{"stream": "Loaded image: " + l + "\n"}); err != nil {
+			return err
+		}
 	}
 
-	cmdStr = "rkt image export " + rktID[0] + " " + strings.TrimRight(string(rktID[0]), " ") + ".aci"
-
-	logrus.Debugf("The operation for rkt is : %s", cmdStr)
-
-	err = utils.Run(exec.Command("/bin/sh", "-c", cmdStr))
-
-	return err
+	return nil
 }
 
-func rktCmdCatmanifest(r *http.Request) error {
-	var cmdStr string
-	var rktID []string
-
-	requestBody, err := ioutil.ReadAll(r.Body)
+// importArchive fetches every image of an ACI or docker save archive into the
+// rkt store and describes what was loaded. When repoTag is set the imported
+// images are renamed to it.
+func importArchive(archive string, tmpDir string, repoTag string) ([]string, error) {
+	format, err := detectArchiveFormat(archive)
 	if err != nil {
-		logrus.Errorf("Read request body error: %s", err)
-		return err
+		return nil, err
 	}
+	logrus.Debugf("Loading %s archive", format)
 
-	cmdStr = strings.TrimRight(string(requestBody), "\n")
-	logrus.Debugf("Transforwarding request body: %s", cmdStr)
-
-	rktID = strings.SplitAfter(r.URL.Path, "images/")
-	if len(rktID) < 2 {
-		return nil
+	images := []archiveImage{{Path: archive}}
+	if format == ArchiveDocker {
+		images, err = dockerArchiveToACI(archive, tmpDir)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	rktID = strings.Split(rktID[1], "/json")
-	if len(rktID) < 1 {
-		return nil
-	}
+	var loaded []string
+	for _, img := range images {
+		if repoTag != "" {
+			if err := retagACI(img.Path, repoTag); err != nil {
+				return nil, err
+			}
+			img.RepoTag = repoTag
+		}
+
+		logrus.Debugf("The operation for rkt is : rkt fetch --insecure-skip-verify %s", img.Path)
+		out, err := utils.RunOutput(exec.Command("rkt", "fetch", "--insecure-skip-verify", img.Path))
+		if err != nil {
+			return nil, err
+		}
 
-	cmdStr = "rkt image cat-manifest " + rktID[0]
+		id := strings.TrimSpace(out)
+		if img.RepoTag != "" {
+			id = img.RepoTag + " (" + id + ")"
+		}
+		loaded = append(loaded, id)
+	}
 
-	logrus.Debugf("The operation for rkt is : %s", cmdStr)
+	return loaded, nil
+}
 
-	err = utils.Run(exec.Command("/bin/sh", "-c", cmdStr))
+func rktCmdCatmanifest(r *http.Request) error {
+	id := strings.SplitAfter(r.URL.Path, "images/")
+	if len(id) < 2 {
+		return nil
+	}
+	id = strings.Split(id[1], "/json")
 
-	return err
+	logrus.Debugf("The operation for rkt is : rkt image cat-manifest %s", id[0])
+	return utils.Run(exec.Command("rkt", "image", "cat-manifest", id[0]))
 }
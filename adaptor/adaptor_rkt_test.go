@@ -0,0 +1,79 @@
+package adaptor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/engine/events"
+)
+
+// fakeRkt prepares pods named after their name in the create request.
+const fakeRkt = `#!/bin/sh
+for arg; do
+	case "$arg" in
+	--set-env=NAME=*) echo "${arg#--set-env=NAME=}" ;;
+	esac
+done
+`
+
+func TestCreateLogDriver(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "harbour-create")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := ioutil.WriteFile(filepath.Join(tmp, "rkt"), []byte(fakeRkt), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", tmp+":"+os.Getenv("PATH"))
+	defer func(old string) { engine.StateRoot = old }(engine.StateRoot)
+	engine.StateRoot = tmp
+	defer func(old *events.Events) { eventLog = old }(eventLog)
+	eventLog = events.New()
+
+	for _, tc := range []struct {
+		name, driver string
+		warned       bool
+	}{
+		{"default", "", false},
+		{"json", "json-file", false},
+		{"syslog", "syslog", true},
+	} {
+		body, _ := json.Marshal(&types.ContainerConfig{
+			Image:      "busybox",
+			Env:        []string{"NAME=" + tc.name},
+			HostConfig: &types.HostConfig{LogConfig: types.LogConfig{Type: tc.driver, Config: map[string]string{"tag": "x"}}},
+		})
+		req, _ := http.NewRequest("POST", "/containers/create?name="+tc.name, strings.NewReader(string(body)))
+		w := httptest.NewRecorder()
+		if err := rktCmdCreate(w, req); err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		var resp types.ContainerCreateResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		warned := len(resp.Warnings) == 1 && strings.Contains(resp.Warnings[0], "log driver "+tc.driver)
+		if warned != tc.warned || !tc.warned && len(resp.Warnings) > 0 {
+			t.Fatalf("%s: unexpected warnings %v", tc.name, resp.Warnings)
+		}
+
+		c, err := store.get(tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.remove(c)
+		if got := c.Config.HostConfig.LogConfig; tc.warned && got.Type != "" || !tc.warned && got.Type != tc.driver {
+			t.Fatalf("%s: unexpected log config %+v", tc.name, got)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// docker build on top of an external build tool.
+
+package adaptor
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/utils"
+)
+
+type jsonError struct {
+	Message string `json:"message"`
+}
+
+// jsonMessage is one line of docker's streamed build and pull output.
+type jsonMessage struct {
+	Stream      string     `json:"stream,omitempty"`
+	Status      string     `json:"status,omitempty"`
+	ID          string     `json:"id,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	ErrorDetail *jsonError `json:"errorDetail,omitempty"`
+}
+
+type streamWriter struct {
+	enc *json.Encoder
+}
+
+func newStreamWriter(w http.ResponseWriter) *streamWriter {
+	w.Header().Set("Content-Type", "application/json")
+	return &streamWriter{enc: json.NewEncoder(ioutils.NewWriteFlusher(w))}
+}
+
+func (s *streamWriter) Stream(format string, args ...interface{}) {
+	s.enc.Encode(&jsonMessage{Stream: fmt.Sprintf(format, args...)})
+}
+
+func (s *streamWriter) Error(err error) {
+	s.enc.Encode(&jsonMessage{Error: err.Error(), ErrorDetail: &jsonError{Message: err.Error()}})
+}
+
+// rktCmdBuild runs the configured build tool on the uploaded context and
+// imports the image it produces into the rkt store.
+//
+// The tool is run through /bin/sh with the build described in the
+// environment:
+//
+//	HARBOUR_BUILD_CONTEXT    directory holding the extracted build context
+//	HARBOUR_BUILD_DOCKERFILE path of the Dockerfile inside the context
+//	HARBOUR_BUILD_TAG        requested repository tag, may be empty
+//	HARBOUR_BUILD_ARGS       build arguments as a JSON object
+//	HARBOUR_BUILD_NOCACHE    "1" when the client asked for --no-cache
+//	HARBOUR_BUILD_OUTPUT     where to write the result, as an ACI or docker save archive
+func rktCmdBuild(w http.ResponseWriter, r *http.Request) error {
+	if engine.BuildTool == "" {
+		return fmt.Errorf("Impossible to build images on rkt: no build tool configured, see --build-tool")
+	}
+
+	query := r.URL.Query()
+	if remote := query.Get("remote"); remote != "" {
+		return fmt.Errorf("Bad parameter: remote build contexts are not supported on rkt")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "harbour-build-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	contextDir := filepath.Join(tmpDir, "context")
+	if err := untarContext(r.Body, contextDir); err != nil {
+		return fmt.Errorf("Bad parameter: invalid build context: %s", err)
+	}
+
+	dockerfile := query.Get("dockerfile")
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	dockerfile = filepath.Join(contextDir, filepath.Clean("/"+dockerfile))
+	if _, err := os.Stat(dockerfile); err != nil {
+		return fmt.Errorf("Bad parameter: cannot locate Dockerfile %s in the build context", query.Get("dockerfile"))
+	}
+
+	buildArgs := query.Get("buildargs")
+	if buildArgs == "" {
+		buildArgs = "{}"
+	}
+	noCache := "0"
+	if query.Get("nocache") == "1" || query.Get("nocache") == "true" {
+		noCache = "1"
+	}
+	tag := query.Get("t")
+	output := filepath.Join(tmpDir, "image.aci")
+
+	cmd := exec.Command("/bin/sh", "-c", engine.BuildTool)
+	cmd.Dir = contextDir
+	cmd.Env = append(os.Environ(),
+		"HARBOUR_BUILD_CONTEXT="+contextDir,
+		"HARBOUR_BUILD_DOCKERFILE="+dockerfile,
+		"HARBOUR_BUILD_TAG="+tag,
+		"HARBOUR_BUILD_ARGS="+buildArgs,
+		"HARBOUR_BUILD_NOCACHE="+noCache,
+		"HARBOUR_BUILD_OUTPUT="+output,
+	)
+	logrus.Debugf("The operation for rkt is : %s", engine.BuildTool)
+
+	// From here on the response has started, failures go into the stream.
+	out := newStreamWriter(w)
+	quiet := query.Get("q") == "1" || query.Get("q") == "true"
+
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	release := utils.Acquire()
+	if err := cmd.Start(); err != nil {
+		release()
+		out.Error(err)
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			if !quiet {
+				out.Stream("%s\n", scanner.Text())
+			}
+		}
+		io.Copy(ioutil.Discard, pr)
+		close(done)
+	}()
+	err = cmd.Wait()
+	release()
+	pw.Close()
+	<-done
+	if err != nil {
+		out.Error(fmt.Errorf("The build tool failed: %s", err))
+		return nil
+	}
+
+	loaded, err := importArchive(output, tmpDir, tag)
+	if err != nil {
+		out.Error(err)
+		return nil
+	}
+	for _, l := range loaded {
+		out.Stream("Successfully built %s\n", l)
+	}
+
+	return nil
+}
+
+// untarContext extracts a possibly gzipped build context into dir.
+func untarContext(body io.Reader, dir string) error {
+	br := bufio.NewReader(body)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Join(dir, filepath.Clean("/"+hdr.Name))
+		// Refuse entries that would land outside dir through a symlink.
+		if !insideDir(root, filepath.Dir(name)) {
+			return fmt.Errorf("%s escapes the build context", hdr.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+		// An entry replaces what an earlier one left there rather than
+		// writing through it, lest it is a symlink to outside dir.
+		if fi, err := os.Lstat(name); err == nil && !fi.IsDir() && hdr.Typeflag != tar.TypeDir {
+			if err := os.Remove(name); err != nil {
+				return err
+			}
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(name, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			f, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, name); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			target := filepath.Join(dir, filepath.Clean("/"+hdr.Linkname))
+			if !insideDir(root, target) {
+				return fmt.Errorf("%s escapes the build context", hdr.Linkname)
+			}
+			if err := os.Link(target, name); err != nil {
+				return err
+			}
+		default:
+			logrus.Debugf("Skipping %s in build context", hdr.Name)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package adaptor
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/huawei-openlab/harbour/engine"
+)
+
+func contextTar(t *testing.T, hdrs ...*tar.Header) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range hdrs {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(hdr.Name))
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			tw.Write([]byte(hdr.Name))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestUntarContext(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "harbour-build-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	outside := filepath.Join(tmp, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(outside, "secret")
+	if err := ioutil.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Relative and absolute names are kept inside the context.
+	dir := filepath.Join(tmp, "context")
+	err = untarContext(contextTar(t,
+		&tar.Header{Name: "../../up", Typeflag: tar.TypeReg},
+		&tar.Header{Name: "/abs", Typeflag: tar.TypeReg},
+		&tar.Header{Name: "sub/../../../down", Typeflag: tar.TypeReg},
+	), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"up", "abs", "down"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("expected %s inside the context: %s", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "up")); err == nil {
+		t.Fatal("expected ../ to stay inside the context")
+	}
+
+	for name, hdrs := range map[string][]*tar.Header{
+		"file under a symlink": {
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "link/secret", Typeflag: tar.TypeReg},
+		},
+		"file under a relative symlink": {
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../outside"},
+			{Name: "link/new", Typeflag: tar.TypeReg},
+		},
+		"file over a symlink": {
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: secret},
+			{Name: "link", Typeflag: tar.TypeReg},
+		},
+		"hard link through a symlink": {
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "hard", Typeflag: tar.TypeLink, Linkname: "link/secret"},
+		},
+	} {
+		dir := filepath.Join(tmp, strings.Replace(name, " ", "-", -1))
+		untarContext(contextTar(t, hdrs...), dir)
+		if data, _ := ioutil.ReadFile(secret); string(data) != "secret" {
+			t.Fatalf("%s: the file outside the context was overwritten", name)
+		}
+		if _, err := os.Stat(filepath.Join(outside, "new")); err == nil {
+			t.Fatalf("%s: a file was created outside the context", name)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "hard")); err == nil {
+			t.Fatalf("%s: a file outside the context was linked into it", name)
+		}
+	}
+}
+
+func TestBuildEnvironment(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "harbour-build-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	env := filepath.Join(tmp, "env")
+	defer func(old string) { engine.BuildTool = old }(engine.BuildTool)
+	engine.BuildTool = "env > " + env + "; cat \"$HARBOUR_BUILD_DOCKERFILE\"; exit 1"
+
+	body := contextTar(t, &tar.Header{Name: "app/Dockerfile.dev", Typeflag: tar.TypeReg})
+	req, _ := http.NewRequest("POST", `/build?t=app:1&dockerfile=app/Dockerfile.dev&nocache=1&buildargs={"V":"2"}`, body)
+	w := httptest.NewRecorder()
+	if err := rktCmdBuild(w, req); err != nil {
+		t.Fatal(err)
+	}
+	if out := w.Body.String(); !strings.Contains(out, "app/Dockerfile.dev") || !strings.Contains(out, "The build tool failed") {
+		t.Fatalf("expected the output and failure of the tool, got %s", out)
+	}
+
+	data, err := ioutil.ReadFile(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 && strings.HasPrefix(kv[0], "HARBOUR_BUILD_") {
+			vars[kv[0]] = kv[1]
+		}
+	}
+	context := vars["HARBOUR_BUILD_CONTEXT"]
+	if filepath.Base(context) != "context" {
+		t.Fatalf("unexpected context %q", context)
+	}
+	for name, want := range map[string]string{
+		"HARBOUR_BUILD_DOCKERFILE": filepath.Join(context, "app/Dockerfile.dev"),
+		"HARBOUR_BUILD_TAG":        "app:1",
+		"HARBOUR_BUILD_ARGS":       `{"V":"2"}`,
+		"HARBOUR_BUILD_NOCACHE":    "1",
+		"HARBOUR_BUILD_OUTPUT":     filepath.Join(filepath.Dir(context), "image.aci"),
+	} {
+		if vars[name] != want {
+			t.Fatalf("expected %s=%s, got %q", name, want, vars[name])
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Containers harbour created on rkt, kept under the state root.
+
+package adaptor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine"
+)
+
+type ContainerState struct {
+	Running    bool
+	Restarting bool
+	Pid        int
+	ExitCode   int
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Container maps a docker container onto the rkt pod currently backing it.
+type Container struct {
+	ID      string
+	PodID   string
+	Name    string
+	Image   string
+	Created time.Time
+	Config  *types.ContainerConfig
+	State   ContainerState
+
+	// Ports are the port bindings with the host ports actually used.
+	Ports map[string][]types.PortBinding
+
+	// Mounts are the binds and volumes with their resolved host paths.
+	Mounts []types.MountPoint
+
+	// PrepareArgs are the options of rkt prepare, used again to replace
+	// the pod when the container restarts.
+	PrepareArgs     []string
+	RestartCount    int
+	ManuallyStopped bool
+
+	// waitCh is closed when the running pod exits.
+	waitCh chan struct{}
+}
+
+type containerStore struct {
+	sync.Mutex
+	containers map[string]*Container
+}
+
+var store = &containerStore{containers: make(map[string]*Container)}
+
+func containerRoot(id string) string {
+	return filepath.Join(engine.StateRoot, "containers", id)
+}
+
+// load reads back the containers saved under the state root.
+func (s *containerStore) load() error {
+	dirs, err := ioutil.ReadDir(filepath.Join(engine.StateRoot, "containers"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	for _, d := range dirs {
+		data, err := ioutil.ReadFile(filepath.Join(containerRoot(d.Name()), "config.json"))
+		if err != nil {
+			logrus.Warnf("Skipping container %s: %s", d.Name(), err)
+			continue
+		}
+		c := &Container{}
+		if err := json.Unmarshal(data, c); err != nil {
+			logrus.Warnf("Skipping container %s: %s", d.Name(), err)
+			continue
+		}
+		c.waitCh = make(chan struct{})
+		if !c.State.Running {
+			close(c.waitCh)
+		}
+		s.containers[c.ID] = c
+	}
+	return nil
+}
+
+func (s *containerStore) add(c *Container) error {
+	if c.waitCh == nil {
+		c.waitCh = make(chan struct{})
+		close(c.waitCh)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if c.Name != "" {
+		for _, other := range s.containers {
+			if other.Name == c.Name {
+				return fmt.Errorf("Conflict. The name %s is already in use by container %s", c.Name, other.ID)
+			}
+		}
+	}
+	s.containers[c.ID] = c
+	return s.save(c)
+}
+
+// get finds a container by ID, unique ID prefix or name.
+func (s *containerStore) get(ref string) (*Container, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if c, ok := s.containers[ref]; ok {
+		return c, nil
+	}
+	var found *Container
+	for _, c := range s.containers {
+		if c.Name == strings.TrimPrefix(ref, "/") && c.Name != "" {
+			return c, nil
+		}
+		if strings.HasPrefix(c.ID, ref) {
+			if found != nil {
+				return nil, fmt.Errorf("Bad parameter: multiple containers match %s", ref)
+			}
+			found = c
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("No such container: %s", ref)
+	}
+	return found, nil
+}
+
+// byPod finds the container backed by the rkt pod uuid.
+func (s *containerStore) byPod(uuid string) *Container {
+	s.Lock()
+	defer s.Unlock()
+	for _, c := range s.containers {
+		if c.PodID == uuid {
+			return c
+		}
+	}
+	return nil
+}
+
+// view returns a copy of c taken under the store lock. The pods change the
+// state of their containers as they run, the handlers read it from a view.
+func (s *containerStore) view(c *Container) Container {
+	s.Lock()
+	defer s.Unlock()
+	return *c
+}
+
+func (s *containerStore) list() []*Container {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]*Container, 0, len(s.containers))
+	for _, c := range s.containers {
+		list = append(list, c)
+	}
+	return list
+}
+
+func (s *containerStore) remove(c *Container) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.containers, c.ID)
+	return os.RemoveAll(containerRoot(c.ID))
+}
+
+// update applies fn to c under the store lock and saves the result.
+func (s *containerStore) update(c *Container, fn func(c *Container)) error {
+	s.Lock()
+	defer s.Unlock()
+	fn(c)
+	return s.save(c)
+}
+
+func (s *containerStore) save(c *Container) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	root := containerRoot(c.ID)
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return err
+	}
+	tmp := filepath.Join(root, ".config.json")
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(root, "config.json"))
+}
@@ -0,0 +1,16 @@
+// docker events served from harbour's own event log.
+
+package adaptor
+
+import (
+	"net/http"
+)
+
+func rktCmdEvents(w http.ResponseWriter, r *http.Request) error {
+	return eventLog.Serve(w, r, func(id string) string {
+		if c, err := store.get(id); err == nil {
+			return c.Name
+		}
+		return ""
+	})
+}
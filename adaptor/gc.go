@@ -0,0 +1,342 @@
+// Garbage collection of rkt pods and images, in the background according to
+// the GC policy of the engine and on request through the prune endpoints.
+
+package adaptor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/api/filters"
+	"github.com/huawei-openlab/harbour/api/listing"
+	"github.com/huawei-openlab/harbour/api/reference"
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/engine/events"
+	"github.com/huawei-openlab/harbour/engine/trap"
+	"github.com/huawei-openlab/harbour/utils"
+)
+
+type containersPruneReport struct {
+	ContainersDeleted []string
+	SpaceReclaimed    uint64
+}
+
+type imageDeleteResponseItem struct {
+	Untagged string `json:",omitempty"`
+	Deleted  string `json:",omitempty"`
+}
+
+type imagesPruneReport struct {
+	ImagesDeleted  []imageDeleteResponseItem
+	SpaceReclaimed uint64
+}
+
+// startGC runs the collection of policy every policy.Interval until harbour
+// shuts down.
+func startGC(policy engine.GCPolicy) {
+	if policy.Interval <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	trap.ShutdownCallback(func() {
+		close(stop)
+	})
+	go func() {
+		ticker := time.NewTicker(policy.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				collectGarbage(policy)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// CollectGarbage runs a collection now, according to the GC policy of the
+// engine.
+func CollectGarbage() {
+	collectGarbage(engine.GC)
+}
+
+func collectGarbage(policy engine.GCPolicy) {
+	// Prepared pods back containers that were created but not started yet,
+	// which docker keeps for as long as the user wants. startContainer
+	// prepares a new pod if rkt expires one anyway.
+	args := []string{"gc", "--grace-period=" + policy.GracePeriod.String(), "--expire-prepared=8760h"}
+	logrus.Debugf("The operation for rkt is : rkt %s", strings.Join(args, " "))
+	if _, err := utils.RunOutput(exec.Command("rkt", args...)); err != nil {
+		logrus.Warnf("Failed to collect rkt pods: %s", err)
+	}
+
+	if policy.ImageMaxAge == 0 && policy.ImageMaxCount == 0 && policy.ImageMaxSize == 0 {
+		return
+	}
+	images, err := listImages(false)
+	if err != nil {
+		logrus.Warnf("Failed to list rkt images: %s", err)
+		return
+	}
+	inUse := imagesInUse()
+	for _, img := range imagesToCollect(images, inUse, policy, time.Now()) {
+		logrus.Infof("Collecting image %s", img.ID)
+		if err := removeImage(img.ID); err != nil {
+			logrus.Warnf("Failed to remove image %s: %s", img.ID, err)
+		}
+	}
+}
+
+// imagesToCollect picks the images policy asks to remove, oldest first.
+// Images inUse are kept whatever the policy. The copies imageWithPorts made
+// of an image go along with it, and once it is gone those no container uses
+// anymore are removed too.
+func imagesToCollect(images []types.Image, inUse func(types.Image) bool, policy engine.GCPolicy, now time.Time) []types.Image {
+	sorted := make([]types.Image, len(images))
+	copy(sorted, images)
+	sort.Sort(imagesByAge(sorted))
+
+	count := len(sorted)
+	var size int64
+	for _, img := range sorted {
+		size += img.Size
+	}
+
+	var collect []types.Image
+	for _, img := range sorted {
+		tooOld := policy.ImageMaxAge > 0 && now.Sub(time.Unix(img.Created, 0)) > policy.ImageMaxAge
+		tooMany := policy.ImageMaxCount > 0 && count > policy.ImageMaxCount
+		tooBig := policy.ImageMaxSize > 0 && size > policy.ImageMaxSize
+		if !tooOld && !tooMany && !tooBig {
+			continue
+		}
+		if inUse(img) {
+			continue
+		}
+		collect = append(collect, img)
+		count--
+		size -= img.Size
+	}
+
+	collected := map[string]bool{}
+	for _, img := range collect {
+		collected[img.ID] = true
+	}
+	sourceLeft := func(short string) bool {
+		for _, img := range sorted {
+			if !collected[img.ID] && shortImageID(img.ID) == short {
+				return true
+			}
+		}
+		return false
+	}
+	for _, img := range sorted {
+		if collected[img.ID] || len(img.RepoTags) == 0 || inUse(img) {
+			continue
+		}
+		source, ok := portsImageSource(strings.TrimSuffix(img.RepoTags[0], ":latest"))
+		if ok && !sourceLeft(source) {
+			collect = append(collect, img)
+		}
+	}
+	return collect
+}
+
+// imagesInUse tells whether an image backs a container harbour knows about
+// or a running pod.
+func imagesInUse() func(types.Image) bool {
+	refs := map[string]bool{}
+	for _, c := range store.list() {
+		refs[reference.Normalize(c.Image)] = true
+		for _, arg := range c.PrepareArgs {
+			if strings.HasPrefix(arg, "sha512-") {
+				refs[arg] = true
+			}
+		}
+	}
+	if pods, err := listPods(); err == nil {
+		for _, pod := range pods {
+			if pod.State == "running" {
+				refs[reference.Normalize(pod.Image)] = true
+			}
+		}
+	}
+
+	return func(img types.Image) bool {
+		if refs[img.ID] {
+			return true
+		}
+		for ref := range refs {
+			if strings.HasPrefix(ref, "sha512-") && strings.HasPrefix(img.ID, ref) {
+				return true
+			}
+		}
+		for _, rt := range img.RepoTags {
+			if refs[reference.Normalize(rt)] {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func removeImage(id string) error {
+	logrus.Debugf("The operation for rkt is : rkt image rm %s", id)
+	if _, err := utils.RunOutput(exec.Command("rkt", "image", "rm", id)); err != nil {
+		return err
+	}
+	eventLog.LogImage("delete", id)
+	return nil
+}
+
+func rktCmdContainersPrune(w http.ResponseWriter, r *http.Request) error {
+	args, err := filters.FromParam(r.URL.Query().Get("filters"))
+	if err != nil {
+		return err
+	}
+	if err := args.Validate("until", "label"); err != nil {
+		return err
+	}
+	until, err := pruneUntil(args)
+	if err != nil {
+		return err
+	}
+
+	report := &containersPruneReport{ContainersDeleted: []string{}}
+	for _, c := range store.list() {
+		if v := store.view(c); v.State.Running || v.State.Restarting {
+			continue
+		}
+		if !until.IsZero() && !c.Created.Before(until) {
+			continue
+		}
+		if !matchPruneLabels(args, c) {
+			continue
+		}
+		size := dirSize(containerRoot(c.ID))
+		if err := removeContainer(c, false, false); err != nil {
+			logrus.Warnf("Failed to remove container %s: %s", c.ID, err)
+			continue
+		}
+		report.ContainersDeleted = append(report.ContainersDeleted, c.ID)
+		report.SpaceReclaimed += uint64(size)
+	}
+
+	// Pods harbour did not create carry no labels nor creation time.
+	if !args.Include("label") && until.IsZero() {
+		pods, err := listPods()
+		if err != nil {
+			logrus.Debugf("Failed to list rkt pods: %s", err)
+		}
+		for _, pod := range pods {
+			if !pod.exited() || store.byPod(pod.UUID) != nil {
+				continue
+			}
+			if _, err := utils.RunOutput(exec.Command("rkt", "rm", pod.UUID)); err != nil {
+				logrus.Warnf("Failed to remove pod %s: %s", pod.UUID, err)
+				continue
+			}
+			eventLog.Log("destroy", pod.UUID, pod.Image)
+			report.ContainersDeleted = append(report.ContainersDeleted, pod.UUID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(report)
+}
+
+func rktCmdImagesPrune(w http.ResponseWriter, r *http.Request) error {
+	args, err := filters.FromParam(r.URL.Query().Get("filters"))
+	if err != nil {
+		return err
+	}
+	if err := args.Validate("dangling", "until", "label"); err != nil {
+		return err
+	}
+	until, err := pruneUntil(args)
+	if err != nil {
+		return err
+	}
+	danglingOnly := !args.Include("dangling") || args.ExactMatch("dangling", "true") || args.ExactMatch("dangling", "1")
+
+	images, err := listImages(args.Include("label"))
+	if err != nil {
+		return err
+	}
+	inUse := imagesInUse()
+
+	report := &imagesPruneReport{ImagesDeleted: []imageDeleteResponseItem{}}
+	for _, img := range images {
+		if danglingOnly && !(len(img.RepoTags) == 0 || img.RepoTags[0] == "<none>:<none>") {
+			continue
+		}
+		if !until.IsZero() && !time.Unix(img.Created, 0).Before(until) {
+			continue
+		}
+		if !listing.MatchLabels(args, img.Labels) || inUse(img) {
+			continue
+		}
+		if err := removeImage(img.ID); err != nil {
+			logrus.Warnf("Failed to remove image %s: %s", img.ID, err)
+			continue
+		}
+		for _, rt := range img.RepoTags {
+			report.ImagesDeleted = append(report.ImagesDeleted, imageDeleteResponseItem{Untagged: rt})
+		}
+		report.ImagesDeleted = append(report.ImagesDeleted, imageDeleteResponseItem{Deleted: img.ID})
+		report.SpaceReclaimed += uint64(img.Size)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(report)
+}
+
+// pruneUntil reads the until filter, a timestamp or a duration before now.
+func pruneUntil(args filters.Args) (time.Time, error) {
+	values := args.Get("until")
+	if len(values) == 0 {
+		return time.Time{}, nil
+	}
+	if len(values) > 1 {
+		return time.Time{}, fmt.Errorf("Bad parameter: more than one until filter specified")
+	}
+	if d, err := time.ParseDuration(values[0]); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return events.ParseTimestamp(values[0])
+}
+
+func matchPruneLabels(args filters.Args, c *Container) bool {
+	labels := map[string]string{}
+	if c.Config != nil {
+		labels = c.Config.Labels
+	}
+	return listing.MatchLabels(args, labels)
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+type imagesByAge []types.Image
+
+func (l imagesByAge) Len() int           { return len(l) }
+func (l imagesByAge) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l imagesByAge) Less(i, j int) bool { return l[i].Created < l[j].Created }
@@ -0,0 +1,69 @@
+package adaptor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine"
+)
+
+func TestImagesToCollect(t *testing.T) {
+	now := time.Unix(100000, 0)
+	images := []types.Image{
+		{ID: "sha512-new", Created: 99000, Size: 100},
+		{ID: "sha512-old", Created: 1000, Size: 300},
+		{ID: "sha512-used", Created: 500, Size: 500},
+		{ID: "sha512-mid", Created: 50000, Size: 200},
+	}
+	inUse := func(img types.Image) bool { return img.ID == "sha512-used" }
+
+	for _, tc := range []struct {
+		policy engine.GCPolicy
+		ids    []string
+	}{
+		{engine.GCPolicy{}, nil},
+		{engine.GCPolicy{ImageMaxAge: time.Hour}, []string{"sha512-old", "sha512-mid"}},
+		{engine.GCPolicy{ImageMaxAge: 24 * time.Hour}, []string{"sha512-old"}},
+		{engine.GCPolicy{ImageMaxCount: 2}, []string{"sha512-old", "sha512-mid"}},
+		{engine.GCPolicy{ImageMaxCount: 3}, []string{"sha512-old"}},
+		{engine.GCPolicy{ImageMaxSize: 700}, []string{"sha512-old", "sha512-mid"}},
+		{engine.GCPolicy{ImageMaxSize: 1000}, []string{"sha512-old"}},
+		{engine.GCPolicy{ImageMaxCount: 1}, []string{"sha512-old", "sha512-mid", "sha512-new"}},
+	} {
+		collected := imagesToCollect(images, inUse, tc.policy, now)
+		if len(collected) != len(tc.ids) {
+			t.Fatalf("%+v: expected %v, got %v", tc.policy, tc.ids, collected)
+		}
+		for i := range collected {
+			if collected[i].ID != tc.ids[i] {
+				t.Fatalf("%+v: expected %v, got %v", tc.policy, tc.ids, collected)
+			}
+		}
+	}
+}
+
+func TestImagesToCollectPortsCopies(t *testing.T) {
+	now := time.Unix(100000, 0)
+	images := []types.Image{
+		{ID: "sha512-aaaa", RepoTags: []string{"nginx:latest"}, Created: 1000},
+		{ID: "sha512-bbbb", RepoTags: []string{"redis:latest"}, Created: 99000},
+		{ID: "sha512-c1", RepoTags: []string{"harbour/ports-aaaa-0123456789ab:latest"}, Created: 99000},
+		{ID: "sha512-c2", RepoTags: []string{"harbour/ports-aaaa-ba9876543210:latest"}, Created: 99000},
+		{ID: "sha512-c3", RepoTags: []string{"harbour/ports-bbbb-0123456789ab:latest"}, Created: 99000},
+		{ID: "sha512-c4", RepoTags: []string{"harbour/ports-gone-0123456789ab:latest"}, Created: 99000},
+	}
+	inUse := func(img types.Image) bool { return img.ID == "sha512-c2" }
+
+	// The copies of nginx go with it but the one in use, those of redis
+	// stay with it and the one whose image is gone is removed.
+	collected := imagesToCollect(images, inUse, engine.GCPolicy{ImageMaxAge: time.Hour}, now)
+	var ids []string
+	for _, img := range collected {
+		ids = append(ids, img.ID)
+	}
+	if strings.Join(ids, ",") != "sha512-aaaa,sha512-c1,sha512-c4" {
+		t.Fatalf("unexpected images collected %v", ids)
+	}
+}
@@ -0,0 +1,99 @@
+// docker inspect for containers on rkt.
+
+package adaptor
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/api/types"
+)
+
+func rktCmdInspect(w http.ResponseWriter, r *http.Request) error {
+	c, err := store.get(containerRef(r.URL.Path))
+	if err != nil {
+		return err
+	}
+
+	v := store.view(c)
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v.inspect())
+}
+
+func (c *Container) inspect() *types.ContainerJSON {
+	config := c.Config
+	if config == nil {
+		config = &types.ContainerConfig{Image: c.Image}
+	}
+	hostConfig := config.HostConfig
+	if hostConfig == nil {
+		hostConfig = &types.HostConfig{}
+	}
+
+	summary := c.summary()
+	state := &types.ContainerState{
+		Status:     summary.State,
+		Running:    c.State.Running,
+		Restarting: c.State.Restarting,
+		Pid:        c.State.Pid,
+		ExitCode:   c.State.ExitCode,
+	}
+	if !c.State.StartedAt.IsZero() {
+		state.StartedAt = c.State.StartedAt.Format(time.RFC3339Nano)
+	}
+	if !c.State.FinishedAt.IsZero() {
+		state.FinishedAt = c.State.FinishedAt.Format(time.RFC3339Nano)
+	}
+
+	var path string
+	var args []string
+	if cmd := append(append([]string{}, config.Entrypoint...), config.Cmd...); len(cmd) > 0 {
+		path, args = cmd[0], cmd[1:]
+	}
+
+	network, _ := rktNetwork(hostConfig)
+	settings := &types.NetworkSettings{
+		Ports:    c.Ports,
+		Networks: map[string]*types.EndpointSettings{},
+	}
+	if settings.Ports == nil {
+		settings.Ports = map[string][]types.PortBinding{}
+	}
+	for port := range config.ExposedPorts {
+		if _, ok := settings.Ports[normalizePort(port)]; !ok {
+			settings.Ports[normalizePort(port)] = nil
+		}
+	}
+	if c.State.Running && network == "default" {
+		status, err := podStatus(c.PodID)
+		if err != nil {
+			logrus.Debugf("Failed to get the status of pod %s: %s", c.PodID, err)
+		} else if ip := podIP(status["networks"]); ip != "" {
+			settings.IPAddress = ip
+			settings.Networks["default"] = &types.EndpointSettings{IPAddress: ip}
+		}
+	}
+
+	mounts := c.Mounts
+	if mounts == nil {
+		mounts = []types.MountPoint{}
+	}
+
+	return &types.ContainerJSON{
+		ID:              c.ID,
+		Created:         c.Created.Format(time.RFC3339Nano),
+		Path:            path,
+		Args:            args,
+		State:           state,
+		Image:           c.Image,
+		Name:            summary.Names[0],
+		RestartCount:    c.RestartCount,
+		Driver:          "rkt",
+		Config:          config,
+		HostConfig:      hostConfig,
+		NetworkSettings: settings,
+		Mounts:          mounts,
+	}
+}
@@ -0,0 +1,238 @@
+// docker ps and docker images on top of rkt list and rkt image list.
+
+package adaptor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/api/listing"
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/utils"
+)
+
+var (
+	importTimePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(\.\d+)? [+-]\d{4}`)
+	sizePattern       = regexp.MustCompile(`^(\d+(\.\d+)?)([KMGT]i?B|B)$`)
+)
+
+func rktCmdList(w http.ResponseWriter, r *http.Request) error {
+	opts, err := listing.ParseContainerOptions(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	list, err := listContainers()
+	if err != nil {
+		return err
+	}
+	list, err = listing.Containers(list, opts)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(list)
+}
+
+func rktCmdImage(w http.ResponseWriter, r *http.Request) error {
+	opts, err := listing.ParseImageOptions(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	list, err := listImages(opts.Filters.Include("label"))
+	if err != nil {
+		return err
+	}
+	list, err = listing.Images(list, opts)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(list)
+}
+
+// listContainers describes the containers harbour created along with the
+// pods it finds in rkt that were started some other way.
+func listContainers() ([]types.Container, error) {
+	var list []types.Container
+	for _, c := range store.list() {
+		v := store.view(c)
+		list = append(list, v.summary())
+	}
+
+	pods, err := listPods()
+	if err != nil {
+		logrus.Debugf("Failed to list rkt pods: %s", err)
+		return list, nil
+	}
+	for _, pod := range pods {
+		if store.byPod(pod.UUID) != nil {
+			continue
+		}
+		state := "created"
+		status := "Created"
+		switch {
+		case pod.State == "running":
+			state, status = "running", "Up"
+		case pod.exited():
+			state, status = "exited", "Exited"
+		}
+		list = append(list, types.Container{
+			ID:     pod.UUID,
+			Names:  []string{"/" + pod.App},
+			Image:  pod.Image,
+			State:  state,
+			Status: status,
+			Labels: map[string]string{},
+			Ports:  []types.Port{},
+		})
+	}
+	return list, nil
+}
+
+func (c *Container) summary() types.Container {
+	name := c.Name
+	if name == "" {
+		name = c.ID
+		if len(name) > 12 {
+			name = name[:12]
+		}
+	}
+
+	state, status := "created", "Created"
+	if c.State.Running {
+		state = "running"
+		status = "Up " + listing.HumanDuration(time.Since(c.State.StartedAt))
+	} else if c.State.Restarting {
+		state = "restarting"
+		status = fmt.Sprintf("Restarting (%d) %s ago", c.State.ExitCode, listing.HumanDuration(time.Since(c.State.FinishedAt)))
+	} else if !c.State.StartedAt.IsZero() {
+		state = "exited"
+		status = fmt.Sprintf("Exited (%d) %s ago", c.State.ExitCode, listing.HumanDuration(time.Since(c.State.FinishedAt)))
+	}
+
+	labels := map[string]string{}
+	var command []string
+	if c.Config != nil {
+		for k, v := range c.Config.Labels {
+			labels[k] = v
+		}
+		command = append(append(command, c.Config.Entrypoint...), c.Config.Cmd...)
+	}
+
+	ports := []types.Port{}
+	for port, bindings := range c.Ports {
+		number, proto, _ := splitPort(port)
+		for _, b := range bindings {
+			public, _ := strconv.Atoi(b.HostPort)
+			ports = append(ports, types.Port{IP: "0.0.0.0", PrivatePort: number, PublicPort: public, Type: proto})
+		}
+	}
+
+	return types.Container{
+		ID:      c.ID,
+		Names:   []string{"/" + name},
+		Image:   c.Image,
+		Command: strings.Join(command, " "),
+		Created: c.Created.Unix(),
+		Ports:   ports,
+		Labels:  labels,
+		State:   state,
+		Status:  status,
+	}
+}
+
+// listImages describes the images of the rkt store. Labels come from the
+// image manifests, which are only read when asked for.
+func listImages(withLabels bool) ([]types.Image, error) {
+	out, err := utils.RunOutput(exec.Command("rkt", "image", "list", "--full", "--no-legend"))
+	if err != nil {
+		return nil, err
+	}
+
+	list := parseRktImageList(out)
+	if withLabels {
+		for i := range list {
+			list[i].Labels = imageLabels(list[i].ID)
+		}
+	}
+	return list, nil
+}
+
+func parseRktImageList(out string) []types.Image {
+	list := []types.Image{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "sha512-") {
+			continue
+		}
+
+		repoTag := fields[1]
+		if !strings.Contains(repoTag[strings.LastIndex(repoTag, "/")+1:], ":") {
+			repoTag += ":latest"
+		}
+		img := types.Image{
+			ID:          fields[0],
+			RepoTags:    []string{repoTag},
+			RepoDigests: []string{},
+			Labels:      map[string]string{},
+		}
+		if t := importTimePattern.FindString(line); t != "" {
+			if created, err := time.Parse("2006-01-02 15:04:05.999999999 -0700", t); err == nil {
+				img.Created = created.Unix()
+			}
+		}
+		for _, f := range fields[2:] {
+			if size, ok := parseSize(f); ok {
+				img.Size = size
+				img.VirtualSize = size
+				break
+			}
+		}
+		list = append(list, img)
+	}
+	return list
+}
+
+func imageLabels(id string) map[string]string {
+	labels := map[string]string{}
+	out, err := utils.RunOutput(exec.Command("rkt", "image", "cat-manifest", id))
+	if err != nil {
+		logrus.Debugf("Failed to read the manifest of %s: %s", id, err)
+		return labels
+	}
+	m := &aciManifest{}
+	if err := json.Unmarshal([]byte(out), m); err != nil {
+		return labels
+	}
+	for _, a := range m.Ann {
+		labels[a.Name] = a.Value
+	}
+	return labels
+}
+
+func parseSize(s string) (int64, bool) {
+	m := sizePattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	unit := map[string]float64{
+		"B": 1, "KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12,
+		"KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30, "TiB": 1 << 40,
+	}[m[3]]
+	return int64(n * unit), true
+}
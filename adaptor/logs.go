@@ -0,0 +1,24 @@
+// docker logs for rkt pods, read back from the json-file log harbour writes
+// their output to.
+
+package adaptor
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/huawei-openlab/harbour/engine/jsonlog"
+)
+
+func rktCmdLogs(w http.ResponseWriter, r *http.Request) error {
+	c, err := store.get(containerRef(r.URL.Path))
+	if err != nil {
+		return err
+	}
+	tty := c.Config != nil && c.Config.Tty
+	var exited <-chan struct{}
+	if v := store.view(c); v.State.Running {
+		exited = v.waitCh
+	}
+	return jsonlog.Serve(w, r, filepath.Join(containerRoot(c.ID), jsonlog.FileName), tty, exited)
+}
@@ -0,0 +1,72 @@
+package adaptor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine"
+)
+
+const testLog = `{"log":"one\n","stream":"stdout","time":"2015-10-01T10:00:00Z"}
+{"log":"oops\n","stream":"stderr","time":"2015-10-01T10:00:01Z"}
+{"log":"two\n","stream":"stdout","time":"2015-10-01T10:00:02Z"}
+{"log":"par`
+
+func TestLogs(t *testing.T) {
+	root, err := ioutil.TempDir("", "harbour-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(old string) { engine.StateRoot = old }(engine.StateRoot)
+	engine.StateRoot = root
+
+	c := &Container{ID: "0123456789ab", Name: "logger", Config: &types.ContainerConfig{}}
+	if err := store.add(c); err != nil {
+		t.Fatal(err)
+	}
+	defer store.remove(c)
+	if err := ioutil.WriteFile(filepath.Join(containerRoot(c.ID), "container-json.log"), []byte(testLog), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := func(query string) (string, error) {
+		req, _ := http.NewRequest("GET", "/containers/logger/logs?"+query, nil)
+		w := httptest.NewRecorder()
+		err := rktCmdLogs(w, req)
+		return w.Body.String(), err
+	}
+	for _, tc := range []struct {
+		query, want string
+	}{
+		{"stdout=1", "\x01\x00\x00\x00\x00\x00\x00\x04one\n\x01\x00\x00\x00\x00\x00\x00\x04two\n"},
+		{"stderr=1", "\x02\x00\x00\x00\x00\x00\x00\x05oops\n"},
+		{"stdout=1&tail=1", "\x01\x00\x00\x00\x00\x00\x00\x04two\n"},
+		{"stdout=1&stderr=1&since=1443693601", "\x01\x00\x00\x00\x00\x00\x00\x04two\n"},
+		{"stdout=1&tail=1&timestamps=1", "\x01\x00\x00\x00\x00\x00\x00\x19" + "2015-10-01T10:00:02Z two\n"},
+	} {
+		got, err := logs(tc.query)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.query, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%s: expected %q, got %q", tc.query, tc.want, got)
+		}
+	}
+
+	c.Config.Tty = true
+	if got, err := logs("stdout=1&stderr=1"); err != nil || got != "one\noops\ntwo\n" {
+		t.Fatalf("expected the raw tty output, got %q, %v", got, err)
+	}
+	if _, err := logs("tail=1"); err == nil {
+		t.Fatal("expected a request without streams to be refused")
+	}
+	if _, err := logs("stdout=1&tail=last"); err == nil {
+		t.Fatal("expected an invalid tail to be refused")
+	}
+}
@@ -0,0 +1,298 @@
+// Port publishing and network modes for rkt pods.
+
+package adaptor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/utils"
+)
+
+// rktNetwork maps a docker NetworkMode onto the --net setting of rkt.
+func rktNetwork(hc *types.HostConfig) (string, error) {
+	mode := ""
+	if hc != nil {
+		mode = hc.NetworkMode
+	}
+	switch mode {
+	case "", "default", "bridge":
+		return "default", nil
+	case "host", "none":
+		return mode, nil
+	}
+	return "", fmt.Errorf("Bad parameter: network mode %s is not supported on rkt", mode)
+}
+
+// publishedPorts resolves the port bindings of config, picking free host
+// ports where docker would have.
+func publishedPorts(config *types.ContainerConfig) (map[string][]types.PortBinding, []string, error) {
+	var warnings []string
+	ports := map[string][]types.PortBinding{}
+	hc := config.HostConfig
+	if hc == nil {
+		return ports, nil, nil
+	}
+
+	for port, bindings := range hc.PortBindings {
+		ports[normalizePort(port)] = append([]types.PortBinding{}, bindings...)
+	}
+	if hc.PublishAllPorts {
+		for port := range config.ExposedPorts {
+			if _, ok := ports[normalizePort(port)]; !ok {
+				ports[normalizePort(port)] = []types.PortBinding{{}}
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return ports, nil, nil
+	}
+
+	network, err := rktNetwork(hc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if network != "default" {
+		warnings = append(warnings, fmt.Sprintf("Published ports are discarded when using %s network mode", network))
+		return map[string][]types.PortBinding{}, warnings, nil
+	}
+
+	for port, bindings := range ports {
+		if _, _, err := splitPort(port); err != nil {
+			return nil, nil, err
+		}
+		if len(bindings) == 0 {
+			bindings = []types.PortBinding{{}}
+		}
+		if len(bindings) > 1 {
+			warnings = append(warnings, fmt.Sprintf("rkt publishes a port once, only the first binding of %s is used", port))
+			bindings = bindings[:1]
+		}
+		b := &bindings[0]
+		if b.HostIP != "" && b.HostIP != "0.0.0.0" {
+			warnings = append(warnings, fmt.Sprintf("rkt publishes ports on every address, ignoring host IP %s for %s", b.HostIP, port))
+			b.HostIP = ""
+		}
+		if b.HostPort == "" {
+			free, err := freePort(port)
+			if err != nil {
+				return nil, nil, err
+			}
+			b.HostPort = strconv.Itoa(free)
+		} else if _, err := strconv.ParseUint(b.HostPort, 10, 16); err != nil {
+			return nil, nil, fmt.Errorf("Bad parameter: invalid host port %s for %s", b.HostPort, port)
+		}
+		ports[port] = bindings
+	}
+
+	return ports, warnings, nil
+}
+
+// portsImagePrefix starts the names of the copies of images imageWithPorts
+// declares ports in.
+const portsImagePrefix = "harbour/ports-"
+
+// imageWithPorts makes sure the image declares every port in ports and
+// returns its rkt image ID along with the name rkt knows each port by.
+// Missing declarations are added to a copy of the image, named after the
+// image ID and the ports so that the containers publishing the same ports of
+// an image share it.
+func imageWithPorts(image string, ports map[string][]types.PortBinding) (string, map[string]string, error) {
+	out, err := utils.RunOutput(exec.Command("rkt", "--insecure-skip-verify", "fetch", rktImageRef(image)))
+	if err != nil {
+		return "", nil, err
+	}
+	id := lastLine(out)
+
+	manifestData, err := utils.RunOutput(exec.Command("rkt", "image", "cat-manifest", id))
+	if err != nil {
+		return "", nil, err
+	}
+	m := &aciManifest{}
+	if err := json.Unmarshal([]byte(manifestData), m); err != nil {
+		return "", nil, err
+	}
+
+	names := map[string]string{}
+	var missing []aciPort
+	for port := range ports {
+		number, proto, _ := splitPort(port)
+		found := false
+		if m.App != nil {
+			for _, p := range m.App.Ports {
+				if p.Port == uint(number) && p.Protocol == proto {
+					names[port] = p.Name
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			name := fmt.Sprintf("%d-%s", number, proto)
+			names[port] = name
+			missing = append(missing, aciPort{Name: name, Protocol: proto, Port: uint(number), Count: 1})
+		}
+	}
+	if len(missing) == 0 {
+		return id, names, nil
+	}
+
+	name := portsImageName(id, missing)
+	images, err := listImages(false)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, img := range images {
+		for _, rt := range img.RepoTags {
+			if rt == name+":latest" {
+				return img.ID, names, nil
+			}
+		}
+	}
+
+	logrus.Debugf("Declaring ports %v in a copy of %s named %s", missing, image, name)
+	tmpDir, err := ioutil.TempDir("", "harbour-ports-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	aci := filepath.Join(tmpDir, "image.aci")
+	if _, err := utils.RunOutput(exec.Command("rkt", "image", "export", "--overwrite", id, aci)); err != nil {
+		return "", nil, err
+	}
+	err = rewriteACIManifest(aci, func(m *aciManifest) {
+		m.Name = name
+		labels := m.Labels[:0]
+		for _, l := range m.Labels {
+			if l.Name != "version" {
+				labels = append(labels, l)
+			}
+		}
+		m.Labels = labels
+		if m.App == nil {
+			m.App = &aciApp{User: "0", Group: "0"}
+		}
+		m.App.Ports = append(m.App.Ports, missing...)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	out, err = utils.RunOutput(exec.Command("rkt", "fetch", "--insecure-skip-verify", aci))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return lastLine(out), names, nil
+}
+
+// portsImageName names the copy of image id declaring the ports missing:
+// harbour/ports-, the start of the ID of the image and a hash of the ports.
+func portsImageName(id string, missing []aciPort) string {
+	ports := make([]string, len(missing))
+	for i, p := range missing {
+		ports[i] = p.Name
+	}
+	sort.Strings(ports)
+	sum := sha256.Sum256([]byte(id + "\n" + strings.Join(ports, "\n")))
+	return portsImagePrefix + shortImageID(id) + "-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// portsImageSource returns the start of the ID of the image name is a copy
+// of, if it is one made by imageWithPorts.
+func portsImageSource(name string) (string, bool) {
+	if !strings.HasPrefix(name, portsImagePrefix) {
+		return "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(name, portsImagePrefix), "-")
+	if len(parts) != 2 {
+		return "", false
+	}
+	return parts[0], true
+}
+
+func shortImageID(id string) string {
+	id = strings.TrimPrefix(id, "sha512-")
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return id
+}
+
+// podIP extracts the address of the default network from the networks
+// reported by rkt, e.g. "default:ip4=172.16.28.7".
+func podIP(networks string) string {
+	first := ""
+	for _, n := range strings.Split(networks, ",") {
+		parts := strings.SplitN(n, ":", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "ip4=") {
+			continue
+		}
+		ip := strings.TrimPrefix(parts[1], "ip4=")
+		if parts[0] == "default" {
+			return ip
+		}
+		if first == "" {
+			first = ip
+		}
+	}
+	return first
+}
+
+func normalizePort(port string) string {
+	if !strings.Contains(port, "/") {
+		return port + "/tcp"
+	}
+	return port
+}
+
+func splitPort(port string) (int, string, error) {
+	parts := strings.SplitN(normalizePort(port), "/", 2)
+	n, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil || n == 0 {
+		return 0, "", fmt.Errorf("Bad parameter: invalid port %s", port)
+	}
+	if parts[1] != "tcp" && parts[1] != "udp" {
+		return 0, "", fmt.Errorf("Bad parameter: invalid protocol in port %s", port)
+	}
+	return int(n), parts[1], nil
+}
+
+// freePort asks the kernel for a free host port of the protocol of port.
+func freePort(port string) (int, error) {
+	_, proto, _ := splitPort(port)
+	if proto == "udp" {
+		c, err := net.ListenPacket("udp", ":0")
+		if err != nil {
+			return 0, err
+		}
+		defer c.Close()
+		return c.LocalAddr().(*net.UDPAddr).Port, nil
+	}
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func lastLine(out string) string {
+	lines := strings.Fields(out)
+	if len(lines) == 0 {
+		return ""
+	}
+	return lines[len(lines)-1]
+}
@@ -0,0 +1,103 @@
+package adaptor
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/huawei-openlab/harbour/api/types"
+)
+
+// fakeRktImages fetches nginx as sha512-source, which declares port 80, and
+// stores the ACIs it is given as sha512-copy.
+const fakeRktImages = `#!/bin/sh
+echo "$@" >> "$DIR/calls"
+case "$1 $2" in
+"--insecure-skip-verify fetch") echo sha512-source ;;
+"image cat-manifest") echo '{"acKind":"ImageManifest","name":"nginx","app":{"user":"0","group":"0","ports":[{"name":"http","protocol":"tcp","port":80}]}}' ;;
+"image list") cat "$DIR/list" 2>/dev/null || true ;;
+"image export") cp "$DIR/source.aci" "$5" ;;
+"fetch --insecure-skip-verify")
+	cp "$3" "$DIR/copy.aci"
+	echo "sha512-copy $(tar -xOf "$3" manifest | sed 's/.*"name":"\(harbour[^"]*\)".*/\1/')" >> "$DIR/list"
+	echo sha512-copy ;;
+esac
+`
+
+func TestImageWithPorts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harbour-ports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "rkt"), []byte(fakeRktImages), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+	defer os.Unsetenv("DIR")
+	os.Setenv("DIR", dir)
+
+	aci, err := os.Create(filepath.Join(dir, "source.aci"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(aci)
+	manifest := `{"acKind":"ImageManifest","name":"nginx","labels":[{"name":"version","value":"1.9"}],"app":{"user":"0","group":"0","ports":[{"name":"http","protocol":"tcp","port":80}]}}`
+	if err := writeTarFile(tw, "manifest", []byte(manifest)); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+	aci.Close()
+
+	exports := func() int {
+		calls, _ := ioutil.ReadFile(filepath.Join(dir, "calls"))
+		return strings.Count(string(calls), "image export")
+	}
+
+	// Declared ports need no copy.
+	id, names, err := imageWithPorts("nginx", map[string][]types.PortBinding{"80/tcp": {{HostPort: "8080"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "sha512-source" || names["80/tcp"] != "http" || exports() != 0 {
+		t.Fatalf("expected the image itself, got %s %v after %d exports", id, names, exports())
+	}
+
+	ports := map[string][]types.PortBinding{"80/tcp": {{HostPort: "8080"}}, "53/udp": {{HostPort: "5353"}}}
+	for i := 0; i < 2; i++ {
+		id, names, err = imageWithPorts("nginx", ports)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != "sha512-copy" || names["80/tcp"] != "http" || names["53/udp"] != "53-udp" {
+			t.Fatalf("expected the copy, got %s %v", id, names)
+		}
+		if exports() != 1 {
+			t.Fatalf("expected the copy to be made once, got %d exports", exports())
+		}
+	}
+
+	var m aciManifest
+	err = walkTar(filepath.Join(dir, "copy.aci"), func(hdr *tar.Header, r io.Reader) error {
+		return json.NewDecoder(r).Decode(&m)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := portsImageName("sha512-source", []aciPort{{Name: "53-udp"}})
+	if m.Name != want || len(m.Labels) != 0 || len(m.App.Ports) != 2 {
+		t.Fatalf("expected a copy named %s declaring both ports, got %+v", want, m)
+	}
+	if source, ok := portsImageSource(m.Name); !ok || source != "source" {
+		t.Fatalf("expected %s to be a copy of sha512-source, got %q", m.Name, source)
+	}
+	if portsImageName("sha512-source", []aciPort{{Name: "53-tcp"}}) == want {
+		t.Fatal("expected other ports to make another copy")
+	}
+}
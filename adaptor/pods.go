@@ -0,0 +1,321 @@
+// Running rkt pods and following their state.
+
+package adaptor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/engine/events"
+	"github.com/huawei-openlab/harbour/engine/jsonlog"
+	"github.com/huawei-openlab/harbour/engine/trap"
+	"github.com/huawei-openlab/harbour/utils"
+)
+
+const podWatchInterval = 2 * time.Second
+
+var (
+	eventLog *events.Events
+
+	uuidPattern = regexp.MustCompile("^[0-9a-f]{8}(-[0-9a-f]{4}){3}-[0-9a-f]{12}$")
+	podStates   = []string{"embryo", "preparing", "prepared", "running", "deleting", "exited", "garbage", "aborted"}
+
+	// waiters are the pods harbour runs itself: their exit code comes from
+	// the process waiting for them, not from watchPods.
+	waiters = struct {
+		sync.Mutex
+		pods map[string]bool
+	}{pods: make(map[string]bool)}
+)
+
+func setWaited(uuid string, waited bool) {
+	waiters.Lock()
+	defer waiters.Unlock()
+	if waited {
+		waiters.pods[uuid] = true
+	} else {
+		delete(waiters.pods, uuid)
+	}
+}
+
+func isWaited(uuid string) bool {
+	waiters.Lock()
+	defer waiters.Unlock()
+	return waiters.pods[uuid]
+}
+
+// rktPod is one pod line of `rkt list`.
+type rktPod struct {
+	UUID     string
+	App      string
+	Image    string
+	State    string
+	Networks string
+}
+
+func (p *rktPod) exited() bool {
+	return p.State == "exited" || p.State == "garbage" || p.State == "aborted"
+}
+
+// Init prepares the rkt adaptor: it reloads the containers harbour knows
+// about, restarts the ones that should always run and starts following the
+// pods.
+func Init(eng *engine.Engine) error {
+	eventLog = eng.Events
+	if err := store.load(); err != nil {
+		return err
+	}
+	trap.ShutdownCallback(restarts.shutdown)
+	restarts.restore()
+	go watchPods(podWatchInterval)
+	startGC(engine.GC)
+	return nil
+}
+
+// Pod is a rkt pod, along with the harbour container it backs if any.
+type Pod struct {
+	UUID      string
+	App       string
+	Image     string
+	State     string
+	Container string
+}
+
+// Pods returns the pods rkt knows about.
+func Pods() ([]Pod, error) {
+	pods, err := listPods()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Pod, 0, len(pods))
+	for _, p := range pods {
+		pod := Pod{UUID: p.UUID, App: p.App, Image: p.Image, State: p.State}
+		if c := store.byPod(p.UUID); c != nil {
+			pod.Container = c.ID
+		}
+		list = append(list, pod)
+	}
+	return list, nil
+}
+
+// listPods runs `rkt list` and returns its pods. The column layout changed
+// between rkt releases, so the state is looked up by value.
+func listPods() ([]rktPod, error) {
+	out, err := utils.RunOutput(exec.Command("rkt", "list", "--full", "--no-legend"))
+	if err != nil {
+		return nil, err
+	}
+	return parseRktList(out), nil
+}
+
+func parseRktList(out string) []rktPod {
+	var pods []rktPod
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !uuidPattern.MatchString(fields[0]) {
+			continue
+		}
+		pod := rktPod{UUID: fields[0], App: fields[1], Image: fields[2]}
+		for i, f := range fields[3:] {
+			for _, s := range podStates {
+				if f == s {
+					pod.State = s
+					if rest := fields[3+i+1:]; len(rest) > 0 {
+						pod.Networks = rest[len(rest)-1]
+					}
+					break
+				}
+			}
+			if pod.State != "" {
+				break
+			}
+		}
+		pods = append(pods, pod)
+	}
+	return pods
+}
+
+// podStatus runs `rkt status` and returns its key=value pairs.
+func podStatus(uuid string) (map[string]string, error) {
+	out, err := utils.RunOutput(exec.Command("rkt", "status", uuid))
+	if err != nil {
+		return nil, fmt.Errorf("No such pod: %s: %s", uuid, err)
+	}
+	status := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) == 2 {
+			status[kv[0]] = kv[1]
+		}
+	}
+	return status, nil
+}
+
+// watchPods notices pods exiting on their own, including the ones harbour
+// did not start itself or lost track of across a restart.
+func watchPods(interval time.Duration) {
+	last := map[string]string{}
+	for {
+		pods, err := listPods()
+		if err != nil {
+			logrus.Debugf("Failed to list rkt pods: %s", err)
+		} else {
+			last = checkPods(pods, last)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// checkPods records the exit of the pods no process of harbour waits for,
+// given their states as of the previous poll, last, and returns their
+// current states.
+func checkPods(pods []rktPod, last map[string]string) map[string]string {
+	seen := map[string]string{}
+	for _, pod := range pods {
+		seen[pod.UUID] = pod.State
+		if !pod.exited() || isWaited(pod.UUID) {
+			continue
+		}
+		if c := store.byPod(pod.UUID); c != nil {
+			podExited(c, -1)
+		} else if last[pod.UUID] == "running" {
+			eventLog.Log("die", pod.UUID, pod.Image)
+		}
+	}
+	return seen
+}
+
+// startPod runs the prepared pod of c in the background.
+func startPod(c *Container) error {
+	network, err := rktNetwork(c.Config.HostConfig)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(containerRoot(c.ID), jsonlog.FileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	uuid := store.view(c).PodID
+	args := []string{"--mds-register=false", "run-prepared", "--net=" + network, uuid}
+	logrus.Debugf("The operation for rkt is : rkt %s", strings.Join(args, " "))
+	cmd := exec.Command("rkt", args...)
+	logs := jsonlog.NewWriter(f)
+	cmd.Stdout = logs.Stream("stdout")
+	cmd.Stderr = logs.Stream("stderr")
+	// Keep the pod out of harbour's process group so that a ^C on harbour
+	// does not take the pods down with it.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	setWaited(uuid, true)
+	if err := cmd.Start(); err != nil {
+		setWaited(uuid, false)
+		f.Close()
+		return err
+	}
+
+	err = store.update(c, func(c *Container) {
+		c.waitCh = make(chan struct{})
+		c.State = ContainerState{
+			Running:   true,
+			Pid:       cmd.Process.Pid,
+			StartedAt: time.Now().UTC(),
+		}
+	})
+	if err != nil {
+		logrus.Errorf("Failed to save container %s: %s", c.ID, err)
+	}
+	eventLog.Log("start", c.ID, c.Image)
+	go applyCgroupLimits(c)
+
+	go func() {
+		code := 0
+		if err := cmd.Wait(); err != nil {
+			code = -1
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+					code = status.ExitStatus()
+				}
+			}
+		}
+		logs.Flush()
+		f.Close()
+		podExited(c, code)
+		setWaited(uuid, false)
+	}()
+
+	return nil
+}
+
+// podExited records that the pod of c is gone. It is safe to call more than
+// once for the same exit.
+func podExited(c *Container, code int) {
+	exited := false
+	store.update(c, func(c *Container) {
+		if !c.State.Running {
+			return
+		}
+		exited = true
+		c.State.Running = false
+		c.State.Pid = 0
+		c.State.ExitCode = code
+		c.State.FinishedAt = time.Now().UTC()
+		close(c.waitCh)
+	})
+	if exited {
+		eventLog.Log("die", c.ID, c.Image)
+		restarts.handleExit(c)
+	}
+}
+
+// signalPod sends sig to the pod of c, looking its pid up when harbour did
+// not start it itself.
+func signalPod(c *Container, sig syscall.Signal) error {
+	v := store.view(c)
+	if !v.State.Running {
+		return fmt.Errorf("Impossible to signal container %s: it is not running", c.ID)
+	}
+	pid := v.State.Pid
+	if pid == 0 {
+		status, err := podStatus(v.PodID)
+		if err != nil {
+			return err
+		}
+		pid, _ = strconv.Atoi(status["pid"])
+	}
+	if pid <= 0 {
+		return fmt.Errorf("Impossible to signal container %s: unknown pid", c.ID)
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// stopPod asks the pod of c to terminate and kills it after timeout.
+func stopPod(c *Container, timeout time.Duration) error {
+	v := store.view(c)
+	if !v.State.Running {
+		return nil
+	}
+	if err := signalPod(c, syscall.SIGTERM); err != nil {
+		return err
+	}
+	select {
+	case <-v.waitCh:
+		return nil
+	case <-time.After(timeout):
+	}
+	if err := signalPod(c, syscall.SIGKILL); err != nil {
+		return err
+	}
+	<-v.waitCh
+	return nil
+}
@@ -0,0 +1,47 @@
+package adaptor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/engine/events"
+)
+
+func TestCheckPods(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "harbour-pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	defer func(old string) { engine.StateRoot = old }(engine.StateRoot)
+	engine.StateRoot = tmp
+	defer func(old *events.Events) { eventLog = old }(eventLog)
+	eventLog = events.New()
+
+	running := ContainerState{Running: true, StartedAt: time.Now().UTC()}
+	waited := &Container{ID: "waited", PodID: "pod-waited", State: running, waitCh: make(chan struct{})}
+	lost := &Container{ID: "lost", PodID: "pod-lost", State: running, waitCh: make(chan struct{})}
+	for _, c := range []*Container{waited, lost} {
+		if err := store.add(c); err != nil {
+			t.Fatal(err)
+		}
+		defer store.remove(c)
+	}
+	setWaited("pod-waited", true)
+	defer setWaited("pod-waited", false)
+
+	last := checkPods([]rktPod{{UUID: "pod-waited", State: "exited"}, {UUID: "pod-lost", State: "exited"}}, nil)
+	if len(last) != 2 {
+		t.Fatalf("expected the states of both pods, got %v", last)
+	}
+	// The exit code of a pod harbour waits for comes from its process.
+	if v := store.view(waited); !v.State.Running {
+		t.Fatalf("expected the waited pod to be left to its process, got %+v", v.State)
+	}
+	if v := store.view(lost); v.State.Running || v.State.ExitCode != -1 {
+		t.Fatalf("expected the lost pod to have exited, got %+v", v.State)
+	}
+}
@@ -0,0 +1,165 @@
+// Resource limits for rkt pods. Memory and CPU quotas map onto rkt
+// isolators; the other limits are written to the cgroup of the pod once it
+// runs.
+
+package adaptor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine/cgroups"
+)
+
+const (
+	minMemoryLimit   = 4 << 20
+	defaultCPUPeriod = 100000
+
+	// podPidTimeout bounds the wait for a started pod to report its pid.
+	podPidTimeout = 10 * time.Second
+)
+
+var cpusetPattern = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+
+// resourceArgs validates the limits of hc and returns the rkt isolator
+// options for them. Limits harbour cannot enforce are removed from hc with a
+// warning, so that inspect shows what is actually applied.
+func resourceArgs(hc *types.HostConfig) ([]string, []string, error) {
+	if hc == nil {
+		return nil, nil, nil
+	}
+
+	switch {
+	case hc.Memory < 0:
+		return nil, nil, fmt.Errorf("Bad parameter: invalid memory limit %d", hc.Memory)
+	case hc.Memory > 0 && hc.Memory < minMemoryLimit:
+		return nil, nil, fmt.Errorf("Bad parameter: Minimum memory limit allowed is 4MB")
+	case hc.MemorySwap > 0 && hc.Memory == 0:
+		return nil, nil, fmt.Errorf("Bad parameter: You should always set the Memory limit when using Memoryswap limit")
+	case hc.MemorySwap > 0 && hc.MemorySwap < hc.Memory:
+		return nil, nil, fmt.Errorf("Bad parameter: Minimum memoryswap limit should be larger than memory limit")
+	case hc.CPUShares < 0:
+		return nil, nil, fmt.Errorf("Bad parameter: invalid CPU shares %d", hc.CPUShares)
+	case hc.CPUQuota < 0 || (hc.CPUQuota > 0 && hc.CPUQuota < 1000):
+		return nil, nil, fmt.Errorf("Bad parameter: CPU cfs quota can not be less than 1ms (i.e. 1000)")
+	case hc.CPUPeriod < 0 || (hc.CPUPeriod > 0 && (hc.CPUPeriod < 1000 || hc.CPUPeriod > 1000000)):
+		return nil, nil, fmt.Errorf("Bad parameter: CPU cfs period can not be less than 1ms (i.e. 1000) or larger than 1s (i.e. 1000000)")
+	case hc.BlkioWeight > 0 && (hc.BlkioWeight < 10 || hc.BlkioWeight > 1000):
+		return nil, nil, fmt.Errorf("Bad parameter: Range of blkio weight is from 10 to 1000")
+	case hc.CpusetCpus != "" && !cpusetPattern.MatchString(hc.CpusetCpus):
+		return nil, nil, fmt.Errorf("Bad parameter: invalid value %s for cpuset cpus", hc.CpusetCpus)
+	}
+
+	var args, warnings []string
+	if hc.Memory > 0 {
+		args = append(args, "--memory="+strconv.FormatInt(hc.Memory, 10))
+	}
+	if hc.CPUQuota > 0 {
+		period := hc.CPUPeriod
+		if period == 0 {
+			period = defaultCPUPeriod
+		}
+		millis := hc.CPUQuota * 1000 / period
+		if millis == 0 {
+			millis = 1
+		}
+		args = append(args, fmt.Sprintf("--cpu=%dm", millis))
+	} else if hc.CPUPeriod > 0 {
+		warnings = append(warnings, "CPU period is discarded without a CPU quota on rkt")
+		hc.CPUPeriod = 0
+	}
+	if len(hc.Ulimits) > 0 {
+		warnings = append(warnings, "rkt does not support ulimits, ulimits are discarded")
+		hc.Ulimits = nil
+	}
+
+	return args, warnings, nil
+}
+
+// cgroupResources returns the limits of hc that harbour writes to the cgroup
+// of the pod itself, or nil when there are none.
+func cgroupResources(hc *types.HostConfig) *cgroups.Resources {
+	if hc == nil || (hc.CPUShares == 0 && hc.CpusetCpus == "" && hc.BlkioWeight == 0 && hc.MemorySwap == 0) {
+		return nil
+	}
+	return &cgroups.Resources{
+		Memory:      hc.Memory,
+		MemorySwap:  hc.MemorySwap,
+		CPUShares:   hc.CPUShares,
+		CpusetCpus:  hc.CpusetCpus,
+		BlkioWeight: hc.BlkioWeight,
+	}
+}
+
+// applyCgroupLimits writes the limits rkt has no isolator for to the cgroup
+// of the running pod of c. Limits that cannot be applied are dropped from
+// the container config.
+func applyCgroupLimits(c *Container) {
+	resources := cgroupResources(store.view(c).Config.HostConfig)
+	if resources == nil {
+		return
+	}
+
+	pid, err := waitPodPid(c, podPidTimeout)
+	if err != nil {
+		logrus.Warnf("Failed to apply the resource limits of container %s: %s", c.ID, err)
+		return
+	}
+	cg, err := cgroups.ForPid(pid)
+	if err != nil {
+		logrus.Warnf("Failed to apply the resource limits of container %s: %s", c.ID, err)
+		return
+	}
+
+	failed := cg.Apply(resources)
+	if len(failed) == 0 {
+		return
+	}
+	// The configuration is replaced rather than changed, as inspect reads
+	// it outside of the lock.
+	store.update(c, func(c *Container) {
+		config := *c.Config
+		hc := *config.HostConfig
+		config.HostConfig = &hc
+		c.Config = &config
+		for name, err := range failed {
+			logrus.Warnf("Failed to apply %s to container %s: %s", name, c.ID, err)
+			switch name {
+			case "CpuShares":
+				hc.CPUShares = 0
+			case "CpusetCpus":
+				hc.CpusetCpus = ""
+			case "BlkioWeight":
+				hc.BlkioWeight = 0
+			case "MemorySwap":
+				hc.MemorySwap = 0
+			}
+		}
+	})
+}
+
+// waitPodPid waits for the pod of c to report the pid of its init process.
+func waitPodPid(c *Container, timeout time.Duration) (int, error) {
+	v := store.view(c)
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case <-v.waitCh:
+			return 0, fmt.Errorf("the pod exited")
+		default:
+		}
+		if status, err := podStatus(v.PodID); err == nil {
+			if pid, _ := strconv.Atoi(status["pid"]); pid > 0 {
+				return pid, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("timed out waiting for the pod to start")
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
@@ -0,0 +1,242 @@
+// Restart policies for rkt pods. rkt runs a pod only once, so a restart
+// prepares a new pod from the options the container was created with.
+
+package adaptor
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/utils"
+)
+
+const (
+	minRestartDelay = 100 * time.Millisecond
+	maxRestartDelay = time.Minute
+
+	// A container that ran for restartResetTime starts its backoff over.
+	restartResetTime = 10 * time.Second
+)
+
+// supervisor restarts the containers whose pods exit according to their
+// restart policy.
+type supervisor struct {
+	sync.Mutex
+	shuttingDown bool
+	pending      map[string]*time.Timer
+	delays       map[string]time.Duration
+}
+
+var restarts = &supervisor{
+	pending: make(map[string]*time.Timer),
+	delays:  make(map[string]time.Duration),
+}
+
+func validateRestartPolicy(p types.RestartPolicy) error {
+	switch p.Name {
+	case "", "no", "always", "unless-stopped":
+		if p.MaximumRetryCount != 0 {
+			return fmt.Errorf("Bad parameter: maximum retry count cannot be used with restart policy '%s'", p.Name)
+		}
+	case "on-failure":
+		if p.MaximumRetryCount < 0 {
+			return fmt.Errorf("Bad parameter: maximum retry count cannot be negative")
+		}
+	default:
+		return fmt.Errorf("Bad parameter: invalid restart policy '%s'", p.Name)
+	}
+	return nil
+}
+
+func restartPolicy(c *Container) types.RestartPolicy {
+	if c.Config == nil || c.Config.HostConfig == nil {
+		return types.RestartPolicy{}
+	}
+	return c.Config.HostConfig.RestartPolicy
+}
+
+// shouldRestart applies the restart policy p to a pod that exited with code
+// after restartCount restarts.
+func shouldRestart(p types.RestartPolicy, code, restartCount int, manuallyStopped bool) bool {
+	if manuallyStopped {
+		return false
+	}
+	switch p.Name {
+	case "always", "unless-stopped":
+		return true
+	case "on-failure":
+		return code != 0 && (p.MaximumRetryCount == 0 || restartCount < p.MaximumRetryCount)
+	}
+	return false
+}
+
+// restartOnRestore tells whether a container with the restart policy p is
+// brought back when harbour starts. Like docker, always does so even for a
+// container stopped by hand, unless-stopped does not.
+func restartOnRestore(p types.RestartPolicy, manuallyStopped bool) bool {
+	switch p.Name {
+	case "always":
+		return true
+	case "unless-stopped":
+		return !manuallyStopped
+	}
+	return false
+}
+
+// nextDelay doubles the previous backoff, starting over once the container
+// managed to run for a while.
+func nextDelay(prev, ran time.Duration) time.Duration {
+	if prev == 0 || ran >= restartResetTime {
+		return minRestartDelay
+	}
+	if prev *= 2; prev > maxRestartDelay {
+		prev = maxRestartDelay
+	}
+	return prev
+}
+
+// handleExit schedules a restart of c if its policy asks for one.
+func (s *supervisor) handleExit(c *Container) {
+	s.Lock()
+	defer s.Unlock()
+	if s.shuttingDown {
+		return
+	}
+	v := store.view(c)
+	if !shouldRestart(restartPolicy(c), v.State.ExitCode, v.RestartCount, v.ManuallyStopped) {
+		delete(s.delays, c.ID)
+		return
+	}
+
+	delay := nextDelay(s.delays[c.ID], v.State.FinishedAt.Sub(v.State.StartedAt))
+	s.delays[c.ID] = delay
+	store.update(c, func(c *Container) {
+		c.State.Restarting = true
+	})
+	logrus.Debugf("Restarting container %s in %s", c.ID, delay)
+	s.pending[c.ID] = time.AfterFunc(delay, func() {
+		s.Lock()
+		_, ok := s.pending[c.ID]
+		delete(s.pending, c.ID)
+		s.Unlock()
+		if !ok {
+			return
+		}
+		if err := restartPod(c, true); err != nil {
+			logrus.Errorf("Failed to restart container %s: %s", c.ID, err)
+			store.update(c, func(c *Container) {
+				c.State.Restarting = false
+			})
+		}
+	})
+}
+
+// cancel drops a scheduled restart of c.
+func (s *supervisor) cancel(c *Container) {
+	s.Lock()
+	defer s.Unlock()
+	if t, ok := s.pending[c.ID]; ok {
+		t.Stop()
+		delete(s.pending, c.ID)
+	}
+	delete(s.delays, c.ID)
+	if store.view(c).State.Restarting {
+		store.update(c, func(c *Container) {
+			c.State.Restarting = false
+		})
+	}
+}
+
+// shutdown stops restarting containers, so that the pods going away with
+// harbour stay down.
+func (s *supervisor) shutdown() {
+	s.Lock()
+	defer s.Unlock()
+	s.shuttingDown = true
+	for id, t := range s.pending {
+		t.Stop()
+		delete(s.pending, id)
+	}
+}
+
+// restore records the pods that went away while harbour was down and brings
+// back the containers that should always run.
+func (s *supervisor) restore() {
+	running := map[string]bool{}
+	pods, err := listPods()
+	if err != nil {
+		logrus.Warnf("Failed to list rkt pods: %s", err)
+		return
+	}
+	for _, pod := range pods {
+		running[pod.UUID] = pod.State == "running"
+	}
+
+	for _, c := range store.list() {
+		v := store.view(c)
+		if running[v.PodID] {
+			continue
+		}
+		if v.State.Running || v.State.Restarting {
+			store.update(c, func(c *Container) {
+				if c.State.Running {
+					c.State.Running = false
+					c.State.Pid = 0
+					c.State.FinishedAt = time.Now().UTC()
+					close(c.waitCh)
+				}
+				c.State.Restarting = false
+			})
+		}
+
+		// Like docker, the containers that were never started stay
+		// created.
+		if v.State.StartedAt.IsZero() || !restartOnRestore(restartPolicy(c), v.ManuallyStopped) {
+			continue
+		}
+		logrus.Infof("Restarting container %s", c.ID)
+		if err := restartPod(c, false); err != nil {
+			logrus.Errorf("Failed to restart container %s: %s", c.ID, err)
+		}
+	}
+}
+
+// restartPod replaces the exited pod of c with a new one and starts it.
+func restartPod(c *Container, counted bool) error {
+	if len(c.PrepareArgs) == 0 {
+		return fmt.Errorf("Impossible to restart container %s: its rkt options are unknown", c.ID)
+	}
+
+	logrus.Debugf("The operation for rkt is : rkt %s", strings.Join(c.PrepareArgs, " "))
+	out, err := utils.RunOutput(exec.Command("rkt", c.PrepareArgs...))
+	if err != nil {
+		return err
+	}
+	uuid := lastLine(out)
+	if uuid == "" {
+		return fmt.Errorf("rkt prepare did not return a pod UUID")
+	}
+
+	old := store.view(c).PodID
+	err = store.update(c, func(c *Container) {
+		c.PodID = uuid
+		if counted {
+			c.RestartCount++
+		} else {
+			c.RestartCount = 0
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := utils.RunOutput(exec.Command("rkt", "rm", old)); err != nil {
+		logrus.Debugf("Failed to remove pod %s: %s", old, err)
+	}
+
+	return startPod(c)
+}
@@ -0,0 +1,116 @@
+package adaptor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine"
+)
+
+func TestShouldRestart(t *testing.T) {
+	for _, tc := range []struct {
+		policy  types.RestartPolicy
+		code    int
+		count   int
+		stopped bool
+		want    bool
+	}{
+		{types.RestartPolicy{}, 1, 0, false, false},
+		{types.RestartPolicy{Name: "no"}, 1, 0, false, false},
+		{types.RestartPolicy{Name: "always"}, 0, 5, false, true},
+		{types.RestartPolicy{Name: "always"}, 0, 0, true, false},
+		{types.RestartPolicy{Name: "unless-stopped"}, 137, 0, false, true},
+		{types.RestartPolicy{Name: "unless-stopped"}, 137, 0, true, false},
+		{types.RestartPolicy{Name: "on-failure"}, 0, 0, false, false},
+		{types.RestartPolicy{Name: "on-failure"}, 1, 10, false, true},
+		{types.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}, 1, 2, false, true},
+		{types.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}, 1, 3, false, false},
+	} {
+		if got := shouldRestart(tc.policy, tc.code, tc.count, tc.stopped); got != tc.want {
+			t.Fatalf("%+v exit %d after %d restarts, stopped %t: expected %t", tc.policy, tc.code, tc.count, tc.stopped, tc.want)
+		}
+	}
+}
+
+func TestRestartOnRestore(t *testing.T) {
+	for _, tc := range []struct {
+		policy  string
+		stopped bool
+		want    bool
+	}{
+		{"", false, false},
+		{"no", false, false},
+		{"on-failure", false, false},
+		{"always", false, true},
+		{"always", true, true},
+		{"unless-stopped", false, true},
+		{"unless-stopped", true, false},
+	} {
+		if got := restartOnRestore(types.RestartPolicy{Name: tc.policy}, tc.stopped); got != tc.want {
+			t.Fatalf("%q stopped %t: expected %t", tc.policy, tc.stopped, tc.want)
+		}
+	}
+}
+
+func TestNextDelay(t *testing.T) {
+	d := nextDelay(0, 0)
+	for _, want := range []time.Duration{200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond} {
+		if d = nextDelay(d, time.Second); d != want {
+			t.Fatalf("expected %s, got %s", want, d)
+		}
+	}
+	if d = nextDelay(time.Minute, time.Second); d != maxRestartDelay {
+		t.Fatalf("expected the delay to be capped at %s, got %s", maxRestartDelay, d)
+	}
+	if d = nextDelay(time.Minute, time.Minute); d != minRestartDelay {
+		t.Fatalf("expected the delay to start over, got %s", d)
+	}
+}
+
+// fakeRktRestore lists no pods and fails to prepare any.
+const fakeRktRestore = `#!/bin/sh
+echo "$@" >> "$DIR/calls"
+[ "$1" = list ]
+`
+
+func TestRestore(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "harbour-restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := ioutil.WriteFile(filepath.Join(tmp, "rkt"), []byte(fakeRktRestore), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", tmp+":"+os.Getenv("PATH"))
+	defer os.Unsetenv("DIR")
+	os.Setenv("DIR", tmp)
+	defer func(old string) { engine.StateRoot = old }(engine.StateRoot)
+	engine.StateRoot = tmp
+
+	always := &types.ContainerConfig{HostConfig: &types.HostConfig{RestartPolicy: types.RestartPolicy{Name: "always"}}}
+	for _, c := range []*Container{
+		{ID: "started", Config: always, PrepareArgs: []string{"prepare", "started"}, State: ContainerState{StartedAt: time.Now().UTC()}},
+		{ID: "created", Config: always, PrepareArgs: []string{"prepare", "created"}},
+	} {
+		if err := store.add(c); err != nil {
+			t.Fatal(err)
+		}
+		defer store.remove(c)
+	}
+
+	(&supervisor{pending: make(map[string]*time.Timer), delays: make(map[string]time.Duration)}).restore()
+	calls, err := ioutil.ReadFile(filepath.Join(tmp, "calls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(calls), "prepare started") || strings.Contains(string(calls), "prepare created") {
+		t.Fatalf("expected only the started container to be restarted, got:\n%s", calls)
+	}
+}
@@ -0,0 +1,252 @@
+// docker stats for rkt pods, read from the cgroups and the network namespace
+// of the pod.
+
+package adaptor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine/cgroups"
+)
+
+const statsInterval = time.Second
+
+func rktCmdStats(w http.ResponseWriter, r *http.Request) error {
+	c, err := store.get(containerRef(r.URL.Path))
+	if err != nil {
+		return err
+	}
+	stream := true
+	if s := r.URL.Query().Get("stream"); s != "" {
+		stream = s == "1" || s == "true"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	out := ioutils.NewWriteFlusher(w)
+	enc := json.NewEncoder(out)
+	noPreRead := time.Time{}.Format(time.RFC3339Nano)
+
+	v := store.view(c)
+	if !v.State.Running {
+		return enc.Encode(&types.Stats{Read: time.Now().UTC().Format(time.RFC3339Nano), PreRead: noPreRead})
+	}
+	exited := v.waitCh
+	pid, err := waitPodPid(c, podPidTimeout)
+	if err != nil {
+		return err
+	}
+	cg, err := cgroups.ForPid(pid)
+	if err != nil {
+		return err
+	}
+
+	var closed <-chan bool
+	if closeNotifier, ok := w.(http.CloseNotifier); ok {
+		closed = closeNotifier.CloseNotify()
+	}
+
+	var prev *types.Stats
+	for {
+		s, err := sampleStats(pid, cg)
+		if err != nil {
+			if prev == nil {
+				return err
+			}
+			// The pod went away between two samples.
+			return nil
+		}
+		s.PreRead = noPreRead
+		if prev != nil {
+			s.PreRead = prev.Read
+			s.PreCPUStats = prev.CPUStats
+		}
+		// Without streaming, a second sample is taken so that the CPU
+		// usage can be computed from the answer.
+		if stream || prev != nil {
+			if err := enc.Encode(s); err != nil {
+				return nil
+			}
+		}
+		if !stream && prev != nil {
+			return nil
+		}
+		prev = s
+
+		select {
+		case <-time.After(statsInterval):
+		case <-exited:
+			if !stream {
+				return enc.Encode(prev)
+			}
+			return nil
+		case <-closed:
+			return nil
+		}
+	}
+}
+
+// sampleStats reads the resource usage of the pod whose init process is pid.
+func sampleStats(pid int, cg *cgroups.Cgroup) (*types.Stats, error) {
+	cs, err := cg.Stats()
+	if err != nil {
+		return nil, err
+	}
+	s := &types.Stats{
+		Read: time.Now().UTC().Format(time.RFC3339Nano),
+		CPUStats: types.CPUStats{
+			CPUUsage: types.CPUUsage{
+				TotalUsage:        cs.CPU.Total,
+				PercpuUsage:       cs.CPU.PerCPU,
+				UsageInKernelmode: cs.CPU.System,
+				UsageInUsermode:   cs.CPU.User,
+			},
+			ThrottlingData: types.ThrottlingData{
+				Periods:          cs.CPU.Periods,
+				ThrottledPeriods: cs.CPU.ThrottledPeriods,
+				ThrottledTime:    cs.CPU.ThrottledTime,
+			},
+		},
+		MemoryStats: types.MemoryStats{
+			Usage:    cs.Memory.Usage,
+			MaxUsage: cs.Memory.MaxUsage,
+			Stats:    cs.Memory.Stats,
+			Failcnt:  cs.Memory.Failcnt,
+			Limit:    cs.Memory.Limit,
+		},
+		BlkioStats: types.BlkioStats{
+			IoServiceBytesRecursive: blkioEntries(cs.IOServiceBytes),
+			IoServicedRecursive:     blkioEntries(cs.IOServiced),
+			IoQueuedRecursive:       []types.BlkioStatEntry{},
+			IoServiceTimeRecursive:  []types.BlkioStatEntry{},
+			IoWaitTimeRecursive:     []types.BlkioStatEntry{},
+			IoMergedRecursive:       []types.BlkioStatEntry{},
+			IoTimeRecursive:         []types.BlkioStatEntry{},
+			SectorsRecursive:        []types.BlkioStatEntry{},
+		},
+	}
+
+	if f, err := os.Open("/proc/stat"); err == nil {
+		s.CPUStats.SystemUsage, s.CPUStats.OnlineCPUs, err = parseProcStat(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.MemoryStats.Limit == 0 {
+		s.MemoryStats.Limit = hostMemory()
+	}
+
+	f, err := os.Open(fmt.Sprintf("/proc/%d/net/dev", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if s.Networks, err = parseNetDev(f); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func blkioEntries(entries []cgroups.BlkioEntry) []types.BlkioStatEntry {
+	list := []types.BlkioStatEntry{}
+	for _, e := range entries {
+		list = append(list, types.BlkioStatEntry{Major: e.Major, Minor: e.Minor, Op: e.Op, Value: e.Value})
+	}
+	return list
+}
+
+// parseProcStat returns the time all CPUs of the host spent, in nanoseconds,
+// and the number of CPUs.
+func parseProcStat(r io.Reader) (uint64, uint32, error) {
+	var usage uint64
+	var cpus uint32
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if fields[0] != "cpu" {
+			cpus++
+			continue
+		}
+		if len(fields) < 8 {
+			return 0, 0, fmt.Errorf("invalid cpu line in /proc/stat: %s", s.Text())
+		}
+		// user, nice, system, idle, iowait, irq and softirq
+		for _, f := range fields[1:8] {
+			n, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid cpu line in /proc/stat: %s", s.Text())
+			}
+			usage += n
+		}
+	}
+	return usage * 1e9 / cgroups.UserHZ, cpus, s.Err()
+}
+
+// parseNetDev reads the counters of /proc/<pid>/net/dev, leaving out the
+// loopback interface.
+func parseNetDev(r io.Reader) (map[string]types.NetworkStats, error) {
+	networks := map[string]types.NetworkStats{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		parts := strings.SplitN(s.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(parts[0])
+		fields := strings.Fields(parts[1])
+		if name == "lo" || len(fields) < 16 {
+			continue
+		}
+		var n [16]uint64
+		for i := range n {
+			v, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid counters for %s in net/dev: %s", name, s.Text())
+			}
+			n[i] = v
+		}
+		networks[name] = types.NetworkStats{
+			RxBytes:   n[0],
+			RxPackets: n[1],
+			RxErrors:  n[2],
+			RxDropped: n[3],
+			TxBytes:   n[8],
+			TxPackets: n[9],
+			TxErrors:  n[10],
+			TxDropped: n[11],
+		}
+	}
+	return networks, s.Err()
+}
+
+// hostMemory is the memory limit reported for pods that are not limited.
+func hostMemory() uint64 {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, _ := strconv.ParseUint(fields[1], 10, 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
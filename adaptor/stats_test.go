@@ -0,0 +1,43 @@
+package adaptor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/huawei-openlab/harbour/api/types"
+)
+
+func TestParseProcStat(t *testing.T) {
+	usage, cpus, err := parseProcStat(strings.NewReader(`cpu  100 5 50 1000 10 1 2 0 0 0
+cpu0 50 2 25 500 5 1 1 0 0 0
+cpu1 50 3 25 500 5 0 1 0 0 0
+intr 12345
+ctxt 6789
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != 1168*1e7 {
+		t.Fatalf("expected a usage of %d, got %d", uint64(1168*1e7), usage)
+	}
+	if cpus != 2 {
+		t.Fatalf("expected 2 cpus, got %d", cpus)
+	}
+}
+
+func TestParseNetDev(t *testing.T) {
+	networks, err := parseNetDev(strings.NewReader(`Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    1024      10    0    0    0     0          0         0     1024      10    0    0    0     0       0          0
+  eth0:648 8 0 1 0 0 0 0 2048 16 2 0 0 0 0 0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]types.NetworkStats{
+		"eth0": {RxBytes: 648, RxPackets: 8, RxDropped: 1, TxBytes: 2048, TxPackets: 16, TxErrors: 2},
+	}
+	if len(networks) != 1 || networks["eth0"] != want["eth0"] {
+		t.Fatalf("expected %+v, got %+v", want, networks)
+	}
+}
@@ -0,0 +1,397 @@
+// Volumes and bind mounts for rkt pods. Named volumes are directories under
+// the state root that harbour mounts into pods as host volumes.
+
+package adaptor
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/api/listing"
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine"
+)
+
+const localVolumeDriver = "local"
+
+var (
+	volumeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+	// volumesLock serialises changes to the volumes directory.
+	volumesLock sync.Mutex
+)
+
+type volume struct {
+	Name      string
+	Driver    string
+	Labels    map[string]string
+	CreatedAt time.Time
+
+	// Anonymous volumes back the Volumes of a container config and are
+	// removed along with the container by docker rm -v.
+	Anonymous bool
+}
+
+func volumeRoot(name string) string {
+	return filepath.Join(engine.StateRoot, "volumes", name)
+}
+
+func (v *volume) mountpoint() string {
+	return filepath.Join(volumeRoot(v.Name), "_data")
+}
+
+func (v *volume) toAPI() *types.Volume {
+	labels := v.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return &types.Volume{
+		Name:       v.Name,
+		Driver:     v.Driver,
+		Mountpoint: v.mountpoint(),
+		Labels:     labels,
+		Scope:      "local",
+	}
+}
+
+func rktCmdVolumeCreate(w http.ResponseWriter, r *http.Request) error {
+	req := &types.VolumeCreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return fmt.Errorf("Bad parameter: %s", err)
+	}
+
+	v, err := createVolume(req.Name, req.Driver, req.DriverOpts, req.Labels, false)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(v.toAPI())
+}
+
+func rktCmdVolumeList(w http.ResponseWriter, r *http.Request) error {
+	opts, err := listing.ParseVolumeOptions(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	volumes, err := listVolumes()
+	if err != nil {
+		return err
+	}
+	var list []*types.Volume
+	for _, v := range volumes {
+		list = append(list, v.toAPI())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(&types.VolumesListResponse{
+		Volumes: listing.Volumes(list, opts, func(name string) bool {
+			return len(volumeUsers(name)) > 0
+		}),
+	})
+}
+
+func rktCmdVolumeInspect(w http.ResponseWriter, r *http.Request) error {
+	v, err := getVolume(volumeRef(r.URL.Path))
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v.toAPI())
+}
+
+func rktCmdVolumeRm(w http.ResponseWriter, r *http.Request) error {
+	if err := removeVolume(volumeRef(r.URL.Path)); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// volumeRef extracts the volume name of a /volumes/{name} path.
+func volumeRef(path string) string {
+	parts := strings.SplitN(path, "/volumes/", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return strings.Trim(parts[1], "/")
+}
+
+// createVolume creates the named volume, or returns it when it already
+// exists with the same driver. An empty name creates an anonymous volume.
+func createVolume(name, driver string, opts, labels map[string]string, anonymous bool) (*volume, error) {
+	if driver == "" {
+		driver = localVolumeDriver
+	}
+	if driver != localVolumeDriver {
+		return nil, fmt.Errorf("Bad parameter: volume driver %s is not supported on rkt", driver)
+	}
+	if len(opts) > 0 {
+		return nil, fmt.Errorf("Bad parameter: the %s volume driver takes no options on rkt", driver)
+	}
+	if name == "" {
+		name = randomID()
+		anonymous = true
+	} else if !volumeNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("Bad parameter: %q includes invalid characters for a local volume name, only %q are allowed", name, volumeNamePattern.String())
+	}
+
+	volumesLock.Lock()
+	defer volumesLock.Unlock()
+
+	if v, err := readVolume(name); err == nil {
+		if v.Driver != driver {
+			return nil, fmt.Errorf("Conflict: volume %s already exists with driver %s", name, v.Driver)
+		}
+		return v, nil
+	}
+
+	v := &volume{
+		Name:      name,
+		Driver:    driver,
+		Labels:    labels,
+		CreatedAt: time.Now().UTC(),
+		Anonymous: anonymous,
+	}
+	if err := os.MkdirAll(v.mountpoint(), 0755); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(volumeRoot(name), "volume.json"), data, 0600); err != nil {
+		os.RemoveAll(volumeRoot(name))
+		return nil, err
+	}
+	eventLog.LogVolume("create", name, driver)
+	return v, nil
+}
+
+func readVolume(name string) (*volume, error) {
+	data, err := ioutil.ReadFile(filepath.Join(volumeRoot(name), "volume.json"))
+	if err != nil {
+		return nil, err
+	}
+	v := &volume{}
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func getVolume(name string) (*volume, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("No such volume: %s", name)
+	}
+	volumesLock.Lock()
+	defer volumesLock.Unlock()
+	v, err := readVolume(name)
+	if err != nil {
+		return nil, fmt.Errorf("No such volume: %s", name)
+	}
+	return v, nil
+}
+
+func listVolumes() ([]*volume, error) {
+	volumesLock.Lock()
+	defer volumesLock.Unlock()
+
+	dirs, err := ioutil.ReadDir(filepath.Join(engine.StateRoot, "volumes"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var list []*volume
+	for _, d := range dirs {
+		v, err := readVolume(d.Name())
+		if err != nil {
+			logrus.Warnf("Skipping volume %s: %s", d.Name(), err)
+			continue
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// volumeUsers returns the IDs of the containers that mount the volume.
+func volumeUsers(name string) []string {
+	var ids []string
+	for _, c := range store.list() {
+		for _, m := range c.Mounts {
+			if m.Name == name {
+				ids = append(ids, c.ID)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+func removeVolume(name string) error {
+	v, err := getVolume(name)
+	if err != nil {
+		return err
+	}
+	if users := volumeUsers(name); len(users) > 0 {
+		return fmt.Errorf("Conflict: unable to remove volume %s: volume is in use - %v", name, users)
+	}
+
+	volumesLock.Lock()
+	defer volumesLock.Unlock()
+	if err := os.RemoveAll(volumeRoot(name)); err != nil {
+		return err
+	}
+	eventLog.LogVolume("destroy", name, v.Driver)
+	return nil
+}
+
+// parseBind reads a docker bind, "source:destination[:mode]". Sources that
+// are not absolute paths name a volume.
+func parseBind(bind string) (types.MountPoint, error) {
+	m := types.MountPoint{RW: true}
+	parts := strings.Split(bind, ":")
+	switch len(parts) {
+	case 2:
+	case 3:
+		m.Mode = parts[2]
+		for _, mode := range strings.Split(parts[2], ",") {
+			switch mode {
+			case "ro":
+				m.RW = false
+			case "rw", "z", "Z":
+			default:
+				return m, fmt.Errorf("Bad parameter: invalid mode %s in bind %s", mode, bind)
+			}
+		}
+	default:
+		return m, fmt.Errorf("Bad parameter: invalid volume specification: %s", bind)
+	}
+
+	if parts[0] == "" || !filepath.IsAbs(parts[1]) {
+		return m, fmt.Errorf("Bad parameter: invalid volume specification: %s", bind)
+	}
+	m.Destination = filepath.Clean(parts[1])
+	if filepath.IsAbs(parts[0]) {
+		m.Source = filepath.Clean(parts[0])
+	} else {
+		m.Name = parts[0]
+	}
+	return m, nil
+}
+
+// containerMounts resolves the binds and volumes of config, creating the
+// volumes that do not exist yet.
+func containerMounts(config *types.ContainerConfig) ([]types.MountPoint, []string, error) {
+	var binds []string
+	driver := ""
+	if hc := config.HostConfig; hc != nil {
+		binds = hc.Binds
+		driver = hc.VolumeDriver
+	}
+
+	var mounts []types.MountPoint
+	var warnings []string
+	targets := map[string]bool{}
+	for _, bind := range binds {
+		m, err := parseBind(bind)
+		if err != nil {
+			return nil, nil, err
+		}
+		if targets[m.Destination] {
+			return nil, nil, fmt.Errorf("Bad parameter: duplicate mount point %s", m.Destination)
+		}
+		targets[m.Destination] = true
+		if strings.ContainsAny(m.Mode, "zZ") {
+			warnings = append(warnings, fmt.Sprintf("SELinux relabeling of %s is not supported on rkt", m.Destination))
+		}
+		mounts = append(mounts, m)
+	}
+	for dest := range config.Volumes {
+		if !filepath.IsAbs(dest) {
+			return nil, nil, fmt.Errorf("Bad parameter: invalid volume destination %s", dest)
+		}
+		if !targets[filepath.Clean(dest)] {
+			targets[filepath.Clean(dest)] = true
+			mounts = append(mounts, types.MountPoint{Destination: filepath.Clean(dest), RW: true})
+		}
+	}
+
+	for i := range mounts {
+		m := &mounts[i]
+		if m.Source != "" {
+			if err := os.MkdirAll(m.Source, 0755); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		v, err := createVolume(m.Name, driver, nil, nil, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		m.Name = v.Name
+		m.Driver = v.Driver
+		m.Source = v.mountpoint()
+	}
+	for _, m := range mounts {
+		if strings.Contains(m.Source, ",") || strings.Contains(m.Destination, ",") {
+			return nil, nil, fmt.Errorf("Bad parameter: rkt cannot mount paths containing commas: %s:%s", m.Source, m.Destination)
+		}
+	}
+
+	return mounts, warnings, nil
+}
+
+// rktMountArgs turns mounts into the --volume and --mount options of rkt
+// prepare.
+func rktMountArgs(mounts []types.MountPoint) []string {
+	var args []string
+	for i, m := range mounts {
+		name := fmt.Sprintf("vol-%d", i)
+		args = append(args,
+			fmt.Sprintf("--volume=%s,kind=host,source=%s,readOnly=%t", name, m.Source, !m.RW),
+			fmt.Sprintf("--mount=volume=%s,target=%s", name, m.Destination))
+	}
+	return args
+}
+
+// removeAnonymousVolumes removes the anonymous volumes mounted by c once no
+// other container uses them.
+func removeAnonymousVolumes(c *Container) {
+	for _, m := range c.Mounts {
+		if m.Name == "" {
+			continue
+		}
+		v, err := getVolume(m.Name)
+		if err != nil || !v.Anonymous {
+			continue
+		}
+		if err := removeVolume(m.Name); err != nil {
+			logrus.Warnf("Failed to remove volume %s: %s", m.Name, err)
+		}
+	}
+}
+
+func randomID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
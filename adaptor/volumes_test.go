@@ -0,0 +1,30 @@
+package adaptor
+
+import (
+	"testing"
+
+	"github.com/huawei-openlab/harbour/api/types"
+)
+
+func TestParseBind(t *testing.T) {
+	for bind, want := range map[string]types.MountPoint{
+		"/srv/data:/data":         {Source: "/srv/data", Destination: "/data", RW: true},
+		"/srv/data/:/data/:ro":    {Source: "/srv/data", Destination: "/data", Mode: "ro"},
+		"pgdata:/var/lib/pg":      {Name: "pgdata", Destination: "/var/lib/pg", RW: true},
+		"pgdata:/var/lib/pg:z,rw": {Name: "pgdata", Destination: "/var/lib/pg", Mode: "z,rw", RW: true},
+	} {
+		m, err := parseBind(bind)
+		if err != nil {
+			t.Fatalf("%s: %s", bind, err)
+		}
+		if m != want {
+			t.Fatalf("%s: expected %+v, got %+v", bind, want, m)
+		}
+	}
+
+	for _, bind := range []string{"/data", "data:relative", ":/data", "/a:/b:rx", "/a:/b:ro:rw"} {
+		if _, err := parseBind(bind); err == nil {
+			t.Fatalf("%s: expected an error", bind)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Package client is the harbour command line client. It talks to the daemon
+// over its docker API and its admin API, whatever the runtime behind it.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	hclient "github.com/huawei-openlab/harbour/client"
+	"github.com/huawei-openlab/harbour/mflag"
+)
+
+// Command describes a command of the client.
+type Command struct {
+	Name        string
+	Description string
+}
+
+// Commands lists the commands of the client, for the usage of harbour.
+var Commands = []Command{
+	{"exec", "Run a command in a running container"},
+	{"images", "List images"},
+	{"info", "Display information about the daemon"},
+	{"logs", "Fetch the logs of a container"},
+	{"ps", "List containers"},
+	{"pull", "Pull an image"},
+	{"rm", "Remove one or more containers"},
+	{"run", "Run a command in a new container"},
+	{"runtimes", "List the runtimes of the daemon"},
+}
+
+// ErrHelp is returned by the commands that only printed their usage.
+var ErrHelp = errors.New("help requested")
+
+// StatusError reports the exit status a command should end harbour with.
+type StatusError struct {
+	Status     string
+	StatusCode int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("Status: %s, Code: %d", e.Status, e.StatusCode)
+}
+
+// HarbourCli runs the commands of the client against a daemon.
+type HarbourCli struct {
+	in  io.ReadCloser
+	out io.Writer
+	err io.Writer
+
+	api *hclient.Client
+
+	// runtime is the runtime of the daemon, for the items that do not name
+	// theirs.
+	runtime string
+}
+
+// NewHarbourCli creates a client of the daemon listening on proto://addr.
+// tlsConfig is used for TCP addresses when set.
+func NewHarbourCli(in io.ReadCloser, out, err io.Writer, proto, addr string, tlsConfig *tls.Config) (*HarbourCli, error) {
+	api, e := hclient.New(proto+"://"+addr, tlsConfig)
+	if e != nil {
+		return nil, e
+	}
+	return &HarbourCli{in: in, out: out, err: err, api: api}, nil
+}
+
+func (cli *HarbourCli) commands() map[string]func(args ...string) error {
+	return map[string]func(args ...string) error{
+		"exec":     cli.CmdExec,
+		"images":   cli.CmdImages,
+		"info":     cli.CmdInfo,
+		"logs":     cli.CmdLogs,
+		"ps":       cli.CmdPs,
+		"pull":     cli.CmdPull,
+		"rm":       cli.CmdRm,
+		"run":      cli.CmdRun,
+		"runtimes": cli.CmdRuntimes,
+	}
+}
+
+// Cmd runs the command named by args[0] with the rest of args.
+func (cli *HarbourCli) Cmd(args ...string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command given")
+	}
+	cmd, ok := cli.commands()[args[0]]
+	if !ok {
+		names := []string{}
+		for name := range cli.commands() {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("harbour: '%s' is not a harbour command, see 'harbour --help'. Commands: %s", args[0], strings.Join(names, ", "))
+	}
+	return cmd(args[1:]...)
+}
+
+// Subcmd creates the flags of a command, with its usage.
+func (cli *HarbourCli) Subcmd(name, signature, description string) *mflag.FlagSet {
+	flags := mflag.NewFlagSet(name, mflag.ContinueOnError)
+	flags.SetOutput(cli.err)
+	flags.Usage = func() {
+		fmt.Fprintf(cli.out, "\nUsage: harbour %s [OPTIONS] %s\n\n%s\n\n", name, signature, description)
+		flags.SetOutput(cli.out)
+		flags.PrintDefaults()
+	}
+	flags.Bool([]string{"h", "-help"}, false, "Print usage")
+	return flags
+}
+
+// ParseFlags parses args into flags and checks the number of arguments
+// left. It returns ErrHelp once the usage is printed.
+func (cli *HarbourCli) ParseFlags(flags *mflag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		// mflag printed the error along with the usage.
+		return StatusError{StatusCode: 1}
+	}
+	if help := flags.Lookup("h"); help != nil && help.Value.String() == "true" {
+		flags.Usage()
+		return ErrHelp
+	}
+	if msg := flags.CheckArgs(); msg != "" {
+		fmt.Fprintf(cli.err, "harbour: %s.\nSee 'harbour %s --help'.\n", msg, flags.Name())
+		return StatusError{StatusCode: 1}
+	}
+	return nil
+}
+
+// Runtime returns the runtime of the daemon, asking it once.
+func (cli *HarbourCli) Runtime() string {
+	if cli.runtime == "" {
+		info, err := cli.api.Info(context.Background())
+		if err != nil || info.Runtime == "" {
+			cli.runtime = "unknown"
+		} else {
+			cli.runtime = info.Runtime
+		}
+	}
+	return cli.runtime
+}
+
+// runtimeOf returns the runtime an item of a listing names, or the one of
+// the daemon.
+func (cli *HarbourCli) runtimeOf(runtime string) string {
+	if runtime != "" {
+		return runtime
+	}
+	return cli.Runtime()
+}
+
+// isTerminal tells whether f is a terminal, as far as the client cares.
+func isTerminal(f interface{}) bool {
+	file, ok := f.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := file.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCli(t *testing.T, handler http.HandlerFunc) (*HarbourCli, *bytes.Buffer, func()) {
+	srv := httptest.NewServer(handler)
+	out := &bytes.Buffer{}
+	cli, err := NewHarbourCli(nil, out, out, "tcp", strings.TrimPrefix(srv.URL, "http://"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli, out, srv.Close
+}
+
+func TestPs(t *testing.T) {
+	created := time.Now().Add(-time.Hour).Unix()
+	cli, out, done := newTestCli(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/harbour/v1/info":
+			fmt.Fprint(w, `{"Version":"0.0.1","Runtime":"rkt"}`)
+		case "/containers/json":
+			if r.URL.Query().Get("all") != "1" {
+				t.Errorf("expected all containers, got %s", r.URL.RawQuery)
+			}
+			fmt.Fprintf(w, `[
+				{"Id":"0123456789abcdef","Names":["/web"],"Image":"nginx","Command":"nginx -g daemon off;","Created":%d,"Status":"Up 1 hour"},
+				{"Id":"fedcba9876543210","Names":["/db"],"Image":"postgres","Command":"postgres","Created":%d,"Status":"Exited (0)","Runtime":"docker"}
+			]`, created, created)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer done()
+
+	if err := cli.Cmd("ps", "-a"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], "RUNTIME") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+	if !strings.Contains(lines[1], "0123456789ab ") || !strings.HasSuffix(lines[1], "rkt") {
+		t.Errorf("expected the runtime of the daemon, got %s", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], "docker") {
+		t.Errorf("expected the runtime of the container, got %s", lines[2])
+	}
+
+	out.Reset()
+	if err := cli.Cmd("rm"); err == nil {
+		t.Fatal("expected rm without a container to fail")
+	}
+	if err := cli.Cmd("nope"); err == nil || !strings.Contains(err.Error(), "not a harbour command") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := cli.Cmd("ps", "--help"); err != ErrHelp {
+		t.Fatalf("expected the help, got %v", err)
+	}
+}
+
+func TestRunPullsMissingImages(t *testing.T) {
+	var calls []string
+	cli, out, done := newTestCli(t, func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch r.URL.Path {
+		case "/containers/create":
+			if len(calls) == 1 {
+				http.Error(w, "No such image: busybox", http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, `{"Id":"abc"}`)
+		case "/images/create":
+			if r.URL.RawQuery != "fromImage=busybox&tag=latest" {
+				t.Errorf("unexpected pull %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"status":"Pulling busybox"}`)
+		case "/containers/abc/start":
+			w.WriteHeader(http.StatusNoContent)
+		case "/containers/abc/logs":
+			w.Write([]byte{1, 0, 0, 0, 0, 0, 0, 3})
+			fmt.Fprint(w, "hi\n")
+		case "/containers/abc/wait":
+			fmt.Fprint(w, `{"StatusCode":3}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer done()
+
+	err := cli.Cmd("run", "-p", "127.0.0.1:8080:80", "busybox", "echo", "hi")
+	if sterr, ok := err.(StatusError); !ok || sterr.StatusCode != 3 {
+		t.Fatalf("expected the exit code of the container, got %v", err)
+	}
+	if !strings.Contains(out.String(), "Pulling busybox") || !strings.HasSuffix(out.String(), "hi\n") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+	want := "POST /containers/create,POST /images/create,POST /containers/create,POST /containers/abc/start,GET /containers/abc/logs,POST /containers/abc/wait"
+	if got := strings.Join(calls, ","); got != want {
+		t.Fatalf("unexpected calls %s", got)
+	}
+}
+
+func TestParsePort(t *testing.T) {
+	for p, want := range map[string]string{
+		"80":                  "80/tcp  ",
+		"8080:80":             "80/tcp  8080",
+		"127.0.0.1:53:53/udp": "53/udp 127.0.0.1 53",
+	} {
+		port, binding, err := parsePort(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := port + " " + binding.HostIP + " " + binding.HostPort; got != want {
+			t.Errorf("%s: expected %q, got %q", p, want, got)
+		}
+	}
+	for _, p := range []string{"", "http", "1:2:3:4", "99999"} {
+		if _, _, err := parsePort(p); err == nil {
+			t.Errorf("%s: expected an error", p)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	hclient "github.com/huawei-openlab/harbour/client"
+	"github.com/huawei-openlab/harbour/mflag"
+)
+
+// CmdExec runs a command in a running container.
+//
+// Usage: harbour exec [OPTIONS] CONTAINER COMMAND [ARG...]
+func (cli *HarbourCli) CmdExec(args ...string) error {
+	cmd := cli.Subcmd("exec", "CONTAINER COMMAND [ARG...]", "Run a command in a running container")
+	detach := cmd.Bool([]string{"d", "-detach"}, false, "Detached mode: run command in the background")
+	interactive := cmd.Bool([]string{"i", "-interactive"}, false, "Keep STDIN open even if not attached")
+	tty := cmd.Bool([]string{"t", "-tty"}, false, "Allocate a pseudo-TTY")
+	cmd.Require(mflag.Min, 2)
+	if err := cli.ParseFlags(cmd, args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	id, err := cli.api.ExecCreate(ctx, cmd.Arg(0), &hclient.ExecConfig{
+		AttachStdin:  *interactive && !*detach,
+		AttachStdout: !*detach,
+		AttachStderr: !*detach,
+		Tty:          *tty,
+		Cmd:          cmd.Args()[1:],
+	})
+	if err != nil {
+		return err
+	}
+	if *detach {
+		return cli.api.ExecStartDetached(ctx, id)
+	}
+
+	var stdin io.Reader
+	if *interactive {
+		stdin = cli.in
+		if *tty && isTerminal(cli.in) {
+			restore, err := setRawTerminal(cli.in.(*os.File))
+			if err != nil {
+				return err
+			}
+			defer restore()
+		}
+	}
+	resp, err := cli.api.ExecStart(ctx, id, *tty)
+	if err != nil {
+		return err
+	}
+	if err := cli.stream(resp, *tty, stdin); err != nil {
+		return err
+	}
+
+	_, exitCode, err := cli.api.ExecInspect(ctx, id)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return StatusError{Status: fmt.Sprintf("exit status %d", exitCode), StatusCode: exitCode}
+	}
+	return nil
+}
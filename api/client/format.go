@@ -0,0 +1,61 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// humanDuration describes d the way docker does, e.g. "5 minutes".
+func humanDuration(d time.Duration) string {
+	seconds := int(d.Seconds())
+	switch {
+	case seconds < 1:
+		return "Less than a second"
+	case seconds < 60:
+		return fmt.Sprintf("%d seconds", seconds)
+	case d.Minutes() < 60:
+		if m := int(d.Minutes()); m > 1 {
+			return fmt.Sprintf("%d minutes", m)
+		}
+		return "About a minute"
+	case d.Hours() < 48:
+		if h := int(d.Hours() + 0.5); h > 1 {
+			return fmt.Sprintf("%d hours", h)
+		}
+		return "About an hour"
+	case d.Hours() < 24*7*2:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	case d.Hours() < 24*365*2:
+		return fmt.Sprintf("%d weeks", int(d.Hours()/24/7))
+	}
+	return fmt.Sprintf("%d years", int(d.Hours()/24/365))
+}
+
+func since(unix int64) string {
+	return humanDuration(time.Since(time.Unix(unix, 0))) + " ago"
+}
+
+// humanSize describes size in decimal units, e.g. "1.2 MB".
+func humanSize(size int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	f := float64(size)
+	i := 0
+	for f >= 1000 && i < len(units)-1 {
+		f /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.4g %s", f, units[i])
+}
+
+// truncateID shortens the IDs docker and rkt give to the 12 characters
+// shown in listings.
+func truncateID(id string) string {
+	if i := strings.IndexAny(id, ":-"); i >= 0 && strings.HasPrefix(id, "sha") {
+		id = id[i+1:]
+	}
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return id
+}
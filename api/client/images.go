@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/huawei-openlab/harbour/mflag"
+)
+
+// CmdImages lists the images.
+//
+// Usage: harbour images [OPTIONS]
+func (cli *HarbourCli) CmdImages(args ...string) error {
+	cmd := cli.Subcmd("images", "", "List images")
+	all := cmd.Bool([]string{"a", "-all"}, false, "Show all images (default hides intermediate images)")
+	quiet := cmd.Bool([]string{"q", "-quiet"}, false, "Only show numeric IDs")
+	noTrunc := cmd.Bool([]string{"-no-trunc"}, false, "Don't truncate output")
+	cmd.Require(mflag.Exact, 0)
+	if err := cli.ParseFlags(cmd, args); err != nil {
+		return err
+	}
+
+	images, err := cli.api.ImageList(context.Background(), *all)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(cli.out, 20, 1, 3, ' ', 0)
+	if !*quiet {
+		fmt.Fprintln(w, "REPOSITORY\tTAG\tIMAGE ID\tCREATED\tSIZE\tRUNTIME")
+	}
+	for _, img := range images {
+		id := img.ID
+		if !*noTrunc {
+			id = truncateID(id)
+		}
+		if *quiet {
+			fmt.Fprintln(w, id)
+			continue
+		}
+		size := img.VirtualSize
+		if size == 0 {
+			size = img.Size
+		}
+		tags := img.RepoTags
+		if len(tags) == 0 {
+			tags = []string{"<none>:<none>"}
+		}
+		for _, tag := range tags {
+			repo, t := tag, "<none>"
+			if i := strings.LastIndex(tag, ":"); i > strings.LastIndex(tag, "/") {
+				repo, t = tag[:i], tag[i+1:]
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", repo, t, id, since(img.Created), humanSize(size),
+				cli.runtimeOf(img.Runtime))
+		}
+	}
+	return w.Flush()
+}
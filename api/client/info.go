@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/huawei-openlab/harbour/mflag"
+)
+
+// CmdInfo displays information about the daemon.
+//
+// Usage: harbour info
+func (cli *HarbourCli) CmdInfo(args ...string) error {
+	cmd := cli.Subcmd("info", "", "Display information about the daemon")
+	cmd.Require(mflag.Exact, 0)
+	if err := cli.ParseFlags(cmd, args); err != nil {
+		return err
+	}
+
+	info, err := cli.api.Info(context.Background())
+	if err != nil {
+		return err
+	}
+	health := "healthy"
+	if !info.Backend.Healthy {
+		health = "unhealthy: " + info.Backend.Error
+	}
+	fmt.Fprintf(cli.out, "Version: %s\n", info.Version)
+	fmt.Fprintf(cli.out, "Uptime: %s\n", info.Uptime)
+	fmt.Fprintf(cli.out, "Runtime: %s (%s)\n", info.Runtime, health)
+	if info.ConfigFile != "" {
+		fmt.Fprintf(cli.out, "Config file: %s\n", info.ConfigFile)
+	}
+	return nil
+}
+
+// CmdRuntimes lists the runtimes of the daemon.
+//
+// Usage: harbour runtimes
+func (cli *HarbourCli) CmdRuntimes(args ...string) error {
+	cmd := cli.Subcmd("runtimes", "", "List the runtimes of the daemon")
+	cmd.Require(mflag.Exact, 0)
+	if err := cli.ParseFlags(cmd, args); err != nil {
+		return err
+	}
+
+	runtimes, err := cli.api.RuntimeStatuses(context.Background())
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(cli.out, 10, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tACTIVE\tAVAILABLE\tPATH")
+	for _, rt := range runtimes {
+		fmt.Fprintf(w, "%s\t%t\t%t\t%s\n", rt.Name, rt.Active, rt.Available, rt.Path)
+	}
+	return w.Flush()
+}
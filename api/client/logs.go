@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	hclient "github.com/huawei-openlab/harbour/client"
+	"github.com/huawei-openlab/harbour/mflag"
+)
+
+// CmdLogs fetches the logs of a container.
+//
+// Usage: harbour logs [OPTIONS] CONTAINER
+func (cli *HarbourCli) CmdLogs(args ...string) error {
+	cmd := cli.Subcmd("logs", "CONTAINER", "Fetch the logs of a container")
+	follow := cmd.Bool([]string{"f", "-follow"}, false, "Follow log output")
+	timestamps := cmd.Bool([]string{"t", "-timestamps"}, false, "Show timestamps")
+	tail := cmd.String([]string{"-tail"}, "all", "Number of lines to show from the end of the logs")
+	since := cmd.String([]string{"-since"}, "", "Show logs since timestamp")
+	cmd.Require(mflag.Exact, 1)
+	if err := cli.ParseFlags(cmd, args); err != nil {
+		return err
+	}
+	sinceTime, err := parseSince(*since)
+	if err != nil {
+		return err
+	}
+
+	c, err := cli.api.ContainerInspect(context.Background(), cmd.Arg(0))
+	if err != nil {
+		return err
+	}
+	return cli.logs(c.ID, c.Config != nil && c.Config.Tty, hclient.LogsOptions{
+		Follow:     *follow,
+		Timestamps: *timestamps,
+		Tail:       *tail,
+		Since:      sinceTime,
+	})
+}
+
+// logs copies the logs of container id to the outputs of the client.
+func (cli *HarbourCli) logs(id string, tty bool, options hclient.LogsOptions) error {
+	options.Stdout, options.Stderr = true, true
+	rc, err := cli.api.ContainerLogs(context.Background(), id, options)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return cli.copyOutput(rc, tty)
+}
+
+// parseSince reads the --since of logs, a unix timestamp or an RFC 3339
+// date.
+func parseSince(since string) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if s, err := strconv.ParseInt(since, 10, 64); err == nil {
+		return time.Unix(s, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %s, expected a timestamp or an RFC 3339 date", since)
+	}
+	return t, nil
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/huawei-openlab/harbour/mflag"
+)
+
+// CmdPs lists the containers.
+//
+// Usage: harbour ps [OPTIONS]
+func (cli *HarbourCli) CmdPs(args ...string) error {
+	cmd := cli.Subcmd("ps", "", "List containers")
+	all := cmd.Bool([]string{"a", "-all"}, false, "Show all containers (default shows just running)")
+	quiet := cmd.Bool([]string{"q", "-quiet"}, false, "Only display numeric IDs")
+	noTrunc := cmd.Bool([]string{"-no-trunc"}, false, "Don't truncate output")
+	cmd.Require(mflag.Exact, 0)
+	if err := cli.ParseFlags(cmd, args); err != nil {
+		return err
+	}
+
+	containers, err := cli.api.ContainerList(context.Background(), *all)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(cli.out, 20, 1, 3, ' ', 0)
+	if !*quiet {
+		fmt.Fprintln(w, "CONTAINER ID\tIMAGE\tCOMMAND\tCREATED\tSTATUS\tNAMES\tRUNTIME")
+	}
+	for _, c := range containers {
+		id, command := c.ID, c.Command
+		if !*noTrunc {
+			id = truncateID(id)
+			if len(command) > 20 {
+				command = command[:19] + "…"
+			}
+		}
+		if *quiet {
+			fmt.Fprintln(w, id)
+			continue
+		}
+		names := []string{}
+		for _, name := range c.Names {
+			names = append(names, strings.TrimPrefix(name, "/"))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%q\t%s\t%s\t%s\t%s\n", id, c.Image, command, since(c.Created), c.Status,
+			strings.Join(names, ","), cli.runtimeOf(c.Runtime))
+	}
+	return w.Flush()
+}
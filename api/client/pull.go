@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	hclient "github.com/huawei-openlab/harbour/client"
+	"github.com/huawei-openlab/harbour/mflag"
+)
+
+// CmdPull pulls an image.
+//
+// Usage: harbour pull NAME[:TAG|@DIGEST]
+func (cli *HarbourCli) CmdPull(args ...string) error {
+	cmd := cli.Subcmd("pull", "NAME[:TAG|@DIGEST]", "Pull an image from a registry")
+	cmd.Require(mflag.Exact, 1)
+	if err := cli.ParseFlags(cmd, args); err != nil {
+		return err
+	}
+	return cli.pull(cmd.Arg(0))
+}
+
+func (cli *HarbourCli) pull(ref string) error {
+	return cli.api.ImagePull(context.Background(), ref, func(m hclient.JSONMessage) {
+		switch {
+		case m.Stream != "":
+			fmt.Fprint(cli.out, m.Stream)
+		case m.ID != "":
+			fmt.Fprintf(cli.out, "%s: %s %s\n", m.ID, m.Status, m.Progress)
+		case m.Status != "":
+			fmt.Fprintln(cli.out, m.Status)
+		}
+	})
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/huawei-openlab/harbour/mflag"
+)
+
+// CmdRm removes containers.
+//
+// Usage: harbour rm [OPTIONS] CONTAINER [CONTAINER...]
+func (cli *HarbourCli) CmdRm(args ...string) error {
+	cmd := cli.Subcmd("rm", "CONTAINER [CONTAINER...]", "Remove one or more containers")
+	force := cmd.Bool([]string{"f", "-force"}, false, "Force the removal of a running container")
+	volumes := cmd.Bool([]string{"v", "-volumes"}, false, "Remove the anonymous volumes of the container")
+	cmd.Require(mflag.Min, 1)
+	if err := cli.ParseFlags(cmd, args); err != nil {
+		return err
+	}
+
+	var failed bool
+	for _, name := range cmd.Args() {
+		if err := cli.api.ContainerRemove(context.Background(), name, *force, *volumes); err != nil {
+			fmt.Fprintln(cli.err, err)
+			failed = true
+			continue
+		}
+		fmt.Fprintln(cli.out, name)
+	}
+	if failed {
+		return StatusError{StatusCode: 1}
+	}
+	return nil
+}
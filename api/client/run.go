@@ -0,0 +1,197 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/huawei-openlab/harbour/api/types"
+	hclient "github.com/huawei-openlab/harbour/client"
+	"github.com/huawei-openlab/harbour/mflag"
+	"github.com/huawei-openlab/harbour/opts"
+)
+
+// CmdRun runs a command in a new container.
+//
+// Usage: harbour run [OPTIONS] IMAGE [COMMAND] [ARG...]
+func (cli *HarbourCli) CmdRun(args ...string) error {
+	cmd := cli.Subcmd("run", "IMAGE [COMMAND] [ARG...]", "Run a command in a new container")
+	detach := cmd.Bool([]string{"d", "-detach"}, false, "Run container in background and print container ID")
+	interactive := cmd.Bool([]string{"i", "-interactive"}, false, "Keep STDIN open even if not attached")
+	tty := cmd.Bool([]string{"t", "-tty"}, false, "Allocate a pseudo-TTY")
+	name := cmd.String([]string{"-name"}, "", "Assign a name to the container")
+	autoRemove := cmd.Bool([]string{"-rm"}, false, "Automatically remove the container when it exits")
+	restart := cmd.String([]string{"-restart"}, "", "Restart policy to apply when a container exits")
+	memory := cmd.String([]string{"m", "-memory"}, "", "Memory limit")
+	env := opts.NewListOpts(nil)
+	cmd.Var(&env, []string{"e", "-env"}, "Set environment variables")
+	volumes := opts.NewListOpts(nil)
+	cmd.Var(&volumes, []string{"v", "-volume"}, "Bind mount a volume")
+	ports := opts.NewListOpts(nil)
+	cmd.Var(&ports, []string{"p", "-publish"}, "Publish a container's port(s) to the host")
+	labels := opts.NewListOpts(nil)
+	cmd.Var(&labels, []string{"l", "-label"}, "Set meta data on a container")
+	cmd.Require(mflag.Min, 1)
+	if err := cli.ParseFlags(cmd, args); err != nil {
+		return err
+	}
+	if *detach && *autoRemove {
+		return fmt.Errorf("Conflicting options: --rm and -d")
+	}
+
+	config := &types.ContainerConfig{
+		Image:        cmd.Arg(0),
+		Cmd:          cmd.Args()[1:],
+		Env:          env.GetAll(),
+		Tty:          *tty,
+		OpenStdin:    *interactive,
+		StdinOnce:    *interactive,
+		AttachStdin:  *interactive && !*detach,
+		AttachStdout: !*detach,
+		AttachStderr: !*detach,
+		Labels:       map[string]string{},
+		ExposedPorts: map[string]struct{}{},
+		HostConfig: &types.HostConfig{
+			Binds:        volumes.GetAll(),
+			PortBindings: map[string][]types.PortBinding{},
+		},
+	}
+	for _, l := range labels.GetAll() {
+		kv := strings.SplitN(l, "=", 2)
+		config.Labels[kv[0]] = ""
+		if len(kv) == 2 {
+			config.Labels[kv[0]] = kv[1]
+		}
+	}
+	for _, p := range ports.GetAll() {
+		port, binding, err := parsePort(p)
+		if err != nil {
+			return err
+		}
+		config.ExposedPorts[port] = struct{}{}
+		config.HostConfig.PortBindings[port] = append(config.HostConfig.PortBindings[port], binding)
+	}
+	if *restart != "" {
+		parts := strings.SplitN(*restart, ":", 2)
+		config.HostConfig.RestartPolicy.Name = parts[0]
+		if len(parts) == 2 {
+			n, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return fmt.Errorf("invalid restart policy %s", *restart)
+			}
+			config.HostConfig.RestartPolicy.MaximumRetryCount = n
+		}
+	}
+	if *memory != "" {
+		m, err := opts.ParseSize(*memory)
+		if err != nil {
+			return err
+		}
+		config.HostConfig.Memory = m
+	}
+
+	id, err := cli.create(config, *name)
+	if err != nil {
+		return err
+	}
+
+	// Attach before the start not to miss the first output.
+	ctx := context.Background()
+	attached := make(chan error, 1)
+	if *interactive && !*detach {
+		resp, err := cli.api.ContainerAttach(ctx, id, hclient.AttachOptions{Stdin: true, Stdout: true, Stderr: true})
+		if err != nil {
+			return err
+		}
+		restore := func() {}
+		if *tty && isTerminal(cli.in) {
+			if restore, err = setRawTerminal(cli.in.(*os.File)); err != nil {
+				resp.Close()
+				return err
+			}
+		}
+		go func() {
+			defer restore()
+			attached <- cli.stream(resp, *tty, cli.in)
+		}()
+	}
+	if err := cli.api.ContainerStart(ctx, id); err != nil {
+		return err
+	}
+	if *detach {
+		fmt.Fprintln(cli.out, id)
+		return nil
+	}
+	if *interactive {
+		if err := <-attached; err != nil {
+			return err
+		}
+	} else if err := cli.logs(id, *tty, hclient.LogsOptions{Follow: true}); err != nil {
+		return err
+	}
+
+	status, err := cli.api.ContainerWait(ctx, id)
+	if err != nil {
+		return err
+	}
+	if *autoRemove {
+		if err := cli.api.ContainerRemove(ctx, id, false, true); err != nil {
+			return err
+		}
+	}
+	if status != 0 {
+		return StatusError{StatusCode: status}
+	}
+	return nil
+}
+
+// create creates a container, pulling its image first if needed.
+func (cli *HarbourCli) create(config *types.ContainerConfig, name string) (string, error) {
+	ctx := context.Background()
+	resp, err := cli.api.ContainerCreate(ctx, name, config)
+	if hclient.IsNotFound(err) && strings.Contains(err.Error(), "No such image") {
+		fmt.Fprintf(cli.err, "Unable to find image '%s' locally\n", config.Image)
+		if err := cli.pull(config.Image); err != nil {
+			return "", err
+		}
+		resp, err = cli.api.ContainerCreate(ctx, name, config)
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, warning := range resp.Warnings {
+		fmt.Fprintf(cli.err, "WARNING: %s\n", warning)
+	}
+	return resp.ID, nil
+}
+
+// parsePort reads a port to publish: [[ip:]hostPort:]containerPort[/proto].
+func parsePort(p string) (string, types.PortBinding, error) {
+	var binding types.PortBinding
+	proto := "tcp"
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		p, proto = p[:i], p[i+1:]
+	}
+	parts := strings.Split(p, ":")
+	switch len(parts) {
+	case 1:
+	case 2:
+		binding.HostPort = parts[0]
+	case 3:
+		binding.HostIP, binding.HostPort = parts[0], parts[1]
+	default:
+		return "", binding, fmt.Errorf("invalid port %s", p)
+	}
+	port := parts[len(parts)-1]
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", binding, fmt.Errorf("invalid port %s", p)
+	}
+	if binding.HostPort != "" {
+		if _, err := strconv.ParseUint(binding.HostPort, 10, 16); err != nil {
+			return "", binding, fmt.Errorf("invalid port %s", p)
+		}
+	}
+	return port + "/" + proto, binding, nil
+}
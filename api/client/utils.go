@@ -0,0 +1,30 @@
+package client
+
+import (
+	"io"
+
+	hclient "github.com/huawei-openlab/harbour/client"
+)
+
+// stream wires the connection resp took over to the streams of the client,
+// copying stdin to the container if not nil, until its output ends.
+func (cli *HarbourCli) stream(resp *hclient.HijackedResponse, tty bool, stdin io.Reader) error {
+	defer resp.Close()
+	if stdin != nil {
+		go func() {
+			io.Copy(resp.Conn, stdin)
+			resp.CloseWrite()
+		}()
+	}
+	return cli.copyOutput(resp.Reader, tty)
+}
+
+// copyOutput copies the output r of a container to the outputs of the
+// client, split into stdout and stderr unless the container has a tty.
+func (cli *HarbourCli) copyOutput(r io.Reader, tty bool) error {
+	if tty {
+		_, err := io.Copy(cli.out, r)
+		return err
+	}
+	return hclient.StdCopy(cli.out, cli.err, r)
+}
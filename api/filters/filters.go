@@ -0,0 +1,95 @@
+// Package filters parses the filters query parameter of the Docker remote API.
+package filters
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Args maps a filter name to the values it accepts.
+type Args map[string][]string
+
+// FromParam decodes the filters parameter. Both the legacy
+// {"name":["value"]} and the newer {"name":{"value":true}} forms are accepted.
+func FromParam(p string) (Args, error) {
+	args := Args{}
+	if p == "" {
+		return args, nil
+	}
+
+	if err := json.Unmarshal([]byte(p), &args); err == nil {
+		return args, nil
+	}
+
+	sets := map[string]map[string]bool{}
+	if err := json.Unmarshal([]byte(p), &sets); err != nil {
+		return nil, fmt.Errorf("Bad parameter: invalid filters %s", p)
+	}
+	for name, values := range sets {
+		for v, ok := range values {
+			if ok {
+				args[name] = append(args[name], v)
+			}
+		}
+	}
+	return args, nil
+}
+
+// Get returns the values given for name.
+func (args Args) Get(name string) []string {
+	return args[name]
+}
+
+// Include tells whether a filter on name was given.
+func (args Args) Include(name string) bool {
+	_, ok := args[name]
+	return ok
+}
+
+// ExactMatch is true when no filter on name was given or one of its values
+// equals value.
+func (args Args) ExactMatch(name, value string) bool {
+	values, ok := args[name]
+	if !ok || len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// PrefixMatch is like ExactMatch but also accepts values that are a prefix
+// of value, the way short IDs are matched.
+func (args Args) PrefixMatch(name, value string) bool {
+	values, ok := args[name]
+	if !ok || len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if strings.HasPrefix(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate rejects filter names outside accepted.
+func (args Args) Validate(accepted ...string) error {
+	for name := range args {
+		found := false
+		for _, a := range accepted {
+			if a == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Bad parameter: invalid filter '%s'", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,440 @@
+// Package listing applies the options of docker ps, docker images and docker
+// volume ls to container, image and volume lists, whatever runtime they come
+// from.
+package listing
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/huawei-openlab/harbour/api/filters"
+	"github.com/huawei-openlab/harbour/api/types"
+)
+
+// ContainerOptions are the query parameters of GET /containers/json.
+type ContainerOptions struct {
+	All     bool
+	Limit   int
+	Since   string
+	Before  string
+	Size    bool
+	Filters filters.Args
+}
+
+// ImageOptions are the query parameters of GET /images/json.
+type ImageOptions struct {
+	All     bool
+	Filter  string
+	Filters filters.Args
+}
+
+// VolumeOptions are the query parameters of GET /volumes.
+type VolumeOptions struct {
+	Filters filters.Args
+}
+
+var containerStates = []string{"created", "restarting", "running", "paused", "exited", "dead"}
+
+func boolValue(v string) bool {
+	return v == "1" || strings.ToLower(v) == "true"
+}
+
+// ParseContainerOptions reads the options of docker ps from query.
+func ParseContainerOptions(query url.Values) (*ContainerOptions, error) {
+	opts := &ContainerOptions{
+		All:    boolValue(query.Get("all")),
+		Size:   boolValue(query.Get("size")),
+		Since:  query.Get("since"),
+		Before: query.Get("before"),
+		Limit:  -1,
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return nil, fmt.Errorf("Bad parameter: invalid limit %s", limit)
+		}
+		opts.Limit = n
+	}
+
+	args, err := filters.FromParam(query.Get("filters"))
+	if err != nil {
+		return nil, err
+	}
+	if err := args.Validate("status", "label", "name", "id", "ancestor", "before", "since", "exited"); err != nil {
+		return nil, err
+	}
+	for _, status := range args.Get("status") {
+		valid := false
+		for _, s := range containerStates {
+			valid = valid || s == status
+		}
+		if !valid {
+			return nil, fmt.Errorf("Bad parameter: unrecognised filter value for status: %s", status)
+		}
+	}
+	opts.Filters = args
+
+	return opts, nil
+}
+
+// ParseImageOptions reads the options of docker images from query.
+func ParseImageOptions(query url.Values) (*ImageOptions, error) {
+	args, err := filters.FromParam(query.Get("filters"))
+	if err != nil {
+		return nil, err
+	}
+	if err := args.Validate("dangling", "label", "before", "since", "reference"); err != nil {
+		return nil, err
+	}
+	for _, d := range args.Get("dangling") {
+		if d != "true" && d != "false" && d != "1" && d != "0" {
+			return nil, fmt.Errorf("Bad parameter: invalid filter 'dangling=%s'", d)
+		}
+	}
+	return &ImageOptions{
+		All:     boolValue(query.Get("all")),
+		Filter:  query.Get("filter"),
+		Filters: args,
+	}, nil
+}
+
+// ParseVolumeOptions reads the options of docker volume ls from query.
+func ParseVolumeOptions(query url.Values) (*VolumeOptions, error) {
+	args, err := filters.FromParam(query.Get("filters"))
+	if err != nil {
+		return nil, err
+	}
+	if err := args.Validate("dangling", "name", "driver", "label"); err != nil {
+		return nil, err
+	}
+	for _, d := range args.Get("dangling") {
+		if d != "true" && d != "false" && d != "1" && d != "0" {
+			return nil, fmt.Errorf("Bad parameter: invalid filter 'dangling=%s'", d)
+		}
+	}
+	return &VolumeOptions{Filters: args}, nil
+}
+
+// Containers returns the containers of list selected by opts, most recently
+// created first.
+func Containers(list []types.Container, opts *ContainerOptions) ([]types.Container, error) {
+	sorted := make([]types.Container, len(list))
+	copy(sorted, list)
+	sort.Sort(byCreated(sorted))
+
+	args := opts.Filters
+	if args == nil {
+		args = filters.Args{}
+	}
+
+	// Like docker, since and before bound the list by creation time of the
+	// container they name.
+	var since, before int64 = -1, -1
+	for _, ref := range append(args.Get("since"), opts.Since) {
+		if ref == "" {
+			continue
+		}
+		c, err := findContainer(sorted, ref)
+		if err != nil {
+			return nil, err
+		}
+		if c.Created > since {
+			since = c.Created
+		}
+	}
+	for _, ref := range append(args.Get("before"), opts.Before) {
+		if ref == "" {
+			continue
+		}
+		c, err := findContainer(sorted, ref)
+		if err != nil {
+			return nil, err
+		}
+		if before < 0 || c.Created < before {
+			before = c.Created
+		}
+	}
+
+	all := opts.All || opts.Limit > 0 || since >= 0 || before >= 0 || args.Include("status")
+	result := []types.Container{}
+	for _, c := range sorted {
+		if opts.Limit > 0 && len(result) == opts.Limit {
+			break
+		}
+		if !all && c.State != "running" {
+			continue
+		}
+		if since >= 0 && c.Created <= since {
+			continue
+		}
+		if before >= 0 && c.Created >= before {
+			continue
+		}
+		if !args.ExactMatch("status", c.State) {
+			continue
+		}
+		if !args.PrefixMatch("id", c.ID) {
+			continue
+		}
+		if !MatchLabels(args, c.Labels) || !matchNames(args, c.Names) || !matchAncestor(args, c) {
+			continue
+		}
+		if args.Include("exited") && (c.State != "exited" || !args.ExactMatch("exited", exitCode(c.Status))) {
+			continue
+		}
+		result = append(result, c)
+	}
+
+	return result, nil
+}
+
+// Images returns the images of list selected by opts, most recent first.
+func Images(list []types.Image, opts *ImageOptions) ([]types.Image, error) {
+	sorted := make([]types.Image, len(list))
+	copy(sorted, list)
+	sort.Sort(imagesByCreated(sorted))
+
+	args := opts.Filters
+	if args == nil {
+		args = filters.Args{}
+	}
+
+	var since, before int64 = -1, -1
+	for _, ref := range args.Get("since") {
+		img, err := findImage(sorted, ref)
+		if err != nil {
+			return nil, err
+		}
+		if img.Created > since {
+			since = img.Created
+		}
+	}
+	for _, ref := range args.Get("before") {
+		img, err := findImage(sorted, ref)
+		if err != nil {
+			return nil, err
+		}
+		if before < 0 || img.Created < before {
+			before = img.Created
+		}
+	}
+
+	result := []types.Image{}
+	for _, img := range sorted {
+		dangling := isDangling(img)
+		if args.Include("dangling") {
+			want := args.ExactMatch("dangling", "true") || args.ExactMatch("dangling", "1")
+			if dangling != want {
+				continue
+			}
+		} else if dangling && !opts.All {
+			continue
+		}
+		if since >= 0 && img.Created <= since {
+			continue
+		}
+		if before >= 0 && img.Created >= before {
+			continue
+		}
+		if !MatchLabels(args, img.Labels) {
+			continue
+		}
+		if opts.Filter != "" && !matchReference([]string{opts.Filter}, img.RepoTags) {
+			continue
+		}
+		if args.Include("reference") && !matchReference(args.Get("reference"), img.RepoTags) {
+			continue
+		}
+		result = append(result, img)
+	}
+
+	return result, nil
+}
+
+// Volumes returns the volumes of list selected by opts, sorted by name.
+// inUse tells whether a container refers to a volume.
+func Volumes(list []*types.Volume, opts *VolumeOptions, inUse func(name string) bool) []*types.Volume {
+	args := opts.Filters
+	if args == nil {
+		args = filters.Args{}
+	}
+
+	result := []*types.Volume{}
+	for _, v := range list {
+		if args.Include("dangling") {
+			want := args.ExactMatch("dangling", "true") || args.ExactMatch("dangling", "1")
+			if inUse(v.Name) == want {
+				continue
+			}
+		}
+		if !matchNames(args, []string{v.Name}) {
+			continue
+		}
+		if !args.ExactMatch("driver", v.Driver) {
+			continue
+		}
+		if !MatchLabels(args, v.Labels) {
+			continue
+		}
+		result = append(result, v)
+	}
+	sort.Sort(volumesByName(result))
+	return result
+}
+
+// MatchLabels accepts "key" and "key=value" label filters, all of which
+// must match.
+func MatchLabels(args filters.Args, labels map[string]string) bool {
+	for _, l := range args.Get("label") {
+		kv := strings.SplitN(l, "=", 2)
+		v, ok := labels[kv[0]]
+		if !ok || (len(kv) == 2 && v != kv[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchNames(args filters.Args, names []string) bool {
+	if !args.Include("name") {
+		return true
+	}
+	for _, want := range args.Get("name") {
+		for _, n := range names {
+			if strings.Contains(strings.TrimPrefix(n, "/"), strings.TrimPrefix(want, "/")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchAncestor(args filters.Args, c types.Container) bool {
+	if !args.Include("ancestor") {
+		return true
+	}
+	for _, a := range args.Get("ancestor") {
+		if a == c.Image || withTag(a) == withTag(c.Image) {
+			return true
+		}
+		if c.ImageID != "" && strings.HasPrefix(c.ImageID, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchReference matches repository tags against shell patterns, with or
+// without the tag part.
+func matchReference(patterns []string, repoTags []string) bool {
+	for _, p := range patterns {
+		for _, rt := range repoTags {
+			if ok, _ := path.Match(p, rt); ok {
+				return true
+			}
+			repo := rt
+			if i := strings.LastIndex(rt, ":"); i > strings.LastIndex(rt, "/") {
+				repo = rt[:i]
+			}
+			if ok, _ := path.Match(p, repo); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isDangling(img types.Image) bool {
+	if len(img.RepoTags) == 0 {
+		return true
+	}
+	return len(img.RepoTags) == 1 && img.RepoTags[0] == "<none>:<none>"
+}
+
+func findContainer(list []types.Container, ref string) (types.Container, error) {
+	for _, c := range list {
+		for _, n := range c.Names {
+			if strings.TrimPrefix(n, "/") == strings.TrimPrefix(ref, "/") {
+				return c, nil
+			}
+		}
+	}
+	for _, c := range list {
+		if strings.HasPrefix(c.ID, ref) {
+			return c, nil
+		}
+	}
+	return types.Container{}, fmt.Errorf("No such container: %s", ref)
+}
+
+func findImage(list []types.Image, ref string) (types.Image, error) {
+	for _, img := range list {
+		for _, rt := range img.RepoTags {
+			if rt == ref || rt == withTag(ref) {
+				return img, nil
+			}
+		}
+		if strings.HasPrefix(img.ID, ref) {
+			return img, nil
+		}
+	}
+	return types.Image{}, fmt.Errorf("No such image: %s", ref)
+}
+
+func withTag(image string) string {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image
+	}
+	return image + ":latest"
+}
+
+// exitCode extracts the code of an "Exited (code) ..." status.
+func exitCode(status string) string {
+	start := strings.Index(status, "(")
+	end := strings.Index(status, ")")
+	if start < 0 || end < start {
+		return ""
+	}
+	return status[start+1 : end]
+}
+
+// HumanDuration describes d the way docker statuses do, e.g. "5 minutes".
+func HumanDuration(d time.Duration) string {
+	switch seconds := int(d.Seconds()); {
+	case seconds < 1:
+		return "Less than a second"
+	case seconds < 60:
+		return fmt.Sprintf("%d seconds", seconds)
+	case d.Minutes() < 60:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	case d.Hours() < 48:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	case d.Hours() < 24*7*2:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	default:
+		return fmt.Sprintf("%d weeks", int(d.Hours()/24/7))
+	}
+}
+
+type byCreated []types.Container
+
+func (l byCreated) Len() int           { return len(l) }
+func (l byCreated) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byCreated) Less(i, j int) bool { return l[i].Created > l[j].Created }
+
+type imagesByCreated []types.Image
+
+func (l imagesByCreated) Len() int           { return len(l) }
+func (l imagesByCreated) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l imagesByCreated) Less(i, j int) bool { return l[i].Created > l[j].Created }
+
+type volumesByName []*types.Volume
+
+func (l volumesByName) Len() int           { return len(l) }
+func (l volumesByName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l volumesByName) Less(i, j int) bool { return l[i].Name < l[j].Name }
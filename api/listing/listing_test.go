@@ -0,0 +1,156 @@
+package listing
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/huawei-openlab/harbour/api/types"
+)
+
+var testContainers = []types.Container{
+	{ID: "aaaa1111", Names: []string{"/web"}, Image: "nginx", Created: 100, State: "running", Labels: map[string]string{"team": "a"}},
+	{ID: "bbbb2222", Names: []string{"/db"}, Image: "postgres:9.4", Created: 200, State: "exited", Status: "Exited (1) 2 minutes ago", Labels: map[string]string{"team": "b"}},
+	{ID: "cccc3333", Names: []string{"/cache"}, Image: "redis", Created: 300, State: "running", Labels: map[string]string{}},
+	{ID: "dddd4444", Names: []string{"/job"}, Image: "busybox", Created: 400, State: "created"},
+}
+
+func listIDs(t *testing.T, query string) []string {
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := ParseContainerOptions(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := Containers(testContainers, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, c := range list {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func TestContainers(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		ids   []string
+	}{
+		{"", []string{"cccc3333", "aaaa1111"}},
+		{"all=1", []string{"dddd4444", "cccc3333", "bbbb2222", "aaaa1111"}},
+		{"limit=2", []string{"dddd4444", "cccc3333"}},
+		{"since=web", []string{"dddd4444", "cccc3333", "bbbb2222"}},
+		{"before=cache", []string{"bbbb2222", "aaaa1111"}},
+		{`filters={"status":["exited"]}`, []string{"bbbb2222"}},
+		{`filters={"label":["team"]}&all=1`, []string{"bbbb2222", "aaaa1111"}},
+		{`filters={"label":["team=a"]}`, []string{"aaaa1111"}},
+		{`filters={"name":["ca"]}`, []string{"cccc3333"}},
+		{`filters={"id":["aaaa"]}`, []string{"aaaa1111"}},
+		{`filters={"ancestor":["postgres:9.4"]}&all=1`, []string{"bbbb2222"}},
+		{`filters={"ancestor":["nginx:latest"]}`, []string{"aaaa1111"}},
+		{`filters={"exited":["1"]}&all=1`, []string{"bbbb2222"}},
+		{`filters={"status":{"running":true}}`, []string{"cccc3333", "aaaa1111"}},
+	} {
+		ids := listIDs(t, tc.query)
+		if len(ids) != len(tc.ids) {
+			t.Fatalf("%s: expected %v, got %v", tc.query, tc.ids, ids)
+		}
+		for i := range ids {
+			if ids[i] != tc.ids[i] {
+				t.Fatalf("%s: expected %v, got %v", tc.query, tc.ids, ids)
+			}
+		}
+	}
+}
+
+func TestContainerOptionsErrors(t *testing.T) {
+	for _, query := range []string{
+		"limit=x",
+		`filters={"status":["sleeping"]}`,
+		`filters={"unknown":["x"]}`,
+		`filters=notjson`,
+	} {
+		q, _ := url.ParseQuery(query)
+		if _, err := ParseContainerOptions(q); err == nil {
+			t.Fatalf("%s: expected an error", query)
+		}
+	}
+}
+
+func TestImages(t *testing.T) {
+	images := []types.Image{
+		{ID: "sha512-1", RepoTags: []string{"registry.internal/app:1.0"}, Created: 100, Labels: map[string]string{"stage": "prod"}},
+		{ID: "sha512-2", RepoTags: []string{"<none>:<none>"}, Created: 200},
+		{ID: "sha512-3", RepoTags: []string{"busybox:latest"}, Created: 300},
+	}
+
+	for _, tc := range []struct {
+		query string
+		ids   []string
+	}{
+		{"", []string{"sha512-3", "sha512-1"}},
+		{"all=1", []string{"sha512-3", "sha512-2", "sha512-1"}},
+		{`filters={"dangling":["true"]}`, []string{"sha512-2"}},
+		{`filters={"label":["stage=prod"]}`, []string{"sha512-1"}},
+		{`filters={"reference":["registry.internal/*"]}`, []string{"sha512-1"}},
+		{`filters={"since":["registry.internal/app:1.0"]}`, []string{"sha512-3"}},
+		{"filter=busybox", []string{"sha512-3"}},
+	} {
+		q, _ := url.ParseQuery(tc.query)
+		opts, err := ParseImageOptions(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := Images(images, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != len(tc.ids) {
+			t.Fatalf("%s: expected %v, got %v", tc.query, tc.ids, list)
+		}
+		for i := range list {
+			if list[i].ID != tc.ids[i] {
+				t.Fatalf("%s: expected %v, got %v", tc.query, tc.ids, list)
+			}
+		}
+	}
+}
+
+func TestVolumes(t *testing.T) {
+	volumes := []*types.Volume{
+		{Name: "web-data", Driver: "local", Labels: map[string]string{"app": "web"}},
+		{Name: "db-data", Driver: "local"},
+		{Name: "scratch", Driver: "local"},
+	}
+	inUse := func(name string) bool { return name != "scratch" }
+
+	for _, tc := range []struct {
+		query string
+		names []string
+	}{
+		{"", []string{"db-data", "scratch", "web-data"}},
+		{`filters={"dangling":["true"]}`, []string{"scratch"}},
+		{`filters={"dangling":["false"]}`, []string{"db-data", "web-data"}},
+		{`filters={"name":["data"]}`, []string{"db-data", "web-data"}},
+		{`filters={"label":["app=web"]}`, []string{"web-data"}},
+		{`filters={"driver":["nfs"]}`, []string{}},
+	} {
+		q, _ := url.ParseQuery(tc.query)
+		opts, err := ParseVolumeOptions(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list := Volumes(volumes, opts, inUse)
+		if len(list) != len(tc.names) {
+			t.Fatalf("%s: expected %v, got %d volumes", tc.query, tc.names, len(list))
+		}
+		for i := range list {
+			if list[i].Name != tc.names[i] {
+				t.Fatalf("%s: expected %v, got %s at %d", tc.query, tc.names, list[i].Name, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/huawei-openlab/harbour/opts"
+)
+
+func init() {
+	Register("body-limit", newBodyLimit)
+}
+
+// bodyLimit rejects request bodies larger than max bytes. It should come
+// before the middlewares that read bodies.
+type bodyLimit struct {
+	max int64
+}
+
+func newBodyLimit(options json.RawMessage) (Middleware, error) {
+	var o struct {
+		Max string `json:"max"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if o.Max == "" {
+		return nil, fmt.Errorf("max is required")
+	}
+	max, err := opts.ParseSize(o.Max)
+	if err != nil {
+		return nil, err
+	}
+	return &bodyLimit{max: max}, nil
+}
+
+func (m *bodyLimit) Request(r *Request) error {
+	if r.ContentLength > m.max {
+		return fmt.Errorf("Request body too large: %d bytes, the limit is %d", r.ContentLength, m.max)
+	}
+	if r.Body != nil {
+		r.Body = &limitedBody{ReadCloser: r.Body, left: m.max, max: m.max}
+	}
+	return nil
+}
+
+func (m *bodyLimit) Response(r *Request, resp *Response) error {
+	return nil
+}
+
+// limitedBody fails the read of a body that goes over its limit, which
+// chunked bodies do not announce.
+type limitedBody struct {
+	io.ReadCloser
+	left int64
+	max  int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		// Tell an exact fit from a body that goes on.
+		var one [1]byte
+		if n, _ := b.ReadCloser.Read(one[:]); n > 0 {
+			return 0, fmt.Errorf("Request body too large, the limit is %d bytes", b.max)
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func init() {
+	Register("headers", newHeaders)
+}
+
+type headerRewrite struct {
+	Set    map[string]string `json:"set"`
+	Remove []string          `json:"remove"`
+}
+
+func (h *headerRewrite) apply(header http.Header) {
+	for _, name := range h.Remove {
+		header.Del(name)
+	}
+	for name, value := range h.Set {
+		header.Set(name, value)
+	}
+}
+
+// headers sets and removes headers of requests and responses.
+type headers struct {
+	OnRequest  headerRewrite `json:"request"`
+	OnResponse headerRewrite `json:"response"`
+}
+
+func newHeaders(options json.RawMessage) (Middleware, error) {
+	m := &headers{}
+	if err := decodeOptions(options, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *headers) Request(r *Request) error {
+	m.OnRequest.apply(r.Header)
+	return nil
+}
+
+func (m *headers) Response(r *Request, resp *Response) error {
+	m.OnResponse.apply(resp.Header)
+	return nil
+}
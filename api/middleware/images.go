@@ -0,0 +1,223 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/huawei-openlab/harbour/api/reference"
+)
+
+var imageCreate = regexp.MustCompile(`/images/create$`)
+
+func init() {
+	Register("images", newImages)
+}
+
+// images restricts the images pulled and run through harbour and points the
+// pulls at local mirrors.
+type images struct {
+	// Allow lists the images that may be used. Everything is allowed when
+	// it is empty.
+	Allow []*imageRule `json:"allow"`
+	// Mirrors maps registries to the mirror that serves their images, e.g.
+	// "docker.io" to "mirror.internal:5000".
+	Mirrors map[string]string `json:"mirrors"`
+	// Exempt callers are not held to Allow.
+	Exempt struct {
+		UIDs []uint32 `json:"uids"`
+		GIDs []uint32 `json:"gids"`
+	} `json:"exempt"`
+}
+
+// imageRule matches the images by glob, where * matches anything, or by
+// regular expression. Either is tried on the normalized name of the image,
+// e.g. docker.io/library/busybox, and on the full reference with its tag or
+// digest.
+type imageRule struct {
+	Glob  string `json:"glob"`
+	Regex string `json:"regex"`
+	// RequireDigest only allows the images pinned by digest.
+	RequireDigest bool `json:"requireDigest"`
+
+	re *regexp.Regexp
+}
+
+func newImages(options json.RawMessage) (Middleware, error) {
+	m := &images{}
+	if err := decodeOptions(options, m); err != nil {
+		return nil, err
+	}
+	for _, rule := range m.Allow {
+		var err error
+		switch {
+		case rule.Glob != "" && rule.Regex != "":
+			return nil, fmt.Errorf("a rule has either a glob or a regex")
+		case rule.Glob != "":
+			rule.re, err = regexp.Compile(globToRegexp(rule.Glob))
+		case rule.Regex != "":
+			rule.re, err = regexp.Compile(rule.Regex)
+		default:
+			return nil, fmt.Errorf("a rule needs a glob or a regex")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *images) Request(r *Request) error {
+	if r.Method != "POST" {
+		return nil
+	}
+	switch {
+	case imageCreate.MatchString(r.URL.Path):
+		q := r.URL.Query()
+		image := q.Get("fromImage")
+		if image == "" {
+			// Imports do not come from a registry.
+			return nil
+		}
+		if tag := q.Get("tag"); tag != "" {
+			if strings.Contains(tag, ":") {
+				image += "@" + tag
+			} else {
+				image += ":" + tag
+			}
+		}
+		ref, transport, err := m.check(r, image)
+		if err != nil || ref == nil {
+			return err
+		}
+		// Docker passes digests in the tag as well.
+		q.Set("fromImage", transport+ref.Name())
+		q.Set("tag", ref.Tag)
+		if ref.Digest != "" {
+			q.Set("tag", ref.Digest)
+		}
+		r.URL.RawQuery = q.Encode()
+	case containerCreate.MatchString(r.URL.Path):
+		body, err := r.JSON()
+		if err != nil || body == nil {
+			return err
+		}
+		image, _ := body["Image"].(string)
+		if image == "" {
+			return nil
+		}
+		ref, transport, err := m.check(r, image)
+		if err != nil || ref == nil {
+			return err
+		}
+		body["Image"] = transport + ref.String()
+	}
+	return nil
+}
+
+func (m *images) Response(r *Request, resp *Response) error {
+	return nil
+}
+
+// check tells whether the caller of r may use image. It returns the
+// reference on the mirror to pass to the backend instead, if any, and the rkt
+// transport image was given with, to keep on it.
+//
+// Images referred to by ID are already local and pass. Those rkt fetches by
+// URL or file come from no registry the rules could match, so they are only
+// allowed when there are no rules or for the exempt callers.
+func (m *images) check(r *Request, image string) (*reference.Reference, string, error) {
+	if reference.IsID(image) {
+		return nil, "", nil
+	}
+	if reference.IsRkt(image) {
+		return nil, "", m.permit(r, image, len(m.Allow) == 0)
+	}
+	var transport string
+	if strings.HasPrefix(image, reference.DockerTransport) {
+		transport = reference.DockerTransport
+	}
+	ref, err := reference.Parse(strings.TrimPrefix(image, transport))
+	if err != nil {
+		return nil, "", err
+	}
+	if err := m.permit(r, image, m.allowed(ref)); err != nil {
+		return nil, "", err
+	}
+	mirror, ok := m.Mirrors[ref.Domain]
+	if !ok {
+		return nil, "", nil
+	}
+	ref.Domain = strings.TrimSuffix(mirror, "/")
+	return &ref, transport, nil
+}
+
+// permit refuses image unless it is allowed or the caller of r is exempt.
+func (m *images) permit(r *Request, image string, allowed bool) error {
+	if allowed {
+		return nil
+	}
+	exempt, err := m.exempt(r)
+	if err != nil {
+		return err
+	}
+	if !exempt {
+		return fmt.Errorf("Forbidden by policy: image %s is not allowed", image)
+	}
+	return nil
+}
+
+func (m *images) allowed(ref reference.Reference) bool {
+	if len(m.Allow) == 0 {
+		return true
+	}
+	for _, rule := range m.Allow {
+		if !rule.re.MatchString(ref.Name()) && !rule.re.MatchString(ref.String()) {
+			continue
+		}
+		if rule.RequireDigest && ref.Digest == "" {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (m *images) exempt(r *Request) (bool, error) {
+	if len(m.Exempt.UIDs) == 0 && len(m.Exempt.GIDs) == 0 {
+		return false, nil
+	}
+	cred, err := r.Peer()
+	if err != nil || cred == nil {
+		return false, err
+	}
+	for _, uid := range m.Exempt.UIDs {
+		if cred.Uid == uid {
+			return true, nil
+		}
+	}
+	for _, gid := range m.Exempt.GIDs {
+		if cred.Gid == gid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, c := range glob {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestImages(t *testing.T) {
+	chain := newChain(t, `[{"name": "images", "options": {
+		"allow": [
+			{"glob": "registry.internal/*"},
+			{"regex": "^docker\\.io/library/(busybox|alpine)$"},
+			{"glob": "docker.io/library/nginx", "requireDigest": true}
+		],
+		"mirrors": {"docker.io": "mirror.internal:5000"}
+	}}]`)
+
+	var got *http.Request
+	next := func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}
+	pull := func(query string) int {
+		got = nil
+		req, _ := http.NewRequest("POST", "/v1.21/images/create?"+query, nil)
+		return serve(chain, next, req).Code
+	}
+
+	for query, want := range map[string]string{
+		"fromImage=busybox&tag=1":                                       "fromImage=mirror.internal%3A5000%2Flibrary%2Fbusybox&tag=1",
+		"fromImage=registry.internal%2Fteam%2Fapp":                      "fromImage=registry.internal%2Fteam%2Fapp",
+		"fromImage=docker%3A%2F%2Fbusybox":                              "fromImage=docker%3A%2F%2Fmirror.internal%3A5000%2Flibrary%2Fbusybox&tag=latest",
+		"fromImage=nginx&tag=sha256%3A0123456789abcdef0123456789abcdef": "fromImage=mirror.internal%3A5000%2Flibrary%2Fnginx&tag=sha256%3A0123456789abcdef0123456789abcdef",
+	} {
+		if code := pull(query); code != http.StatusOK {
+			t.Fatalf("%s: expected the pull to be allowed, got %d", query, code)
+		}
+		if got.URL.RawQuery != want {
+			t.Errorf("%s: expected %s, got %s", query, want, got.URL.RawQuery)
+		}
+	}
+	for _, query := range []string{
+		"fromImage=ubuntu",
+		"fromImage=nginx&tag=latest",
+		"fromImage=registry.internal.evil%2Fapp",
+		"fromImage=docker%3A%2F%2Fubuntu",
+		"fromImage=https%3A%2F%2Fregistry.internal%2Fapp.aci",
+		"fromImage=%2Ftmp%2Fapp.aci",
+		// Names that look like short IDs are pulled like any other.
+		"fromImage=deadbeefcafe",
+	} {
+		if code := pull(query); code != http.StatusBadRequest || got != nil {
+			t.Errorf("%s: expected the pull to be rejected, got %d", query, code)
+		}
+	}
+
+	for image, want := range map[string]string{
+		"alpine:3.2":           "mirror.internal:5000/library/alpine:3.2",
+		"docker://busybox":     "docker://mirror.internal:5000/library/busybox:latest",
+		"registry.internal/db": "registry.internal/db",
+	} {
+		req, _ := http.NewRequest("POST", "/containers/create", strings.NewReader(`{"Image":"`+image+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		var got string
+		serve(chain, func(w http.ResponseWriter, r *http.Request) {
+			var body struct{ Image string }
+			json.NewDecoder(r.Body).Decode(&body)
+			got = body.Image
+		}, req)
+		if got != want {
+			t.Fatalf("%s: expected %s, got %s", image, want, got)
+		}
+	}
+
+	// Without rules, rkt images by URL or file pass untouched.
+	chain = newChain(t, `[{"name": "images", "options": {"mirrors": {"docker.io": "mirror.internal:5000"}}}]`)
+	for _, query := range []string{"fromImage=%2Ftmp%2Fapp.aci", "fromImage=https%3A%2F%2Fregistry.internal%2Fapp.aci"} {
+		if code := pull(query); code != http.StatusOK || got.URL.RawQuery != query {
+			t.Errorf("%s: expected the pull to pass untouched, got %d", query, code)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+var labelledCreate = regexp.MustCompile(`/(containers|volumes)/create$`)
+
+func init() {
+	Register("labels", newLabels)
+}
+
+// labels adds labels to the containers and volumes created through
+// harbour. Labels the client set are kept unless force is set.
+type labels struct {
+	Labels map[string]string `json:"labels"`
+	Force  bool              `json:"force"`
+}
+
+func newLabels(options json.RawMessage) (Middleware, error) {
+	m := &labels{}
+	if err := decodeOptions(options, m); err != nil {
+		return nil, err
+	}
+	if len(m.Labels) == 0 {
+		return nil, fmt.Errorf("labels is required")
+	}
+	return m, nil
+}
+
+func (m *labels) Request(r *Request) error {
+	if r.Method != "POST" || !labelledCreate.MatchString(r.URL.Path) {
+		return nil
+	}
+	body, err := r.JSON()
+	if err != nil || body == nil {
+		return err
+	}
+
+	current, _ := body["Labels"].(map[string]interface{})
+	if current == nil {
+		current = map[string]interface{}{}
+	}
+	for k, v := range m.Labels {
+		if _, ok := current[k]; !ok || m.Force {
+			current[k] = v
+		}
+	}
+	body["Labels"] = current
+	return nil
+}
+
+func (m *labels) Response(r *Request, resp *Response) error {
+	return nil
+}
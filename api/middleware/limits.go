@@ -0,0 +1,258 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("limits", newLimits)
+}
+
+// The classes of requests limits tells apart, the others are "other".
+var routeClasses = []struct {
+	class   string
+	pattern *regexp.Regexp
+}{
+	{"create", regexp.MustCompile(`/(containers|volumes)/create$`)},
+	{"pull", regexp.MustCompile(`/images/create$`)},
+	{"build", regexp.MustCompile(`/build$`)},
+	{"exec", regexp.MustCompile(`/(containers/[^/]+/exec|exec/[^/]+/start)$`)},
+}
+
+// maxBuckets bounds the number of callers tracked. Idle ones are dropped
+// beyond it.
+const maxBuckets = 4096
+
+// limits caps the requests of every caller in each class of requests, so
+// that a runaway client cannot starve the backend.
+type limits struct {
+	// Classes are the limits of each class of requests, per caller.
+	Classes map[string]Limit `json:"classes"`
+	// Callers override Classes for some callers, as named by
+	// Request.Caller, e.g. "uid:0" or "cn:ci".
+	Callers map[string]map[string]Limit `json:"callers"`
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+	now     func() time.Time
+}
+
+// Limit is a token bucket refilled with Rate requests a second up to Burst,
+// along with a cap on the requests in flight. Zero values do not limit.
+type Limit struct {
+	Rate        float64 `json:"rate"`
+	Burst       int     `json:"burst"`
+	MaxInFlight int     `json:"maxInFlight"`
+}
+
+type bucketKey struct {
+	caller, class string
+}
+
+type bucket struct {
+	limit    Limit
+	tokens   float64
+	last     time.Time
+	inFlight int
+}
+
+type limitsKey struct{}
+
+func newLimits(options json.RawMessage) (Middleware, error) {
+	m := &limits{buckets: map[bucketKey]*bucket{}, now: time.Now}
+	if err := decodeOptions(options, m); err != nil {
+		return nil, err
+	}
+	check := func(classes map[string]Limit) error {
+		for class, l := range classes {
+			if !knownClass(class) {
+				return fmt.Errorf("unknown class %s", class)
+			}
+			if l.Rate < 0 || l.Burst < 0 || l.MaxInFlight < 0 {
+				return fmt.Errorf("negative limit for %s", class)
+			}
+			if l.Rate > 0 && l.Burst == 0 {
+				l.Burst = int(math.Ceil(l.Rate))
+				classes[class] = l
+			}
+		}
+		return nil
+	}
+	if err := check(m.Classes); err != nil {
+		return nil, err
+	}
+	for _, classes := range m.Callers {
+		if err := check(classes); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func knownClass(class string) bool {
+	if class == "other" {
+		return true
+	}
+	for _, rc := range routeClasses {
+		if rc.class == class {
+			return true
+		}
+	}
+	return false
+}
+
+func classOf(r *http.Request) string {
+	if r.Method == "POST" {
+		for _, rc := range routeClasses {
+			if rc.pattern.MatchString(r.URL.Path) {
+				return rc.class
+			}
+		}
+	}
+	return "other"
+}
+
+func (m *limits) limit(key bucketKey) Limit {
+	if l, ok := m.Callers[key.caller][key.class]; ok {
+		return l
+	}
+	return m.Classes[key.class]
+}
+
+func (m *limits) Request(r *Request) error {
+	key := bucketKey{r.Caller(), classOf(r.Request)}
+	l := m.limit(key)
+	if l.Rate == 0 && l.MaxInFlight == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.bucket(key, l)
+	if l.MaxInFlight > 0 && b.inFlight >= l.MaxInFlight {
+		return &tooManyRequests{
+			msg:   fmt.Sprintf("%s has %d %s requests in flight", key.caller, b.inFlight, key.class),
+			retry: time.Second,
+		}
+	}
+	if l.Rate > 0 {
+		if b.tokens < 1 {
+			return &tooManyRequests{
+				msg:   fmt.Sprintf("%s is over %g %s requests a second", key.caller, l.Rate, key.class),
+				retry: time.Duration((1 - b.tokens) / l.Rate * float64(time.Second)),
+			}
+		}
+		b.tokens--
+	}
+	b.inFlight++
+	r.Request = r.Request.WithContext(context.WithValue(r.Context(), limitsKey{}, key))
+	return nil
+}
+
+// bucket returns the bucket of key, refilled. m.mu is held.
+func (m *limits) bucket(key bucketKey, l Limit) *bucket {
+	now := m.now()
+	b, ok := m.buckets[key]
+	if !ok {
+		if len(m.buckets) >= maxBuckets {
+			m.prune(now)
+		}
+		b = &bucket{limit: l, tokens: float64(l.Burst), last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+	return b
+}
+
+// prune drops the buckets back to their initial state.
+func (m *limits) prune(now time.Time) {
+	for key, b := range m.buckets {
+		full := b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst)
+		if b.inFlight == 0 && full {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func (m *limits) Response(r *Request, resp *Response) error {
+	return nil
+}
+
+func (m *limits) Finish(r *Request) {
+	key, ok := r.Context().Value(limitsKey{}).(bucketKey)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	if b, ok := m.buckets[key]; ok {
+		b.inFlight--
+	}
+	m.mu.Unlock()
+}
+
+func (m *limits) Name() string {
+	return "limits"
+}
+
+type limitsReport struct {
+	Classes map[string]Limit            `json:"classes"`
+	Callers map[string]map[string]Limit `json:"callers,omitempty"`
+	Usage   []limitsUsage               `json:"usage"`
+}
+
+type limitsUsage struct {
+	Caller   string  `json:"caller"`
+	Class    string  `json:"class"`
+	Tokens   float64 `json:"tokens"`
+	InFlight int     `json:"inFlight"`
+}
+
+func (m *limits) Report() interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report := &limitsReport{Classes: m.Classes, Callers: m.Callers, Usage: []limitsUsage{}}
+	for key := range m.buckets {
+		b := m.bucket(key, m.limit(key))
+		report.Usage = append(report.Usage, limitsUsage{
+			Caller:   key.caller,
+			Class:    key.class,
+			Tokens:   math.Floor(b.tokens*100) / 100,
+			InFlight: b.inFlight,
+		})
+	}
+	sort.Slice(report.Usage, func(i, j int) bool {
+		if report.Usage[i].Caller != report.Usage[j].Caller {
+			return report.Usage[i].Caller < report.Usage[j].Caller
+		}
+		return report.Usage[i].Class < report.Usage[j].Class
+	})
+	return report
+}
+
+// tooManyRequests is answered with a 429 and a Retry-After header.
+type tooManyRequests struct {
+	msg   string
+	retry time.Duration
+}
+
+func (e *tooManyRequests) Error() string {
+	return "Too many requests: " + e.msg
+}
+
+func (e *tooManyRequests) Header() http.Header {
+	seconds := int64(math.Ceil(e.retry.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return http.Header{"Retry-After": {strconv.FormatInt(seconds, 10)}}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLimits(t *testing.T) {
+	chain := newChain(t, `[{"name": "limits", "options": {
+		"classes": {"create": {"rate": 1, "burst": 2}, "exec": {"maxInFlight": 1}},
+		"callers": {"ip:10.0.0.1": {"create": {}}}
+	}}]`)
+	m := chain[0].(*limits)
+	now := time.Unix(0, 0)
+	m.now = func() time.Time { return now }
+
+	block := make(chan struct{})
+	next := func(w http.ResponseWriter, r *http.Request) {
+		if classOf(r) == "exec" {
+			<-block
+		}
+	}
+	call := func(addr, path string) (int, string) {
+		req, _ := http.NewRequest("POST", path, nil)
+		req.RemoteAddr = addr + ":1234"
+		w := serve(chain, next, req)
+		return w.Code, w.Header().Get("Retry-After")
+	}
+
+	for i := 0; i < 2; i++ {
+		if code, _ := call("10.0.0.2", "/containers/create"); code != http.StatusOK {
+			t.Fatalf("expected the burst to pass, got %d", code)
+		}
+	}
+	if code, retry := call("10.0.0.2", "/containers/create"); code != http.StatusBadRequest || retry != "1" {
+		t.Fatalf("expected the create to be limited, got %d with Retry-After %q", code, retry)
+	}
+	if code, _ := call("10.0.0.2", "/containers/abc/start"); code != http.StatusOK {
+		t.Fatalf("expected other requests to pass, got %d", code)
+	}
+	if code, _ := call("10.0.0.3", "/containers/create"); code != http.StatusOK {
+		t.Fatalf("expected other callers to pass, got %d", code)
+	}
+	for i := 0; i < 5; i++ {
+		if code, _ := call("10.0.0.1", "/containers/create"); code != http.StatusOK {
+			t.Fatalf("expected the exempt caller to pass, got %d", code)
+		}
+	}
+	now = now.Add(time.Second)
+	if code, _ := call("10.0.0.2", "/containers/create"); code != http.StatusOK {
+		t.Fatalf("expected the bucket to refill, got %d", code)
+	}
+
+	done := make(chan int)
+	go func() {
+		code, _ := call("10.0.0.2", "/containers/abc/exec")
+		done <- code
+	}()
+	for {
+		m.mu.Lock()
+		b := m.buckets[bucketKey{"ip:10.0.0.2", "exec"}]
+		inFlight := b != nil && b.inFlight == 1
+		m.mu.Unlock()
+		if inFlight {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if code, _ := call("10.0.0.2", "/exec/abc/start"); code != http.StatusBadRequest {
+		t.Fatalf("expected the exec to be capped, got %d", code)
+	}
+	close(block)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("expected the first exec to pass, got %d", code)
+	}
+	if code, _ := call("10.0.0.2", "/exec/abc/start"); code != http.StatusOK {
+		t.Fatalf("expected the exec to pass once the first is done, got %d", code)
+	}
+
+	report := chain.Report()["limits"].(*limitsReport)
+	if len(report.Usage) != 3 {
+		t.Fatalf("unexpected usage %+v", report.Usage)
+	}
+}
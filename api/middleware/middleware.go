@@ -0,0 +1,259 @@
+// Package middleware lets small in-process extensions inspect and change the
+// API requests harbour serves and the responses it sends back, whatever the
+// backend.
+//
+// An extension implements Middleware and registers a Factory for it under a
+// name from an init function. The configuration file of the daemon then
+// lists the middlewares to run, in order:
+//
+//	{
+//		"middlewares": [
+//			{"name": "request-id"},
+//			{"name": "body-limit", "options": {"max": "16m"}},
+//			{"name": "labels", "options": {"labels": {"team": "core"}, "force": true}}
+//		]
+//	}
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/engine"
+)
+
+// Middleware sees every request before it is dispatched to the backend and
+// every response before it is sent.
+type Middleware interface {
+	// Request may change r. Returning an error answers the request with
+	// the error instead of dispatching it.
+	Request(r *Request) error
+	// Response may change resp before its headers are sent. Returning an
+	// error replaces a buffered response with the error; streamed
+	// responses are already on their way and only log it.
+	Response(r *Request, resp *Response) error
+}
+
+// Finisher is implemented by the middlewares that need to know when the
+// backend is done with a request, streams and hijacked connections included.
+type Finisher interface {
+	Finish(r *Request)
+}
+
+// Reporter is implemented by the middlewares with a state to show on the
+// admin API.
+type Reporter interface {
+	Name() string
+	Report() interface{}
+}
+
+// Factory creates a middleware from the options given in the
+// configuration file, which may be empty.
+type Factory func(options json.RawMessage) (Middleware, error)
+
+var (
+	factoriesLock sync.Mutex
+	factories     = make(map[string]Factory)
+)
+
+// Register makes a middleware available to the configuration file under
+// name.
+func Register(name string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	if _, ok := factories[name]; ok {
+		panic("middleware: " + name + " is registered twice")
+	}
+	factories[name] = factory
+}
+
+// Names returns the names of the registered middlewares.
+func Names() []string {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Request is an API request on its way to the backend.
+type Request struct {
+	*http.Request
+
+	json     map[string]interface{}
+	raw      []byte
+	jsonRead bool
+}
+
+// JSON returns the decoded body of a JSON request, or nil for requests
+// without one. Changes to the returned map are sent to the backend. Bodies
+// of other requests, such as the tar archives of docker build, are streamed
+// to the backend untouched.
+func (r *Request) JSON() (map[string]interface{}, error) {
+	if r.jsonRead {
+		return r.json, nil
+	}
+	r.jsonRead = true
+	if r.Body == nil || !isJSON(r.Header.Get("Content-Type")) {
+		return nil, nil
+	}
+
+	raw, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	r.raw = raw
+	r.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	// Numbers stay as they were sent, memory limits do not fit a float.
+	dec.UseNumber()
+	var body map[string]interface{}
+	if err := dec.Decode(&body); err != nil {
+		// Let the backend answer with its own error.
+		return nil, nil
+	}
+	r.json = body
+	return r.json, nil
+}
+
+// updateBody encodes the JSON body back for the backend.
+func (r *Request) updateBody() error {
+	if r.json == nil {
+		return nil
+	}
+	data, err := json.Marshal(r.json)
+	if err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(data))
+	r.ContentLength = int64(len(data))
+	r.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	return nil
+}
+
+// Response is the answer to a Request.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	// JSON is the decoded body of a JSON response that is not streamed,
+	// nil otherwise. Changes to it are sent to the client.
+	JSON interface{}
+}
+
+// Chain is a list of middlewares, run in order on requests and in reverse
+// order on responses.
+type Chain []Middleware
+
+// New creates the middlewares listed in configs.
+func New(configs []engine.MiddlewareConfig) (Chain, error) {
+	var chain Chain
+	for _, c := range configs {
+		factoriesLock.Lock()
+		factory, ok := factories[c.Name]
+		factoriesLock.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("Unknown middleware %s, available: %v", c.Name, Names())
+		}
+		m, err := factory(c.Options)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid options for middleware %s: %s", c.Name, err)
+		}
+		chain = append(chain, m)
+	}
+	return chain, nil
+}
+
+// Handler runs the chain around next. Errors of the middlewares are written
+// with onError.
+func (c Chain) Handler(next http.Handler, onError func(http.ResponseWriter, error)) http.Handler {
+	if len(c) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &Request{Request: r}
+		rw := &responseWriter{w: w, req: req, chain: c}
+
+		for i, m := range c {
+			if err := m.Request(req); err != nil {
+				c[:i].finish(req)
+				writeError(rw, onError, err)
+				return
+			}
+		}
+		defer c.finish(req)
+		if err := req.updateBody(); err != nil {
+			writeError(rw, onError, err)
+			return
+		}
+
+		next.ServeHTTP(rw, req.Request)
+		rw.finish(onError)
+	})
+}
+
+// Report returns the state of the middlewares that have one, by name.
+func (c Chain) Report() map[string]interface{} {
+	reports := map[string]interface{}{}
+	for _, m := range c {
+		if r, ok := m.(Reporter); ok {
+			reports[r.Name()] = r.Report()
+		}
+	}
+	return reports
+}
+
+func (c Chain) finish(req *Request) {
+	for i := len(c) - 1; i >= 0; i-- {
+		if f, ok := c[i].(Finisher); ok {
+			f.Finish(req)
+		}
+	}
+}
+
+func (c Chain) response(req *Request, resp *Response) error {
+	for i := len(c) - 1; i >= 0; i-- {
+		if err := c[i].Response(req, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeError answers with err, along with the headers it carries if it has
+// a Header method.
+func writeError(rw *responseWriter, onError func(http.ResponseWriter, error), err error) {
+	if he, ok := err.(interface {
+		Header() http.Header
+	}); ok {
+		for k, v := range he.Header() {
+			rw.Header()[k] = v
+		}
+	}
+	onError(rw, err)
+	rw.finish(onError)
+}
+
+func isJSON(contentType string) bool {
+	t, _, err := mime.ParseMediaType(contentType)
+	return err == nil && t == "application/json"
+}
+
+func logResponseError(req *Request, err error) {
+	logrus.Errorf("Middleware failed on the response to %s %s: %s", req.Method, req.URL.Path, err)
+}
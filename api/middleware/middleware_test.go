@@ -0,0 +1,267 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine"
+)
+
+func newChain(t *testing.T, config string) Chain {
+	var configs []engine.MiddlewareConfig
+	if err := json.Unmarshal([]byte(config), &configs); err != nil {
+		t.Fatal(err)
+	}
+	chain, err := New(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain
+}
+
+func serve(chain Chain, next http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	chain.Handler(next, func(w http.ResponseWriter, err error) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}).ServeHTTP(w, req)
+	return w
+}
+
+func TestLabelsAndRequestID(t *testing.T) {
+	chain := newChain(t, `[
+		{"name": "request-id"},
+		{"name": "labels", "options": {"labels": {"team": "core", "env": "prod"}}}
+	]`)
+
+	var got map[string]interface{}
+	next := func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintln(w, `{"Id":"abc","Warnings":null}`)
+	}
+	req, _ := http.NewRequest("POST", "/v1.21/containers/create",
+		strings.NewReader(`{"Image":"busybox","Labels":{"env":"dev"},"HostConfig":{"Memory":9223372036854775807}}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := serve(chain, next, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+	labels := got["Labels"].(map[string]interface{})
+	if labels["team"] != "core" || labels["env"] != "dev" {
+		t.Fatalf("unexpected labels %v", labels)
+	}
+	if memory := got["HostConfig"].(map[string]interface{})["Memory"]; memory != 9223372036854775807.0 {
+		t.Fatalf("unexpected memory %v", memory)
+	}
+	if !strings.Contains(w.Body.String(), "abc") {
+		t.Fatalf("unexpected body %s", w.Body.String())
+	}
+	if w.Header().Get("X-Request-Id") == "" {
+		t.Fatal("expected a request ID")
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	chain := newChain(t, `[{"name": "body-limit", "options": {"max": "16"}}]`)
+	next := func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "/build", strings.NewReader(strings.Repeat("x", 32)))
+	if w := serve(chain, next, req); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected the announced body to be rejected, got %d", w.Code)
+	}
+
+	req, _ = http.NewRequest("POST", "/build", ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 32))))
+	req.ContentLength = -1
+	if w := serve(chain, next, req); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected the chunked body to be cut, got %d", w.Code)
+	}
+
+	req, _ = http.NewRequest("POST", "/build", strings.NewReader(strings.Repeat("x", 16)))
+	if w := serve(chain, next, req); w.Code != http.StatusOK {
+		t.Fatalf("expected a body at the limit to pass, got %d", w.Code)
+	}
+}
+
+type rewriteNames struct{}
+
+func (rewriteNames) Request(r *Request) error { return nil }
+
+func (rewriteNames) Response(r *Request, resp *Response) error {
+	if list, ok := resp.JSON.([]interface{}); ok {
+		for _, c := range list {
+			c.(map[string]interface{})["Names"] = []string{"/hidden"}
+		}
+	}
+	resp.Header.Set("X-Seen", "1")
+	return nil
+}
+
+func TestResponses(t *testing.T) {
+	chain := Chain{rewriteNames{}}
+
+	req, _ := http.NewRequest("GET", "/containers/json", nil)
+	w := serve(chain, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"Id":"abc","Names":["/web"]}]`)
+	}, req)
+	if !strings.Contains(w.Body.String(), "/hidden") || w.Header().Get("X-Seen") != "1" {
+		t.Fatalf("expected the response to be rewritten, got %s", w.Body.String())
+	}
+
+	// Streamed responses are passed through as they are written.
+	req, _ = http.NewRequest("GET", "/events", nil)
+	w = serve(chain, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"Names":["/web"]}]`)
+		w.(http.Flusher).Flush()
+		if !strings.Contains(w.(*responseWriter).w.(*httptest.ResponseRecorder).Body.String(), "/web") {
+			t.Fatal("expected the flushed event to be sent")
+		}
+		fmt.Fprint(w, `{"status":"start"}`)
+	}, req)
+	if !strings.Contains(w.Body.String(), "/web") || w.Header().Get("X-Seen") != "1" {
+		t.Fatalf("expected the stream untouched with its headers rewritten, got %s", w.Body.String())
+	}
+}
+
+// countResponses counts the responses it sees.
+type countResponses struct {
+	responses int
+}
+
+func (c *countResponses) Request(r *Request) error { return nil }
+
+func (c *countResponses) Response(r *Request, resp *Response) error {
+	c.responses++
+	return nil
+}
+
+func TestHijack(t *testing.T) {
+	counter := &countResponses{}
+	chain := Chain{counter}
+	var errors bytes.Buffer
+	handler := chain.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		buf.WriteString("HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\nhello")
+		buf.Flush()
+		conn.Close()
+		w.(http.Flusher).Flush()
+	}), func(w http.ResponseWriter, err error) {
+		t.Errorf("unexpected error %s", err)
+	})
+	done := make(chan struct{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		handler.ServeHTTP(w, r)
+	}))
+	srv.Config.ErrorLog = log.New(&errors, "", 0)
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "POST /containers/abc/attach HTTP/1.1\r\nHost: docker\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "HTTP/1.1 101 UPGRADED") || !strings.HasSuffix(string(data), "hello") {
+		t.Fatalf("expected the hijacked stream alone, got %q", data)
+	}
+
+	<-done
+	if counter.responses != 0 {
+		t.Fatalf("expected no response for the middlewares, got %d", counter.responses)
+	}
+	if errors.Len() > 0 {
+		t.Fatalf("expected nothing written after the hijack, got %s", errors.String())
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	chain := newChain(t, `[{"name": "policy", "options": {
+		"labels": {"cost-center": "42"},
+		"requiredLabels": ["owner", "cost-center"],
+		"uidLabel": "harbour.uid",
+		"resources": {"memory": "512m", "cpuShares": 512},
+		"logConfig": {"Type": "json-file"},
+		"restartPolicy": {"Name": "on-failure", "MaximumRetryCount": 3}
+	}}]`)
+
+	dir, err := ioutil.TempDir("", "harbour-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "harbour.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got types.ContainerConfig
+	srv := &http.Server{
+		Handler: chain.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&got)
+		}), func(w http.ResponseWriter, err error) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		}),
+		ConnContext: ConnContext,
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+	client := &http.Client{Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", sock)
+		},
+	}}
+	create := func(body string) int {
+		resp, err := client.Post("http://harbour/containers/create", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := create(`{"Image":"busybox"}`); code != http.StatusForbidden {
+		t.Fatalf("expected a container without owner to be rejected, got %d", code)
+	}
+	code := create(`{"Image":"busybox","Labels":{"owner":"me","harbour.uid":"0"},"HostConfig":{"CpuShares":1024,"RestartPolicy":{"Name":"no"}}}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected the container to be accepted, got %d", code)
+	}
+	if uid := strconv.Itoa(os.Getuid()); got.Labels["harbour.uid"] != uid || got.Labels["cost-center"] != "42" {
+		t.Fatalf("unexpected labels %v", got.Labels)
+	}
+	hc := got.HostConfig
+	if hc.Memory != 512<<20 || hc.CPUShares != 1024 || hc.LogConfig.Type != "json-file" || hc.RestartPolicy.Name != "on-failure" {
+		t.Fatalf("unexpected host config %+v", hc)
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// decodeOptions reads the options of a middleware into v, rejecting unknown
+// fields so that typos in the configuration file do not go unnoticed.
+func decodeOptions(options json.RawMessage, v interface{}) error {
+	if len(bytes.TrimSpace(options)) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(options))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
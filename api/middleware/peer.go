@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+type connKey struct{}
+
+// ConnContext is the http.Server ConnContext hook that lets the middlewares
+// find out who sent a request.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// Peer returns the credentials of the process that sent the request over a
+// unix socket, nil for requests that came over TCP.
+func (r *Request) Peer() (*syscall.Ucred, error) {
+	c, ok := r.Context().Value(connKey{}).(*net.UnixConn)
+	if !ok {
+		return nil, nil
+	}
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		cred    *syscall.Ucred
+		credErr error
+	)
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	return cred, credErr
+}
+
+// Caller identifies the client of the request: its uid over a unix socket,
+// the subject of its certificate over TLS or else its address.
+func (r *Request) Caller() string {
+	if cred, err := r.Peer(); err == nil && cred != nil {
+		return "uid:" + strconv.FormatUint(uint64(cred.Uid), 10)
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		subject := r.TLS.PeerCertificates[0].Subject
+		if subject.CommonName != "" {
+			return "cn:" + subject.CommonName
+		}
+		return "subject:" + subject.String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
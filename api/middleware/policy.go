@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/opts"
+)
+
+var containerCreate = regexp.MustCompile(`/containers/create$`)
+
+func init() {
+	Register("policy", newPolicy)
+}
+
+// policy enforces the site rules on the containers created through harbour,
+// whichever backend runs them.
+type policy struct {
+	// Labels are added to the containers that do not set them.
+	Labels map[string]string `json:"labels"`
+	// RequiredLabels must be set, by the client or by Labels.
+	RequiredLabels []string `json:"requiredLabels"`
+	// UIDLabel receives the uid of the client process. The client cannot
+	// set it itself.
+	UIDLabel string `json:"uidLabel"`
+
+	Resources     *policyResources     `json:"resources"`
+	LogConfig     *types.LogConfig     `json:"logConfig"`
+	RestartPolicy *types.RestartPolicy `json:"restartPolicy"`
+
+	hostConfig map[string]interface{}
+}
+
+// policyResources are the limits of the containers created without them.
+type policyResources struct {
+	Memory      string `json:"memory"`
+	MemorySwap  string `json:"memorySwap"`
+	CPUShares   int64  `json:"cpuShares"`
+	CPUPeriod   int64  `json:"cpuPeriod"`
+	CPUQuota    int64  `json:"cpuQuota"`
+	BlkioWeight int64  `json:"blkioWeight"`
+}
+
+func newPolicy(options json.RawMessage) (Middleware, error) {
+	m := &policy{}
+	if err := decodeOptions(options, m); err != nil {
+		return nil, err
+	}
+
+	// Defaults of the HostConfig, by the name docker gives them.
+	m.hostConfig = map[string]interface{}{}
+	if res := m.Resources; res != nil {
+		for name, size := range map[string]string{"Memory": res.Memory, "MemorySwap": res.MemorySwap} {
+			if size == "" {
+				continue
+			}
+			n, err := opts.ParseSize(size)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", name, err)
+			}
+			m.hostConfig[name] = json.Number(strconv.FormatInt(n, 10))
+		}
+		for name, n := range map[string]int64{"CpuShares": res.CPUShares, "CpuPeriod": res.CPUPeriod, "CpuQuota": res.CPUQuota, "BlkioWeight": res.BlkioWeight} {
+			if n != 0 {
+				m.hostConfig[name] = json.Number(strconv.FormatInt(n, 10))
+			}
+		}
+	}
+	if m.LogConfig != nil {
+		if m.LogConfig.Type == "" {
+			return nil, fmt.Errorf("logConfig needs a type")
+		}
+		m.hostConfig["LogConfig"] = m.LogConfig
+	}
+	if m.RestartPolicy != nil {
+		if m.RestartPolicy.Name == "" {
+			return nil, fmt.Errorf("restartPolicy needs a name")
+		}
+		m.hostConfig["RestartPolicy"] = m.RestartPolicy
+	}
+	return m, nil
+}
+
+func (m *policy) Request(r *Request) error {
+	if r.Method != "POST" || !containerCreate.MatchString(r.URL.Path) {
+		return nil
+	}
+	body, err := r.JSON()
+	if err != nil {
+		return err
+	}
+	if body == nil {
+		// Let the backend reject it, unless the policy has to see labels.
+		if len(m.RequiredLabels) > 0 || m.UIDLabel != "" {
+			return fmt.Errorf("Bad parameter: the container configuration is required")
+		}
+		return nil
+	}
+
+	labels, _ := body["Labels"].(map[string]interface{})
+	if labels == nil {
+		labels = map[string]interface{}{}
+	}
+	for k, v := range m.Labels {
+		if _, ok := labels[k]; !ok {
+			labels[k] = v
+		}
+	}
+	if m.UIDLabel != "" {
+		cred, err := r.Peer()
+		if err != nil {
+			return err
+		}
+		if cred != nil {
+			labels[m.UIDLabel] = strconv.FormatUint(uint64(cred.Uid), 10)
+		} else {
+			delete(labels, m.UIDLabel)
+		}
+	}
+	for _, k := range m.RequiredLabels {
+		if v, ok := labels[k].(string); !ok || v == "" {
+			return fmt.Errorf("Forbidden by policy: label %s is required", k)
+		}
+	}
+	body["Labels"] = labels
+
+	if len(m.hostConfig) == 0 {
+		return nil
+	}
+	hostConfig, _ := body["HostConfig"].(map[string]interface{})
+	if hostConfig == nil {
+		hostConfig = map[string]interface{}{}
+	}
+	for k, v := range m.hostConfig {
+		if unset(k, hostConfig[k]) {
+			hostConfig[k] = v
+		}
+	}
+	body["HostConfig"] = hostConfig
+	return nil
+}
+
+func (m *policy) Response(r *Request, resp *Response) error {
+	return nil
+}
+
+// unset tells whether the client left a HostConfig field to its default.
+// The docker client sends a "no" restart policy when none is given, so it
+// gets the default too.
+func unset(name string, v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case json.Number:
+		return v.String() == "0"
+	case map[string]interface{}:
+		switch name {
+		case "LogConfig":
+			t, _ := v["Type"].(string)
+			return t == ""
+		case "RestartPolicy":
+			n, _ := v["Name"].(string)
+			return n == "" || n == "no"
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const defaultRequestIDHeader = "X-Request-Id"
+
+func init() {
+	Register("request-id", newRequestID)
+}
+
+// requestID gives every request an ID, kept from the client when it sent
+// one, and returns it with the response.
+type requestID struct {
+	Header string `json:"header"`
+}
+
+func newRequestID(options json.RawMessage) (Middleware, error) {
+	m := &requestID{Header: defaultRequestIDHeader}
+	if err := decodeOptions(options, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *requestID) Request(r *Request) error {
+	id := r.Header.Get(m.Header)
+	if id == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		id = hex.EncodeToString(b)
+		r.Header.Set(m.Header, id)
+	}
+	logrus.Debugf("Request %s: %s %s", id, r.Method, r.URL.Path)
+	return nil
+}
+
+func (m *requestID) Response(r *Request, resp *Response) error {
+	resp.Header.Set(m.Header, r.Header.Get(m.Header))
+	return nil
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// maxBuffered bounds the JSON responses held back for the middlewares.
+// Larger ones are streamed.
+const maxBuffered = 16 << 20
+
+// responseWriter holds JSON responses back until the handler is done so
+// that the middlewares can change them. Anything flushed, hijacked or not
+// JSON is passed through as it comes.
+type responseWriter struct {
+	w     http.ResponseWriter
+	req   *Request
+	chain Chain
+
+	status    int
+	buffering bool
+	committed bool
+	hijacked  bool
+	buf       bytes.Buffer
+}
+
+func (rw *responseWriter) Header() http.Header {
+	return rw.w.Header()
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.status != 0 {
+		return
+	}
+	rw.status = code
+	rw.buffering = isJSON(rw.Header().Get("Content-Type")) &&
+		code != http.StatusNoContent && code != http.StatusNotModified && code >= http.StatusOK
+	if !rw.buffering {
+		rw.sendHeader()
+	}
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.committed {
+		return rw.w.Write(p)
+	}
+	rw.buf.Write(p)
+	if rw.buf.Len() > maxBuffered {
+		if err := rw.passThrough(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush is what streaming handlers call, their responses are not held back.
+func (rw *responseWriter) Flush() {
+	if rw.hijacked {
+		return
+	}
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if !rw.committed {
+		rw.passThrough()
+	}
+	if f, ok := rw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response cannot be hijacked")
+	}
+	conn, buf, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	// The connection now speaks another protocol, there is no response
+	// for the middlewares to see.
+	rw.status = http.StatusSwitchingProtocols
+	rw.committed, rw.hijacked = true, true
+	return conn, buf, nil
+}
+
+func (rw *responseWriter) CloseNotify() <-chan bool {
+	if cn, ok := rw.w.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// commit runs the middlewares on the response. The headers are sent by the
+// caller.
+func (rw *responseWriter) commit(body interface{}) (*Response, error) {
+	rw.committed = true
+	resp := &Response{StatusCode: rw.status, Header: rw.Header(), JSON: body}
+	return resp, rw.chain.response(rw.req, resp)
+}
+
+// sendHeader sends the headers of a response that is not held back.
+func (rw *responseWriter) sendHeader() {
+	resp, err := rw.commit(nil)
+	if err != nil {
+		logResponseError(rw.req, err)
+	}
+	rw.w.WriteHeader(resp.StatusCode)
+}
+
+// passThrough gives up on holding the response back.
+func (rw *responseWriter) passThrough() error {
+	rw.sendHeader()
+	_, err := rw.w.Write(rw.buf.Bytes())
+	rw.buf.Reset()
+	return err
+}
+
+// finish sends what the handler left in the buffer once it returned.
+func (rw *responseWriter) finish(onError func(http.ResponseWriter, error)) {
+	if rw.hijacked {
+		return
+	}
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.committed {
+		return
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(rw.buf.Bytes()))
+	dec.UseNumber()
+	var body interface{}
+	if err := dec.Decode(&body); err != nil || dec.More() {
+		// Not a single JSON document, e.g. a stream of them.
+		rw.passThrough()
+		return
+	}
+
+	resp, err := rw.commit(body)
+	if err != nil {
+		onError(rw.w, err)
+		return
+	}
+	data, err := json.Marshal(resp.JSON)
+	if err != nil {
+		logResponseError(rw.req, err)
+		data = bytes.TrimRight(rw.buf.Bytes(), "\n")
+	}
+	data = append(data, '\n')
+	rw.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	rw.w.WriteHeader(resp.StatusCode)
+	rw.w.Write(data)
+}
@@ -0,0 +1,126 @@
+// Package reference parses the image references clients, the kubelet and the
+// runtimes use, so that harbour compares and checks them the same way
+// everywhere.
+//
+// Besides docker references, rkt takes images by ID (sha512-...), URL,
+// file (*.aci) and discovery name. A docker:// prefix only names the
+// transport and the rest is the docker reference. The other rkt references
+// are not docker references: Parse refuses them and Normalize leaves them as
+// they are.
+package reference
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DockerTransport is the prefix rkt fetches docker images with.
+const DockerTransport = "docker://"
+
+var (
+	pattern = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*(:[0-9]+)?(/[a-z0-9]+([._-]+[a-z0-9]+)*)*(:[\w][\w.-]{0,127})?(@[a-z0-9]+:[a-f0-9]{32,})?$`)
+	// Only full IDs are told apart from names: docker pulls a short hex ID
+	// it does not have as the image of that name, and rkt takes sha512- for
+	// an ID before anything else.
+	id = regexp.MustCompile(`^(sha256:[0-9a-f]{64}|sha512-[0-9a-f]{32,128})$`)
+)
+
+// Reference is a docker image reference in its normalized form.
+type Reference struct {
+	Domain string
+	Path   string
+	Tag    string
+	Digest string
+}
+
+// IsID tells whether ref is the full ID of a local image rather than a
+// reference.
+func IsID(ref string) bool {
+	return id.MatchString(ref)
+}
+
+// IsRkt tells whether ref is an image only rkt fetches, by URL or file.
+func IsRkt(ref string) bool {
+	return !strings.HasPrefix(ref, DockerTransport) &&
+		(strings.Contains(ref, "://") || strings.HasSuffix(ref, ".aci"))
+}
+
+// Parse normalizes image the way docker does: busybox stands for
+// docker.io/library/busybox:latest.
+func Parse(image string) (Reference, error) {
+	var ref Reference
+	if !pattern.MatchString(image) {
+		return ref, fmt.Errorf("Bad parameter: invalid image reference %s", image)
+	}
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.Digest = name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+
+	i := strings.Index(name, "/")
+	if i >= 0 && (strings.ContainsAny(name[:i], ".:") || name[:i] == "localhost") {
+		ref.Domain, ref.Path = name[:i], name[i+1:]
+	} else {
+		ref.Domain, ref.Path = "docker.io", name
+	}
+	if ref.Domain == "index.docker.io" || ref.Domain == "registry-1.docker.io" {
+		ref.Domain = "docker.io"
+	}
+	if ref.Domain == "docker.io" && !strings.Contains(ref.Path, "/") {
+		ref.Path = "library/" + ref.Path
+	}
+	return ref, nil
+}
+
+// Normalize reduces the names docker, rkt and the kubelet give to the same
+// image to a single form, the short one docker shows: busybox:latest for
+// docker.io/library/busybox. IDs and the references Parse refuses are
+// returned as they are.
+func Normalize(image string) string {
+	if IsID(image) {
+		return image
+	}
+	ref, err := Parse(strings.TrimPrefix(image, DockerTransport))
+	if err != nil {
+		return image
+	}
+	return ref.Familiar()
+}
+
+// Name is the reference without its tag nor digest, e.g.
+// docker.io/library/busybox.
+func (ref Reference) Name() string {
+	return ref.Domain + "/" + ref.Path
+}
+
+// Familiar is the reference the way docker shows it, without the default
+// registry and library/ prefix.
+func (ref Reference) Familiar() string {
+	s := ref.Domain + "/" + ref.Path
+	if ref.Domain == "docker.io" {
+		s = strings.TrimPrefix(ref.Path, "library/")
+	}
+	return s + ref.suffix()
+}
+
+func (ref Reference) String() string {
+	return ref.Name() + ref.suffix()
+}
+
+func (ref Reference) suffix() string {
+	var s string
+	if ref.Tag != "" {
+		s += ":" + ref.Tag
+	}
+	if ref.Digest != "" {
+		s += "@" + ref.Digest
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package reference
+
+import (
+	"testing"
+)
+
+// The garbage collector, the drivers, the CRI server and the images
+// middleware all go through Normalize or Parse, so this table is what they
+// agree on.
+func TestReference(t *testing.T) {
+	for _, tc := range []struct {
+		image string
+		// normalized is what Normalize gives.
+		normalized string
+		// parsed is what Parse gives, empty if it refuses image.
+		parsed string
+	}{
+		{"busybox", "busybox:latest", "docker.io/library/busybox:latest"},
+		{"docker://busybox", "busybox:latest", ""},
+		{"docker.io/library/nginx", "nginx:latest", "docker.io/library/nginx:latest"},
+		{"registry-1.docker.io/library/busybox:latest", "busybox:latest", "docker.io/library/busybox:latest"},
+		{"index.docker.io/busybox", "busybox:latest", "docker.io/library/busybox:latest"},
+		{"nginx:1.9", "nginx:1.9", "docker.io/library/nginx:1.9"},
+		{"user/app:1.0", "user/app:1.0", "docker.io/user/app:1.0"},
+		{"localhost/app", "localhost/app:latest", "localhost/app:latest"},
+		{"localhost:5000/app", "localhost:5000/app:latest", "localhost:5000/app:latest"},
+		{"registry.internal:5000/team/app", "registry.internal:5000/team/app:latest", "registry.internal:5000/team/app:latest"},
+		{"coreos.com/etcd:v2.0.0", "coreos.com/etcd:v2.0.0", "coreos.com/etcd:v2.0.0"},
+		{"busybox@sha256:0123456789abcdef0123456789abcdef", "busybox@sha256:0123456789abcdef0123456789abcdef", "docker.io/library/busybox@sha256:0123456789abcdef0123456789abcdef"},
+		{"quay.io/coreos/etcd@sha1", "quay.io/coreos/etcd@sha1", ""},
+		{"sha512-abc", "sha512-abc:latest", "docker.io/library/sha512-abc:latest"},
+		{"sha512-0123456789abcdef0123456789abcdef", "sha512-0123456789abcdef0123456789abcdef", "docker.io/library/sha512-0123456789abcdef0123456789abcdef:latest"},
+		{"0123456789ab", "0123456789ab:latest", "docker.io/library/0123456789ab:latest"},
+		{"https://example.com/app.aci", "https://example.com/app.aci", ""},
+		{"/tmp/app.aci", "/tmp/app.aci", ""},
+		{"", "", ""},
+		{"Busybox", "Busybox", ""},
+		{"busybox:", "busybox:", ""},
+	} {
+		if got := Normalize(tc.image); got != tc.normalized {
+			t.Errorf("Normalize(%q) = %q, expected %q", tc.image, got, tc.normalized)
+		}
+		ref, err := Parse(tc.image)
+		switch {
+		case tc.parsed == "" && err == nil:
+			t.Errorf("Parse(%q) = %s, expected an error", tc.image, ref)
+		case tc.parsed != "" && err != nil:
+			t.Errorf("Parse(%q): %s", tc.image, err)
+		case tc.parsed != "" && ref.String() != tc.parsed:
+			t.Errorf("Parse(%q) = %s, expected %s", tc.image, ref, tc.parsed)
+		}
+	}
+}
+
+func TestKinds(t *testing.T) {
+	for image, want := range map[string][2]bool{
+		"sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef": {true, false},
+		"sha256:0123456789ab":                     {false, false},
+		"sha512-0123456789abcdef0123456789abcdef": {true, false},
+		"sha512-0123abcd":                         {false, false},
+		"0123456789ab":                            {false, false},
+		"busybox":                                 {false, false},
+		"docker://busybox":                        {false, false},
+		"/tmp/app.aci":                            {false, true},
+		"https://x/app":                           {false, true},
+	} {
+		if got := [2]bool{IsID(image), IsRkt(image)}; got != want {
+			t.Errorf("%s: expected IsID, IsRkt = %v, got %v", image, want, got)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// The admin API of harbour itself, under /harbour/v1/ next to the docker API
+// it serves.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/huawei-openlab/harbour/adaptor"
+	"github.com/huawei-openlab/harbour/api/middleware"
+	"github.com/huawei-openlab/harbour/driver"
+	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/utils"
+)
+
+const adminPrefix = "/harbour/v1/"
+
+func isAdminPath(path string) bool {
+	return strings.HasPrefix(path, adminPrefix)
+}
+
+// addAdminRoutes adds the admin API to the routes m of a router.
+func (s *Server) addAdminRoutes(m map[string]map[string]HttpApiFunc) {
+	for method, routes := range map[string]map[string]HttpApiFunc{
+		"GET": {
+			adminPrefix + "info":     s.getInfo,
+			adminPrefix + "sessions": s.getSessions,
+			adminPrefix + "config":   s.getConfig,
+			adminPrefix + "runtimes": s.getRuntimes,
+			adminPrefix + "limits":   s.getLimits,
+		},
+		"POST": {
+			adminPrefix + "config/reload": s.postConfigReload,
+			adminPrefix + "gc":            s.postGC,
+		},
+	} {
+		for route, fct := range routes {
+			m[method][route] = fct
+		}
+	}
+}
+
+// adminHandler serves the admin API alone, for the admin listeners. It does
+// not go through the middlewares.
+func (s *Server) adminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdminPath(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		defer s.sessions.start(r)()
+		s.router.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v)
+}
+
+// Info is returned by GET /harbour/v1/info.
+type Info struct {
+	Version string
+	Started time.Time
+	Uptime  string
+	Runtime string
+	Backend Health
+	// Backends are the docker daemons of the docker runtime.
+	Backends   []BackendHealth `json:",omitempty"`
+	ConfigFile string          `json:",omitempty"`
+}
+
+// Health tells whether harbour can reach its backend.
+type Health struct {
+	Healthy bool
+	Error   string `json:",omitempty"`
+}
+
+// BackendHealth is the health of a docker daemon as of its last ping.
+type BackendHealth struct {
+	Address string
+	Primary bool
+	Checked time.Time
+	Health
+}
+
+func (s *Server) getInfo(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	s.mu.RLock()
+	configFile := s.configFile
+	s.mu.RUnlock()
+	info := &Info{
+		Version:    engine.Version,
+		Started:    eng.Started,
+		Uptime:     time.Since(eng.Started).Truncate(time.Second).String(),
+		Runtime:    engine.RuntimeNames[eng.RuntimeType],
+		ConfigFile: configFile,
+	}
+	if err := s.backendHealth(r); err != nil {
+		info.Backend.Error = err.Error()
+	} else {
+		info.Backend.Healthy = true
+	}
+	if eng.Backends != nil {
+		for i, b := range eng.Backends.Backends() {
+			checked, err := b.Health()
+			health := BackendHealth{Address: b.Address, Primary: i == 0, Checked: checked}
+			if err != nil {
+				health.Error = err.Error()
+			} else {
+				health.Healthy = true
+			}
+			info.Backends = append(info.Backends, health)
+		}
+	}
+	return writeJSON(w, info)
+}
+
+// backendHealth asks the driver of the runtime of s whether its backend
+// answers.
+func (s *Server) backendHealth(r *http.Request) error {
+	if s.driver == nil {
+		return fmt.Errorf("no driver for runtime %s", engine.RuntimeNames[s.eng.RuntimeType])
+	}
+	if info := s.driver.Info(r.Context()); !info.Healthy {
+		return fmt.Errorf("%s", info.Error)
+	}
+	return nil
+}
+
+// Runtime is an entry of GET /harbour/v1/runtimes.
+type Runtime struct {
+	Name      string
+	Active    bool
+	Available bool
+	Path      string `json:",omitempty"`
+}
+
+func (s *Server) getRuntimes(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	runtimes := []Runtime{}
+	for t, name := range engine.RuntimeNames {
+		rt := Runtime{Name: name, Active: t == eng.RuntimeType}
+		d, err := driver.New(name, nil)
+		if err == nil {
+			rt.Available = true
+			// The runtimes without a binary, such as the fake one,
+			// run in harbour itself.
+			if l, ok := d.(driver.Locator); ok {
+				rt.Path, err = l.Locate()
+				rt.Available = err == nil
+			}
+		}
+		runtimes = append(runtimes, rt)
+	}
+	sort.Slice(runtimes, func(i, j int) bool { return runtimes[i].Name < runtimes[j].Name })
+	return writeJSON(w, runtimes)
+}
+
+func (s *Server) getConfig(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	s.mu.RLock()
+	config := s.config
+	s.mu.RUnlock()
+	if config == nil {
+		config = &engine.Config{}
+	}
+	return writeJSON(w, config)
+}
+
+func (s *Server) postConfigReload(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := s.Reload(); err != nil {
+		return fmt.Errorf("Bad parameter: %s", err)
+	}
+	return s.getConfig(eng, w, r, vars)
+}
+
+func (s *Server) postGC(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if eng.RuntimeType != engine.RuntimeRkt {
+		return fmt.Errorf("Impossible to collect garbage for %s, harbour only collects it for rkt", engine.RuntimeNames[eng.RuntimeType])
+	}
+	adaptor.CollectGarbage()
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type limitsReport struct {
+	Middlewares map[string]interface{} `json:"middlewares"`
+	Processes   struct {
+		Running int `json:"running"`
+		Max     int `json:"max"`
+	} `json:"processes"`
+}
+
+// getLimits reports the limits the middlewares enforce with their current
+// usage, along with the commands run for the backend.
+func (s *Server) getLimits(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	s.mu.RLock()
+	chain := s.chain
+	s.mu.RUnlock()
+	report := &limitsReport{Middlewares: chain.Report()}
+	report.Processes.Running, report.Processes.Max = utils.Procs()
+	return writeJSON(w, report)
+}
+
+// Session is a request being served, such as an attach or a log stream.
+type Session struct {
+	ID      uint64
+	Method  string
+	Path    string
+	Caller  string
+	Started time.Time
+}
+
+type sessions struct {
+	mu     sync.Mutex
+	nextID uint64
+	active map[uint64]*Session
+}
+
+// start records r until the returned function is called.
+func (s *sessions) start(r *http.Request) func() {
+	session := &Session{
+		ID:      atomic.AddUint64(&s.nextID, 1),
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Caller:  (&middleware.Request{Request: r}).Caller(),
+		Started: time.Now(),
+	}
+	s.mu.Lock()
+	s.active[session.ID] = session
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		delete(s.active, session.ID)
+		s.mu.Unlock()
+	}
+}
+
+func (s *Server) getSessions(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	s.sessions.mu.Lock()
+	list := make([]*Session, 0, len(s.sessions.active))
+	for _, session := range s.sessions.active {
+		list = append(list, session)
+	}
+	s.sessions.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return writeJSON(w, list)
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/huawei-openlab/harbour/driver/docker"
+	"github.com/huawei-openlab/harbour/driver/emulator"
+	_ "github.com/huawei-openlab/harbour/driver/fake"
+	_ "github.com/huawei-openlab/harbour/driver/nspawn"
+	_ "github.com/huawei-openlab/harbour/driver/oci"
+	_ "github.com/huawei-openlab/harbour/driver/rkt"
+	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/engine/backend"
+)
+
+func TestAdminConfigReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harbour-admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "harbour.json")
+	write := func(config string) {
+		if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"middlewares": [{"name": "request-id"}]}`)
+
+	srv := New(engine.New(engine.RuntimeRkt), false)
+	config, err := engine.LoadConfig(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Configure(path, true, config); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(h http.Handler, method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	if w := do(srv, "GET", "/harbour/v1/config"); w.Header().Get("X-Request-Id") == "" {
+		t.Fatal("expected the admin API to go through the middlewares")
+	}
+
+	write(`{"middlewares": [{"name": "nope"}]}`)
+	if w := do(srv, "POST", "/harbour/v1/config/reload"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid configuration to be rejected, got %d", w.Code)
+	}
+	write(`{"middlewares": []}`)
+	w := do(srv, "POST", "/harbour/v1/config/reload")
+	var got engine.Config
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Middlewares) != 0 {
+		t.Fatalf("expected the middlewares to be reloaded, got %+v", got)
+	}
+	if w := do(srv, "GET", "/harbour/v1/config"); w.Header().Get("X-Request-Id") != "" {
+		t.Fatal("expected the reloaded middlewares to apply")
+	}
+
+	// With listeners of its own, the admin API is not served with docker's.
+	srv.admin = true
+	if w := do(srv, "GET", "/harbour/v1/info"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected the admin API to be hidden, got %d", w.Code)
+	}
+	if w := do(srv.adminHandler(), "GET", "/harbour/v1/sessions"); w.Code != http.StatusOK || w.Body.String() == "[]\n" {
+		t.Fatalf("expected the session listing itself, got %d %s", w.Code, w.Body.String())
+	}
+	if w := do(srv.adminHandler(), "GET", "/containers/json"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected the docker API to be hidden, got %d", w.Code)
+	}
+}
+
+// fakeBinaries print the versions of the runtimes found on the host.
+var fakeBinaries = map[string]string{
+	"docker":         "Docker version 1.9.1",
+	"rkt":            "rkt Version: 0.10.0",
+	"runc":           "runc version 1.1.12",
+	"systemd-nspawn": "systemd 255",
+	"systemd-run":    "systemd 255",
+	"systemctl":      "systemd 255",
+	"machinectl":     "systemd 255",
+}
+
+func TestAdminRuntimes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harbour-runtimes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, version := range fakeBinaries {
+		script := "#!/bin/sh\necho '" + version + "'\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir)
+	defer func(root, runtime string) {
+		engine.StateRoot, engine.OCIRuntime = root, runtime
+	}(engine.StateRoot, engine.OCIRuntime)
+	engine.StateRoot, engine.OCIRuntime = dir, "runc"
+
+	docker := fakeDocker("docker")
+	defer docker.Close()
+
+	get := func(srv *Server, path string, v interface{}) {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", path, w.Code, w.Body.String())
+		}
+		if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		runtime int
+		// path is where the runtime is found, none when it runs in
+		// harbour.
+		path string
+	}{
+		{engine.RuntimeDocker, "docker"},
+		{engine.RuntimeRkt, "rkt"},
+		{engine.RuntimeOCI, "runc"},
+		{engine.RuntimeNspawn, "systemd-nspawn"},
+		{engine.RuntimeFake, ""},
+	} {
+		name := engine.RuntimeNames[tc.runtime]
+		eng := engine.New(tc.runtime)
+		if tc.runtime == engine.RuntimeDocker {
+			eng.Backends, err = backend.NewPool([]backend.Config{{Address: strings.Replace(docker.URL, "http://", "tcp://", 1)}}, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if emulator.Registered(name) {
+			if err := emulator.Init(eng); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		}
+		srv := New(eng, false)
+
+		var info Info
+		get(srv, "/harbour/v1/info", &info)
+		if info.Runtime != name || !info.Backend.Healthy {
+			t.Fatalf("expected %s to be healthy, got %+v", name, info)
+		}
+
+		var runtimes []Runtime
+		get(srv, "/harbour/v1/runtimes", &runtimes)
+		found := false
+		for _, rt := range runtimes {
+			if rt.Name != name {
+				continue
+			}
+			found = true
+			path := ""
+			if tc.path != "" {
+				path = filepath.Join(dir, tc.path)
+			}
+			if !rt.Active || !rt.Available || rt.Path != path {
+				t.Fatalf("expected %s to be active and available at %q, got %+v", name, path, rt)
+			}
+		}
+		if !found {
+			t.Fatalf("expected %s to be listed, got %+v", name, runtimes)
+		}
+	}
+
+	// The oci runtime is only healthy with the binary it is told to drive.
+	engine.OCIRuntime = "crun"
+	srv := New(engine.New(engine.RuntimeOCI), false)
+	var info Info
+	get(srv, "/harbour/v1/info", &info)
+	if info.Backend.Healthy || !strings.Contains(info.Backend.Error, "crun") {
+		t.Fatalf("expected oci to miss crun, got %+v", info)
+	}
+	var runtimes []Runtime
+	get(srv, "/harbour/v1/runtimes", &runtimes)
+	for _, rt := range runtimes {
+		if rt.Name == "oci" && rt.Available {
+			t.Fatalf("expected oci to be unavailable without crun, got %+v", rt)
+		}
+	}
+}
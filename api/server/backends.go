@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/api/listing"
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/engine/backend"
+)
+
+var (
+	// statelessPath matches the requests any docker daemon up can answer.
+	statelessPath = regexp.MustCompile(`^(/v[0-9.]+)?/(_ping|version|info|images/json|images/search)$`)
+	// objectPath matches the requests on a container or an exec, which go
+	// to the daemon that has it.
+	objectPath = regexp.MustCompile(`^(/v[0-9.]+)?/(containers|exec)/([^/]+)(/[^/]+)?$`)
+	// containersPath matches docker ps, which lists the containers of all
+	// the daemons.
+	containersPath = regexp.MustCompile(`^(/v[0-9.]+)?/containers/json$`)
+)
+
+// objectOf returns the kind and reference of the container or exec r is on,
+// if any.
+func objectOf(r *http.Request) (kind, ref, action string) {
+	m := objectPath.FindStringSubmatch(r.URL.Path)
+	if m == nil || (m[2] == "containers" && m[4] == "" && (m[3] == "json" || m[3] == "create")) {
+		return "", "", ""
+	}
+	return m[2], m[3], m[4]
+}
+
+// route picks the docker daemon of eng that r goes to.
+func route(eng *engine.Engine, r *http.Request) (*backend.Backend, error) {
+	if eng.Backends == nil {
+		return nil, fmt.Errorf("Service unavailable: no docker daemon to forward to")
+	}
+	if r.Method == "GET" && statelessPath.MatchString(r.URL.Path) {
+		return eng.Backends.Any()
+	}
+	if kind, ref, _ := objectOf(r); kind != "" {
+		return eng.Backends.Owner(kind, ref)
+	}
+	return eng.Backends.Primary()
+}
+
+// forget drops the owner of the container or exec of r once the answer of
+// the daemon tells it is gone or renamed.
+func forget(eng *engine.Engine, r *http.Request, status int) {
+	kind, ref, action := objectOf(r)
+	if kind == "" || eng.Backends == nil {
+		return
+	}
+	removed := r.Method == "DELETE" && action == "" && status < 300
+	renamed := action == "/rename" && status < 300
+	if status == http.StatusNotFound || removed || renamed {
+		eng.Backends.Forget(kind, ref)
+	}
+}
+
+// fansOut tells whether r is answered from all the daemons of eng rather
+// than forwarded to one.
+func fansOut(eng *engine.Engine, r *http.Request) bool {
+	return r.Method == "GET" && containersPath.MatchString(r.URL.Path) &&
+		eng.Backends != nil && len(eng.Backends.Backends()) > 1
+}
+
+// listContainers answers docker ps with the containers of all the daemons
+// up. Each one is asked for all of its containers, the options apply to the
+// merged list so that since, before and limit span the daemons.
+func listContainers(eng *engine.Engine, w http.ResponseWriter, r *http.Request) error {
+	opts, err := listing.ParseContainerOptions(r.URL.Query())
+	if err != nil {
+		return err
+	}
+	up := eng.Backends.Up()
+	if len(up) == 0 {
+		_, err := eng.Backends.Any()
+		return err
+	}
+
+	query := url.Values{"all": {"1"}}
+	if opts.Size {
+		query.Set("size", "1")
+	}
+	path := r.URL.Path + "?" + query.Encode()
+	lists := make([][]types.Container, len(up))
+	var wg sync.WaitGroup
+	for i, b := range up {
+		wg.Add(1)
+		go func(i int, b *backend.Backend) {
+			defer wg.Done()
+			list, err := containersOf(b, path)
+			if err != nil {
+				logrus.Warnf("Failed to list the containers of docker at %s: %s", b.Address, err)
+				return
+			}
+			lists[i] = list
+		}(i, b)
+	}
+	wg.Wait()
+
+	var merged []types.Container
+	for _, list := range lists {
+		merged = append(merged, list...)
+	}
+
+	list, err := listing.Containers(merged, opts)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(list)
+}
+
+func containersOf(b *backend.Backend, path string) ([]types.Container, error) {
+	client := &http.Client{Transport: b.Transport()}
+	resp, err := client.Get("http://docker" + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("docker answered %s", resp.Status)
+	}
+	var list []types.Container
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
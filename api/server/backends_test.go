@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/engine/backend"
+)
+
+// fakeDocker answers with its name, and has the containers of ids.
+func fakeDocker(name string, ids ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, id := range ids {
+			if strings.HasPrefix(r.URL.Path, "/containers/"+id+"/") {
+				fmt.Fprintf(w, `{"Id": %q, "Daemon": %q}`, id, name)
+				return
+			}
+		}
+		if strings.HasPrefix(r.URL.Path, "/containers/") && r.URL.Path != "/containers/create" {
+			http.Error(w, "No such container", http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"Daemon": %q}`, name)
+	}))
+}
+
+func TestBackends(t *testing.T) {
+	primary, secondary := fakeDocker("primary"), fakeDocker("secondary", "c2")
+	defer secondary.Close()
+	pool, err := backend.NewPool([]backend.Config{
+		{Address: strings.Replace(primary.URL, "http://", "tcp://", 1)},
+		{Address: strings.Replace(secondary.URL, "http://", "tcp://", 1)},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eng := engine.New(engine.RuntimeDocker)
+	eng.Backends = pool
+	srv := New(eng, false)
+
+	do := func(method, path string, code int, daemon string) {
+		req, _ := http.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		if w.Code != code || !strings.Contains(w.Body.String(), daemon) {
+			t.Fatalf("expected %s %s to get %d from %s, got %d: %s", method, path, code, daemon, w.Code, w.Body.String())
+		}
+	}
+	do("GET", "/v1.24/version", http.StatusOK, "primary")
+	do("POST", "/containers/create", http.StatusOK, "primary")
+	do("POST", "/v1.24/containers/c2/start", http.StatusOK, "secondary")
+	do("GET", "/containers/c1/json", http.StatusNotFound, "No such container")
+
+	primary.Close()
+	pool.Check()
+	do("GET", "/version", http.StatusOK, "secondary")
+	do("POST", "/containers/create", http.StatusServiceUnavailable, "Service unavailable")
+	do("POST", "/containers/c2/stop", http.StatusOK, "secondary")
+	do("GET", "/containers/c1/json", http.StatusServiceUnavailable, "Service unavailable")
+}
+
+// fakeList is a docker daemon with containers, which it lists like docker ps.
+func fakeList(containers ...types.Container) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/containers/json") {
+			return
+		}
+		list := []types.Container{}
+		for _, c := range containers {
+			if c.State == "running" || r.URL.Query().Get("all") == "1" {
+				list = append(list, c)
+			}
+		}
+		json.NewEncoder(w).Encode(list)
+	}))
+}
+
+func TestListContainers(t *testing.T) {
+	primary := fakeList(
+		types.Container{ID: "c1", Names: []string{"/web"}, Created: 1, State: "running"},
+		types.Container{ID: "c3", Names: []string{"/job"}, Created: 3, State: "exited", Status: "Exited (0) 1 minute ago"},
+	)
+	defer primary.Close()
+	secondary := fakeList(
+		types.Container{ID: "c2", Names: []string{"/db"}, Created: 2, State: "running", Labels: map[string]string{"team": "a"}},
+	)
+	defer secondary.Close()
+	pool, err := backend.NewPool([]backend.Config{
+		{Address: strings.Replace(primary.URL, "http://", "tcp://", 1)},
+		{Address: strings.Replace(secondary.URL, "http://", "tcp://", 1)},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eng := engine.New(engine.RuntimeDocker)
+	eng.Backends = pool
+	srv := New(eng, false)
+
+	ps := func(query, want string) {
+		req, _ := http.NewRequest("GET", "/v1.24/containers/json?"+query, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		var list []types.Container
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+			t.Fatalf("%s: %d %s", query, w.Code, err)
+		}
+		var ids []string
+		for _, c := range list {
+			ids = append(ids, c.ID)
+		}
+		if strings.Join(ids, ",") != want {
+			t.Fatalf("%s: expected %s, got %v", query, want, ids)
+		}
+	}
+	ps("", "c2,c1")
+	ps("all=1", "c3,c2,c1")
+	ps("limit=1", "c3")
+	ps("since=web", "c3,c2")
+	ps(`filters={"label":["team=a"]}`, "c2")
+	ps(`filters={"status":["exited"]}`, "c3")
+	ps(`filters={"name":["db"]}&all=1`, "c2")
+
+	secondary.Close()
+	pool.Check()
+	ps("all=1", "c3,c1")
+}
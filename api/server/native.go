@@ -0,0 +1,261 @@
+// The native API of harbour, under /harbour/api/v1/: containers, images,
+// pods and runtimes described the same way whatever the runtime, built on
+// the drivers.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/huawei-openlab/harbour/driver"
+	"github.com/huawei-openlab/harbour/engine"
+)
+
+const nativePrefix = "/harbour/api/v1/"
+
+// addNativeRoutes adds the native API to the routes m of a router.
+func (s *Server) addNativeRoutes(m map[string]map[string]HttpApiFunc) {
+	for method, routes := range map[string]map[string]HttpApiFunc{
+		"GET": {
+			nativePrefix + "containers":      s.getContainers,
+			nativePrefix + "containers/{id}": s.getContainer,
+			nativePrefix + "images":          s.getImages,
+			nativePrefix + "pods":            s.getPods,
+			nativePrefix + "runtimes":        s.getNativeRuntimes,
+			nativePrefix + "openapi.json":    getOpenAPI,
+		},
+		"POST": {
+			nativePrefix + "containers":            s.postContainers,
+			nativePrefix + "containers/{id}/start": s.postContainerStart,
+			nativePrefix + "containers/{id}/stop":  s.postContainerStop,
+			nativePrefix + "images":                s.postImages,
+		},
+		"DELETE": {
+			nativePrefix + "containers/{id}": s.deleteContainer,
+			nativePrefix + "images/{id:.+}":  s.deleteImage,
+		},
+	} {
+		for route, fct := range routes {
+			m[method][route] = fct
+		}
+	}
+}
+
+// runtime returns the driver of the runtime a request names, the active one
+// when it names none.
+func (s *Server) runtime(name string) (driver.Driver, error) {
+	if s.driver == nil {
+		return nil, fmt.Errorf("Impossible to serve the native API, %s has no driver", engine.RuntimeNames[s.eng.RuntimeType])
+	}
+	if name != "" && name != s.driver.Name() {
+		return nil, fmt.Errorf("Bad parameter: runtime %s is not served, harbour runs %s", name, s.driver.Name())
+	}
+	return s.driver, nil
+}
+
+type originKey struct{}
+
+// nativeContext is the context of the Docker API requests the drivers send
+// to serve r, on behalf of its caller.
+func nativeContext(r *http.Request) context.Context {
+	return context.WithValue(r.Context(), originKey{}, r)
+}
+
+// pipeline is the transport of the drivers. It serves their requests
+// in-process through the middlewares and the router, like the requests of
+// the Docker API, so that the native API cannot get around the policies.
+type pipeline struct {
+	s *Server
+}
+
+func (p pipeline) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.RequestURI = req.URL.RequestURI()
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+	if origin, ok := req.Context().Value(originKey{}).(*http.Request); ok {
+		r.RemoteAddr, r.TLS = origin.RemoteAddr, origin.TLS
+	}
+
+	p.s.mu.RLock()
+	h := p.s.handler
+	p.s.mu.RUnlock()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	resp := w.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+func (s *Server) getContainers(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	query := r.URL.Query()
+	d, err := s.runtime(query.Get("runtime"))
+	if err != nil {
+		return err
+	}
+	all, _ := strconv.ParseBool(query.Get("all"))
+	containers, err := d.ListContainers(nativeContext(r), all)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, containers)
+}
+
+func (s *Server) getContainer(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	d, err := s.runtime(r.URL.Query().Get("runtime"))
+	if err != nil {
+		return err
+	}
+	c, err := d.GetContainer(nativeContext(r), vars["id"])
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, c)
+}
+
+func (s *Server) postContainers(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	spec := &driver.ContainerSpec{}
+	if err := json.NewDecoder(r.Body).Decode(spec); err != nil {
+		return fmt.Errorf("Bad parameter: %s", err)
+	}
+	d, err := s.runtime(spec.Runtime)
+	if err != nil {
+		return err
+	}
+	c, err := d.CreateContainer(nativeContext(r), spec)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(c)
+}
+
+func (s *Server) postContainerStart(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	d, err := s.runtime(r.URL.Query().Get("runtime"))
+	if err != nil {
+		return err
+	}
+	if err := d.StartContainer(nativeContext(r), vars["id"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) postContainerStop(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	query := r.URL.Query()
+	d, err := s.runtime(query.Get("runtime"))
+	if err != nil {
+		return err
+	}
+	timeout := 10 * time.Second
+	if t := query.Get("timeout"); t != "" {
+		n, err := strconv.Atoi(t)
+		if err != nil || n < 0 {
+			return fmt.Errorf("Bad parameter: invalid timeout %s", t)
+		}
+		timeout = time.Duration(n) * time.Second
+	}
+	if err := d.StopContainer(nativeContext(r), vars["id"], timeout); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) deleteContainer(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	query := r.URL.Query()
+	d, err := s.runtime(query.Get("runtime"))
+	if err != nil {
+		return err
+	}
+	force, _ := strconv.ParseBool(query.Get("force"))
+	if err := d.RemoveContainer(nativeContext(r), vars["id"], force); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) getImages(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	d, err := s.runtime(r.URL.Query().Get("runtime"))
+	if err != nil {
+		return err
+	}
+	images, err := d.ListImages(nativeContext(r))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, images)
+}
+
+// ImagePull is the body of POST /harbour/api/v1/images.
+type ImagePull struct {
+	Runtime string
+	Image   string
+}
+
+func (s *Server) postImages(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	pull := &ImagePull{}
+	if err := json.NewDecoder(r.Body).Decode(pull); err != nil {
+		return fmt.Errorf("Bad parameter: %s", err)
+	}
+	if pull.Image == "" {
+		return fmt.Errorf("Bad parameter: no image specified")
+	}
+	d, err := s.runtime(pull.Runtime)
+	if err != nil {
+		return err
+	}
+	if err := d.PullImage(nativeContext(r), pull.Image); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) deleteImage(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	d, err := s.runtime(r.URL.Query().Get("runtime"))
+	if err != nil {
+		return err
+	}
+	if err := d.RemoveImage(nativeContext(r), vars["id"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) getPods(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	d, err := s.runtime(r.URL.Query().Get("runtime"))
+	if err != nil {
+		return err
+	}
+	pods, err := d.ListPods(nativeContext(r))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, pods)
+}
+
+func (s *Server) getNativeRuntimes(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	d, err := s.runtime("")
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, []*driver.RuntimeInfo{d.Info(nativeContext(r))})
+}
+
+func getOpenAPI(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write([]byte(openAPI))
+	return err
+}
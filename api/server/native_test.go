@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huawei-openlab/harbour/driver"
+	"github.com/huawei-openlab/harbour/engine"
+)
+
+type stubDriver struct {
+	driver.Driver
+	created *driver.ContainerSpec
+}
+
+func (d *stubDriver) Name() string {
+	return "rkt"
+}
+
+func (d *stubDriver) CreateContainer(ctx context.Context, spec *driver.ContainerSpec) (*driver.Container, error) {
+	d.created = spec
+	return &driver.Container{ID: "c1", Runtime: d.Name(), Image: spec.Image, Created: time.Unix(0, 0)}, nil
+}
+
+func (d *stubDriver) ListPods(ctx context.Context) ([]*driver.Pod, error) {
+	return nil, driver.ErrNoPods
+}
+
+func TestNative(t *testing.T) {
+	srv := New(engine.New(engine.RuntimeRkt), false)
+	stub := &stubDriver{}
+	srv.driver = stub
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/harbour/api/v1/containers", `{"Image": "busybox", "Labels": {"a": "b"}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected the container to be created, got %d: %s", w.Code, w.Body)
+	}
+	var c driver.Container
+	if err := json.NewDecoder(w.Body).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != "c1" || c.Runtime != "rkt" || stub.created.Labels["a"] != "b" {
+		t.Fatalf("unexpected container %+v from %+v", c, stub.created)
+	}
+
+	if w := do("POST", "/harbour/api/v1/containers", `{"Runtime": "docker", "Image": "busybox"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a runtime harbour does not run to be rejected, got %d", w.Code)
+	}
+	if w := do("GET", "/harbour/api/v1/pods", ""); w.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected pods to be refused without pods, got %d", w.Code)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(openAPI), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	m := map[string]map[string]HttpApiFunc{"GET": {}, "POST": {}, "DELETE": {}}
+	(&Server{}).addNativeRoutes(m)
+	for method, routes := range m {
+		for route := range routes {
+			path := strings.Replace(strings.TrimPrefix(route, strings.TrimSuffix(nativePrefix, "/")), "{id:.+}", "{id}", 1)
+			if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+				t.Errorf("%s %s is not documented", method, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package server
+
+// openAPI describes the native API, served at
+// /harbour/api/v1/openapi.json.
+const openAPI = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Harbour native API",
+    "version": "1",
+    "description": "Containers, images, pods and runtimes described the same way whatever the runtime harbour drives. Every resource names its runtime; requests may name one with the runtime query parameter or field, the active runtime otherwise."
+  },
+  "servers": [{"url": "/harbour/api/v1"}],
+  "paths": {
+    "/containers": {
+      "get": {
+        "summary": "List the containers",
+        "parameters": [
+          {"$ref": "#/components/parameters/runtime"},
+          {"name": "all", "in": "query", "description": "List the stopped containers too", "schema": {"type": "boolean"}}
+        ],
+        "responses": {
+          "200": {"description": "The containers", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Container"}}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Create a container",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ContainerSpec"}}}},
+        "responses": {
+          "201": {"description": "The container created", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Container"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/containers/{id}": {
+      "parameters": [
+        {"$ref": "#/components/parameters/id"},
+        {"$ref": "#/components/parameters/runtime"}
+      ],
+      "get": {
+        "summary": "Describe a container",
+        "responses": {
+          "200": {"description": "The container", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Container"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Remove a container",
+        "parameters": [
+          {"name": "force", "in": "query", "description": "Kill the container if it runs", "schema": {"type": "boolean"}}
+        ],
+        "responses": {
+          "204": {"description": "The container was removed"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/containers/{id}/start": {
+      "parameters": [
+        {"$ref": "#/components/parameters/id"},
+        {"$ref": "#/components/parameters/runtime"}
+      ],
+      "post": {
+        "summary": "Start a container",
+        "responses": {
+          "204": {"description": "The container was started"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/containers/{id}/stop": {
+      "parameters": [
+        {"$ref": "#/components/parameters/id"},
+        {"$ref": "#/components/parameters/runtime"}
+      ],
+      "post": {
+        "summary": "Stop a container",
+        "parameters": [
+          {"name": "timeout", "in": "query", "description": "Seconds to wait before killing the container, 10 by default", "schema": {"type": "integer", "minimum": 0}}
+        ],
+        "responses": {
+          "204": {"description": "The container was stopped"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/images": {
+      "get": {
+        "summary": "List the images",
+        "parameters": [{"$ref": "#/components/parameters/runtime"}],
+        "responses": {
+          "200": {"description": "The images", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Image"}}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Pull an image",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ImagePull"}}}},
+        "responses": {
+          "204": {"description": "The image was pulled"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/images/{id}": {
+      "parameters": [
+        {"$ref": "#/components/parameters/id"},
+        {"$ref": "#/components/parameters/runtime"}
+      ],
+      "delete": {
+        "summary": "Remove an image",
+        "responses": {
+          "204": {"description": "The image was removed"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/pods": {
+      "get": {
+        "summary": "List the pods, for the runtimes that have pods",
+        "parameters": [{"$ref": "#/components/parameters/runtime"}],
+        "responses": {
+          "200": {"description": "The pods", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Pod"}}}}},
+          "406": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/runtimes": {
+      "get": {
+        "summary": "List the runtimes harbour serves",
+        "responses": {
+          "200": {"description": "The runtimes", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Runtime"}}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/openapi.json": {
+      "get": {
+        "summary": "This document",
+        "responses": {
+          "200": {"description": "The OpenAPI document of the native API", "content": {"application/json": {}}}
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "id": {"name": "id", "in": "path", "required": true, "description": "ID or name", "schema": {"type": "string"}},
+      "runtime": {"name": "runtime", "in": "query", "description": "Runtime to ask, the active one if empty", "schema": {"type": "string"}}
+    },
+    "responses": {
+      "Error": {"description": "The error, as text", "content": {"text/plain": {"schema": {"type": "string"}}}}
+    },
+    "schemas": {
+      "Container": {
+        "type": "object",
+        "properties": {
+          "ID": {"type": "string"},
+          "Name": {"type": "string"},
+          "Runtime": {"type": "string"},
+          "Image": {"type": "string"},
+          "Command": {"type": "string"},
+          "Labels": {"type": "object", "additionalProperties": {"type": "string"}},
+          "Created": {"type": "string", "format": "date-time"},
+          "State": {"type": "string", "enum": ["created", "running", "restarting", "paused", "exited"]},
+          "Status": {"type": "string"},
+          "Started": {"type": "string", "format": "date-time"},
+          "Finished": {"type": "string", "format": "date-time"},
+          "ExitCode": {"type": "integer"}
+        }
+      },
+      "ContainerSpec": {
+        "type": "object",
+        "required": ["Image"],
+        "properties": {
+          "Runtime": {"type": "string"},
+          "Name": {"type": "string"},
+          "Image": {"type": "string"},
+          "Command": {"type": "array", "items": {"type": "string"}},
+          "Env": {"type": "array", "items": {"type": "string"}},
+          "Labels": {"type": "object", "additionalProperties": {"type": "string"}},
+          "Memory": {"type": "integer", "format": "int64", "description": "Memory limit in bytes"},
+          "RestartPolicy": {"type": "string", "description": "no, always, unless-stopped or on-failure[:max-retries]"}
+        }
+      },
+      "Image": {
+        "type": "object",
+        "properties": {
+          "ID": {"type": "string"},
+          "Runtime": {"type": "string"},
+          "Names": {"type": "array", "items": {"type": "string"}},
+          "Created": {"type": "string", "format": "date-time"},
+          "Size": {"type": "integer", "format": "int64"},
+          "Labels": {"type": "object", "additionalProperties": {"type": "string"}}
+        }
+      },
+      "ImagePull": {
+        "type": "object",
+        "required": ["Image"],
+        "properties": {
+          "Runtime": {"type": "string"},
+          "Image": {"type": "string", "description": "Reference of the image, with a tag or a digest"}
+        }
+      },
+      "Pod": {
+        "type": "object",
+        "properties": {
+          "ID": {"type": "string"},
+          "Runtime": {"type": "string"},
+          "State": {"type": "string"},
+          "Image": {"type": "string"},
+          "Container": {"type": "string", "description": "The harbour container backed by the pod"}
+        }
+      },
+      "Runtime": {
+        "type": "object",
+        "properties": {
+          "Name": {"type": "string"},
+          "Version": {"type": "string"},
+          "Healthy": {"type": "boolean"},
+          "Error": {"type": "string"}
+        }
+      }
+    }
+  }
+}
+`
@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,14 +12,20 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/huawei-openlab/harbour/adaptor"
+	"github.com/huawei-openlab/harbour/api/middleware"
+	"github.com/huawei-openlab/harbour/cri"
+	"github.com/huawei-openlab/harbour/driver"
+	"github.com/huawei-openlab/harbour/driver/emulator"
 	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/engine/backend"
 	"github.com/huawei-openlab/harbour/engine/trap"
 
 	"github.com/Sirupsen/logrus"
@@ -29,7 +36,31 @@ import (
 )
 
 type Server struct {
+	eng    *engine.Engine
 	router *mux.Router
+
+	// handler is the router wrapped in the middlewares of config, swapped
+	// when the configuration is reloaded.
+	mu             sync.RWMutex
+	handler        http.Handler
+	chain          middleware.Chain
+	config         *engine.Config
+	configFile     string
+	configRequired bool
+
+	// driver serves the native API, and the CRI through cri when harbour
+	// runs for a kubelet.
+	driver driver.Driver
+	cri    *cri.Server
+
+	sessions sessions
+	// admin is set when the admin API has listeners of its own.
+	admin bool
+
+	// TLSConfig secures the TCP sockets when set.
+	TLSConfig *tls.Config
+	// Force takes over the unix sockets other processes serve.
+	Force bool
 }
 
 type HttpServer struct {
@@ -56,11 +87,20 @@ func httpError(w http.ResponseWriter, err error) {
 	// If we need to differentiate between different possible error types, we should
 	// create appropriate error types with clearly defined meaning.
 	errStr := strings.ToLower(err.Error())
+	// The cause of an unavailable daemon, e.g. its socket is missing, would
+	// match the other keywords.
+	if strings.HasPrefix(errStr, "service unavailable") {
+		errStr = ""
+		statusCode = http.StatusServiceUnavailable
+	}
 	for keyword, status := range map[string]int{
 		"not found":             http.StatusNotFound,
 		"no such":               http.StatusNotFound,
 		"bad parameter":         http.StatusBadRequest,
+		"too large":             http.StatusRequestEntityTooLarge,
+		"too many requests":     http.StatusTooManyRequests,
 		"conflict":              http.StatusConflict,
+		"forbidden":             http.StatusForbidden,
 		"impossible":            http.StatusNotAcceptable,
 		"wrong login/password":  http.StatusUnauthorized,
 		"hasn't been activated": http.StatusForbidden,
@@ -93,7 +133,7 @@ func getHandlerProc(eng *engine.Engine, w http.ResponseWriter, r *http.Request,
 	logrus.Debugf("Request's url: %v", r.URL)
 	logrus.Debugf("Request's url path: %v", r.URL.Path)
 
-	err = adaptor.Rkt_Rundockercmd(r, adaptor.GET)
+	err = adaptor.Rkt_Rundockercmd(w, r, adaptor.GET)
 
 	return err
 }
@@ -104,7 +144,7 @@ func postHandlerProc(eng *engine.Engine, w http.ResponseWriter, r *http.Request,
 	logrus.Debugf("Request's url: %v", r.URL)
 	logrus.Debugf("Request's url path: %v", r.URL.Path)
 
-	err = adaptor.Rkt_Rundockercmd(r, adaptor.POST)
+	err = adaptor.Rkt_Rundockercmd(w, r, adaptor.POST)
 
 	return err
 }
@@ -115,12 +155,17 @@ func deleteHandlerProc(eng *engine.Engine, w http.ResponseWriter, r *http.Reques
 	logrus.Debugf("Request's url: %v", r.URL)
 	logrus.Debugf("Request's url path: %v", r.URL.Path)
 
-	err = adaptor.Rkt_Rundockercmd(r, adaptor.DELETE)
+	err = adaptor.Rkt_Rundockercmd(w, r, adaptor.DELETE)
 
 	return err
 
 }
-func createRouterDocker(eng *engine.Engine, srv *Server, kube bool) *mux.Router {
+func emulatedHandlerProc(eng *engine.Engine, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	logrus.Debugf("Request's url path: %v", r.URL.Path)
+	return emulator.Rundockercmd(w, r)
+}
+
+func createRouterDocker(eng *engine.Engine, srv *Server) *mux.Router {
 	r := mux.NewRouter()
 	m := map[string]map[string]HttpApiFunc{
 		"GET": {
@@ -133,6 +178,8 @@ func createRouterDocker(eng *engine.Engine, srv *Server, kube bool) *mux.Router
 			"": transForwarding,
 		},
 	}
+	srv.addAdminRoutes(m)
+	srv.addNativeRoutes(m)
 
 	for method, routes := range m {
 		keys := []string{}
@@ -163,7 +210,7 @@ func createRouterDocker(eng *engine.Engine, srv *Server, kube bool) *mux.Router
 	return r
 }
 
-func createRouterRkt(eng *engine.Engine, srv *Server, kube bool) *mux.Router {
+func createRouterRkt(eng *engine.Engine, srv *Server) *mux.Router {
 	r := mux.NewRouter()
 	m := map[string]map[string]HttpApiFunc{
 		"GET": {
@@ -176,6 +223,8 @@ func createRouterRkt(eng *engine.Engine, srv *Server, kube bool) *mux.Router {
 			"": deleteHandlerProc,
 		},
 	}
+	srv.addAdminRoutes(m)
+	srv.addNativeRoutes(m)
 
 	for method, routes := range m {
 		keys := []string{}
@@ -206,43 +255,169 @@ func createRouterRkt(eng *engine.Engine, srv *Server, kube bool) *mux.Router {
 	return r
 }
 
+// createRouterEmulated serves the runtimes the emulator runs the Docker API
+// on.
+func createRouterEmulated(eng *engine.Engine, srv *Server) *mux.Router {
+	r := mux.NewRouter()
+	m := map[string]map[string]HttpApiFunc{
+		"GET": {
+			"": emulatedHandlerProc,
+		},
+		"POST": {
+			"": emulatedHandlerProc,
+		},
+		"DELETE": {
+			"": emulatedHandlerProc,
+		},
+	}
+	srv.addAdminRoutes(m)
+	srv.addNativeRoutes(m)
+
+	name := engine.RuntimeNames[eng.RuntimeType]
+	for method, routes := range m {
+		keys := []string{}
+		for route := range routes {
+			keys = append(keys, route)
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+		for _, route := range keys {
+			logrus.Debugf("Registering %s, %s for %s", method, route, name)
+			f := makeHttpHandler(eng, method, route, routes[route])
+			if route == "" {
+				r.Methods(method).HandlerFunc(f)
+			} else {
+				r.Path(route).Methods(method).HandlerFunc(f)
+			}
+		}
+	}
+
+	return r
+}
+
+// New creates the server of the API of eng. With kube, it serves the CRI of
+// Kubernetes too, on engine.CRISocket.
 func New(eng *engine.Engine, kube bool) *Server {
 	var r *mux.Router
 
-	srv := &Server{}
+	srv := &Server{eng: eng, sessions: sessions{active: map[uint64]*Session{}}}
 	if eng.RuntimeType == engine.RuntimeRkt {
-		r = createRouterRkt(eng, srv, kube)
+		r = createRouterRkt(eng, srv)
+	} else if emulator.Registered(engine.RuntimeNames[eng.RuntimeType]) {
+		r = createRouterEmulated(eng, srv)
 	} else {
-		r = createRouterDocker(eng, srv, kube)
+		r = createRouterDocker(eng, srv)
 	}
 	srv.router = r
+	srv.handler = r
+
+	d, err := driver.New(engine.RuntimeNames[eng.RuntimeType], pipeline{srv})
+	if err != nil {
+		logrus.Warnf("The native API is not available: %s", err)
+	}
+	srv.driver = d
+	if kube && d != nil {
+		srv.cri = cri.New(d, engine.PodInfraImage)
+	}
 
 	return srv
 }
 
-func (s *Server) newServer(proto, addr string) (*HttpServer, error) {
+// Use runs the middlewares of chain around every request.
+func (s *Server) Use(chain middleware.Chain) {
+	s.mu.Lock()
+	s.chain = chain
+	s.handler = chain.Handler(s.router, httpError)
+	s.mu.Unlock()
+}
+
+// Configure runs the middlewares of config, read from path, around every
+// request, and forwards to its docker daemons. The admin API reloads it from
+// path on demand.
+func (s *Server) Configure(path string, required bool, config *engine.Config) error {
+	chain, err := middleware.New(config.Middlewares)
+	if err != nil {
+		return err
+	}
+	if s.eng.Backends != nil {
+		if err := s.eng.Backends.Update(config.Backends); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.config, s.configFile, s.configRequired = config, path, required
+	s.mu.Unlock()
+	s.Use(chain)
+	return nil
+}
+
+// Reload reads the configuration file again. The requests already
+// dispatched finish with the previous middlewares.
+func (s *Server) Reload() error {
+	s.mu.RLock()
+	path, required := s.configFile, s.configRequired
+	s.mu.RUnlock()
+	if path == "" {
+		return fmt.Errorf("Impossible to reload, harbour was started without a configuration file")
+	}
+	config, err := engine.LoadConfig(path, required)
+	if err != nil {
+		return err
+	}
+	if err := s.Configure(path, required, config); err != nil {
+		return err
+	}
+	logrus.Infof("Reloaded the configuration from %s", path)
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.admin && isAdminPath(r.URL.Path) {
+		http.NotFound(w, r)
+		return
+	}
+	defer s.sessions.start(r)()
+	s.mu.RLock()
+	h := s.handler
+	s.mu.RUnlock()
+	h.ServeHTTP(w, r)
+}
+
+func (s *Server) newServer(proto, addr string, admin bool) (*HttpServer, error) {
+	var handler http.Handler = s
+	if admin {
+		handler = s.adminHandler()
+	}
 	switch proto {
 	case "tcp":
 		l, err := net.Listen("tcp", addr)
 		if err != nil {
 			return nil, err
 		}
-		return &HttpServer{&http.Server{Addr: addr, Handler: s.router}, l}, nil
+		if s.TLSConfig != nil {
+			l = tls.NewListener(l, s.TLSConfig)
+		} else {
+			logrus.Warnf("Listening on %s without TLS, anyone reaching it controls the backend", addr)
+		}
+		return &HttpServer{&http.Server{Addr: addr, Handler: handler, ConnContext: middleware.ConnContext}, l}, nil
 	case "unix":
-		os.Remove(addr)
-		l, err := net.Listen("unix", addr)
+		l, err := listenUnix(addr, s.Force)
 		if err != nil {
 			return nil, err
 		}
-		if err := setSocketGroup(addr, engine.SocketGroup); err != nil {
-			l.Close()
-			return nil, err
+		// The admin sockets are left to root.
+		mode := os.FileMode(0600)
+		if !admin {
+			if err := setSocketGroup(addr, engine.SocketGroup); err != nil {
+				l.Close()
+				return nil, err
+			}
+			mode = 0660
 		}
-		if err := os.Chmod(addr, 0660); err != nil {
+		if err := os.Chmod(addr, mode); err != nil {
 			l.Close()
 			return nil, err
 		}
-		return &HttpServer{&http.Server{Addr: addr, Handler: s.router}, l}, nil
+		return &HttpServer{&http.Server{Addr: addr, Handler: handler, ConnContext: middleware.ConnContext}, l}, nil
 	default:
 		return nil, fmt.Errorf("Invalid protocol format.")
 	}
@@ -292,34 +467,53 @@ func lookupGidByName(nameOrGid string) (int, error) {
 	return -1, fmt.Errorf("Group %s not found", nameOrGid)
 }
 
-func (s *Server) CreateServer(eng *engine.Engine, protoAddrs []string) error {
-	var chErrors = make(chan error, len(protoAddrs))
+// CreateServer serves the API on protoAddrs. The admin API is only served on
+// adminAddrs if there are any.
+func (s *Server) CreateServer(eng *engine.Engine, protoAddrs []string, adminAddrs []string) error {
+	s.admin = len(adminAddrs) > 0
+	servers := len(protoAddrs) + len(adminAddrs)
+	if s.cri != nil {
+		servers++
+	}
+	var chErrors = make(chan error, servers)
+
+	serve := func(newServer func() (*HttpServer, error)) {
+		srv, err := newServer()
+		if err != nil {
+			chErrors <- err
+			return
+		}
+		trap.ShutdownCallback(func() {
+			if err := srv.Close(); err != nil {
+				logrus.Errorln(err)
+			}
+		})
+		if err = srv.Serve(); err != nil && strings.Contains(err.Error(), "use of closed network connection") {
+			err = nil
+		}
+		chErrors <- err
+	}
 
-	for _, protoAddr := range protoAddrs {
+	addrs := append(append([]string{}, protoAddrs...), adminAddrs...)
+	for i, protoAddr := range addrs {
 		protoAddrParts := strings.SplitN(protoAddr, "://", 2)
 		if len(protoAddrParts) != 2 {
-			return fmt.Errorf("usage: %s PROTO://ADDR [PROTO://ADDR ...]")
+			return fmt.Errorf("usage: %s PROTO://ADDR [PROTO://ADDR ...]", protoAddr)
 		}
-		go func() {
+		admin := i >= len(protoAddrs)
+		go serve(func() (*HttpServer, error) {
 			logrus.Debugf("Listening for HTTP on %s (%s)", protoAddrParts[0], protoAddrParts[1])
-			srv, err := s.newServer(protoAddrParts[0], protoAddrParts[1])
-			if err != nil {
-				chErrors <- err
-				return
-			}
-			trap.ShutdownCallback(func() {
-				if err := srv.Close(); err != nil {
-					logrus.Errorln(err)
-				}
-			})
-			if err = srv.Serve(); err != nil && strings.Contains(err.Error(), "use of closed network connection") {
-				err = nil
-			}
-			chErrors <- err
-		}()
+			return s.newServer(protoAddrParts[0], protoAddrParts[1], admin)
+		})
+	}
+	if s.cri != nil {
+		go serve(func() (*HttpServer, error) {
+			logrus.Debugf("Listening for the CRI on %s", engine.CRISocket)
+			return s.newCRIServer(engine.CRISocket)
+		})
 	}
 
-	for i := 0; i < len(protoAddrs); i++ {
+	for i := 0; i < servers; i++ {
 		err := <-chErrors
 		if err != nil {
 			logrus.Errorln(err)
@@ -330,6 +524,25 @@ func (s *Server) CreateServer(eng *engine.Engine, protoAddrs []string) error {
 	return nil
 }
 
+// newCRIServer listens for the kubelet on the unix socket path. gRPC runs
+// over HTTP/2, which the kubelet speaks there without TLS.
+func (s *Server) newCRIServer(path string) (*HttpServer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	l, err := listenUnix(path, s.Force)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+	return &HttpServer{&http.Server{Addr: path, Handler: s.cri, ConnContext: middleware.ConnContext, Protocols: protocols}, l}, nil
+}
+
 func hijackServer(w http.ResponseWriter) (io.ReadCloser, io.Writer, error) {
 	conn, _, err := w.(http.Hijacker).Hijack()
 	if err != nil {
@@ -379,6 +592,13 @@ func transForwarding(eng *engine.Engine, w http.ResponseWriter, r *http.Request,
 		r.Body = newBody
 	}
 
+	if fansOut(eng, r) {
+		return listContainers(eng, w, r)
+	}
+	b, err := route(eng, r)
+	if err != nil {
+		return err
+	}
 	r.URL.Scheme = "http"
 	r.URL.Host = "unix.sock"
 	r.RequestURI = ""
@@ -393,10 +613,9 @@ func transForwarding(eng *engine.Engine, w http.ResponseWriter, r *http.Request,
 	case "stream":
 		{
 			logrus.Debugf("Stream mode is running")
-			dial, err := net.Dial("unix", engine.DockerSock)
-			if tcpConn, ok := dial.(*net.TCPConn); ok {
-				tcpConn.SetKeepAlive(true)
-				tcpConn.SetKeepAlivePeriod(30 * time.Second)
+			dial, err := b.Dial()
+			if err != nil {
+				return err
 			}
 			clientconn := httputil.NewClientConn(dial, nil)
 
@@ -433,7 +652,7 @@ func transForwarding(eng *engine.Engine, w http.ResponseWriter, r *http.Request,
 		{
 			logrus.Debugf("fetchStream mode is running")
 
-			resp, err := initClient(r)
+			resp, err := initClient(b, r)
 
 			if err != nil {
 				logrus.Errorf("fetchStream fail: %s", err)
@@ -451,10 +670,9 @@ func transForwarding(eng *engine.Engine, w http.ResponseWriter, r *http.Request,
 		{
 			logrus.Debugf("presist mode is running")
 
-			dial, err := net.Dial("unix", engine.DockerSock)
-			if tcpConn, ok := dial.(*net.TCPConn); ok {
-				tcpConn.SetKeepAlive(true)
-				tcpConn.SetKeepAlivePeriod(30 * time.Second)
+			dial, err := b.Dial()
+			if err != nil {
+				return err
 			}
 			clientconn := httputil.NewClientConn(dial, nil)
 
@@ -514,11 +732,12 @@ func transForwarding(eng *engine.Engine, w http.ResponseWriter, r *http.Request,
 		}
 	case "other":
 		{
-			resp, err := initClient(r)
+			resp, err := initClient(b, r)
 
 			if err != nil {
 				return err
 			}
+			forget(eng, r, resp.StatusCode)
 
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(resp.StatusCode)
@@ -599,15 +818,8 @@ func urlActionSelector(url string, query string, body []byte) (string, error) {
 }
 
 //client init,return the response
-func initClient(r *http.Request) (*http.Response, error) {
-	unixDial := func(proto, addr string) (net.Conn, error) {
-		return net.Dial("unix", engine.DockerSock)
-	}
-	tr := &http.Transport{
-		Dial:              unixDial,
-		DisableKeepAlives: true,
-	}
-	client := &http.Client{Transport: tr}
+func initClient(b *backend.Backend, r *http.Request) (*http.Response, error) {
+	client := &http.Client{Transport: b.Transport()}
 
 	resp, err := client.Do(r)
 	if err != nil {
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// listenUnix listens on the unix socket path. A socket left there by a
+// process that is gone is replaced, a socket some process still serves only
+// with force, and nothing else is.
+func listenUnix(path string, force bool) (net.Listener, error) {
+	fi, err := os.Lstat(path)
+	if err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("Conflict: %s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			if !force {
+				return nil, fmt.Errorf("Conflict: %s is served by another process, use --force to take it over", path)
+			}
+			logrus.Warnf("Taking over %s from the process serving it", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harbour-socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "docker.sock")
+
+	live, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenUnix(path, false); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("expected a live socket to be refused, got %v", err)
+	}
+	l, err := listenUnix(path, true)
+	if err != nil {
+		t.Fatalf("expected --force to take the socket over, got %v", err)
+	}
+	live.(*net.UnixListener).SetUnlinkOnClose(false)
+	live.Close()
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	// Nothing serves the socket left behind anymore.
+	if _, err := os.Lstat(path); err != nil {
+		t.Fatal(err)
+	}
+	l, err = listenUnix(path, false)
+	if err != nil {
+		t.Fatalf("expected a stale socket to be replaced, got %v", err)
+	}
+	l.Close()
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenUnix(file, true); err == nil {
+		t.Fatal("expected a file to be left alone")
+	}
+}
@@ -0,0 +1,264 @@
+// Package types holds the Docker remote API documents harbour reads and
+// produces when it emulates docker on top of another runtime.
+package types
+
+// ContainerConfig is the body of POST /containers/create.
+type ContainerConfig struct {
+	Hostname     string
+	Domainname   string
+	User         string
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+	ExposedPorts map[string]struct{}
+	Tty          bool
+	OpenStdin    bool
+	StdinOnce    bool
+	Env          []string
+	Cmd          []string
+	Image        string
+	Volumes      map[string]struct{}
+	WorkingDir   string
+	Entrypoint   []string
+	Labels       map[string]string
+	HostConfig   *HostConfig `json:",omitempty"`
+}
+
+// HostConfig is the host dependent part of a container configuration.
+type HostConfig struct {
+	Binds           []string
+	PortBindings    map[string][]PortBinding
+	PublishAllPorts bool
+	NetworkMode     string
+	RestartPolicy   RestartPolicy
+	VolumeDriver    string
+	LogConfig       LogConfig
+
+	Memory      int64
+	MemorySwap  int64
+	CPUShares   int64 `json:"CpuShares"`
+	CPUPeriod   int64 `json:"CpuPeriod"`
+	CPUQuota    int64 `json:"CpuQuota"`
+	CpusetCpus  string
+	BlkioWeight uint16
+	Ulimits     []*Ulimit
+}
+
+type LogConfig struct {
+	Type   string
+	Config map[string]string
+}
+
+type Ulimit struct {
+	Name string
+	Hard int64
+	Soft int64
+}
+
+type PortBinding struct {
+	HostIP   string `json:"HostIp"`
+	HostPort string
+}
+
+type RestartPolicy struct {
+	Name              string
+	MaximumRetryCount int
+}
+
+// ContainerCreateResponse is returned by POST /containers/create.
+type ContainerCreateResponse struct {
+	ID       string `json:"Id"`
+	Warnings []string
+}
+
+type ContainerState struct {
+	Status     string
+	Running    bool
+	Paused     bool
+	Restarting bool
+	OOMKilled  bool
+	Dead       bool
+	Pid        int
+	ExitCode   int
+	Error      string
+	StartedAt  string
+	FinishedAt string
+}
+
+type EndpointSettings struct {
+	IPAddress   string
+	IPPrefixLen int
+	Gateway     string
+	MacAddress  string
+}
+
+type NetworkSettings struct {
+	IPAddress   string
+	IPPrefixLen int
+	Gateway     string
+	MacAddress  string
+	Ports       map[string][]PortBinding
+	Networks    map[string]*EndpointSettings
+}
+
+// ContainerJSON is returned by GET /containers/{id}/json.
+type ContainerJSON struct {
+	ID              string `json:"Id"`
+	Created         string
+	Path            string
+	Args            []string
+	State           *ContainerState
+	Image           string
+	Name            string
+	RestartCount    int
+	Driver          string
+	Config          *ContainerConfig
+	HostConfig      *HostConfig
+	NetworkSettings *NetworkSettings
+	Mounts          []MountPoint
+}
+
+// MountPoint is a volume or bind mount of a container.
+type MountPoint struct {
+	Name        string `json:",omitempty"`
+	Source      string
+	Destination string
+	Driver      string `json:",omitempty"`
+	Mode        string
+	RW          bool
+}
+
+// ContainerWaitResponse is returned by POST /containers/{id}/wait.
+type ContainerWaitResponse struct {
+	StatusCode int
+}
+
+type Port struct {
+	IP          string `json:",omitempty"`
+	PrivatePort int
+	PublicPort  int `json:",omitempty"`
+	Type        string
+}
+
+// Container is an entry of GET /containers/json.
+type Container struct {
+	ID         string `json:"Id"`
+	Names      []string
+	Image      string
+	ImageID    string
+	Command    string
+	Created    int64
+	Ports      []Port
+	Labels     map[string]string
+	State      string
+	Status     string
+	SizeRw     int64 `json:",omitempty"`
+	SizeRootFs int64 `json:",omitempty"`
+	// Runtime is named by the daemons running several runtimes.
+	Runtime string `json:",omitempty"`
+}
+
+// Image is an entry of GET /images/json.
+type Image struct {
+	ID          string `json:"Id"`
+	ParentID    string `json:"ParentId"`
+	RepoTags    []string
+	RepoDigests []string
+	Created     int64
+	Size        int64
+	VirtualSize int64
+	Labels      map[string]string
+	// Runtime is named by the daemons running several runtimes.
+	Runtime string `json:",omitempty"`
+}
+
+// Volume is returned by the /volumes endpoints.
+type Volume struct {
+	Name       string
+	Driver     string
+	Mountpoint string
+	Labels     map[string]string
+	Scope      string
+}
+
+// VolumesListResponse is returned by GET /volumes.
+type VolumesListResponse struct {
+	Volumes  []*Volume
+	Warnings []string
+}
+
+// VolumeCreateRequest is the body of POST /volumes/create.
+type VolumeCreateRequest struct {
+	Name       string
+	Driver     string
+	DriverOpts map[string]string
+	Labels     map[string]string
+}
+
+type CPUUsage struct {
+	TotalUsage        uint64   `json:"total_usage"`
+	PercpuUsage       []uint64 `json:"percpu_usage,omitempty"`
+	UsageInKernelmode uint64   `json:"usage_in_kernelmode"`
+	UsageInUsermode   uint64   `json:"usage_in_usermode"`
+}
+
+type ThrottlingData struct {
+	Periods          uint64 `json:"periods"`
+	ThrottledPeriods uint64 `json:"throttled_periods"`
+	ThrottledTime    uint64 `json:"throttled_time"`
+}
+
+type CPUStats struct {
+	CPUUsage       CPUUsage       `json:"cpu_usage"`
+	SystemUsage    uint64         `json:"system_cpu_usage,omitempty"`
+	OnlineCPUs     uint32         `json:"online_cpus,omitempty"`
+	ThrottlingData ThrottlingData `json:"throttling_data,omitempty"`
+}
+
+type MemoryStats struct {
+	Usage    uint64            `json:"usage,omitempty"`
+	MaxUsage uint64            `json:"max_usage,omitempty"`
+	Stats    map[string]uint64 `json:"stats,omitempty"`
+	Failcnt  uint64            `json:"failcnt,omitempty"`
+	Limit    uint64            `json:"limit,omitempty"`
+}
+
+type BlkioStatEntry struct {
+	Major uint64 `json:"major"`
+	Minor uint64 `json:"minor"`
+	Op    string `json:"op"`
+	Value uint64 `json:"value"`
+}
+
+type BlkioStats struct {
+	IoServiceBytesRecursive []BlkioStatEntry `json:"io_service_bytes_recursive"`
+	IoServicedRecursive     []BlkioStatEntry `json:"io_serviced_recursive"`
+	IoQueuedRecursive       []BlkioStatEntry `json:"io_queue_recursive"`
+	IoServiceTimeRecursive  []BlkioStatEntry `json:"io_service_time_recursive"`
+	IoWaitTimeRecursive     []BlkioStatEntry `json:"io_wait_time_recursive"`
+	IoMergedRecursive       []BlkioStatEntry `json:"io_merged_recursive"`
+	IoTimeRecursive         []BlkioStatEntry `json:"io_time_recursive"`
+	SectorsRecursive        []BlkioStatEntry `json:"sectors_recursive"`
+}
+
+type NetworkStats struct {
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// Stats is a sample of GET /containers/{id}/stats.
+type Stats struct {
+	Read        string                  `json:"read"`
+	PreRead     string                  `json:"preread"`
+	CPUStats    CPUStats                `json:"cpu_stats"`
+	PreCPUStats CPUStats                `json:"precpu_stats"`
+	MemoryStats MemoryStats             `json:"memory_stats"`
+	BlkioStats  BlkioStats              `json:"blkio_stats"`
+	Networks    map[string]NetworkStats `json:"networks,omitempty"`
+}
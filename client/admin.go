@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// The methods of the admin API of harbour, under /harbour/v1/.
+
+const adminPrefix = "/harbour/v1"
+
+// Info describes the daemon and the health of its runtime.
+type Info struct {
+	Version string
+	Started time.Time
+	Uptime  string
+	Runtime string
+	Backend struct {
+		Healthy bool
+		Error   string
+	}
+	ConfigFile string
+}
+
+// Info describes the daemon.
+func (c *Client) Info(ctx context.Context) (*Info, error) {
+	info := &Info{}
+	if err := c.call(ctx, "GET", adminPrefix+"/info", nil, nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// RuntimeStatus tells whether a runtime is active and found on the host of
+// the daemon.
+type RuntimeStatus struct {
+	Name      string
+	Active    bool
+	Available bool
+	Path      string
+}
+
+// RuntimeStatuses lists the runtimes harbour knows of, whether the daemon
+// serves them or not.
+func (c *Client) RuntimeStatuses(ctx context.Context) ([]RuntimeStatus, error) {
+	var runtimes []RuntimeStatus
+	err := c.call(ctx, "GET", adminPrefix+"/runtimes", nil, nil, &runtimes)
+	return runtimes, err
+}
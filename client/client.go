@@ -0,0 +1,139 @@
+// Package client is the Go client of harbour. It covers the native API of
+// harbour and the docker API it serves, whatever the runtime behind them.
+//
+//	c, err := client.New("unix:///var/run/docker.sock", nil)
+//	if err != nil {
+//		return err
+//	}
+//	containers, err := c.Containers(ctx, "", true)
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/huawei-openlab/harbour/opts"
+)
+
+// Client talks to a harbour daemon. It is safe for concurrent use.
+type Client struct {
+	proto     string
+	addr      string
+	tlsConfig *tls.Config
+	dialer    net.Dialer
+	http      *http.Client
+}
+
+// New creates a client of the daemon at host, an address in any form the
+// -H flag of harbour takes: unix:///path, tcp://host:port or host:port.
+// tlsConfig secures TCP connections when set.
+func New(host string, tlsConfig *tls.Config) (*Client, error) {
+	host, err := opts.ParseHost(opts.DEFAULTHTTPHOST, opts.DEFAULTUNIXSOCKET, host)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(host, "://", 2)
+	if parts[0] != "unix" && parts[0] != "tcp" {
+		return nil, fmt.Errorf("Impossible to dial %s, harbour is reached over unix or tcp", host)
+	}
+
+	c := &Client{proto: parts[0], addr: parts[1]}
+	if c.proto == "tcp" {
+		c.tlsConfig = tlsConfig
+	}
+	c.http = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return c.dialer.DialContext(ctx, c.proto, c.addr)
+			},
+			TLSClientConfig: c.tlsConfig,
+		},
+	}
+	return c, nil
+}
+
+// Close releases the idle connections of the client.
+func (c *Client) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+func (c *Client) url(path string, query url.Values) string {
+	scheme, host := "http", c.addr
+	if c.tlsConfig != nil {
+		scheme = "https"
+	}
+	if c.proto != "tcp" {
+		// Any name does, the transport dials the socket.
+		host = "harbour"
+	}
+	u := scheme + "://" + host + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// do sends a request to the daemon. The body of the response is left to the
+// caller, unless the daemon answered with an error.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var in io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		in = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.url(path, query), in)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("Cannot connect to the harbour daemon at %s://%s: %s", c.proto, c.addr, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// call sends a request and decodes the JSON answer into v, if v is not nil.
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, body, v interface{}) error {
+	resp, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// runtimeQuery names runtime in a query, the daemon uses its active one when
+// none is named.
+func runtimeQuery(runtime string) url.Values {
+	query := url.Values{}
+	if runtime != "" {
+		query.Set("runtime", runtime)
+	}
+	return query
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc) (*Client, func()) {
+	ts := httptest.NewServer(h)
+	c, err := New(strings.TrimPrefix(ts.URL, "http://"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, ts.Close
+}
+
+func TestErrors(t *testing.T) {
+	c, done := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/harbour/api/v1/containers/nope":
+			http.Error(w, "No such container: nope", http.StatusNotFound)
+		case "/containers/create":
+			w.Header().Set("Retry-After", "3")
+			http.Error(w, "Too many requests: create", http.StatusTooManyRequests)
+		case "/containers/json":
+			http.Error(w, "Service unavailable: all the docker daemons are down", http.StatusServiceUnavailable)
+		case "/harbour/api/v1/pods":
+			w.WriteHeader(http.StatusNotAcceptable)
+			fmt.Fprint(w, `{"message": "Impossible to list pods, the runtime has none"}`)
+		}
+	})
+	defer done()
+	ctx := context.Background()
+
+	if _, err := c.Container(ctx, "", "nope"); !IsNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+	_, err := c.ContainerCreate(ctx, "", nil)
+	if !IsTooManyRequests(err) || err.(*Error).RetryAfter != 3*time.Second {
+		t.Fatalf("expected a too many requests error with its delay, got %#v", err)
+	}
+	if _, err := c.ContainerList(ctx, false); !IsServiceUnavailable(err) {
+		t.Fatalf("expected a service unavailable error, got %v", err)
+	}
+	_, err = c.Pods(ctx, "docker")
+	if !IsImpossible(err) || err.(*Error).Message != "Impossible to list pods, the runtime has none" {
+		t.Fatalf("expected the message of the daemon, got %v", err)
+	}
+}
+
+func TestNative(t *testing.T) {
+	c, done := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/harbour/api/v1/containers" || r.URL.Query().Get("runtime") != "rkt" || r.URL.Query().Get("all") != "1" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `[{"ID": "abc", "Runtime": "rkt", "State": "running"}]`)
+	})
+	defer done()
+
+	containers, err := c.Containers(context.Background(), "rkt", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].Runtime != "rkt" || containers[0].State != "running" {
+		t.Fatalf("unexpected containers %+v", containers)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	c, done := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"status": "create", "id": "abc", "Type": "container"}`)
+		fmt.Fprintln(w, `{"status": "start", "id": "abc", "Type": "container"}`)
+	})
+	defer done()
+
+	messages, errs := c.Events(context.Background(), EventsOptions{Filters: map[string][]string{"type": {"container"}}})
+	var got []string
+	for m := range messages {
+		got = append(got, m.Status)
+	}
+	select {
+	case err := <-errs:
+		t.Fatal(err)
+	default:
+	}
+	if strings.Join(got, ",") != "create,start" {
+		t.Fatalf("unexpected events %v", got)
+	}
+}
+
+func TestNewRejectsFd(t *testing.T) {
+	if _, err := New("fd://3", nil); err == nil {
+		t.Fatal("expected fd:// to be rejected")
+	}
+}
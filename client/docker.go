@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/huawei-openlab/harbour/api/types"
+)
+
+// The methods of the docker API, served by harbour whatever the runtime.
+
+// Ping checks that the daemon answers.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.call(ctx, "GET", "/_ping", nil, nil, nil)
+}
+
+// Version is the answer to GET /version.
+type Version struct {
+	Version       string
+	APIVersion    string `json:"ApiVersion"`
+	GitCommit     string
+	GoVersion     string
+	Os            string
+	Arch          string
+	KernelVersion string `json:",omitempty"`
+}
+
+// ServerVersion returns the version of the daemon behind harbour.
+func (c *Client) ServerVersion(ctx context.Context) (*Version, error) {
+	v := &Version{}
+	if err := c.call(ctx, "GET", "/version", nil, nil, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ContainerList lists the containers, the stopped ones too when all is set.
+func (c *Client) ContainerList(ctx context.Context, all bool) ([]types.Container, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "1")
+	}
+	var containers []types.Container
+	err := c.call(ctx, "GET", "/containers/json", query, nil, &containers)
+	return containers, err
+}
+
+// ContainerInspect describes the container id.
+func (c *Client) ContainerInspect(ctx context.Context, id string) (*types.ContainerJSON, error) {
+	container := &types.ContainerJSON{}
+	if err := c.call(ctx, "GET", "/containers/"+id+"/json", nil, nil, container); err != nil {
+		return nil, err
+	}
+	return container, nil
+}
+
+// ContainerCreate creates a container from config, named name if not empty.
+func (c *Client) ContainerCreate(ctx context.Context, name string, config *types.ContainerConfig) (*types.ContainerCreateResponse, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+	created := &types.ContainerCreateResponse{}
+	if err := c.call(ctx, "POST", "/containers/create", query, config, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// ContainerStart starts the container id.
+func (c *Client) ContainerStart(ctx context.Context, id string) error {
+	return c.call(ctx, "POST", "/containers/"+id+"/start", nil, nil, nil)
+}
+
+// ContainerStop stops the container id, killing it after timeout.
+func (c *Client) ContainerStop(ctx context.Context, id string, timeout time.Duration) error {
+	query := url.Values{"t": {strconv.Itoa(int(timeout.Seconds()))}}
+	return c.call(ctx, "POST", "/containers/"+id+"/stop", query, nil, nil)
+}
+
+// ContainerWait waits for the container id to exit and returns its exit
+// code. Cancel ctx to stop waiting.
+func (c *Client) ContainerWait(ctx context.Context, id string) (int, error) {
+	var resp types.ContainerWaitResponse
+	if err := c.call(ctx, "POST", "/containers/"+id+"/wait", nil, nil, &resp); err != nil {
+		return -1, err
+	}
+	return resp.StatusCode, nil
+}
+
+// ContainerRemove removes the container id, killing it first if force is
+// set, along with its anonymous volumes if volumes is set.
+func (c *Client) ContainerRemove(ctx context.Context, id string, force, volumes bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+	if volumes {
+		query.Set("v", "1")
+	}
+	return c.call(ctx, "DELETE", "/containers/"+id, query, nil, nil)
+}
+
+// ImageList lists the images, the intermediate ones too when all is set.
+func (c *Client) ImageList(ctx context.Context, all bool) ([]types.Image, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "1")
+	}
+	var images []types.Image
+	err := c.call(ctx, "GET", "/images/json", query, nil, &images)
+	return images, err
+}
+
+// ImagePull pulls ref, a name with a tag or a digest, and returns once it
+// is done. progress is given the progress messages of the daemon if not nil.
+func (c *Client) ImagePull(ctx context.Context, ref string, progress func(JSONMessage)) error {
+	name, tag := ref, "latest"
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, tag = name[:i], name[i+1:]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	query := url.Values{"fromImage": {name}, "tag": {tag}}
+	resp, err := c.do(ctx, "POST", "/images/create", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return ReadJSONMessages(resp.Body, progress)
+}
+
+// ImageRemove removes the image id.
+func (c *Client) ImageRemove(ctx context.Context, id string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+	return c.call(ctx, "DELETE", "/images/"+id, query, nil, nil)
+}
+
+// ExecConfig describes a command to run in a container.
+type ExecConfig struct {
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+	Tty          bool
+	Cmd          []string
+}
+
+// ExecCreate prepares config to run in the container id and returns the ID
+// of the exec, for ExecStart.
+func (c *Client) ExecCreate(ctx context.Context, id string, config *ExecConfig) (string, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := c.call(ctx, "POST", "/containers/"+id+"/exec", nil, config, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// ExecInspect returns whether the exec id runs and its exit code once it is
+// done.
+func (c *Client) ExecInspect(ctx context.Context, id string) (running bool, exitCode int, err error) {
+	var inspect struct {
+		Running  bool
+		ExitCode int
+	}
+	if err := c.call(ctx, "GET", "/exec/"+id+"/json", nil, nil, &inspect); err != nil {
+		return false, -1, err
+	}
+	return inspect.Running, inspect.ExitCode, nil
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is an error the daemon answered with.
+type Error struct {
+	StatusCode int
+	Message    string
+	// RetryAfter is how long to wait before retrying a request the daemon
+	// refused for too many requests, 0 if it did not say.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return "Error response from daemon: " + e.Message
+}
+
+func responseError(resp *http.Response) error {
+	data, _ := ioutil.ReadAll(resp.Body)
+	e := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	// Docker wraps its errors in JSON, harbour sends them as text.
+	var body struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Message != "" {
+		e.Message = body.Message
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(s) * time.Second
+	}
+	return e
+}
+
+func hasStatus(err error, code int) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == code
+}
+
+// IsNotFound tells whether err reports a missing container, image or route.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsBadParameter tells whether err reports an invalid request.
+func IsBadParameter(err error) bool {
+	return hasStatus(err, http.StatusBadRequest)
+}
+
+// IsConflict tells whether err reports a conflict, such as a name in use.
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// IsForbidden tells whether err reports a request refused by the policies
+// of the daemon.
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+// IsImpossible tells whether err reports a request the runtime cannot
+// serve, such as pods on docker.
+func IsImpossible(err error) bool {
+	return hasStatus(err, http.StatusNotAcceptable)
+}
+
+// IsTooLarge tells whether err reports a request body over the limit of the
+// daemon.
+func IsTooLarge(err error) bool {
+	return hasStatus(err, http.StatusRequestEntityTooLarge)
+}
+
+// IsTooManyRequests tells whether err reports a request refused by the
+// rate limits of the daemon. Its RetryAfter says when to retry.
+func IsTooManyRequests(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+// IsServiceUnavailable tells whether err reports that the docker daemons
+// behind harbour are down.
+func IsServiceUnavailable(err error) bool {
+	return hasStatus(err, http.StatusServiceUnavailable)
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/huawei-openlab/harbour/driver"
+)
+
+// The methods of the native API take the runtime to ask, the active runtime
+// of the daemon when empty.
+
+const nativePrefix = "/harbour/api/v1"
+
+// Containers lists the containers of runtime, the stopped ones too when all
+// is set.
+func (c *Client) Containers(ctx context.Context, runtime string, all bool) ([]*driver.Container, error) {
+	query := runtimeQuery(runtime)
+	if all {
+		query.Set("all", "1")
+	}
+	var containers []*driver.Container
+	err := c.call(ctx, "GET", nativePrefix+"/containers", query, nil, &containers)
+	return containers, err
+}
+
+// Container describes the container id of runtime.
+func (c *Client) Container(ctx context.Context, runtime, id string) (*driver.Container, error) {
+	container := &driver.Container{}
+	if err := c.call(ctx, "GET", nativePrefix+"/containers/"+id, runtimeQuery(runtime), nil, container); err != nil {
+		return nil, err
+	}
+	return container, nil
+}
+
+// CreateContainer creates a container with the runtime of spec.
+func (c *Client) CreateContainer(ctx context.Context, spec *driver.ContainerSpec) (*driver.Container, error) {
+	container := &driver.Container{}
+	if err := c.call(ctx, "POST", nativePrefix+"/containers", nil, spec, container); err != nil {
+		return nil, err
+	}
+	return container, nil
+}
+
+// StartContainer starts the container id of runtime.
+func (c *Client) StartContainer(ctx context.Context, runtime, id string) error {
+	return c.call(ctx, "POST", nativePrefix+"/containers/"+id+"/start", runtimeQuery(runtime), nil, nil)
+}
+
+// StopContainer stops the container id of runtime, killing it after timeout.
+func (c *Client) StopContainer(ctx context.Context, runtime, id string, timeout time.Duration) error {
+	query := runtimeQuery(runtime)
+	query.Set("timeout", strconv.Itoa(int(timeout.Seconds())))
+	return c.call(ctx, "POST", nativePrefix+"/containers/"+id+"/stop", query, nil, nil)
+}
+
+// RemoveContainer removes the container id of runtime, killing it first if
+// force is set.
+func (c *Client) RemoveContainer(ctx context.Context, runtime, id string, force bool) error {
+	query := runtimeQuery(runtime)
+	if force {
+		query.Set("force", "1")
+	}
+	return c.call(ctx, "DELETE", nativePrefix+"/containers/"+id, query, nil, nil)
+}
+
+// Images lists the images of runtime.
+func (c *Client) Images(ctx context.Context, runtime string) ([]*driver.Image, error) {
+	var images []*driver.Image
+	err := c.call(ctx, "GET", nativePrefix+"/images", runtimeQuery(runtime), nil, &images)
+	return images, err
+}
+
+// PullImage pulls ref with runtime and returns once it is done.
+func (c *Client) PullImage(ctx context.Context, runtime, ref string) error {
+	body := struct {
+		Runtime string
+		Image   string
+	}{runtime, ref}
+	return c.call(ctx, "POST", nativePrefix+"/images", nil, body, nil)
+}
+
+// RemoveImage removes the image id of runtime.
+func (c *Client) RemoveImage(ctx context.Context, runtime, id string) error {
+	return c.call(ctx, "DELETE", nativePrefix+"/images/"+id, runtimeQuery(runtime), nil, nil)
+}
+
+// Pods lists the pods of runtime. It fails with an error IsImpossible
+// recognizes for the runtimes without pods.
+func (c *Client) Pods(ctx context.Context, runtime string) ([]*driver.Pod, error) {
+	var pods []*driver.Pod
+	err := c.call(ctx, "GET", nativePrefix+"/pods", runtimeQuery(runtime), nil, &pods)
+	return pods, err
+}
+
+// Runtimes lists the runtimes the daemon serves.
+func (c *Client) Runtimes(ctx context.Context) ([]*driver.RuntimeInfo, error) {
+	var runtimes []*driver.RuntimeInfo
+	err := c.call(ctx, "GET", nativePrefix+"/runtimes", nil, nil, &runtimes)
+	return runtimes, err
+}
+
+// OpenAPI returns the OpenAPI document of the native API.
+func (c *Client) OpenAPI(ctx context.Context) ([]byte, error) {
+	resp, err := c.do(ctx, "GET", nativePrefix+"/openapi.json", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,289 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/huawei-openlab/harbour/engine/events"
+)
+
+// JSONMessage is a message of the progress streams of the daemon, such as
+// the one of a pull.
+type JSONMessage struct {
+	ID       string `json:"id,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Progress string `json:"progress,omitempty"`
+	Stream   string `json:"stream,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ReadJSONMessages reads the progress stream r until its end, giving its
+// messages to fn if not nil, and returns the error the stream ended with.
+func ReadJSONMessages(r io.Reader, fn func(JSONMessage)) error {
+	dec := json.NewDecoder(r)
+	for {
+		var m JSONMessage
+		if err := dec.Decode(&m); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if m.Error != "" {
+			return fmt.Errorf("%s", m.Error)
+		}
+		if fn != nil {
+			fn(m)
+		}
+	}
+}
+
+// StdCopy splits the multiplexed stream the daemon sends for the containers
+// without a tty into stdout and stderr.
+func StdCopy(stdout, stderr io.Writer, r io.Reader) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return err
+		}
+	}
+}
+
+// LogsOptions selects the logs of a container.
+type LogsOptions struct {
+	Stdout     bool
+	Stderr     bool
+	Follow     bool
+	Timestamps bool
+	// Tail is the number of lines to show from the end, all when empty.
+	Tail  string
+	Since time.Time
+}
+
+// ContainerLogs streams the logs of the container id, multiplexed with
+// StdCopy unless the container has a tty. Cancel ctx or close the stream to
+// stop following.
+func (c *Client) ContainerLogs(ctx context.Context, id string, options LogsOptions) (io.ReadCloser, error) {
+	query := url.Values{}
+	for k, v := range map[string]bool{"stdout": options.Stdout, "stderr": options.Stderr, "follow": options.Follow, "timestamps": options.Timestamps} {
+		if v {
+			query.Set(k, "1")
+		}
+	}
+	if options.Tail != "" {
+		query.Set("tail", options.Tail)
+	}
+	if !options.Since.IsZero() {
+		query.Set("since", strconv.FormatInt(options.Since.Unix(), 10))
+	}
+	resp, err := c.do(ctx, "GET", "/containers/"+id+"/logs", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// EventsOptions selects the events to receive.
+type EventsOptions struct {
+	Since time.Time
+	// Until ends the stream, it is endless when zero.
+	Until time.Time
+	// Filters are the filters of docker events, e.g. {"type": {"container"}}.
+	Filters map[string][]string
+}
+
+// Events streams the events of the daemon. The events channel is closed
+// when the stream ends, after the error that ended it if any is sent on the
+// errors channel. Cancel ctx to stop.
+func (c *Client) Events(ctx context.Context, options EventsOptions) (<-chan events.Message, <-chan error) {
+	messages := make(chan events.Message)
+	errs := make(chan error, 1)
+
+	query := url.Values{}
+	if !options.Since.IsZero() {
+		query.Set("since", strconv.FormatInt(options.Since.Unix(), 10))
+	}
+	if !options.Until.IsZero() {
+		query.Set("until", strconv.FormatInt(options.Until.Unix(), 10))
+	}
+	if len(options.Filters) > 0 {
+		data, err := json.Marshal(options.Filters)
+		if err != nil {
+			errs <- err
+			close(messages)
+			return messages, errs
+		}
+		query.Set("filters", string(data))
+	}
+
+	go func() {
+		defer close(messages)
+		resp, err := c.do(ctx, "GET", "/events", query, nil)
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer resp.Body.Close()
+		dec := json.NewDecoder(resp.Body)
+		for {
+			var m events.Message
+			if err := dec.Decode(&m); err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					errs <- err
+				}
+				return
+			}
+			select {
+			case messages <- m:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return messages, errs
+}
+
+// HijackedResponse is a connection the daemon took over, for attach and
+// exec. Reader reads what the container writes, Conn writes to its stdin.
+type HijackedResponse struct {
+	Conn   net.Conn
+	Reader *bufio.Reader
+
+	stop func() bool
+}
+
+// Close closes the connection.
+func (h *HijackedResponse) Close() error {
+	h.stop()
+	return h.Conn.Close()
+}
+
+// CloseWrite tells the container its stdin is done.
+func (h *HijackedResponse) CloseWrite() error {
+	if cw, ok := h.Conn.(interface {
+		CloseWrite() error
+	}); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// AttachOptions selects the streams to attach to.
+type AttachOptions struct {
+	Stdin  bool
+	Stdout bool
+	Stderr bool
+	// Logs replays the output of the container before streaming it.
+	Logs bool
+}
+
+// ContainerAttach attaches to the streams of the container id. The output
+// is multiplexed with StdCopy unless the container has a tty. Cancelling ctx
+// closes the connection.
+func (c *Client) ContainerAttach(ctx context.Context, id string, options AttachOptions) (*HijackedResponse, error) {
+	query := url.Values{"stream": {"1"}}
+	for k, v := range map[string]bool{"stdin": options.Stdin, "stdout": options.Stdout, "stderr": options.Stderr, "logs": options.Logs} {
+		if v {
+			query.Set(k, "1")
+		}
+	}
+	return c.hijack(ctx, "/containers/"+id+"/attach", query, nil)
+}
+
+// ExecStart starts the exec id, created with ExecCreate, attached to its
+// streams. tty must be the one of its ExecConfig.
+func (c *Client) ExecStart(ctx context.Context, id string, tty bool) (*HijackedResponse, error) {
+	body := struct {
+		Detach bool
+		Tty    bool
+	}{false, tty}
+	return c.hijack(ctx, "/exec/"+id+"/start", nil, body)
+}
+
+// ExecStartDetached starts the exec id in the background, without its
+// streams.
+func (c *Client) ExecStartDetached(ctx context.Context, id string) error {
+	body := struct {
+		Detach bool
+		Tty    bool
+	}{true, false}
+	return c.call(ctx, "POST", "/exec/"+id+"/start", nil, body, nil)
+}
+
+// hijack sends a POST request that takes the connection over.
+func (c *Client) hijack(ctx context.Context, path string, query url.Values, body interface{}) (*HijackedResponse, error) {
+	var in io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		in = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest("POST", c.url(path, query), in)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	conn, err := c.dialer.DialContext(ctx, c.proto, c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot connect to the harbour daemon at %s://%s: %s", c.proto, c.addr, err)
+	}
+	if c.tlsConfig != nil {
+		config := c.tlsConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(c.addr)
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer conn.Close()
+		return nil, responseError(resp)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	return &HijackedResponse{Conn: conn, Reader: br, stop: stop}, nil
+}
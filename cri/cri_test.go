@@ -0,0 +1,172 @@
+package cri
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/huawei-openlab/harbour/driver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// memDriver keeps its containers in memory.
+type memDriver struct {
+	driver.Driver
+	containers []*driver.Container
+	images     []*driver.Image
+}
+
+func (d *memDriver) Name() string {
+	return "docker"
+}
+
+func (d *memDriver) Info(ctx context.Context) *driver.RuntimeInfo {
+	return &driver.RuntimeInfo{Name: "docker", Healthy: true}
+}
+
+func (d *memDriver) ListContainers(ctx context.Context, all bool) ([]*driver.Container, error) {
+	return d.containers, nil
+}
+
+func (d *memDriver) GetContainer(ctx context.Context, id string) (*driver.Container, error) {
+	for _, c := range d.containers {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("No such container: %s", id)
+}
+
+func (d *memDriver) CreateContainer(ctx context.Context, spec *driver.ContainerSpec) (*driver.Container, error) {
+	found := false
+	for _, img := range d.images {
+		found = found || matchImage(img, spec.Image)
+	}
+	if !found {
+		return nil, fmt.Errorf("No such image: %s", spec.Image)
+	}
+	c := &driver.Container{
+		ID:      fmt.Sprintf("c%d", len(d.containers)),
+		Name:    spec.Name,
+		Image:   spec.Image,
+		Labels:  spec.Labels,
+		State:   "created",
+		Created: time.Unix(1, 0),
+	}
+	d.containers = append(d.containers, c)
+	return c, nil
+}
+
+func (d *memDriver) StartContainer(ctx context.Context, id string) error {
+	c, err := d.GetContainer(ctx, id)
+	if err == nil {
+		c.State = "running"
+	}
+	return err
+}
+
+func (d *memDriver) PullImage(ctx context.Context, ref string) error {
+	d.images = append(d.images, &driver.Image{ID: "sha256:" + ref, Names: []string{ref}})
+	return nil
+}
+
+func (d *memDriver) ListImages(ctx context.Context) ([]*driver.Image, error) {
+	return d.images, nil
+}
+
+// dial connects to the CRI server s over HTTP/2 without TLS, like the
+// kubelet does on the unix socket.
+func dial(t *testing.T, s *Server) (runtimeapi.RuntimeServiceClient, runtimeapi.ImageServiceClient, func()) {
+	ts := httptest.NewUnstartedServer(s)
+	ts.Config.Protocols = &http.Protocols{}
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	conn, err := grpc.NewClient("passthrough:///"+ts.Listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		ts.Close()
+		t.Fatal(err)
+	}
+	return runtimeapi.NewRuntimeServiceClient(conn), runtimeapi.NewImageServiceClient(conn), func() {
+		conn.Close()
+		ts.Close()
+	}
+}
+
+func TestCRI(t *testing.T) {
+	d := &memDriver{}
+	runtime, images, done := dial(t, New(d, "pause:3.9"))
+	defer done()
+	ctx := context.Background()
+
+	version, err := runtime.Version(ctx, &runtimeapi.VersionRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.RuntimeName != "harbour" || version.RuntimeApiVersion != "v1" {
+		t.Fatalf("unexpected version %v", version)
+	}
+
+	// The pause image is pulled on the first sandbox.
+	sandbox, err := runtime.RunPodSandbox(ctx, &runtimeapi.RunPodSandboxRequest{Config: &runtimeapi.PodSandboxConfig{
+		Metadata: &runtimeapi.PodSandboxMetadata{Name: "web", Uid: "uid-1", Namespace: "default"},
+		Labels:   map[string]string{"app": "web"},
+	}})
+	if err != nil {
+		t.Fatalf("RunPodSandbox failed: %s", err)
+	}
+
+	create := &runtimeapi.CreateContainerRequest{
+		PodSandboxId: sandbox.PodSandboxId,
+		Config: &runtimeapi.ContainerConfig{
+			Metadata: &runtimeapi.ContainerMetadata{Name: "nginx"},
+			Image:    &runtimeapi.ImageSpec{Image: "nginx"},
+		},
+	}
+	if _, err := runtime.CreateContainer(ctx, create); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected a missing image to be not found, got %v", err)
+	}
+	if _, err := images.PullImage(ctx, &runtimeapi.PullImageRequest{Image: &runtimeapi.ImageSpec{Image: "nginx:latest"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runtime.CreateContainer(ctx, create); err != nil {
+		t.Fatalf("CreateContainer failed: %s", err)
+	}
+	if name := d.containers[1].Name; name != "k8s_nginx_web_default_uid-1_0" {
+		t.Fatalf("unexpected container name %s", name)
+	}
+
+	list, err := runtime.ListContainers(ctx, &runtimeapi.ListContainersRequest{Filter: &runtimeapi.ContainerFilter{PodSandboxId: sandbox.PodSandboxId}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Containers) != 1 || list.Containers[0].PodSandboxId != sandbox.PodSandboxId || list.Containers[0].State != runtimeapi.ContainerState_CONTAINER_CREATED {
+		t.Fatalf("unexpected containers %v", list.Containers)
+	}
+
+	sandboxes, err := runtime.ListPodSandbox(ctx, &runtimeapi.ListPodSandboxRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sandboxes.Items) != 1 || sandboxes.Items[0].State != runtimeapi.PodSandboxState_SANDBOX_READY {
+		t.Fatalf("unexpected sandboxes %v", sandboxes.Items)
+	}
+	if labels := sandboxes.Items[0].Labels; len(labels) != 1 || labels["app"] != "web" {
+		t.Fatalf("expected the labels of the kubelet alone, got %v", labels)
+	}
+
+	img, err := images.ImageStatus(ctx, &runtimeapi.ImageStatusRequest{Image: &runtimeapi.ImageSpec{Image: "docker.io/library/nginx"}})
+	if err != nil || img.Image == nil || img.Image.Id != "sha256:nginx:latest" {
+		t.Fatalf("expected nginx by its full name, got %v, %v", img, err)
+	}
+
+	if _, err := runtime.ExecSync(ctx, &runtimeapi.ExecSyncRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected exec to be unimplemented, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package cri
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxMessage bounds the requests of the kubelet, which are small.
+const maxMessage = 4 << 20
+
+// errorCode reads the status of err from its message, the way the API of
+// harbour reads its HTTP status.
+func errorCode(err error) codes.Code {
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+	errStr := strings.ToLower(err.Error())
+	for keyword, code := range map[string]codes.Code{
+		"not found":         codes.NotFound,
+		"no such":           codes.NotFound,
+		"bad parameter":     codes.InvalidArgument,
+		"conflict":          codes.AlreadyExists,
+		"impossible":        codes.FailedPrecondition,
+		"forbidden":         codes.PermissionDenied,
+		"too many requests": codes.ResourceExhausted,
+		"too large":         codes.ResourceExhausted,
+	} {
+		if strings.Contains(errStr, keyword) {
+			return code
+		}
+	}
+	return codes.Unknown
+}
+
+// toStatus answers the errors of the drivers with the gRPC status they
+// stand for.
+func toStatus(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+	logrus.Debugf("CRI call %s failed: %s", info.FullMethod, err)
+	if _, ok := status.FromError(err); ok {
+		return nil, err
+	}
+	return nil, status.Error(errorCode(err), err.Error())
+}
@@ -0,0 +1,130 @@
+package cri
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/huawei-openlab/harbour/api/reference"
+	"github.com/huawei-openlab/harbour/driver"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// imageRoots are where the runtimes store their images, for ImageFsInfo.
+var imageRoots = map[string]string{
+	"docker": "/var/lib/docker",
+	"rkt":    "/var/lib/rkt",
+}
+
+// matchImage tells whether img is the one ref names, by ID or by name.
+func matchImage(img *driver.Image, ref string) bool {
+	if img.ID == ref || strings.TrimPrefix(img.ID, "sha256:") == ref {
+		return true
+	}
+	want := reference.Normalize(ref)
+	for _, name := range img.Names {
+		if reference.Normalize(name) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) findImage(ctx context.Context, ref string) (*driver.Image, error) {
+	images, err := s.driver.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, img := range images {
+		if matchImage(img, ref) {
+			return img, nil
+		}
+	}
+	return nil, nil
+}
+
+// criImage is the Image of the CRI for img.
+func criImage(img *driver.Image) *runtimeapi.Image {
+	image := &runtimeapi.Image{Id: img.ID, Size_: uint64(img.Size)}
+	for _, name := range img.Names {
+		if strings.Contains(name, "@") {
+			image.RepoDigests = append(image.RepoDigests, name)
+		} else {
+			image.RepoTags = append(image.RepoTags, name)
+		}
+	}
+	return image
+}
+
+func (s *Server) ListImages(ctx context.Context, req *runtimeapi.ListImagesRequest) (*runtimeapi.ListImagesResponse, error) {
+	ref := req.GetFilter().GetImage().GetImage()
+	images, err := s.driver.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &runtimeapi.ListImagesResponse{}
+	for _, img := range images {
+		if ref == "" || matchImage(img, ref) {
+			resp.Images = append(resp.Images, criImage(img))
+		}
+	}
+	return resp, nil
+}
+
+// ImageStatus answers without an image when it is not there, as the CRI
+// wants.
+func (s *Server) ImageStatus(ctx context.Context, req *runtimeapi.ImageStatusRequest) (*runtimeapi.ImageStatusResponse, error) {
+	img, err := s.findImage(ctx, req.GetImage().GetImage())
+	if err != nil {
+		return nil, err
+	}
+	resp := &runtimeapi.ImageStatusResponse{}
+	if img != nil {
+		resp.Image = criImage(img)
+	}
+	return resp, nil
+}
+
+func (s *Server) PullImage(ctx context.Context, req *runtimeapi.PullImageRequest) (*runtimeapi.PullImageResponse, error) {
+	ref := req.GetImage().GetImage()
+	if err := s.driver.PullImage(ctx, ref); err != nil {
+		return nil, err
+	}
+	resp := &runtimeapi.PullImageResponse{ImageRef: ref}
+	if img, err := s.findImage(ctx, ref); err == nil && img != nil {
+		resp.ImageRef = img.ID
+	}
+	return resp, nil
+}
+
+func (s *Server) RemoveImage(ctx context.Context, req *runtimeapi.RemoveImageRequest) (*runtimeapi.RemoveImageResponse, error) {
+	img, err := s.findImage(ctx, req.GetImage().GetImage())
+	if err != nil {
+		return nil, err
+	}
+	if img == nil {
+		return &runtimeapi.RemoveImageResponse{}, nil
+	}
+	if err := s.driver.RemoveImage(ctx, img.ID); err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	return &runtimeapi.RemoveImageResponse{}, nil
+}
+
+// ImageFsInfo reports the size of the images, the runtimes do not tell the
+// usage of their filesystem.
+func (s *Server) ImageFsInfo(ctx context.Context, req *runtimeapi.ImageFsInfoRequest) (*runtimeapi.ImageFsInfoResponse, error) {
+	images, err := s.driver.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var used uint64
+	for _, img := range images {
+		used += uint64(img.Size)
+	}
+	return &runtimeapi.ImageFsInfoResponse{ImageFilesystems: []*runtimeapi.FilesystemUsage{{
+		Timestamp: time.Now().UnixNano(),
+		FsId:      &runtimeapi.FilesystemIdentifier{Mountpoint: imageRoots[s.driver.Name()]},
+		UsedBytes: &runtimeapi.UInt64Value{Value: used},
+	}}}, nil
+}
@@ -0,0 +1,370 @@
+package cri
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/huawei-openlab/harbour/driver"
+	"github.com/huawei-openlab/harbour/engine"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+func (s *Server) Version(ctx context.Context, req *runtimeapi.VersionRequest) (*runtimeapi.VersionResponse, error) {
+	return &runtimeapi.VersionResponse{
+		Version:           "0.1.0",
+		RuntimeName:       "harbour",
+		RuntimeVersion:    engine.Version,
+		RuntimeApiVersion: "v1",
+	}, nil
+}
+
+func (s *Server) Status(ctx context.Context, req *runtimeapi.StatusRequest) (*runtimeapi.StatusResponse, error) {
+	info := s.driver.Info(ctx)
+	ready := &runtimeapi.RuntimeCondition{Type: runtimeapi.RuntimeReady, Status: info.Healthy}
+	if !info.Healthy {
+		ready.Reason, ready.Message = "RuntimeUnhealthy", info.Error
+	}
+	return &runtimeapi.StatusResponse{Status: &runtimeapi.RuntimeStatus{Conditions: []*runtimeapi.RuntimeCondition{
+		ready,
+		// The containers use the networks of the runtime.
+		{Type: runtimeapi.NetworkReady, Status: true},
+	}}}, nil
+}
+
+// UpdateRuntimeConfig accepts the pod CIDR the kubelet sends, the runtime
+// networks are left as they are configured.
+func (s *Server) UpdateRuntimeConfig(ctx context.Context, req *runtimeapi.UpdateRuntimeConfigRequest) (*runtimeapi.UpdateRuntimeConfigResponse, error) {
+	return &runtimeapi.UpdateRuntimeConfigResponse{}, nil
+}
+
+func (s *Server) RunPodSandbox(ctx context.Context, req *runtimeapi.RunPodSandboxRequest) (*runtimeapi.RunPodSandboxResponse, error) {
+	config := req.GetConfig()
+	if config == nil {
+		return nil, fmt.Errorf("Bad parameter: no sandbox config")
+	}
+	meta := config.GetMetadata()
+	if meta == nil {
+		return nil, fmt.Errorf("Bad parameter: no sandbox metadata")
+	}
+	m := &metadata{
+		kind:        kindSandbox,
+		name:        meta.Name,
+		uid:         meta.Uid,
+		namespace:   meta.Namespace,
+		attempt:     uint64(meta.Attempt),
+		labels:      config.Labels,
+		annotations: config.Annotations,
+	}
+	labels, err := m.toLabels()
+	if err != nil {
+		return nil, err
+	}
+	spec := &driver.ContainerSpec{
+		Name:   fmt.Sprintf("k8s_POD_%s_%s_%s_%d", m.name, m.namespace, m.uid, m.attempt),
+		Image:  s.pauseImage,
+		Labels: labels,
+	}
+
+	c, err := s.driver.CreateContainer(ctx, spec)
+	if isNotFound(err) && strings.Contains(strings.ToLower(err.Error()), "image") {
+		if err := s.driver.PullImage(ctx, s.pauseImage); err != nil {
+			return nil, err
+		}
+		c, err = s.driver.CreateContainer(ctx, spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.driver.StartContainer(ctx, c.ID); err != nil {
+		s.driver.RemoveContainer(ctx, c.ID, true)
+		return nil, err
+	}
+	return &runtimeapi.RunPodSandboxResponse{PodSandboxId: c.ID}, nil
+}
+
+// containersOf returns the containers of the sandbox id.
+func (s *Server) containersOf(ctx context.Context, id string) ([]*driver.Container, error) {
+	containers, metas, err := s.list(ctx, kindContainer)
+	if err != nil {
+		return nil, err
+	}
+	var list []*driver.Container
+	for i, c := range containers {
+		if metas[i].sandbox == id {
+			list = append(list, c)
+		}
+	}
+	return list, nil
+}
+
+func (s *Server) StopPodSandbox(ctx context.Context, req *runtimeapi.StopPodSandboxRequest) (*runtimeapi.StopPodSandboxResponse, error) {
+	id := req.PodSandboxId
+	containers, err := s.containersOf(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range containers {
+		if c.State == "running" || c.State == "restarting" || c.State == "paused" {
+			if err := s.driver.StopContainer(ctx, c.ID, 10*time.Second); err != nil && !isNotFound(err) {
+				return nil, err
+			}
+		}
+	}
+	c, _, err := s.get(ctx, id, kindSandbox)
+	if isNotFound(err) {
+		return &runtimeapi.StopPodSandboxResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.State != "exited" && c.State != "created" {
+		if err := s.driver.StopContainer(ctx, id, 10*time.Second); err != nil && !isNotFound(err) {
+			return nil, err
+		}
+	}
+	return &runtimeapi.StopPodSandboxResponse{}, nil
+}
+
+func (s *Server) RemovePodSandbox(ctx context.Context, req *runtimeapi.RemovePodSandboxRequest) (*runtimeapi.RemovePodSandboxResponse, error) {
+	id := req.PodSandboxId
+	containers, err := s.containersOf(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range containers {
+		if err := s.driver.RemoveContainer(ctx, c.ID, true); err != nil && !isNotFound(err) {
+			return nil, err
+		}
+	}
+	if _, _, err := s.get(ctx, id, kindSandbox); err != nil {
+		if isNotFound(err) {
+			return &runtimeapi.RemovePodSandboxResponse{}, nil
+		}
+		return nil, err
+	}
+	if err := s.driver.RemoveContainer(ctx, id, true); err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	return &runtimeapi.RemovePodSandboxResponse{}, nil
+}
+
+func sandboxState(c *driver.Container) runtimeapi.PodSandboxState {
+	if c.State == "running" {
+		return runtimeapi.PodSandboxState_SANDBOX_READY
+	}
+	return runtimeapi.PodSandboxState_SANDBOX_NOTREADY
+}
+
+func sandboxMetadata(m *metadata) *runtimeapi.PodSandboxMetadata {
+	return &runtimeapi.PodSandboxMetadata{Name: m.name, Uid: m.uid, Namespace: m.namespace, Attempt: uint32(m.attempt)}
+}
+
+func (s *Server) PodSandboxStatus(ctx context.Context, req *runtimeapi.PodSandboxStatusRequest) (*runtimeapi.PodSandboxStatusResponse, error) {
+	c, m, err := s.get(ctx, req.PodSandboxId, kindSandbox)
+	if err != nil {
+		return nil, err
+	}
+	return &runtimeapi.PodSandboxStatusResponse{Status: &runtimeapi.PodSandboxStatus{
+		Id:          c.ID,
+		Metadata:    sandboxMetadata(m),
+		State:       sandboxState(c),
+		CreatedAt:   c.Created.UnixNano(),
+		Network:     &runtimeapi.PodSandboxNetworkStatus{Ip: c.IP},
+		Labels:      m.labels,
+		Annotations: m.annotations,
+	}}, nil
+}
+
+func (s *Server) ListPodSandbox(ctx context.Context, req *runtimeapi.ListPodSandboxRequest) (*runtimeapi.ListPodSandboxResponse, error) {
+	filter := req.GetFilter()
+	sandboxes, metas, err := s.list(ctx, kindSandbox)
+	if err != nil {
+		return nil, err
+	}
+	resp := &runtimeapi.ListPodSandboxResponse{}
+	for i, c := range sandboxes {
+		m := metas[i]
+		if filter != nil {
+			if filter.Id != "" && !strings.HasPrefix(c.ID, filter.Id) {
+				continue
+			}
+			if filter.State != nil && filter.State.State != sandboxState(c) {
+				continue
+			}
+			if !matchLabels(m.labels, filter.LabelSelector) {
+				continue
+			}
+		}
+		resp.Items = append(resp.Items, &runtimeapi.PodSandbox{
+			Id:          c.ID,
+			Metadata:    sandboxMetadata(m),
+			State:       sandboxState(c),
+			CreatedAt:   c.Created.UnixNano(),
+			Labels:      m.labels,
+			Annotations: m.annotations,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) CreateContainer(ctx context.Context, req *runtimeapi.CreateContainerRequest) (*runtimeapi.CreateContainerResponse, error) {
+	config := req.GetConfig()
+	if config == nil {
+		return nil, fmt.Errorf("Bad parameter: no container config")
+	}
+	_, sandbox, err := s.get(ctx, req.PodSandboxId, kindSandbox)
+	if err != nil {
+		return nil, err
+	}
+	meta := config.GetMetadata()
+	if meta == nil {
+		return nil, fmt.Errorf("Bad parameter: no container metadata")
+	}
+	image := config.GetImage().GetImage()
+	if image == "" {
+		return nil, fmt.Errorf("Bad parameter: no image specified")
+	}
+	m := &metadata{
+		kind:        kindContainer,
+		sandbox:     req.PodSandboxId,
+		name:        meta.Name,
+		namespace:   sandbox.namespace,
+		uid:         sandbox.uid,
+		attempt:     uint64(meta.Attempt),
+		labels:      config.Labels,
+		annotations: config.Annotations,
+	}
+	labels, err := m.toLabels()
+	if err != nil {
+		return nil, err
+	}
+	var env []string
+	for _, kv := range config.Envs {
+		env = append(env, kv.Key+"="+kv.Value)
+	}
+
+	spec := &driver.ContainerSpec{
+		Name:       fmt.Sprintf("k8s_%s_%s_%s_%s_%d", m.name, sandbox.name, m.namespace, m.uid, m.attempt),
+		Image:      image,
+		Entrypoint: config.Command,
+		Command:    config.Args,
+		WorkingDir: config.WorkingDir,
+		Env:        env,
+		Labels:     labels,
+		Sandbox:    req.PodSandboxId,
+	}
+	c, err := s.driver.CreateContainer(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	return &runtimeapi.CreateContainerResponse{ContainerId: c.ID}, nil
+}
+
+func (s *Server) StartContainer(ctx context.Context, req *runtimeapi.StartContainerRequest) (*runtimeapi.StartContainerResponse, error) {
+	if err := s.driver.StartContainer(ctx, req.ContainerId); err != nil {
+		return nil, err
+	}
+	return &runtimeapi.StartContainerResponse{}, nil
+}
+
+func (s *Server) StopContainer(ctx context.Context, req *runtimeapi.StopContainerRequest) (*runtimeapi.StopContainerResponse, error) {
+	timeout := time.Duration(req.Timeout) * time.Second
+	if err := s.driver.StopContainer(ctx, req.ContainerId, timeout); err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	return &runtimeapi.StopContainerResponse{}, nil
+}
+
+func (s *Server) RemoveContainer(ctx context.Context, req *runtimeapi.RemoveContainerRequest) (*runtimeapi.RemoveContainerResponse, error) {
+	if err := s.driver.RemoveContainer(ctx, req.ContainerId, true); err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	return &runtimeapi.RemoveContainerResponse{}, nil
+}
+
+func containerState(c *driver.Container) runtimeapi.ContainerState {
+	switch c.State {
+	case "created":
+		return runtimeapi.ContainerState_CONTAINER_CREATED
+	case "running", "restarting", "paused":
+		return runtimeapi.ContainerState_CONTAINER_RUNNING
+	case "exited":
+		return runtimeapi.ContainerState_CONTAINER_EXITED
+	}
+	return runtimeapi.ContainerState_CONTAINER_UNKNOWN
+}
+
+func containerMetadata(m *metadata) *runtimeapi.ContainerMetadata {
+	return &runtimeapi.ContainerMetadata{Name: m.name, Attempt: uint32(m.attempt)}
+}
+
+func (s *Server) ListContainers(ctx context.Context, req *runtimeapi.ListContainersRequest) (*runtimeapi.ListContainersResponse, error) {
+	filter := req.GetFilter()
+	containers, metas, err := s.list(ctx, kindContainer)
+	if err != nil {
+		return nil, err
+	}
+	resp := &runtimeapi.ListContainersResponse{}
+	for i, c := range containers {
+		m := metas[i]
+		if filter != nil {
+			if filter.Id != "" && !strings.HasPrefix(c.ID, filter.Id) {
+				continue
+			}
+			if filter.PodSandboxId != "" && m.sandbox != filter.PodSandboxId {
+				continue
+			}
+			if filter.State != nil && filter.State.State != containerState(c) {
+				continue
+			}
+			if !matchLabels(m.labels, filter.LabelSelector) {
+				continue
+			}
+		}
+		resp.Containers = append(resp.Containers, &runtimeapi.Container{
+			Id:           c.ID,
+			PodSandboxId: m.sandbox,
+			Metadata:     containerMetadata(m),
+			Image:        &runtimeapi.ImageSpec{Image: c.Image},
+			ImageRef:     c.Image,
+			State:        containerState(c),
+			CreatedAt:    c.Created.UnixNano(),
+			Labels:       m.labels,
+			Annotations:  m.annotations,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) ContainerStatus(ctx context.Context, req *runtimeapi.ContainerStatusRequest) (*runtimeapi.ContainerStatusResponse, error) {
+	c, m, err := s.get(ctx, req.ContainerId, kindContainer)
+	if err != nil {
+		return nil, err
+	}
+	status := &runtimeapi.ContainerStatus{
+		Id:          c.ID,
+		Metadata:    containerMetadata(m),
+		State:       containerState(c),
+		CreatedAt:   c.Created.UnixNano(),
+		Image:       &runtimeapi.ImageSpec{Image: c.Image},
+		ImageRef:    c.Image,
+		Labels:      m.labels,
+		Annotations: m.annotations,
+	}
+	if c.Started != nil {
+		status.StartedAt = c.Started.UnixNano()
+	}
+	if c.Finished != nil {
+		status.FinishedAt = c.Finished.UnixNano()
+	}
+	if c.ExitCode != nil {
+		status.ExitCode = int32(*c.ExitCode)
+		status.Reason = "Completed"
+		if *c.ExitCode != 0 {
+			status.Reason = "Error"
+		}
+	}
+	return &runtimeapi.ContainerStatusResponse{Status: status}, nil
+}
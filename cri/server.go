@@ -0,0 +1,177 @@
+// Package cri serves the Container Runtime Interface of Kubernetes on the
+// runtime drivers of harbour, so that a kubelet can run its pods on any
+// runtime harbour drives. The messages and services are those generated in
+// k8s.io/cri-api, served by grpc-go.
+//
+// A pod sandbox is a pause container the containers of the pod join the
+// network of. It is not mapped onto a rkt pod: rkt cannot add apps to a
+// running pod, so on rkt every container runs in a pod of its own next to
+// the pause container. Streaming calls such as exec and attach, stats and
+// container log files are not implemented.
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/huawei-openlab/harbour/driver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// The labels harbour keeps the CRI metadata of its containers in.
+const (
+	labelPrefix      = "io.harbour.cri."
+	labelKind        = labelPrefix + "kind"
+	labelSandbox     = labelPrefix + "sandbox"
+	labelName        = labelPrefix + "name"
+	labelNamespace   = labelPrefix + "namespace"
+	labelUID         = labelPrefix + "uid"
+	labelAttempt     = labelPrefix + "attempt"
+	labelAnnotations = labelPrefix + "annotations"
+
+	kindSandbox   = "sandbox"
+	kindContainer = "container"
+)
+
+// Server serves the CRI on a driver. The calls it does not implement
+// answer UNIMPLEMENTED.
+type Server struct {
+	runtimeapi.UnimplementedRuntimeServiceServer
+	runtimeapi.UnimplementedImageServiceServer
+
+	driver     driver.Driver
+	pauseImage string
+	grpc       *grpc.Server
+}
+
+// New creates the CRI server of d. The sandboxes run pauseImage.
+func New(d driver.Driver, pauseImage string) *Server {
+	s := &Server{driver: d, pauseImage: pauseImage}
+	s.grpc = grpc.NewServer(grpc.UnaryInterceptor(toStatus), grpc.MaxRecvMsgSize(maxMessage))
+	runtimeapi.RegisterRuntimeServiceServer(s.grpc, s)
+	runtimeapi.RegisterImageServiceServer(s.grpc, s)
+	return s
+}
+
+// ServeHTTP answers the gRPC calls of the CRI. gRPC runs over HTTP/2, the
+// server must allow it without TLS.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "Bad parameter: harbour only serves gRPC on this socket", http.StatusUnsupportedMediaType)
+		return
+	}
+	s.grpc.ServeHTTP(w, r)
+}
+
+// metadata is the metadata of a sandbox or a container, kept in the labels
+// of its harbour container along with the labels and annotations the
+// kubelet gave it.
+type metadata struct {
+	kind        string
+	sandbox     string
+	name        string
+	namespace   string
+	uid         string
+	attempt     uint64
+	labels      map[string]string
+	annotations map[string]string
+}
+
+func (m *metadata) toLabels() (map[string]string, error) {
+	labels := map[string]string{}
+	for k, v := range m.labels {
+		labels[k] = v
+	}
+	annotations, err := json.Marshal(m.annotations)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range map[string]string{
+		labelKind:        m.kind,
+		labelSandbox:     m.sandbox,
+		labelName:        m.name,
+		labelNamespace:   m.namespace,
+		labelUID:         m.uid,
+		labelAttempt:     strconv.FormatUint(m.attempt, 10),
+		labelAnnotations: string(annotations),
+	} {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	return labels, nil
+}
+
+// metadataOf reads the metadata of c, nil if the CRI did not create it.
+func metadataOf(c *driver.Container) *metadata {
+	if c.Labels[labelKind] == "" {
+		return nil
+	}
+	m := &metadata{
+		kind:        c.Labels[labelKind],
+		sandbox:     c.Labels[labelSandbox],
+		name:        c.Labels[labelName],
+		namespace:   c.Labels[labelNamespace],
+		uid:         c.Labels[labelUID],
+		labels:      map[string]string{},
+		annotations: map[string]string{},
+	}
+	m.attempt, _ = strconv.ParseUint(c.Labels[labelAttempt], 10, 32)
+	json.Unmarshal([]byte(c.Labels[labelAnnotations]), &m.annotations)
+	for k, v := range c.Labels {
+		if !strings.HasPrefix(k, labelPrefix) {
+			m.labels[k] = v
+		}
+	}
+	return m
+}
+
+// list returns the containers of kind the CRI created.
+func (s *Server) list(ctx context.Context, kind string) ([]*driver.Container, []*metadata, error) {
+	all, err := s.driver.ListContainers(ctx, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	var containers []*driver.Container
+	var metas []*metadata
+	for _, c := range all {
+		if m := metadataOf(c); m != nil && m.kind == kind {
+			containers = append(containers, c)
+			metas = append(metas, m)
+		}
+	}
+	return containers, metas, nil
+}
+
+// get returns the container id of kind.
+func (s *Server) get(ctx context.Context, id, kind string) (*driver.Container, *metadata, error) {
+	c, err := s.driver.GetContainer(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := metadataOf(c)
+	if m == nil || m.kind != kind {
+		return nil, nil, fmt.Errorf("No such %s: %s", kind, id)
+	}
+	return c, m, nil
+}
+
+func isNotFound(err error) bool {
+	return err != nil && errorCode(err) == codes.NotFound
+}
+
+// matchLabels tells whether labels has every label of selector.
+func matchLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -1,12 +1,30 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+
 	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/adaptor"
 	"github.com/huawei-openlab/harbour/api/server"
+	"github.com/huawei-openlab/harbour/driver/emulator"
 	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/engine/backend"
 	"github.com/huawei-openlab/harbour/engine/trap"
 	"github.com/huawei-openlab/harbour/mflag"
 	"github.com/huawei-openlab/harbour/opts"
+	"github.com/huawei-openlab/harbour/utils"
+
+	// The runtime drivers of the native API, and the backends of the
+	// emulated runtimes.
+	_ "github.com/huawei-openlab/harbour/driver/docker"
+	_ "github.com/huawei-openlab/harbour/driver/fake"
+	_ "github.com/huawei-openlab/harbour/driver/nspawn"
+	_ "github.com/huawei-openlab/harbour/driver/oci"
+	_ "github.com/huawei-openlab/harbour/driver/rkt"
 )
 
 func mainDaemon() {
@@ -15,41 +33,182 @@ func mainDaemon() {
 		return
 	}
 
-	if len(*flDockerSock) == 0 {
-		engine.DockerSock = opts.DEFAULTDOCKERSOCKET
-	} else {
-		engine.DockerSock = *flDockerSock
+	// Only one harbour runs at once.
+	release, err := utils.LockPidFile(*flPidFile)
+	if err != nil {
+		logrus.Fatal(err)
 	}
+	trap.ShutdownCallback(release)
 
 	RuntimeType := engine.RuntimeDocker
-	if len(*flRuntime) != 0 && *flRuntime == opts.RKTRUNTIME {
-		RuntimeType = engine.RuntimeRkt
+	for t, name := range engine.RuntimeNames {
+		if *flRuntime == name {
+			RuntimeType = t
+		}
 	}
 
 	if len(*flGroup) > 0 {
 		engine.SocketGroup = *flGroup
 	}
 
+	configRequired := *flConfig != opts.DEFAULTCONFIGFILE
+	config, err := engine.LoadConfig(*flConfig, configRequired)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	var tlsConfig *tls.Config
+	if *flTLS || *flTLSVerify {
+		if tlsConfig, err = newTLSConfig(*flTLSVerify); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+	if *flMaxProcs < 0 {
+		logrus.Fatalf("Invalid value %d for --max-procs", *flMaxProcs)
+	}
+	utils.SetMaxProcs(*flMaxProcs)
+
+	engine.BuildTool = *flBuildTool
+	engine.StateRoot = *flStateRoot
+	engine.CRISocket = *flCRISocket
+	engine.PodInfraImage = *flPodInfra
+	engine.OCIRuntime = *flOCIRuntime
+	engine.FakeFixture = *flFixture
+	if err := parseGCPolicy(&engine.GC); err != nil {
+		logrus.Fatal(err)
+	}
+
 	eng := engine.New(RuntimeType)
 
+	if RuntimeType == engine.RuntimeDocker {
+		if err := initBackends(eng, config); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	if RuntimeType == engine.RuntimeRkt {
+		if err := adaptor.Init(eng); err != nil {
+			logrus.Fatalf("Failed to initialize the rkt adaptor: %v", err)
+		}
+	}
+	if emulator.Registered(engine.RuntimeNames[RuntimeType]) {
+		if err := emulator.Init(eng); err != nil {
+			logrus.Fatalf("Failed to initialize the %s runtime: %v", *flRuntime, err)
+		}
+	}
+
 	//catch signals
 	trap.SignalsHandler(trap.Shutdown)
 
 	var srv *server.Server
-	srv = server.New(eng, false)
+	srv = server.New(eng, engine.CRISocket != "")
+	if err := srv.Configure(*flConfig, configRequired, config); err != nil {
+		logrus.Fatal(err)
+	}
+	srv.TLSConfig = tlsConfig
+	srv.Force = *flForce
 
 	serverWait := make(chan error)
 	go func() {
-		if err := srv.CreateServer(eng, flHosts); err != nil {
+		if err := srv.CreateServer(eng, flHosts, flAdminHosts); err != nil {
 			logrus.Errorf("Server error: %v", err)
 			serverWait <- err
 			return
 		}
 		serverWait <- nil
 	}()
-	err := <-serverWait
+	err = <-serverWait
 	if err != nil {
 		logrus.Fatalf("Shutting down due to Server error: %v", err)
 	}
 	<-trap.CleanupDone
 }
+
+// initBackends sets the docker daemons eng forwards to: those of
+// --docker-sock then those of config, or the default socket when there are
+// none. The daemons harbour manages are started, and stopped on shutdown.
+func initBackends(eng *engine.Engine, config *engine.Config) error {
+	interval, err := time.ParseDuration(*flDockerPing)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("Invalid value %s for --docker-ping-interval", *flDockerPing)
+	}
+	static := []backend.Config{}
+	for _, addr := range flDockerSocks.GetAll() {
+		static = append(static, backend.Config{Address: addr})
+	}
+	if len(static) == 0 && len(config.Backends) == 0 {
+		static = append(static, backend.Config{Address: opts.DEFAULTDOCKERSOCKET})
+	}
+	self := append(append([]string{}, flHosts...), flAdminHosts...)
+	if engine.CRISocket != "" {
+		self = append(self, "unix://"+engine.CRISocket)
+	}
+	pool, err := backend.NewPool(static, config.Backends, self)
+	if err != nil {
+		return err
+	}
+	eng.Backends = pool
+	trap.ShutdownCallback(pool.Stop)
+	go pool.Watch(interval)
+	return nil
+}
+
+func parseGCPolicy(p *engine.GCPolicy) error {
+	for _, d := range []struct {
+		flag  string
+		value string
+		dst   *time.Duration
+	}{
+		{"--gc-interval", *flGCInterval, &p.Interval},
+		{"--gc-grace-period", *flGCGrace, &p.GracePeriod},
+		{"--image-max-age", *flImageAge, &p.ImageMaxAge},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v < 0 {
+			return fmt.Errorf("Invalid value %s for %s", d.value, d.flag)
+		}
+		*d.dst = v
+	}
+
+	if *flImageCount < 0 {
+		return fmt.Errorf("Invalid value %d for --image-max-count", *flImageCount)
+	}
+	p.ImageMaxCount = *flImageCount
+	if *flImageSize != "" {
+		size, err := opts.ParseSize(*flImageSize)
+		if err != nil {
+			return err
+		}
+		p.ImageMaxSize = size
+	}
+	return nil
+}
+
+// newTLSConfig loads the certificate of the daemon, and the CA its clients
+// must be signed by if verify is set.
+func newTLSConfig(verify bool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(*flCert, *flKey)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't load X509 key pair (%s, %s): %s", *flCert, *flKey, err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if verify {
+		pem, err := ioutil.ReadFile(*flCACert)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't read CA certificate: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificate found in %s", *flCACert)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = pool
+	}
+	return config, nil
+}
@@ -1 +1,26 @@
+// Package dockerdrv drives docker, through its own API.
 package dockerdrv
+
+import (
+	"net/http"
+	"os/exec"
+
+	"github.com/huawei-openlab/harbour/driver"
+)
+
+func init() {
+	driver.Register("docker", New)
+}
+
+type dockerDriver struct {
+	*driver.DockerAPI
+}
+
+// New creates the driver of docker. transport reaches the docker daemon.
+func New(transport http.RoundTripper) (driver.Driver, error) {
+	return &dockerDriver{driver.NewDockerAPI("docker", transport)}, nil
+}
+
+func (d *dockerDriver) Locate() (string, error) {
+	return exec.LookPath("docker")
+}
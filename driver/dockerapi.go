@@ -0,0 +1,333 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/huawei-openlab/harbour/api/types"
+)
+
+// DockerAPI drives a runtime through the Docker API, the common ground of
+// the runtimes harbour serves. The drivers build on it.
+type DockerAPI struct {
+	name   string
+	client *http.Client
+}
+
+// NewDockerAPI creates a driver for runtime name that sends its requests
+// through transport.
+func NewDockerAPI(name string, transport http.RoundTripper) *DockerAPI {
+	return &DockerAPI{name: name, client: &http.Client{Transport: transport}}
+}
+
+func (d *DockerAPI) Name() string {
+	return d.name
+}
+
+// call sends a request to the Docker API and decodes the JSON answer into
+// v, if v is not nil. Errors keep the message of the runtime.
+func (d *DockerAPI) call(ctx context.Context, method, path string, body, v interface{}) error {
+	var in io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		in = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "http://"+d.name+path, in)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	if v == nil {
+		_, err := io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// responseError reads the error of a failed response, which newer docker
+// daemons wrap in JSON.
+func responseError(resp *http.Response) error {
+	data, _ := ioutil.ReadAll(resp.Body)
+	var body struct {
+		Message string `json:"message"`
+	}
+	msg := strings.TrimSpace(string(data))
+	if json.Unmarshal(data, &body) == nil && body.Message != "" {
+		msg = body.Message
+	}
+	if msg == "" {
+		msg = resp.Status
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+func (d *DockerAPI) Info(ctx context.Context) *RuntimeInfo {
+	info := &RuntimeInfo{Name: d.name}
+	var version struct {
+		Version string
+	}
+	if err := d.call(ctx, "GET", "/version", nil, &version); err != nil && err != io.EOF {
+		info.Error = err.Error()
+		return info
+	}
+	info.Version = version.Version
+	info.Healthy = true
+	return info
+}
+
+func (d *DockerAPI) ListContainers(ctx context.Context, all bool) ([]*Container, error) {
+	path := "/containers/json"
+	if all {
+		path += "?all=1"
+	}
+	var list []types.Container
+	if err := d.call(ctx, "GET", path, nil, &list); err != nil {
+		return nil, err
+	}
+	containers := []*Container{}
+	for _, c := range list {
+		name := ""
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		state := c.State
+		if state == "" {
+			state = stateFromStatus(c.Status)
+		}
+		containers = append(containers, &Container{
+			ID:      c.ID,
+			Name:    name,
+			Runtime: d.name,
+			Image:   c.Image,
+			Command: c.Command,
+			Labels:  c.Labels,
+			Created: time.Unix(c.Created, 0).UTC(),
+			State:   state,
+			Status:  c.Status,
+		})
+	}
+	return containers, nil
+}
+
+// stateFromStatus reads the state of a container out of the status of
+// docker listings, for the daemons that do not report it on its own.
+func stateFromStatus(status string) string {
+	switch {
+	case strings.HasPrefix(status, "Up") && strings.HasSuffix(status, "(Paused)"):
+		return "paused"
+	case strings.HasPrefix(status, "Up"):
+		return "running"
+	case strings.HasPrefix(status, "Restarting"):
+		return "restarting"
+	case strings.HasPrefix(status, "Exited"), strings.HasPrefix(status, "Dead"):
+		return "exited"
+	}
+	return "created"
+}
+
+func (d *DockerAPI) GetContainer(ctx context.Context, id string) (*Container, error) {
+	c := &types.ContainerJSON{}
+	if err := d.call(ctx, "GET", "/containers/"+id+"/json", nil, c); err != nil {
+		return nil, err
+	}
+	container := &Container{
+		ID:      c.ID,
+		Name:    strings.TrimPrefix(c.Name, "/"),
+		Runtime: d.name,
+		Image:   c.Image,
+		Command: strings.TrimSpace(c.Path + " " + strings.Join(c.Args, " ")),
+		State:   "created",
+	}
+	if c.Config != nil {
+		container.Image = c.Config.Image
+		container.Labels = c.Config.Labels
+	}
+	if c.NetworkSettings != nil {
+		container.IP = c.NetworkSettings.IPAddress
+	}
+	if t, err := time.Parse(time.RFC3339Nano, c.Created); err == nil {
+		container.Created = t
+	}
+	if s := c.State; s != nil {
+		started := parseTime(s.StartedAt)
+		finished := parseTime(s.FinishedAt)
+		switch {
+		case s.Paused:
+			container.State = "paused"
+		case s.Restarting:
+			container.State = "restarting"
+		case s.Running:
+			container.State = "running"
+		case finished != nil:
+			container.State = "exited"
+			code := s.ExitCode
+			container.ExitCode = &code
+		}
+		container.Started, container.Finished = started, finished
+	}
+	return container, nil
+}
+
+// parseTime reads the times of docker, which are the zero time when unset.
+func parseTime(s string) *time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil || t.IsZero() || t.Year() <= 1 {
+		return nil
+	}
+	return &t
+}
+
+func (d *DockerAPI) CreateContainer(ctx context.Context, spec *ContainerSpec) (*Container, error) {
+	if spec.Image == "" {
+		return nil, fmt.Errorf("Bad parameter: no image specified")
+	}
+	config := &types.ContainerConfig{
+		Image:      spec.Image,
+		Entrypoint: spec.Entrypoint,
+		Cmd:        spec.Command,
+		WorkingDir: spec.WorkingDir,
+		Env:        spec.Env,
+		Labels:     spec.Labels,
+		HostConfig: &types.HostConfig{Memory: spec.Memory},
+	}
+	if spec.Sandbox != "" {
+		config.HostConfig.NetworkMode = "container:" + spec.Sandbox
+	}
+	if spec.RestartPolicy != "" {
+		parts := strings.SplitN(spec.RestartPolicy, ":", 2)
+		config.HostConfig.RestartPolicy.Name = parts[0]
+		if len(parts) == 2 {
+			n, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("Bad parameter: invalid restart policy %s", spec.RestartPolicy)
+			}
+			config.HostConfig.RestartPolicy.MaximumRetryCount = n
+		}
+	}
+
+	path := "/containers/create"
+	if spec.Name != "" {
+		path += "?" + url.Values{"name": {spec.Name}}.Encode()
+	}
+	created := &types.ContainerCreateResponse{}
+	if err := d.call(ctx, "POST", path, config, created); err != nil {
+		return nil, err
+	}
+	return d.GetContainer(ctx, created.ID)
+}
+
+func (d *DockerAPI) StartContainer(ctx context.Context, id string) error {
+	return d.call(ctx, "POST", "/containers/"+id+"/start", nil, nil)
+}
+
+func (d *DockerAPI) StopContainer(ctx context.Context, id string, timeout time.Duration) error {
+	path := fmt.Sprintf("/containers/%s/stop?t=%d", id, int(timeout.Seconds()))
+	return d.call(ctx, "POST", path, nil, nil)
+}
+
+func (d *DockerAPI) RemoveContainer(ctx context.Context, id string, force bool) error {
+	path := "/containers/" + id
+	if force {
+		path += "?force=1"
+	}
+	return d.call(ctx, "DELETE", path, nil, nil)
+}
+
+func (d *DockerAPI) ListImages(ctx context.Context) ([]*Image, error) {
+	var list []types.Image
+	if err := d.call(ctx, "GET", "/images/json", nil, &list); err != nil {
+		return nil, err
+	}
+	images := []*Image{}
+	for _, img := range list {
+		names := []string{}
+		for _, tag := range img.RepoTags {
+			if tag != "<none>:<none>" {
+				names = append(names, tag)
+			}
+		}
+		size := img.VirtualSize
+		if size == 0 {
+			size = img.Size
+		}
+		images = append(images, &Image{
+			ID:      img.ID,
+			Runtime: d.name,
+			Names:   names,
+			Created: time.Unix(img.Created, 0).UTC(),
+			Size:    size,
+			Labels:  img.Labels,
+		})
+	}
+	return images, nil
+}
+
+func (d *DockerAPI) PullImage(ctx context.Context, ref string) error {
+	name, tag := ref, "latest"
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, tag = name[:i], name[i+1:]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	path := "/images/create?" + url.Values{"fromImage": {name}, "tag": {tag}}.Encode()
+
+	req, err := http.NewRequest("POST", "http://"+d.name+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	// Docker reports the failures of a pull in its progress stream.
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var m struct {
+			Error string `json:"error"`
+		}
+		if err := dec.Decode(&m); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if m.Error != "" {
+			return fmt.Errorf("%s", m.Error)
+		}
+	}
+}
+
+func (d *DockerAPI) RemoveImage(ctx context.Context, id string) error {
+	return d.call(ctx, "DELETE", "/images/"+id, nil, nil)
+}
+
+func (d *DockerAPI) ListPods(ctx context.Context) ([]*Pod, error) {
+	return nil, ErrNoPods
+}
@@ -0,0 +1,51 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDockerAPI(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/json":
+			fmt.Fprint(w, `[{"Id": "abc", "Names": ["/web"], "Image": "nginx", "Created": 1, "Status": "Exited (1) 2 minutes ago"}]`)
+		case "/containers/nope/json":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "No such container: nope"}`)
+		}
+	}))
+	defer ts.Close()
+
+	d := NewDockerAPI("docker", rewrite{ts.URL})
+	containers, err := d.ListContainers(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("expected a container, got %d", len(containers))
+	}
+	if c := containers[0]; c.Name != "web" || c.Runtime != "docker" || c.State != "exited" {
+		t.Fatalf("unexpected container %+v", c)
+	}
+
+	if _, err := d.GetContainer(context.Background(), "nope"); err == nil || err.Error() != "No such container: nope" {
+		t.Fatalf("expected the error of docker, got %v", err)
+	}
+}
+
+// rewrite sends the requests to a test server.
+type rewrite struct {
+	url string
+}
+
+func (rw rewrite) RoundTrip(req *http.Request) (*http.Response, error) {
+	r, err := http.NewRequest(req.Method, rw.url+req.URL.RequestURI(), req.Body)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
@@ -1 +1,157 @@
+// Package driver is the runtime-neutral view of the container runtimes
+// harbour drives, on which its native API is built.
+//
+// A driver registers a Factory under the name of its runtime from an init
+// function. The factory is given the transport to reach the Docker API of
+// the runtime through: docker's own or the emulation of harbour.
 package driver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Container is a container whatever the runtime running it.
+type Container struct {
+	ID       string
+	Name     string
+	Runtime  string
+	Image    string
+	Command  string
+	Labels   map[string]string
+	Created  time.Time
+	State    string     // created, running, restarting, paused or exited
+	Status   string     // as docker describes it, e.g. "Up 5 minutes"
+	Started  *time.Time `json:",omitempty"`
+	Finished *time.Time `json:",omitempty"`
+	ExitCode *int       `json:",omitempty"`
+	IP       string     `json:",omitempty"`
+}
+
+// ContainerSpec describes a container to create.
+type ContainerSpec struct {
+	// Runtime to create the container with, the default one if empty.
+	Runtime string
+	Name    string
+	Image   string
+	// Entrypoint replaces the one of the image when set, Command is given
+	// to it as arguments.
+	Entrypoint []string
+	Command    []string
+	WorkingDir string
+	Env        []string
+	Labels     map[string]string
+	// Memory limit in bytes, none when 0.
+	Memory int64
+	// RestartPolicy is one of no, always, unless-stopped and
+	// on-failure[:max-retries].
+	RestartPolicy string
+	// Sandbox is the ID of a container whose network the container joins,
+	// for the runtimes that can share it.
+	Sandbox string `json:",omitempty"`
+}
+
+// Image is an image whatever the runtime storing it.
+type Image struct {
+	ID      string
+	Runtime string
+	Names   []string
+	Created time.Time
+	Size    int64
+	Labels  map[string]string
+}
+
+// Pod is a group of containers sharing their namespaces, for the runtimes
+// that have pods.
+type Pod struct {
+	ID      string
+	Runtime string
+	State   string
+	Image   string
+	// Container is the harbour container backed by the pod, if any.
+	Container string `json:",omitempty"`
+}
+
+// RuntimeInfo describes a runtime and whether harbour can reach it.
+type RuntimeInfo struct {
+	Name    string
+	Version string `json:",omitempty"`
+	Healthy bool
+	Error   string `json:",omitempty"`
+}
+
+// Driver drives a container runtime.
+type Driver interface {
+	// Name is the name of the runtime.
+	Name() string
+	Info(ctx context.Context) *RuntimeInfo
+
+	ListContainers(ctx context.Context, all bool) ([]*Container, error)
+	GetContainer(ctx context.Context, id string) (*Container, error)
+	CreateContainer(ctx context.Context, spec *ContainerSpec) (*Container, error)
+	StartContainer(ctx context.Context, id string) error
+	StopContainer(ctx context.Context, id string, timeout time.Duration) error
+	RemoveContainer(ctx context.Context, id string, force bool) error
+
+	ListImages(ctx context.Context) ([]*Image, error)
+	PullImage(ctx context.Context, ref string) error
+	RemoveImage(ctx context.Context, id string) error
+
+	// ListPods fails with ErrNoPods for the runtimes without pods.
+	ListPods(ctx context.Context) ([]*Pod, error)
+}
+
+// Locator is implemented by the drivers of the runtimes that need a binary of
+// the host. Locate returns its path, or why the runtime cannot run here.
+type Locator interface {
+	Locate() (string, error)
+}
+
+// ErrNoPods is returned by the drivers of runtimes without pods.
+var ErrNoPods = fmt.Errorf("Impossible to list pods, the runtime has none")
+
+// Factory creates a driver that reaches the Docker API of its runtime
+// through transport.
+type Factory func(transport http.RoundTripper) (Driver, error)
+
+var (
+	factoriesLock sync.Mutex
+	factories     = make(map[string]Factory)
+)
+
+// Register makes a driver available under the name of its runtime.
+func Register(name string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	if _, ok := factories[name]; ok {
+		panic("driver: " + name + " is registered twice")
+	}
+	factories[name] = factory
+}
+
+// Names returns the names of the registered drivers.
+func Names() []string {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the driver of runtime name.
+func New(name string, transport http.RoundTripper) (Driver, error) {
+	factoriesLock.Lock()
+	factory, ok := factories[name]
+	factoriesLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("No such runtime: %s", name)
+	}
+	return factory(transport)
+}
@@ -0,0 +1,525 @@
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/huawei-openlab/harbour/api/listing"
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/engine/jsonlog"
+)
+
+// apiVersion is the version of the Docker API the emulator speaks.
+const apiVersion = "1.21"
+
+type handler func(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error
+
+type route struct {
+	method  string
+	pattern *regexp.Regexp
+	handler handler
+}
+
+func newRoute(method, pattern string, h handler) route {
+	return route{method, regexp.MustCompile("^(?:/v[0-9.]+)?" + pattern + "$"), h}
+}
+
+var routes = []route{
+	newRoute("GET", "/_ping", ping),
+	newRoute("GET", "/version", version),
+	newRoute("GET", "/info", info),
+	newRoute("GET", "/events", serveEvents),
+	newRoute("GET", "/containers/json", listContainers),
+	newRoute("GET", "/containers/([^/]+)/json", inspectContainer),
+	newRoute("GET", "/containers/([^/]+)/logs", containerLogs),
+	newRoute("GET", "/images/json", listImages),
+	newRoute("GET", "/images/(.+)/json", inspectImage),
+	newRoute("GET", "/exec/([^/]+)/json", inspectExec),
+	newRoute("POST", "/containers/create", createContainer),
+	newRoute("POST", "/containers/([^/]+)/start", startContainer),
+	newRoute("POST", "/containers/([^/]+)/stop", stopContainer),
+	newRoute("POST", "/containers/([^/]+)/kill", killContainer),
+	newRoute("POST", "/containers/([^/]+)/restart", restartContainer),
+	newRoute("POST", "/containers/([^/]+)/wait", waitContainer),
+	newRoute("POST", "/containers/([^/]+)/exec", createExec),
+	newRoute("POST", "/exec/([^/]+)/start", startExec),
+	newRoute("POST", "/images/create", pullImage),
+	newRoute("DELETE", "/containers/([^/]+)", removeContainer),
+	newRoute("DELETE", "/images/(.+)", removeImage),
+}
+
+// Serve answers a request of the Docker API. The endpoints the emulator
+// does not know are refused.
+func (e *Emulator) Serve(w http.ResponseWriter, r *http.Request) error {
+	for _, rt := range routes {
+		if rt.method != r.Method {
+			continue
+		}
+		if m := rt.pattern.FindStringSubmatch(r.URL.Path); m != nil {
+			ref := ""
+			if len(m) > 1 {
+				ref = m[1]
+			}
+			return rt.handler(e, w, r, ref)
+		}
+	}
+	return fmt.Errorf("Impossible to %s %s: harbour does not emulate it on %s", r.Method, r.URL.Path, e.name)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+func boolValue(r *http.Request, name string) bool {
+	v := r.URL.Query().Get(name)
+	return v == "1" || v == "true"
+}
+
+// timeout reads the t parameter of stop and restart, 10 seconds by default.
+func timeout(r *http.Request) (time.Duration, error) {
+	t := r.URL.Query().Get("t")
+	if t == "" {
+		return 10 * time.Second, nil
+	}
+	n, err := strconv.Atoi(t)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Bad parameter: invalid timeout %s", t)
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+func ping(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	w.Header().Set("Content-Type", "text/plain")
+	_, err := w.Write([]byte("OK"))
+	return err
+}
+
+func version(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	v, err := e.backend.Version(r.Context())
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, map[string]string{
+		"Version":    v,
+		"ApiVersion": apiVersion,
+		"GoVersion":  runtime.Version(),
+		"Os":         runtime.GOOS,
+		"Arch":       runtime.GOARCH,
+	})
+}
+
+func info(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	images, err := e.backend.Images(r.Context())
+	if err != nil {
+		return err
+	}
+	running := 0
+	list := e.list()
+	e.mu.Lock()
+	for _, c := range list {
+		if c.State.Running {
+			running++
+		}
+	}
+	e.mu.Unlock()
+	return writeJSON(w, http.StatusOK, map[string]interface{}{
+		"Containers":        len(list),
+		"ContainersRunning": running,
+		"ContainersStopped": len(list) - running,
+		"Images":            len(images),
+		"Driver":            e.name,
+		"LoggingDriver":     "json-file",
+		"OperatingSystem":   runtime.GOOS,
+		"Architecture":      runtime.GOARCH,
+		"DockerRootDir":     e.root,
+		"ServerVersion":     engine.Version,
+	})
+}
+
+func serveEvents(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	return e.events.Serve(w, r, func(id string) string {
+		if c, err := e.get(id); err == nil {
+			return c.Name
+		}
+		return ""
+	})
+}
+
+// summary describes c the way docker ps does.
+func (e *Emulator) summary(c *Container) types.Container {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	name := c.Name
+	if name == "" {
+		name = c.ID[:12]
+	}
+	state, status := "created", "Created"
+	if c.State.Running {
+		state = "running"
+		status = "Up " + listing.HumanDuration(time.Since(c.State.StartedAt))
+	} else if !c.State.StartedAt.IsZero() {
+		state = "exited"
+		status = fmt.Sprintf("Exited (%d) %s ago", c.State.ExitCode, listing.HumanDuration(time.Since(c.State.FinishedAt)))
+	}
+	labels := map[string]string{}
+	for k, v := range c.Config.Labels {
+		labels[k] = v
+	}
+	return types.Container{
+		ID:      c.ID,
+		Names:   []string{"/" + name},
+		Image:   c.Image,
+		ImageID: c.ImageID,
+		Command: strings.Join(c.Command(), " "),
+		Created: c.Created.Unix(),
+		Ports:   []types.Port{},
+		Labels:  labels,
+		State:   state,
+		Status:  status,
+	}
+}
+
+func listContainers(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	opts, err := listing.ParseContainerOptions(r.URL.Query())
+	if err != nil {
+		return err
+	}
+	list := []types.Container{}
+	for _, c := range e.list() {
+		list = append(list, e.summary(c))
+	}
+	if list, err = listing.Containers(list, opts); err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, list)
+}
+
+func inspectContainer(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	c, err := e.get(ref)
+	if err != nil {
+		return err
+	}
+	summary := e.summary(c)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	config := *c.Config
+	config.HostConfig = nil
+	state := &types.ContainerState{
+		Status:   summary.State,
+		Running:  c.State.Running,
+		Pid:      c.State.Pid,
+		ExitCode: c.State.ExitCode,
+		Error:    c.State.Error,
+	}
+	if !c.State.StartedAt.IsZero() {
+		state.StartedAt = c.State.StartedAt.Format(time.RFC3339Nano)
+	}
+	if !c.State.FinishedAt.IsZero() {
+		state.FinishedAt = c.State.FinishedAt.Format(time.RFC3339Nano)
+	}
+	var path string
+	var args []string
+	if cmd := c.Command(); len(cmd) > 0 {
+		path, args = cmd[0], cmd[1:]
+	}
+	return writeJSON(w, http.StatusOK, &types.ContainerJSON{
+		ID:         c.ID,
+		Created:    c.Created.Format(time.RFC3339Nano),
+		Path:       path,
+		Args:       args,
+		State:      state,
+		Image:      c.ImageID,
+		Name:       "/" + c.Name,
+		Driver:     e.name,
+		Config:     &config,
+		HostConfig: c.Config.HostConfig,
+		NetworkSettings: &types.NetworkSettings{
+			Ports:    map[string][]types.PortBinding{},
+			Networks: map[string]*types.EndpointSettings{},
+		},
+		Mounts: []types.MountPoint{},
+	})
+}
+
+func containerLogs(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	c, err := e.get(ref)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	var exited <-chan struct{}
+	if c.State.Running {
+		exited = c.exited
+	}
+	e.mu.Unlock()
+	return jsonlog.Serve(w, r, filepath.Join(c.Dir, jsonlog.FileName), c.Config.Tty, exited)
+}
+
+func createContainer(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	config := &types.ContainerConfig{}
+	if err := json.NewDecoder(r.Body).Decode(config); err != nil {
+		return fmt.Errorf("Bad parameter: %s", err)
+	}
+	if config.Image == "" {
+		return fmt.Errorf("Bad parameter: no image specified")
+	}
+	name := strings.TrimPrefix(r.URL.Query().Get("name"), "/")
+	c, err := e.create(r.Context(), name, config)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusCreated, &types.ContainerCreateResponse{ID: c.ID, Warnings: []string{}})
+}
+
+func startContainer(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	c, err := e.get(ref)
+	if err != nil {
+		return err
+	}
+	if err := e.start(r.Context(), c); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func stopContainer(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	c, err := e.get(ref)
+	if err != nil {
+		return err
+	}
+	t, err := timeout(r)
+	if err != nil {
+		return err
+	}
+	if err := e.stop(r.Context(), c, t); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func killContainer(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	c, err := e.get(ref)
+	if err != nil {
+		return err
+	}
+	sig, err := parseSignal(r.URL.Query().Get("signal"))
+	if err != nil {
+		return err
+	}
+	if err := e.kill(r.Context(), c, sig); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// signals are the signals docker kill accepts by name.
+var signals = map[string]syscall.Signal{
+	"HUP": syscall.SIGHUP, "INT": syscall.SIGINT, "QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL, "USR1": syscall.SIGUSR1, "USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM, "CONT": syscall.SIGCONT, "STOP": syscall.SIGSTOP,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// parseSignal reads a signal given by number or name, SIGKILL by default.
+func parseSignal(s string) (syscall.Signal, error) {
+	if s == "" {
+		return syscall.SIGKILL, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	if sig, ok := signals[strings.TrimPrefix(strings.ToUpper(s), "SIG")]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("Bad parameter: invalid signal %s", s)
+}
+
+func restartContainer(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	c, err := e.get(ref)
+	if err != nil {
+		return err
+	}
+	t, err := timeout(r)
+	if err != nil {
+		return err
+	}
+	if err := e.stop(r.Context(), c, t); err != nil {
+		return err
+	}
+	if err := e.start(r.Context(), c); err != nil {
+		return err
+	}
+	e.events.Log("restart", c.ID, c.Image)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func waitContainer(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	c, err := e.get(ref)
+	if err != nil {
+		return err
+	}
+	code, err := e.wait(r.Context(), c)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, &types.ContainerWaitResponse{StatusCode: code})
+}
+
+func removeContainer(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	c, err := e.get(ref)
+	if err != nil {
+		return err
+	}
+	if err := e.remove(r.Context(), c, boolValue(r, "force")); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func imageSummary(img *Image) types.Image {
+	tags := img.Names
+	if len(tags) == 0 {
+		tags = []string{"<none>:<none>"}
+	}
+	labels := map[string]string{}
+	if img.Config != nil {
+		for k, v := range img.Config.Labels {
+			labels[k] = v
+		}
+	}
+	return types.Image{
+		ID:          img.ID,
+		RepoTags:    tags,
+		RepoDigests: []string{},
+		Created:     img.Created.Unix(),
+		Size:        img.Size,
+		VirtualSize: img.Size,
+		Labels:      labels,
+	}
+}
+
+func listImages(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	opts, err := listing.ParseImageOptions(r.URL.Query())
+	if err != nil {
+		return err
+	}
+	images, err := e.backend.Images(r.Context())
+	if err != nil {
+		return err
+	}
+	list := []types.Image{}
+	for _, img := range images {
+		list = append(list, imageSummary(img))
+	}
+	if list, err = listing.Images(list, opts); err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, list)
+}
+
+func inspectImage(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	img, err := e.image(r.Context(), ref)
+	if err != nil {
+		return err
+	}
+	config := img.Config
+	if config == nil {
+		config = &types.ContainerConfig{}
+	}
+	return writeJSON(w, http.StatusOK, map[string]interface{}{
+		"Id":           img.ID,
+		"RepoTags":     imageSummary(img).RepoTags,
+		"Created":      img.Created.Format(time.RFC3339Nano),
+		"Config":       config,
+		"Size":         img.Size,
+		"VirtualSize":  img.Size,
+		"Os":           runtime.GOOS,
+		"Architecture": runtime.GOARCH,
+	})
+}
+
+// pullImage streams the progress of the pull the way docker does, errors
+// included once the answer has started.
+func pullImage(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	query := r.URL.Query()
+	image, tag := query.Get("fromImage"), query.Get("tag")
+	if image == "" {
+		return fmt.Errorf("Bad parameter: only pulls are supported, no fromImage specified")
+	}
+	if tag != "" {
+		if strings.Contains(tag, ":") {
+			image += "@" + tag
+		} else {
+			image += ":" + tag
+		}
+	}
+
+	out := ioutils.NewWriteFlusher(w)
+	enc := json.NewEncoder(out)
+	started := false
+	err := e.backend.Pull(r.Context(), image, func(status string) {
+		if !started {
+			w.Header().Set("Content-Type", "application/json")
+			started = true
+		}
+		enc.Encode(map[string]string{"status": status, "id": image})
+	})
+	if err != nil {
+		// Like docker, answer with the error itself until the progress
+		// has begun.
+		if !started {
+			return err
+		}
+		return enc.Encode(map[string]interface{}{
+			"error":       err.Error(),
+			"errorDetail": map[string]string{"message": err.Error()},
+		})
+	}
+	if !started {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	e.events.LogImage("pull", image)
+	return enc.Encode(map[string]string{"status": "Status: Downloaded newer image for " + image})
+}
+
+func removeImage(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	img, err := e.image(r.Context(), ref)
+	if err != nil {
+		return err
+	}
+	for _, c := range e.list() {
+		if c.ImageID == img.ID && !boolValue(r, "force") {
+			return fmt.Errorf("Conflict, cannot delete %s because the container %s is using it, use -f to force", ref, c.ID[:12])
+		}
+	}
+	if err := e.backend.RemoveImage(r.Context(), img.ID); err != nil {
+		return err
+	}
+	deleted := []map[string]string{}
+	for _, name := range img.Names {
+		deleted = append(deleted, map[string]string{"Untagged": name})
+		e.events.LogImage("untag", name)
+	}
+	deleted = append(deleted, map[string]string{"Deleted": img.ID})
+	e.events.LogImage("delete", img.ID)
+	return writeJSON(w, http.StatusOK, deleted)
+}
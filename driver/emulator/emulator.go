@@ -0,0 +1,660 @@
+// Package emulator serves the Docker API on the runtimes that have no daemon
+// of their own, such as the OCI runtimes.
+//
+// A runtime plugs a Backend in, which only knows how to store images and
+// run, signal and remove a container. The emulator keeps the containers,
+// their state and their logs under the state root of harbour, and records
+// their events.
+//
+// The output of the containers goes through harbour to their log, so they
+// are stopped along with harbour rather than left running without it.
+package emulator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/api/reference"
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/engine/events"
+	"github.com/huawei-openlab/harbour/engine/jsonlog"
+	"github.com/huawei-openlab/harbour/engine/trap"
+)
+
+// shutdownTimeout is how long the containers get to stop along with harbour
+// before they are killed, within the time harbour gives its shutdown.
+const shutdownTimeout = 5 * time.Second
+
+// Image is an image of a backend.
+type Image struct {
+	ID      string
+	Names   []string
+	Created time.Time
+	Size    int64
+	// Config holds the defaults the image gives its containers: its
+	// entrypoint, command, environment, working directory, user and labels.
+	Config *types.ContainerConfig
+}
+
+// State is the state of a container.
+type State struct {
+	Running    bool
+	Pid        int
+	ExitCode   int
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Error      string `json:",omitempty"`
+}
+
+// Container is a container of the emulator. Its Config is the create
+// request of docker, with the defaults of its image filled in.
+type Container struct {
+	ID      string
+	Name    string
+	Image   string
+	ImageID string
+	Created time.Time
+	Config  *types.ContainerConfig
+	State   State
+
+	// Dir keeps the state of the container. The backend may keep its
+	// own there too.
+	Dir string `json:"-"`
+
+	// exited is closed when the running container exits.
+	exited chan struct{}
+	// starting is set while the backend starts the container.
+	starting bool
+}
+
+// Command returns the command line of c.
+func (c *Container) Command() []string {
+	return append(append([]string{}, c.Config.Entrypoint...), c.Config.Cmd...)
+}
+
+// Backend runs the containers of a runtime.
+type Backend interface {
+	// Version of the runtime.
+	Version(ctx context.Context) (string, error)
+
+	Images(ctx context.Context) ([]*Image, error)
+	// Pull fetches ref, reporting its progress to progress.
+	Pull(ctx context.Context, ref string, progress func(status string)) error
+	RemoveImage(ctx context.Context, id string) error
+
+	// Create prepares c to run img.
+	Create(ctx context.Context, c *Container, img *Image) error
+	// Start runs c with its output written to stdout and stderr and
+	// returns its pid.
+	Start(ctx context.Context, c *Container, stdout, stderr io.Writer) (int, error)
+	// Wait blocks until c, started as pid, exits and returns its exit
+	// code.
+	Wait(c *Container, pid int) (int, error)
+	Kill(ctx context.Context, c *Container, sig syscall.Signal) error
+	// Delete removes what Create and Start left of c.
+	Delete(ctx context.Context, c *Container) error
+}
+
+// IDGenerator is implemented by the backends that choose the IDs of their
+// containers and execs, such as the fake runtime whose IDs are
+// deterministic.
+type IDGenerator interface {
+	NewID() string
+}
+
+// Factory creates the backend of a runtime, which keeps its state under
+// root.
+type Factory func(root string) (Backend, error)
+
+var (
+	factoriesLock sync.Mutex
+	factories     = make(map[string]Factory)
+)
+
+// Register makes the backend of runtime name available.
+func Register(name string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	if _, ok := factories[name]; ok {
+		panic("emulator: " + name + " is registered twice")
+	}
+	factories[name] = factory
+}
+
+// Registered tells whether runtime name is emulated.
+func Registered(name string) bool {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	_, ok := factories[name]
+	return ok
+}
+
+// current is the emulator of the runtime of the daemon.
+var current *Emulator
+
+// Init opens the emulator of the runtime of eng, under its own directory of
+// the state root.
+func Init(eng *engine.Engine) error {
+	name := engine.RuntimeNames[eng.RuntimeType]
+	e, err := Open(name, filepath.Join(engine.StateRoot, name), eng.Events)
+	if err != nil {
+		return err
+	}
+	current = e
+	trap.ShutdownCallback(e.shutdown)
+	return nil
+}
+
+// Rundockercmd serves a request of the Docker API with the emulator of the
+// daemon.
+func Rundockercmd(w http.ResponseWriter, r *http.Request) error {
+	if current == nil {
+		return fmt.Errorf("Impossible to serve %s: the runtime is not initialized", r.URL.Path)
+	}
+	return current.Serve(w, r)
+}
+
+// Emulator serves the Docker API on a backend.
+type Emulator struct {
+	name    string
+	backend Backend
+	root    string
+	events  *events.Events
+
+	mu           sync.Mutex
+	containers   map[string]*Container
+	execs        map[string]*execSession
+	shuttingDown bool
+}
+
+// Open creates the backend of runtime name and the emulator serving it. Both
+// keep their state under root.
+func Open(name, root string, ev *events.Events) (*Emulator, error) {
+	factoriesLock.Lock()
+	factory, ok := factories[name]
+	factoriesLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("No such runtime: %s", name)
+	}
+	b, err := factory(root)
+	if err != nil {
+		return nil, err
+	}
+	return New(name, b, root, ev)
+}
+
+// New creates the emulator of backend b. The containers saved under root
+// are loaded back, and the ones harbour left running when it went away
+// without stopping them are killed: their output went with it.
+func New(name string, b Backend, root string, ev *events.Events) (*Emulator, error) {
+	e := &Emulator{
+		name:       name,
+		backend:    b,
+		root:       root,
+		events:     ev,
+		containers: make(map[string]*Container),
+		execs:      make(map[string]*execSession),
+	}
+	if err := os.MkdirAll(e.containersDir(), 0700); err != nil {
+		return nil, err
+	}
+	dirs, err := ioutil.ReadDir(e.containersDir())
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dirs {
+		dir := filepath.Join(e.containersDir(), d.Name())
+		data, err := ioutil.ReadFile(filepath.Join(dir, "container.json"))
+		if err != nil {
+			logrus.Warnf("Skipping container %s: %s", d.Name(), err)
+			continue
+		}
+		c := &Container{}
+		if err := json.Unmarshal(data, c); err != nil {
+			logrus.Warnf("Skipping container %s: %s", d.Name(), err)
+			continue
+		}
+		c.Dir = dir
+		c.exited = make(chan struct{})
+		close(c.exited)
+		e.containers[c.ID] = c
+		if c.State.Running {
+			logrus.Warnf("Killing container %s, left running by harbour", c.ID)
+			if err := b.Kill(context.Background(), c, syscall.SIGKILL); err != nil {
+				logrus.Debugf("Failed to kill container %s: %s", c.ID, err)
+			}
+			c.State.Running = false
+			c.State.Pid = 0
+			c.State.ExitCode = 128 + int(syscall.SIGKILL)
+			c.State.FinishedAt = time.Now().UTC()
+			if err := e.save(c); err != nil {
+				logrus.Errorf("Failed to save container %s: %s", c.ID, err)
+			}
+		}
+	}
+	return e, nil
+}
+
+func (e *Emulator) containersDir() string {
+	return filepath.Join(e.root, "containers")
+}
+
+// save writes c to its directory. The caller holds the lock.
+func (e *Emulator) save(c *Container) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(c.Dir, ".container.json")
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(c.Dir, "container.json"))
+}
+
+// update applies fn to c under the lock and saves the result.
+func (e *Emulator) update(c *Container, fn func(c *Container)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fn(c)
+	if err := e.save(c); err != nil {
+		logrus.Errorf("Failed to save container %s: %s", c.ID, err)
+	}
+}
+
+// get finds a container by ID, unique ID prefix or name.
+func (e *Emulator) get(ref string) (*Container, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if c, ok := e.containers[ref]; ok {
+		return c, nil
+	}
+	var found *Container
+	for _, c := range e.containers {
+		if c.Name != "" && c.Name == strings.TrimPrefix(ref, "/") {
+			return c, nil
+		}
+		if strings.HasPrefix(c.ID, ref) {
+			if found != nil {
+				return nil, fmt.Errorf("Bad parameter: multiple containers match %s", ref)
+			}
+			found = c
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("No such container: %s", ref)
+	}
+	return found, nil
+}
+
+func (e *Emulator) list() []*Container {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	list := make([]*Container, 0, len(e.containers))
+	for _, c := range e.containers {
+		list = append(list, c)
+	}
+	return list
+}
+
+// image finds an image of the backend by ID, unique ID prefix or name.
+func (e *Emulator) image(ctx context.Context, ref string) (*Image, error) {
+	images, err := e.backend.Images(ctx)
+	if err != nil {
+		return nil, err
+	}
+	want := reference.Normalize(ref)
+	for _, img := range images {
+		if img.ID == ref || strings.TrimPrefix(img.ID, "sha256:") == ref {
+			return img, nil
+		}
+		for _, name := range img.Names {
+			if reference.Normalize(name) == want {
+				return img, nil
+			}
+		}
+	}
+	if len(ref) >= 12 {
+		for _, img := range images {
+			if strings.HasPrefix(strings.TrimPrefix(img.ID, "sha256:"), strings.TrimPrefix(ref, "sha256:")) {
+				return img, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("No such image: %s", ref)
+}
+
+// create records a container for config, running its image with the
+// defaults of the image where config has none.
+func (e *Emulator) create(ctx context.Context, name string, config *types.ContainerConfig) (*Container, error) {
+	img, err := e.image(ctx, config.Image)
+	if err != nil {
+		return nil, err
+	}
+	if defaults := img.Config; defaults != nil {
+		if len(config.Entrypoint) == 0 {
+			config.Entrypoint = defaults.Entrypoint
+			if len(config.Cmd) == 0 {
+				config.Cmd = defaults.Cmd
+			}
+		}
+		config.Env = mergeEnv(defaults.Env, config.Env)
+		if config.WorkingDir == "" {
+			config.WorkingDir = defaults.WorkingDir
+		}
+		if config.User == "" {
+			config.User = defaults.User
+		}
+		if len(defaults.Labels) > 0 {
+			labels := map[string]string{}
+			for k, v := range defaults.Labels {
+				labels[k] = v
+			}
+			for k, v := range config.Labels {
+				labels[k] = v
+			}
+			config.Labels = labels
+		}
+	}
+	if len(config.Entrypoint) == 0 && len(config.Cmd) == 0 {
+		return nil, fmt.Errorf("Bad parameter: no command specified")
+	}
+	if config.HostConfig == nil {
+		config.HostConfig = &types.HostConfig{}
+	}
+
+	id, err := e.newID()
+	if err != nil {
+		return nil, err
+	}
+	c := &Container{
+		ID:      id,
+		Name:    name,
+		Image:   config.Image,
+		ImageID: img.ID,
+		Created: time.Now().UTC(),
+		Config:  config,
+		Dir:     filepath.Join(e.containersDir(), id),
+		exited:  make(chan struct{}),
+	}
+	close(c.exited)
+
+	e.mu.Lock()
+	for _, other := range e.containers {
+		if name != "" && other.Name == name {
+			e.mu.Unlock()
+			return nil, fmt.Errorf("Conflict. The name %s is already in use by container %s", name, other.ID)
+		}
+	}
+	// Reserve the name while the backend prepares the container.
+	e.containers[c.ID] = c
+	e.mu.Unlock()
+
+	err = os.MkdirAll(c.Dir, 0700)
+	if err == nil {
+		err = e.backend.Create(ctx, c, img)
+	}
+	if err == nil {
+		e.mu.Lock()
+		err = e.save(c)
+		e.mu.Unlock()
+	}
+	if err != nil {
+		e.backend.Delete(ctx, c)
+		e.mu.Lock()
+		delete(e.containers, c.ID)
+		e.mu.Unlock()
+		os.RemoveAll(c.Dir)
+		return nil, err
+	}
+	e.events.Log("create", c.ID, c.Image)
+	return c, nil
+}
+
+// mergeEnv overrides the variables of base with those of env.
+func mergeEnv(base, env []string) []string {
+	merged := []string{}
+	seen := map[string]bool{}
+	for _, v := range env {
+		seen[strings.SplitN(v, "=", 2)[0]] = true
+	}
+	for _, v := range base {
+		if !seen[strings.SplitN(v, "=", 2)[0]] {
+			merged = append(merged, v)
+		}
+	}
+	return append(merged, env...)
+}
+
+// newID returns a new ID for a container or an exec, chosen by the backend
+// if it implements IDGenerator.
+func (e *Emulator) newID() (string, error) {
+	if g, ok := e.backend.(IDGenerator); ok {
+		return g.NewID(), nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// start runs c unless it is running already. c is marked as starting until
+// the backend is done, so that a concurrent start does not run it twice.
+func (e *Emulator) start(ctx context.Context, c *Container) error {
+	e.mu.Lock()
+	switch {
+	case e.shuttingDown:
+		e.mu.Unlock()
+		return fmt.Errorf("Impossible to start container %s: harbour is shutting down", c.ID)
+	case c.starting:
+		e.mu.Unlock()
+		return fmt.Errorf("Conflict. Container %s is already starting", c.ID)
+	case c.State.Running:
+		e.mu.Unlock()
+		return nil
+	}
+	c.starting = true
+	e.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(c.Dir, jsonlog.FileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		e.mu.Lock()
+		c.starting = false
+		e.mu.Unlock()
+		return err
+	}
+	logs := jsonlog.NewWriter(f)
+	pid, err := e.backend.Start(ctx, c, logs.Stream("stdout"), logs.Stream("stderr"))
+	if err != nil {
+		f.Close()
+		e.update(c, func(c *Container) {
+			c.starting = false
+			c.State.Error = err.Error()
+		})
+		return err
+	}
+	shuttingDown := false
+	e.update(c, func(c *Container) {
+		shuttingDown = e.shuttingDown
+		c.starting = false
+		c.exited = make(chan struct{})
+		c.State = State{
+			Running:   true,
+			Pid:       pid,
+			StartedAt: time.Now().UTC(),
+		}
+	})
+	e.events.Log("start", c.ID, c.Image)
+	go e.monitor(c, pid, func() {
+		logs.Flush()
+		f.Close()
+	})
+	// The shutdown began while c was starting, without it.
+	if shuttingDown {
+		return e.backend.Kill(ctx, c, syscall.SIGKILL)
+	}
+	return nil
+}
+
+// monitor waits for c to exit, then records its exit code. done is called
+// once the backend is done with its output.
+func (e *Emulator) monitor(c *Container, pid int, done func()) {
+	code, err := e.backend.Wait(c, pid)
+	if err != nil {
+		logrus.Warnf("Lost track of container %s: %s", c.ID, err)
+		code = -1
+	}
+	done()
+
+	exited := false
+	e.update(c, func(c *Container) {
+		if !c.State.Running {
+			return
+		}
+		exited = true
+		c.State.Running = false
+		c.State.Pid = 0
+		c.State.ExitCode = code
+		c.State.FinishedAt = time.Now().UTC()
+		close(c.exited)
+	})
+	if exited {
+		e.events.Log("die", c.ID, c.Image)
+	}
+}
+
+func (e *Emulator) kill(ctx context.Context, c *Container, sig syscall.Signal) error {
+	e.mu.Lock()
+	running := c.State.Running
+	e.mu.Unlock()
+	if !running {
+		return fmt.Errorf("Conflict. Container %s is not running", c.ID)
+	}
+	if err := e.backend.Kill(ctx, c, sig); err != nil {
+		return err
+	}
+	e.events.Log("kill", c.ID, c.Image)
+	return nil
+}
+
+// stop asks c to terminate and kills it after timeout.
+func (e *Emulator) stop(ctx context.Context, c *Container, timeout time.Duration) error {
+	e.mu.Lock()
+	running, exited := c.State.Running, c.exited
+	e.mu.Unlock()
+	if !running {
+		return nil
+	}
+	if err := e.backend.Kill(ctx, c, syscall.SIGTERM); err != nil {
+		return err
+	}
+	select {
+	case <-exited:
+	case <-time.After(timeout):
+		if err := e.backend.Kill(ctx, c, syscall.SIGKILL); err != nil {
+			return err
+		}
+		select {
+		case <-exited:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	e.events.Log("stop", c.ID, c.Image)
+	return nil
+}
+
+// shutdown stops the running containers, which would be left without their
+// log, and refuses to start others.
+func (e *Emulator) shutdown() {
+	var running []*Container
+	e.mu.Lock()
+	e.shuttingDown = true
+	for _, c := range e.containers {
+		if c.State.Running {
+			running = append(running, c)
+		}
+	}
+	e.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range running {
+		wg.Add(1)
+		go func(c *Container) {
+			defer wg.Done()
+			if err := e.stop(context.Background(), c, shutdownTimeout); err != nil {
+				logrus.Errorf("Failed to stop container %s: %s", c.ID, err)
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// wait blocks until c is not running and returns its exit code.
+func (e *Emulator) wait(ctx context.Context, c *Container) (int, error) {
+	e.mu.Lock()
+	exited := c.exited
+	e.mu.Unlock()
+	select {
+	case <-exited:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return c.State.ExitCode, nil
+}
+
+func (e *Emulator) remove(ctx context.Context, c *Container, force bool) error {
+	e.mu.Lock()
+	running, starting := c.State.Running, c.starting
+	e.mu.Unlock()
+	if starting {
+		return fmt.Errorf("Conflict. Container %s is starting", c.ID)
+	}
+	if running {
+		if !force {
+			return fmt.Errorf("Conflict, You cannot remove a running container %s. Stop the container before attempting removal or use -f", c.ID)
+		}
+		if err := e.backend.Kill(ctx, c, syscall.SIGKILL); err != nil {
+			return err
+		}
+		if _, err := e.wait(ctx, c); err != nil {
+			return err
+		}
+	}
+	if err := e.backend.Delete(ctx, c); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	delete(e.containers, c.ID)
+	for id, s := range e.execs {
+		if s.Container == c {
+			delete(e.execs, id)
+		}
+	}
+	e.mu.Unlock()
+	if err := os.RemoveAll(c.Dir); err != nil {
+		return err
+	}
+	e.events.Log("destroy", c.ID, c.Image)
+	return nil
+}
@@ -0,0 +1,140 @@
+package emulator
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/engine/events"
+)
+
+// stubBackend starts its containers once release is closed, and runs them
+// until they are killed.
+type stubBackend struct {
+	entered chan struct{}
+	release chan struct{}
+
+	mu     sync.Mutex
+	starts int
+	killed []string
+	procs  map[string]chan struct{}
+}
+
+func newStubBackend() *stubBackend {
+	return &stubBackend{
+		entered: make(chan struct{}, 1),
+		release: make(chan struct{}),
+		procs:   make(map[string]chan struct{}),
+	}
+}
+
+func (b *stubBackend) Version(ctx context.Context) (string, error)  { return "1.0", nil }
+func (b *stubBackend) Images(ctx context.Context) ([]*Image, error) { return nil, nil }
+func (b *stubBackend) Pull(ctx context.Context, ref string, progress func(string)) error {
+	return nil
+}
+func (b *stubBackend) RemoveImage(ctx context.Context, id string) error           { return nil }
+func (b *stubBackend) Create(ctx context.Context, c *Container, img *Image) error { return nil }
+func (b *stubBackend) Delete(ctx context.Context, c *Container) error             { return nil }
+
+func (b *stubBackend) Start(ctx context.Context, c *Container, stdout, stderr io.Writer) (int, error) {
+	b.entered <- struct{}{}
+	<-b.release
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.starts++
+	b.procs[c.ID] = make(chan struct{})
+	return 1000 + b.starts, nil
+}
+
+func (b *stubBackend) Wait(c *Container, pid int) (int, error) {
+	b.mu.Lock()
+	done := b.procs[c.ID]
+	b.mu.Unlock()
+	<-done
+	return 143, nil
+}
+
+func (b *stubBackend) Kill(ctx context.Context, c *Container, sig syscall.Signal) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.killed = append(b.killed, c.ID)
+	if done, ok := b.procs[c.ID]; ok {
+		select {
+		case <-done:
+		default:
+			close(done)
+		}
+	}
+	return nil
+}
+
+func TestStartAndShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harbour-emulator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	b := newStubBackend()
+	e, err := New("stub", b, dir, events.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Container{ID: "c1", Dir: filepath.Join(e.containersDir(), "c1"), Config: &types.ContainerConfig{}, exited: make(chan struct{})}
+	close(c.exited)
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	e.containers[c.ID] = c
+
+	started := make(chan error)
+	go func() {
+		started <- e.start(context.Background(), c)
+	}()
+	<-b.entered
+	// The backend is starting c: it is neither started twice nor removed.
+	if err := e.start(context.Background(), c); err == nil || !strings.Contains(err.Error(), "Conflict") {
+		t.Fatalf("expected a concurrent start to conflict, got %v", err)
+	}
+	if err := e.remove(context.Background(), c, true); err == nil || !strings.Contains(err.Error(), "Conflict") {
+		t.Fatalf("expected the removal of a starting container to conflict, got %v", err)
+	}
+	close(b.release)
+	if err := <-started; err != nil {
+		t.Fatal(err)
+	}
+	if err := e.start(context.Background(), c); err != nil {
+		t.Fatalf("expected starting a running container to do nothing, got %v", err)
+	}
+	if b.starts != 1 || !c.State.Running {
+		t.Fatalf("expected c1 to be started once, got %d starts, %+v", b.starts, c.State)
+	}
+
+	e.shutdown()
+	if c.State.Running || c.State.ExitCode != 143 {
+		t.Fatalf("expected c1 to be stopped along with harbour, got %+v", c.State)
+	}
+	if err := e.start(context.Background(), c); err == nil {
+		t.Fatal("expected no start during the shutdown")
+	}
+
+	// A container harbour left running is killed when it starts again.
+	e.update(c, func(c *Container) {
+		c.State.Running = true
+	})
+	b = newStubBackend()
+	if e, err = New("stub", b, dir, events.New()); err != nil {
+		t.Fatal(err)
+	}
+	c = e.containers["c1"]
+	if len(b.killed) != 1 || c.State.Running || c.State.ExitCode != 137 {
+		t.Fatalf("expected c1 to be killed, got %v and %+v", b.killed, c.State)
+	}
+}
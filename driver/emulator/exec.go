@@ -0,0 +1,197 @@
+package emulator
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Execer is implemented by the backends that run commands in their running
+// containers.
+type Execer interface {
+	// Exec runs cmd in c with its output written to stdout and stderr,
+	// and returns its exit code.
+	Exec(ctx context.Context, c *Container, cmd []string, stdout, stderr io.Writer) (int, error)
+}
+
+// execSession is a command docker exec runs in a container.
+type execSession struct {
+	ID        string
+	Container *Container
+	Cmd       []string
+	Tty       bool
+
+	started  bool
+	running  bool
+	exitCode int
+}
+
+func (e *Emulator) execer() (Execer, error) {
+	x, ok := e.backend.(Execer)
+	if !ok {
+		return nil, fmt.Errorf("Impossible to exec in the containers of %s", e.name)
+	}
+	return x, nil
+}
+
+func createExec(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	if _, err := e.execer(); err != nil {
+		return err
+	}
+	c, err := e.get(ref)
+	if err != nil {
+		return err
+	}
+	var config struct {
+		Tty bool
+		Cmd []string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		return fmt.Errorf("Bad parameter: %s", err)
+	}
+	if len(config.Cmd) == 0 {
+		return fmt.Errorf("Bad parameter: no exec command specified")
+	}
+	id, err := e.newID()
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	if !c.State.Running {
+		e.mu.Unlock()
+		return fmt.Errorf("Conflict. Container %s is not running", c.ID)
+	}
+	e.execs[id] = &execSession{ID: id, Container: c, Cmd: config.Cmd, Tty: config.Tty}
+	e.mu.Unlock()
+	e.events.Log("exec_create: "+strings.Join(config.Cmd, " "), c.ID, c.Image)
+	return writeJSON(w, http.StatusCreated, map[string]string{"Id": id})
+}
+
+// startExec runs an exec on the connection of the request, which it takes
+// over unless the exec is detached.
+func startExec(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	x, err := e.execer()
+	if err != nil {
+		return err
+	}
+	var config struct {
+		Detach bool
+	}
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil && err != io.EOF {
+		return fmt.Errorf("Bad parameter: %s", err)
+	}
+
+	e.mu.Lock()
+	s, ok := e.execs[ref]
+	if !ok {
+		e.mu.Unlock()
+		return fmt.Errorf("No such exec instance: %s", ref)
+	}
+	if s.started {
+		e.mu.Unlock()
+		return fmt.Errorf("Conflict. Exec %s has already been started", ref)
+	}
+	if !s.Container.State.Running {
+		e.mu.Unlock()
+		return fmt.Errorf("Conflict. Container %s is not running", s.Container.ID)
+	}
+	s.started, s.running = true, true
+	e.mu.Unlock()
+	e.events.Log("exec_start: "+strings.Join(s.Cmd, " "), s.Container.ID, s.Container.Image)
+
+	if config.Detach {
+		go e.runExec(context.Background(), x, s, nil)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return fmt.Errorf("Impossible to attach to exec %s: the connection cannot be taken over", ref)
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if r.Header.Get("Upgrade") == "tcp" {
+		fmt.Fprint(conn, "HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+	} else {
+		fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Type: application/vnd.docker.raw-stream\r\n\r\n")
+	}
+	e.runExec(context.Background(), x, s, conn)
+	return nil
+}
+
+// runExec runs s with its output written to out, multiplexed unless s has a
+// tty, and records its exit code.
+func (e *Emulator) runExec(ctx context.Context, x Execer, s *execSession, out io.Writer) {
+	stdout, stderr := ioutil.Discard, ioutil.Discard
+	if out != nil {
+		stdout, stderr = out, out
+		if !s.Tty {
+			mu := &sync.Mutex{}
+			stdout, stderr = &stdWriter{out, mu, 1}, &stdWriter{out, mu, 2}
+		}
+	}
+	code, err := x.Exec(ctx, s.Container, s.Cmd, stdout, stderr)
+	if err != nil {
+		logrus.Errorf("Exec %s in container %s failed: %s", s.ID, s.Container.ID, err)
+		fmt.Fprintf(stderr, "%s\n", err)
+		code = 126
+	}
+	e.mu.Lock()
+	s.running, s.exitCode = false, code
+	e.mu.Unlock()
+}
+
+// stdWriter frames what is written to it with the header of the stream the
+// Docker API multiplexes stdout and stderr with.
+type stdWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	stream byte
+}
+
+func (s *stdWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	header := make([]byte, 8)
+	header[0] = s.stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(p)))
+	if _, err := s.w.Write(header); err != nil {
+		return 0, err
+	}
+	return s.w.Write(p)
+}
+
+func inspectExec(e *Emulator, w http.ResponseWriter, r *http.Request, ref string) error {
+	e.mu.Lock()
+	s, ok := e.execs[ref]
+	if !ok {
+		e.mu.Unlock()
+		return fmt.Errorf("No such exec instance: %s", ref)
+	}
+	inspect := map[string]interface{}{
+		"ID":          s.ID,
+		"Running":     s.running,
+		"ExitCode":    s.exitCode,
+		"ContainerID": s.Container.ID,
+		"OpenStdin":   false,
+		"ProcessConfig": map[string]interface{}{
+			"entrypoint": s.Cmd[0],
+			"arguments":  s.Cmd[1:],
+			"tty":        s.Tty,
+		},
+	}
+	e.mu.Unlock()
+	return writeJSON(w, http.StatusOK, inspect)
+}
@@ -0,0 +1,54 @@
+// What the backends running containers on the host share.
+
+package emulator
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Bind is a host directory mounted in a container.
+type Bind struct {
+	Source      string
+	Destination string
+	ReadOnly    bool
+}
+
+// ParseBind reads a bind of docker, host-src:container-dest[:ro|rw], for the
+// runtime name. There are no volumes, only host directories.
+func ParseBind(name, bind string) (Bind, error) {
+	parts := strings.Split(bind, ":")
+	if len(parts) < 2 || len(parts) > 3 || !filepath.IsAbs(parts[0]) || !filepath.IsAbs(parts[1]) {
+		return Bind{}, fmt.Errorf("Bad parameter: invalid bind %s, only host directories can be mounted on the %s runtime", bind, name)
+	}
+	b := Bind{Source: parts[0], Destination: parts[1]}
+	if len(parts) == 3 {
+		switch parts[2] {
+		case "ro":
+			b.ReadOnly = true
+		case "rw":
+		default:
+			return Bind{}, fmt.Errorf("Bad parameter: invalid mode %s of bind %s", parts[2], bind)
+		}
+	}
+	return b, nil
+}
+
+// RefuseTty refuses to run c with a tty on the runtime name: its output
+// goes to its log and attach is not emulated.
+func RefuseTty(name string, c *Container) error {
+	if c.Config.Tty {
+		return fmt.Errorf("Impossible to allocate a tty on the %s runtime, run the container without -t", name)
+	}
+	return nil
+}
+
+// Detach keeps the process cmd runs out of the process group of harbour, so
+// that a ^C on harbour does not take the container down before harbour
+// stops it.
+func Detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,275 @@
+// Package images pulls images from the registries of docker and unpacks
+// them, for the runtimes the emulator runs containers on out of plain
+// directories.
+package images
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huawei-openlab/harbour/api/reference"
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/driver/emulator"
+)
+
+// imageConfig is the part of the configuration of an image harbour reads.
+type imageConfig struct {
+	Created time.Time `json:"created"`
+	Config  struct {
+		User       string
+		Env        []string
+		Entrypoint []string
+		Cmd        []string
+		WorkingDir string
+		Labels     map[string]string
+	} `json:"config"`
+}
+
+// Store keeps the unpacked images of a runtime, each in a directory named
+// after its ID with its description in image.json and its files in rootfs.
+type Store struct {
+	root string
+	mu   sync.Mutex
+}
+
+// New creates the store of the images kept under root.
+func New(root string) *Store {
+	return &Store{root: root}
+}
+
+// Rootfs returns the directory holding the files of image id.
+func (s *Store) Rootfs(id string) string {
+	return filepath.Join(s.imageDir(id), "rootfs")
+}
+
+func (s *Store) imagesDir() string {
+	return filepath.Join(s.root, "images")
+}
+
+// Images lists the unpacked images.
+func (s *Store) Images(ctx context.Context) ([]*emulator.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.images()
+}
+
+func (s *Store) images() ([]*emulator.Image, error) {
+	dirs, err := ioutil.ReadDir(s.imagesDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var images []*emulator.Image
+	for _, d := range dirs {
+		img, err := readImage(filepath.Join(s.imagesDir(), d.Name()))
+		if err != nil {
+			// An image still being unpacked has no description yet.
+			continue
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+func readImage(dir string) (*emulator.Image, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "image.json"))
+	if err != nil {
+		return nil, err
+	}
+	img := &emulator.Image{}
+	if err := json.Unmarshal(data, img); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func writeImage(dir string, img *emulator.Image) error {
+	data, err := json.Marshal(img)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, ".image.json")
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, "image.json"))
+}
+
+func (s *Store) imageDir(id string) string {
+	return filepath.Join(s.imagesDir(), strings.TrimPrefix(id, "sha256:"))
+}
+
+// Pull downloads ref from its registry and unpacks its layers, unless the
+// image is already there.
+func (s *Store) Pull(ctx context.Context, ref string, progress func(status string)) error {
+	r, err := parseReference(ref)
+	if err != nil {
+		return err
+	}
+	name := reference.Normalize(ref)
+	client := newRegistryClient(r)
+
+	progress("Pulling from " + r.repository)
+	m, err := client.manifest(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := client.readBlob(ctx, m.Config.Digest)
+	if err != nil {
+		return err
+	}
+	if err := verify(data, m.Config.Digest); err != nil {
+		return err
+	}
+	config := &imageConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("Bad parameter: invalid configuration for %s: %s", ref, err)
+	}
+
+	id := m.Config.Digest
+	dir := s.imageDir(id)
+	if img, err := readImage(dir); err == nil {
+		progress("Image is up to date for " + name)
+		return s.tag(img, dir, name)
+	}
+
+	if err := os.MkdirAll(s.imagesDir(), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(s.imagesDir(), ".pull-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	rootfs := filepath.Join(tmp, "rootfs")
+	if err := os.Mkdir(rootfs, 0755); err != nil {
+		return err
+	}
+
+	var size int64
+	for _, layer := range m.Layers {
+		short := strings.TrimPrefix(layer.Digest, "sha256:")
+		if len(short) > 12 {
+			short = short[:12]
+		}
+		progress("Pulling fs layer " + short)
+		n, err := s.pullLayer(ctx, client, rootfs, layer.Digest)
+		if err != nil {
+			return err
+		}
+		size += n
+		progress("Pull complete " + short)
+	}
+
+	img := &emulator.Image{
+		ID:      id,
+		Names:   []string{},
+		Created: config.Created,
+		Size:    size,
+		Config: &types.ContainerConfig{
+			User:       config.Config.User,
+			Env:        config.Config.Env,
+			Entrypoint: config.Config.Entrypoint,
+			Cmd:        config.Config.Cmd,
+			WorkingDir: config.Config.WorkingDir,
+			Labels:     config.Config.Labels,
+		},
+	}
+	if err := writeImage(tmp, img); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		// Another pull of the same image got there first.
+		if img, err = readImage(dir); err != nil {
+			return err
+		}
+	}
+	return s.tag(img, dir, name)
+}
+
+func (s *Store) pullLayer(ctx context.Context, client *registryClient, rootfs, digest string) (int64, error) {
+	r, err := client.blob(ctx, digest)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	h := sha256.New()
+	tee := io.TeeReader(r, h)
+	n, err := applyLayer(rootfs, tee)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(ioutil.Discard, tee); err != nil {
+		return 0, err
+	}
+	if "sha256:"+hex.EncodeToString(h.Sum(nil)) != digest {
+		return 0, fmt.Errorf("layer %s does not match its digest", digest)
+	}
+	return n, nil
+}
+
+func verify(data []byte, digest string) error {
+	sum := sha256.Sum256(data)
+	if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return fmt.Errorf("blob %s does not match its digest", digest)
+	}
+	return nil
+}
+
+// tag names img after name, which no other image is named after any more.
+func (s *Store) tag(img *emulator.Image, dir, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	images, err := s.images()
+	if err != nil {
+		return err
+	}
+	for _, other := range images {
+		if other.ID == img.ID {
+			img = other
+			continue
+		}
+		names := []string{}
+		for _, n := range other.Names {
+			if n != name {
+				names = append(names, n)
+			}
+		}
+		if len(names) != len(other.Names) {
+			other.Names = names
+			if err := writeImage(s.imageDir(other.ID), other); err != nil {
+				return err
+			}
+		}
+	}
+	for _, n := range img.Names {
+		if n == name {
+			return nil
+		}
+	}
+	img.Names = append(img.Names, name)
+	return writeImage(dir, img)
+}
+
+// RemoveImage removes image id and its files.
+func (s *Store) RemoveImage(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir := s.imageDir(id)
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("No such image: %s", id)
+	}
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,250 @@
+package images
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// maxLinks bounds the symlinks followed while resolving a path.
+const maxLinks = 40
+
+// Resolve returns the path of name under root, following the symlinks of its
+// parents as if root were /, so that no path of an image leads out of it.
+// The last element of name is not followed.
+func Resolve(root, name string) (string, error) {
+	return resolveLinks(root, name, 0)
+}
+
+func resolveLinks(root, name string, links int) (string, error) {
+	parts := strings.Split(filepath.Clean("/" + name)[1:], "/")
+	if parts[0] == "" {
+		return root, nil
+	}
+	cur := "/"
+	for i, part := range parts[:len(parts)-1] {
+		next := filepath.Join(cur, part)
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+		if links == maxLinks {
+			return "", fmt.Errorf("Bad parameter: too many levels of symbolic links in %s", name)
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(cur, target)
+		}
+		rest := append([]string{target}, parts[i+1:]...)
+		return resolveLinks(root, filepath.Join(rest...), links+1)
+	}
+	return filepath.Join(root, cur, parts[len(parts)-1]), nil
+}
+
+// applyLayer extracts the layer r, gzipped or not, over dir with the whiteout
+// semantics of docker. It returns the size of the files it wrote.
+func applyLayer(dir string, r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	var size int64
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+		name := filepath.Clean("/" + hdr.Name)
+		if name == "/" {
+			continue
+		}
+		p, err := Resolve(dir, name)
+		if err != nil {
+			return size, err
+		}
+
+		base := filepath.Base(name)
+		if base == ".wh..wh..opq" {
+			// An opaque directory hides what the lower layers put in it.
+			parent := filepath.Dir(p)
+			entries, _ := ioutil.ReadDir(parent)
+			for _, e := range entries {
+				os.RemoveAll(filepath.Join(parent, e.Name()))
+			}
+			continue
+		}
+		if strings.HasPrefix(base, ".wh.") {
+			os.RemoveAll(filepath.Join(filepath.Dir(p), strings.TrimPrefix(base, ".wh.")))
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return size, err
+		}
+		if fi, err := os.Lstat(p); err == nil && !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+			if err := os.RemoveAll(p); err != nil {
+				return size, err
+			}
+		}
+
+		mode := os.FileMode(hdr.Mode) & os.ModePerm
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(p, mode); err != nil {
+				return size, err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			f, err := os.OpenFile(p, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+			if err != nil {
+				return size, err
+			}
+			n, err := io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return size, err
+			}
+			size += n
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, p); err != nil {
+				return size, err
+			}
+		case tar.TypeLink:
+			target, err := Resolve(dir, hdr.Linkname)
+			if err != nil {
+				return size, err
+			}
+			if err := os.Link(target, p); err != nil {
+				return size, err
+			}
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			if err := mknod(p, hdr); err != nil {
+				// Devices can only be created by root, the runtime
+				// provides those of /dev anyway.
+				continue
+			}
+		default:
+			continue
+		}
+		applyMeta(p, hdr.Uid, hdr.Gid, os.FileMode(hdr.Mode), hdr.Typeflag == tar.TypeSymlink)
+	}
+}
+
+func mknod(p string, hdr *tar.Header) error {
+	mode := uint32(hdr.Mode & 07777)
+	switch hdr.Typeflag {
+	case tar.TypeChar:
+		mode |= syscall.S_IFCHR
+	case tar.TypeBlock:
+		mode |= syscall.S_IFBLK
+	case tar.TypeFifo:
+		mode |= syscall.S_IFIFO
+	}
+	dev := int((hdr.Devminor & 0xff) | (hdr.Devmajor&0xfff)<<8 | (hdr.Devminor&^0xff)<<12)
+	return syscall.Mknod(p, mode, dev)
+}
+
+// applyMeta gives p its owner and mode. The owner is only kept when harbour
+// runs as root.
+func applyMeta(p string, uid, gid int, mode os.FileMode, link bool) {
+	os.Lchown(p, uid, gid)
+	if !link {
+		perm := mode & os.ModePerm
+		if mode&04000 != 0 {
+			perm |= os.ModeSetuid
+		}
+		if mode&02000 != 0 {
+			perm |= os.ModeSetgid
+		}
+		if mode&01000 != 0 {
+			perm |= os.ModeSticky
+		}
+		os.Chmod(p, perm)
+	}
+}
+
+// CopyTree copies the rootfs of an image into the directory of a container.
+func CopyTree(src, dst string) error {
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		st, _ := fi.Sys().(*syscall.Stat_t)
+
+		switch {
+		case fi.IsDir():
+			if err := os.MkdirAll(target, fi.Mode()&os.ModePerm); err != nil {
+				return err
+			}
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+		case fi.Mode().IsRegular():
+			if err := copyFile(p, target, fi.Mode()); err != nil {
+				return err
+			}
+		case st != nil:
+			if err := syscall.Mknod(target, st.Mode, int(st.Rdev)); err != nil {
+				return nil
+			}
+		default:
+			return nil
+		}
+		if st != nil {
+			os.Lchown(target, int(st.Uid), int(st.Gid))
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			os.Chmod(target, fi.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode&os.ModePerm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,229 @@
+package images
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+
+	"github.com/huawei-openlab/harbour/api/reference"
+)
+
+const (
+	defaultRegistry = "registry-1.docker.io"
+
+	mediaManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaIndex        = "application/vnd.oci.image.index.v1+json"
+	mediaOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+)
+
+// registryRef is an image reference split into the parts a registry wants.
+type registryRef struct {
+	registry   string
+	repository string
+	// tag is a tag or a digest.
+	tag string
+}
+
+func parseReference(ref string) (*registryRef, error) {
+	parsed, err := reference.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	r := &registryRef{registry: parsed.Domain, repository: parsed.Path, tag: parsed.Tag}
+	if parsed.Digest != "" {
+		r.tag = parsed.Digest
+	}
+	if r.registry == "docker.io" {
+		r.registry = defaultRegistry
+	}
+	return r, nil
+}
+
+// registryClient fetches the manifests and blobs of a repository with the
+// version 2 registry API, anonymously.
+type registryClient struct {
+	http  *http.Client
+	base  string
+	ref   *registryRef
+	token string
+}
+
+func newRegistryClient(ref *registryRef) *registryClient {
+	scheme := "https"
+	// Like docker, the local registries are reached in plain HTTP.
+	if host := strings.Split(ref.registry, ":")[0]; host == "localhost" || host == "127.0.0.1" {
+		scheme = "http"
+	}
+	return &registryClient{
+		http: &http.Client{},
+		base: scheme + "://" + ref.registry + "/v2/" + ref.repository,
+		ref:  ref,
+	}
+}
+
+// get fetches path of the repository, getting a token first if the registry
+// asks for one.
+func (c *registryClient) get(ctx context.Context, path string, accept ...string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("GET", c.base+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		for _, a := range accept {
+			req.Header.Add("Accept", a)
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("Www-Authenticate")
+			resp.Body.Close()
+			if err := c.authenticate(ctx, challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnauthorized {
+				return nil, fmt.Errorf("No such image: %s/%s:%s", c.ref.registry, c.ref.repository, c.ref.tag)
+			}
+			return nil, fmt.Errorf("registry %s answered %s", c.ref.registry, resp.Status)
+		}
+		return resp, nil
+	}
+}
+
+// authenticate gets an anonymous token for the Bearer challenge of the
+// registry.
+func (c *registryClient) authenticate(ctx context.Context, challenge string) error {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return fmt.Errorf("registry %s requires an unsupported authentication: %s", c.ref.registry, challenge)
+	}
+	params := map[string]string{}
+	for _, p := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	if params["realm"] == "" {
+		return fmt.Errorf("registry %s gave no token realm", c.ref.registry)
+	}
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + c.ref.repository + ":pull"
+	}
+	query.Set("scope", scope)
+
+	req, err := http.NewRequest("GET", params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token server of %s answered %s", c.ref.registry, resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	return nil
+}
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	Platform  *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	} `json:"platform,omitempty"`
+}
+
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Config    descriptor   `json:"config"`
+	Layers    []descriptor `json:"layers"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+// manifest fetches the manifest of the image for the platform harbour runs
+// on, going through the manifest list of a multi-platform image.
+func (c *registryClient) manifest(ctx context.Context) (*manifest, error) {
+	ref := c.ref.tag
+	for {
+		resp, err := c.get(ctx, "/manifests/"+ref, mediaManifestList, mediaIndex, mediaManifest, mediaOCIManifest)
+		if err != nil {
+			return nil, err
+		}
+		m := &manifest{}
+		err = json.NewDecoder(resp.Body).Decode(m)
+		mediaType := resp.Header.Get("Content-Type")
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if m.MediaType == "" {
+			m.MediaType = mediaType
+		}
+		if m.MediaType != mediaManifestList && m.MediaType != mediaIndex {
+			return m, nil
+		}
+		ref = ""
+		for _, d := range m.Manifests {
+			if d.Platform != nil && d.Platform.OS == "linux" && d.Platform.Architecture == runtime.GOARCH {
+				ref = d.Digest
+				break
+			}
+		}
+		if ref == "" {
+			return nil, fmt.Errorf("Impossible to pull %s: no image for linux/%s", c.ref.repository, runtime.GOARCH)
+		}
+	}
+}
+
+// blob opens the blob digest of the repository.
+func (c *registryClient) blob(ctx context.Context, digest string) (io.ReadCloser, error) {
+	resp, err := c.get(ctx, "/blobs/"+digest)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *registryClient) readBlob(ctx context.Context, digest string) ([]byte, error) {
+	r, err := c.blob(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
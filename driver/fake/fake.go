@@ -0,0 +1,370 @@
+// Package fakedrv is a runtime simulated in harbour itself, for developing
+// and testing the clients of its APIs where no container runtime is at
+// hand.
+//
+// Its containers and execs run nothing: they write the output a fixture
+// scripts for their command, then exit with the code it scripts. The IDs of
+// its containers and images only depend on the order and names of the
+// requests, so that a test can tell them in advance.
+package fakedrv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/huawei-openlab/harbour/api/reference"
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/driver"
+	"github.com/huawei-openlab/harbour/driver/emulator"
+	"github.com/huawei-openlab/harbour/engine"
+)
+
+// firstPid is the pid of the first container, the next ones count from it.
+const firstPid = 1000
+
+// created is the creation date of the images the fixture gives none.
+var created = time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func init() {
+	driver.Register("fake", func(transport http.RoundTripper) (driver.Driver, error) {
+		return &fakeDriver{driver.NewDockerAPI("fake", transport)}, nil
+	})
+	emulator.Register("fake", func(root string) (emulator.Backend, error) {
+		fixture := &Fixture{}
+		if engine.FakeFixture != "" {
+			var err error
+			if fixture, err = LoadFixture(engine.FakeFixture); err != nil {
+				return nil, err
+			}
+		}
+		// Nothing survives a restart of the fake runtime, so that its
+		// IDs start over.
+		if err := os.RemoveAll(root); err != nil {
+			return nil, err
+		}
+		return New(fixture), nil
+	})
+}
+
+type fakeDriver struct {
+	*driver.DockerAPI
+}
+
+// Info has nothing to ask: the fake runtime runs in harbour itself, so it is
+// there and healthy as long as harbour is.
+func (d *fakeDriver) Info(ctx context.Context) *driver.RuntimeInfo {
+	return &driver.RuntimeInfo{Name: d.Name(), Version: engine.Version, Healthy: true}
+}
+
+// Backend simulates containers in memory.
+type Backend struct {
+	fixture *Fixture
+
+	mu      sync.Mutex
+	images  map[string]*emulator.Image
+	running map[string]*process
+	ids     int
+	pids    int
+}
+
+// process is a simulated command.
+type process struct {
+	pid  int
+	kill chan syscall.Signal
+	done chan struct{}
+	code int
+}
+
+// New creates the runtime fixture scripts.
+func New(fixture *Fixture) *Backend {
+	b := &Backend{
+		fixture: fixture,
+		images:  make(map[string]*emulator.Image),
+		running: make(map[string]*process),
+		pids:    firstPid,
+	}
+	for _, fi := range fixture.Images {
+		if fi.Pulled {
+			img := b.newImage(reference.Normalize(fi.Name))
+			b.images[img.ID] = img
+		}
+	}
+	return b
+}
+
+// NewID derives the IDs from a counter.
+func (b *Backend) NewID() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ids++
+	return digest(fmt.Sprintf("harbour-fake-%d", b.ids))
+}
+
+func digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// fail returns the error the fixture scripts for op on image, if any.
+func (b *Backend) fail(op, image, target string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := range b.fixture.Failures {
+		f := &b.fixture.Failures[i]
+		if f.Op != op || (f.Image != "" && reference.Normalize(f.Image) != reference.Normalize(image)) {
+			continue
+		}
+		if f.Times > 0 {
+			if f.left == 0 {
+				continue
+			}
+			f.left--
+		}
+		msg := f.Message
+		if msg == "" {
+			msg = fmt.Sprintf("%s %s failed", op, target)
+		}
+		return fmt.Errorf("%s: %s", failureKeywords[f.Status], msg)
+	}
+	return nil
+}
+
+func (b *Backend) Version(ctx context.Context) (string, error) {
+	return engine.Version, nil
+}
+
+// newImage describes the image name, as the fixture does if it does.
+func (b *Backend) newImage(name string) *emulator.Image {
+	img := &emulator.Image{
+		ID:      "sha256:" + digest(name),
+		Names:   []string{name},
+		Created: created,
+		Size:    1 << 20,
+		Config:  &types.ContainerConfig{Cmd: []string{"sh"}},
+	}
+	for _, fi := range b.fixture.Images {
+		if reference.Normalize(fi.Name) != name {
+			continue
+		}
+		if !fi.Created.IsZero() {
+			img.Created = fi.Created
+		}
+		if fi.Size > 0 {
+			img.Size = fi.Size
+		}
+		img.Config = &types.ContainerConfig{
+			Entrypoint: fi.Entrypoint,
+			Cmd:        fi.Cmd,
+			Env:        fi.Env,
+			WorkingDir: fi.WorkingDir,
+			User:       fi.User,
+			Labels:     fi.Labels,
+		}
+	}
+	return img
+}
+
+func (b *Backend) Images(ctx context.Context) ([]*emulator.Image, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	images := make([]*emulator.Image, 0, len(b.images))
+	for _, img := range b.images {
+		copied := *img
+		copied.Names = append([]string{}, img.Names...)
+		images = append(images, &copied)
+	}
+	return images, nil
+}
+
+// Pull gets any image the fixture does not make fail.
+func (b *Backend) Pull(ctx context.Context, ref string, progress func(status string)) error {
+	if err := b.fail("pull", ref, ref); err != nil {
+		return err
+	}
+	name := reference.Normalize(ref)
+	img := b.newImage(name)
+	progress("Pulling from " + strings.SplitN(name, ":", 2)[0])
+	progress("Pull complete " + img.ID[7:19])
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.images[img.ID]; !ok {
+		b.images[img.ID] = img
+	}
+	return nil
+}
+
+func (b *Backend) RemoveImage(ctx context.Context, id string) error {
+	b.mu.Lock()
+	img, ok := b.images[id]
+	b.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("No such image: %s", id)
+	}
+	ref := id
+	if len(img.Names) > 0 {
+		ref = img.Names[0]
+	}
+	if err := b.fail("rmi", ref, id); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	delete(b.images, id)
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *Backend) Create(ctx context.Context, c *emulator.Container, img *emulator.Image) error {
+	return b.fail("create", c.Image, c.ID)
+}
+
+// command finds how cmd behaves in a container of image.
+func (b *Backend) command(image string, cmd []string) *Command {
+	for i := range b.fixture.Commands {
+		rule := &b.fixture.Commands[i]
+		if rule.Image != "" && reference.Normalize(rule.Image) != reference.Normalize(image) {
+			continue
+		}
+		if len(rule.Cmd) > 0 && strings.Join(rule.Cmd, "\x00") != strings.Join(cmd, "\x00") {
+			continue
+		}
+		return rule
+	}
+	return builtin(cmd)
+}
+
+// builtin simulates a few common commands. The others exit right away.
+func builtin(cmd []string) *Command {
+	rule := &Command{}
+	if len(cmd) == 0 {
+		return rule
+	}
+	switch path.Base(cmd[0]) {
+	case "echo":
+		rule.Stdout = strings.Join(cmd[1:], " ") + "\n"
+	case "false":
+		rule.ExitCode = 1
+	case "sleep":
+		if len(cmd) > 1 {
+			if cmd[1] == "infinity" {
+				rule.forever = true
+			} else if n, err := strconv.ParseFloat(cmd[1], 64); err == nil {
+				rule.duration = time.Duration(n * float64(time.Second))
+			}
+		}
+	case "sh", "bash":
+		// An interactive shell waits for its input forever.
+		if len(cmd) == 1 {
+			rule.forever = true
+		}
+	}
+	return rule
+}
+
+// run simulates rule, which ends early when killed.
+func (p *process) run(rule *Command, stdout, stderr io.Writer) {
+	defer close(p.done)
+	io.WriteString(stdout, rule.Stdout)
+	io.WriteString(stderr, rule.Stderr)
+
+	var timeout <-chan time.Time
+	if !rule.forever {
+		timer := time.NewTimer(rule.duration)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-timeout:
+		p.code = rule.ExitCode
+	case sig := <-p.kill:
+		p.code = 128 + int(sig)
+	}
+}
+
+func (b *Backend) Start(ctx context.Context, c *emulator.Container, stdout, stderr io.Writer) (int, error) {
+	if err := b.fail("start", c.Image, c.ID); err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	b.pids++
+	p := &process{pid: b.pids, kill: make(chan syscall.Signal, 1), done: make(chan struct{})}
+	b.running[c.ID] = p
+	rule := b.command(c.Image, c.Command())
+	b.mu.Unlock()
+
+	go p.run(rule, stdout, stderr)
+	return p.pid, nil
+}
+
+// Wait waits for the simulated process of c. The processes are lost when
+// harbour restarts.
+func (b *Backend) Wait(c *emulator.Container, pid int) (int, error) {
+	b.mu.Lock()
+	p, ok := b.running[c.ID]
+	b.mu.Unlock()
+	if !ok || p.pid != pid {
+		return -1, fmt.Errorf("no process %d", pid)
+	}
+	<-p.done
+
+	b.mu.Lock()
+	if b.running[c.ID] == p {
+		delete(b.running, c.ID)
+	}
+	b.mu.Unlock()
+	return p.code, nil
+}
+
+func (b *Backend) Kill(ctx context.Context, c *emulator.Container, sig syscall.Signal) error {
+	if err := b.fail("kill", c.Image, c.ID); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	p, ok := b.running[c.ID]
+	b.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("Conflict. Container %s is not running", c.ID)
+	}
+	select {
+	case p.kill <- sig:
+	default:
+		// It is being killed already.
+	}
+	return nil
+}
+
+func (b *Backend) Delete(ctx context.Context, c *emulator.Container) error {
+	return b.fail("rm", c.Image, c.ID)
+}
+
+// Exec simulates cmd like the command of a container, until it exits or ctx
+// is done.
+func (b *Backend) Exec(ctx context.Context, c *emulator.Container, cmd []string, stdout, stderr io.Writer) (int, error) {
+	if err := b.fail("exec", c.Image, c.ID); err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	rule := b.command(c.Image, cmd)
+	b.mu.Unlock()
+
+	p := &process{kill: make(chan syscall.Signal, 1), done: make(chan struct{})}
+	go p.run(rule, stdout, stderr)
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		p.kill <- syscall.SIGKILL
+		<-p.done
+	}
+	return p.code, nil
+}
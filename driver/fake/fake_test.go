@@ -0,0 +1,144 @@
+package fakedrv
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/client"
+	"github.com/huawei-openlab/harbour/driver/emulator"
+	"github.com/huawei-openlab/harbour/engine/events"
+)
+
+const fixture = `{
+	"images": [{"name": "app:1", "entrypoint": ["/app"], "env": ["MODE=test"]}],
+	"commands": [
+		{"image": "app:1", "cmd": ["/app"], "stdout": "starting\n", "stderr": "boom\n", "exitCode": 3},
+		{"cmd": ["cat", "/etc/hostname"], "stdout": "fake\n"}
+	],
+	"failures": [
+		{"op": "pull", "image": "missing:1", "status": 404, "message": "manifest for missing:1 not found"},
+		{"op": "start", "image": "flaky:1", "status": 500, "times": 1}
+	]
+}`
+
+func TestFake(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harbour-fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fixture.json")
+	if err := ioutil.WriteFile(path, []byte(fixture), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := LoadFixture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := emulator.New("fake", New(f), dir, events.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := e.Serve(w, r); err != nil {
+			status := http.StatusInternalServerError
+			if strings.HasPrefix(err.Error(), "Not found") {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+		}
+	}))
+	defer ts.Close()
+	c, err := client.New(strings.TrimPrefix(ts.URL, "http://"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := c.ImagePull(ctx, "missing:1", nil); !client.IsNotFound(err) {
+		t.Fatalf("expected the pull to fail with 404, got %v", err)
+	}
+	if err := c.ImagePull(ctx, "app:1", nil); err != nil {
+		t.Fatal(err)
+	}
+	created, err := c.ContainerCreate(ctx, "app", &types.ContainerConfig{Image: "app:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != digest("harbour-fake-1") {
+		t.Fatalf("expected a deterministic ID, got %s", created.ID)
+	}
+	if err := c.ContainerStart(ctx, "app"); err != nil {
+		t.Fatal(err)
+	}
+	if code, err := c.ContainerWait(ctx, "app"); err != nil || code != 3 {
+		t.Fatalf("expected exit code 3, got %d, %v", code, err)
+	}
+	logs, err := c.ContainerLogs(ctx, "app", client.LogsOptions{Stdout: true, Stderr: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	err = client.StdCopy(&stdout, &stderr, logs)
+	logs.Close()
+	if err != nil || stdout.String() != "starting\n" || stderr.String() != "boom\n" {
+		t.Fatalf("unexpected logs %q, %q, %v", stdout.String(), stderr.String(), err)
+	}
+
+	// busybox is not in the fixture, sleep runs until it is stopped.
+	if err := c.ImagePull(ctx, "busybox", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ContainerCreate(ctx, "sleeper", &types.ContainerConfig{Image: "busybox", Cmd: []string{"sleep", "infinity"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ContainerStart(ctx, "sleeper"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := c.ExecCreate(ctx, "sleeper", &client.ExecConfig{AttachStdout: true, AttachStderr: true, Cmd: []string{"cat", "/etc/hostname"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.ExecStart(ctx, id, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	err = client.StdCopy(&stdout, ioutil.Discard, resp.Reader)
+	resp.Close()
+	if err != nil || stdout.String() != "fake\n" {
+		t.Fatalf("unexpected exec output %q, %v", stdout.String(), err)
+	}
+	if running, code, err := c.ExecInspect(ctx, id); err != nil || running || code != 0 {
+		t.Fatalf("expected the exec to be done, got %v, %d, %v", running, code, err)
+	}
+	if err := c.ContainerStop(ctx, "sleeper", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if code, err := c.ContainerWait(ctx, "sleeper"); err != nil || code != 143 {
+		t.Fatalf("expected the exit code of SIGTERM, got %d, %v", code, err)
+	}
+
+	if err := c.ImagePull(ctx, "flaky:1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ContainerCreate(ctx, "flaky", &types.ContainerConfig{Image: "flaky:1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ContainerStart(ctx, "flaky"); err == nil {
+		t.Fatal("expected the first start to fail")
+	}
+	if err := c.ContainerStart(ctx, "flaky"); err != nil {
+		t.Fatalf("expected the second start to succeed, got %v", err)
+	}
+}
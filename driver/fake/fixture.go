@@ -0,0 +1,141 @@
+package fakedrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Fixture scripts the fake runtime. It is read from a JSON file, e.g.
+//
+//	{
+//		"images": [{"name": "busybox", "cmd": ["sh"], "pulled": true}],
+//		"commands": [{"cmd": ["/crash"], "stderr": "boom\n", "exitCode": 3}],
+//		"failures": [{"op": "pull", "image": "missing:1", "status": 404}]
+//	}
+type Fixture struct {
+	Images   []FixtureImage `json:"images"`
+	Commands []Command      `json:"commands"`
+	Failures []Failure      `json:"failures"`
+}
+
+// FixtureImage describes an image a pull gets. The images no fixture
+// describes can be pulled too, with sh as their command.
+type FixtureImage struct {
+	Name       string            `json:"name"`
+	Size       int64             `json:"size"`
+	Created    time.Time         `json:"created"`
+	Entrypoint []string          `json:"entrypoint"`
+	Cmd        []string          `json:"cmd"`
+	Env        []string          `json:"env"`
+	WorkingDir string            `json:"workingDir"`
+	User       string            `json:"user"`
+	Labels     map[string]string `json:"labels"`
+	// Pulled images are there from the start.
+	Pulled bool `json:"pulled"`
+}
+
+// Command scripts what a command does, when run by a container of Image or
+// by an exec in it. Empty fields match any image or command.
+type Command struct {
+	Image    string   `json:"image"`
+	Cmd      []string `json:"cmd"`
+	Stdout   string   `json:"stdout"`
+	Stderr   string   `json:"stderr"`
+	ExitCode int      `json:"exitCode"`
+	// Duration the command runs for once its output is written, e.g.
+	// "2s", until it is killed with "forever". It exits right away by
+	// default.
+	Duration string `json:"duration"`
+
+	duration time.Duration
+	forever  bool
+}
+
+// Failure makes an operation fail with an HTTP status, 500 by default. The
+// operations are pull, rmi, create, start, kill, rm and exec, on Image or on
+// any image when empty.
+type Failure struct {
+	Op      string `json:"op"`
+	Image   string `json:"image"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	// Times the operation fails before it succeeds again, always when 0.
+	Times int `json:"times"`
+
+	left int
+}
+
+// failureKeywords are what the error messages start with for the API to
+// answer with their status.
+var failureKeywords = map[int]string{
+	400: "Bad parameter",
+	403: "Forbidden",
+	404: "Not found",
+	406: "Impossible",
+	409: "Conflict",
+	413: "Request too large",
+	429: "Too many requests",
+	500: "Error",
+}
+
+var failureOps = map[string]bool{
+	"pull": true, "rmi": true, "create": true, "start": true, "kill": true, "rm": true, "exec": true,
+}
+
+// LoadFixture reads the fixture at path.
+func LoadFixture(path string) (*Fixture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fixture := &Fixture{}
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(fixture); err != nil {
+		return nil, fmt.Errorf("Invalid fixture %s: %s", path, err)
+	}
+	if err := fixture.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid fixture %s: %s", path, err)
+	}
+	return fixture, nil
+}
+
+func (f *Fixture) validate() error {
+	for _, img := range f.Images {
+		if img.Name == "" {
+			return fmt.Errorf("an image has no name")
+		}
+	}
+	for i := range f.Commands {
+		cmd := &f.Commands[i]
+		switch cmd.Duration {
+		case "":
+		case "forever":
+			cmd.forever = true
+		default:
+			d, err := time.ParseDuration(cmd.Duration)
+			if err != nil || d < 0 {
+				return fmt.Errorf("invalid duration %s", cmd.Duration)
+			}
+			cmd.duration = d
+		}
+	}
+	for i := range f.Failures {
+		failure := &f.Failures[i]
+		if failure.Status == 0 {
+			failure.Status = 500
+		}
+		failure.left = failure.Times
+		if !failureOps[failure.Op] {
+			return fmt.Errorf("unknown operation %s", failure.Op)
+		}
+		if _, ok := failureKeywords[failure.Status]; !ok {
+			return fmt.Errorf("status %d of %s cannot be scripted", failure.Status, failure.Op)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+// Package nspawndrv runs containers as systemd-nspawn machines, through the
+// Docker API harbour emulates on them.
+//
+// Images are pulled from their registry and unpacked under the state root.
+// docker create copies the rootfs of the image into the directory of the
+// container, docker start runs systemd-nspawn on it in a transient service
+// of its own, named after the container like its machine.
+package nspawndrv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/driver"
+	"github.com/huawei-openlab/harbour/driver/emulator"
+	"github.com/huawei-openlab/harbour/driver/emulator/images"
+	"github.com/huawei-openlab/harbour/utils"
+)
+
+func init() {
+	driver.Register("nspawn", func(transport http.RoundTripper) (driver.Driver, error) {
+		return &nspawnDriver{driver.NewDockerAPI("nspawn", transport)}, nil
+	})
+	emulator.Register("nspawn", func(root string) (emulator.Backend, error) {
+		paths, err := lookBinaries()
+		if err != nil {
+			return nil, err
+		}
+		b := New(root)
+		b.nspawn, b.systemdRun, b.systemctl, b.machinectl = paths[0], paths[1], paths[2], paths[3]
+		return b, nil
+	})
+}
+
+// binaries are the binaries of systemd the backend runs.
+var binaries = []string{"systemd-nspawn", "systemd-run", "systemctl", "machinectl"}
+
+// lookBinaries returns the paths of binaries, in the same order.
+func lookBinaries() ([]string, error) {
+	var paths []string
+	for _, binary := range binaries {
+		path, err := exec.LookPath(binary)
+		if err != nil {
+			return nil, fmt.Errorf("Can't find %s", binary)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+type nspawnDriver struct {
+	*driver.DockerAPI
+}
+
+// Locate returns the path of systemd-nspawn, once every binary of systemd
+// the backend runs is found.
+func (d *nspawnDriver) Locate() (string, error) {
+	paths, err := lookBinaries()
+	if err != nil {
+		return "", err
+	}
+	return paths[0], nil
+}
+
+// Info tells the binaries missing apart from the emulator failing.
+func (d *nspawnDriver) Info(ctx context.Context) *driver.RuntimeInfo {
+	if _, err := lookBinaries(); err != nil {
+		return &driver.RuntimeInfo{Name: d.Name(), Error: err.Error()}
+	}
+	return d.DockerAPI.Info(ctx)
+}
+
+// Backend runs the containers as systemd-nspawn machines.
+type Backend struct {
+	*images.Store
+
+	// The binaries of systemd the backend runs.
+	nspawn     string
+	systemdRun string
+	systemctl  string
+	machinectl string
+
+	mu sync.Mutex
+	// cmds are the systemd-run commands waiting for the containers
+	// harbour started.
+	cmds map[string]*exec.Cmd
+}
+
+// New creates the backend, which keeps its images under root.
+func New(root string) *Backend {
+	return &Backend{
+		Store:      images.New(root),
+		nspawn:     "systemd-nspawn",
+		systemdRun: "systemd-run",
+		systemctl:  "systemctl",
+		machinectl: "machinectl",
+		cmds:       make(map[string]*exec.Cmd),
+	}
+}
+
+// unitName is the name of the service, and of the machine, of c.
+func unitName(c *emulator.Container) string {
+	return "harbour-" + c.ID[:12]
+}
+
+func (b *Backend) run(ctx context.Context, binary string, args ...string) (string, error) {
+	logrus.Debugf("The operation for nspawn is : %s %s", binary, strings.Join(args, " "))
+	return utils.RunOutput(exec.CommandContext(ctx, binary, args...))
+}
+
+// Version reads the version of systemd, e.g. 252 out of "systemd 252
+// (252.22-1)".
+func (b *Backend) Version(ctx context.Context) (string, error) {
+	out, err := b.run(ctx, b.nspawn, "--version")
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(strings.SplitN(out, "\n", 2)[0])
+	if len(fields) < 2 {
+		return strings.Join(fields, " "), nil
+	}
+	return fields[1], nil
+}
+
+// Create copies the rootfs of img into the directory of c.
+func (b *Backend) Create(ctx context.Context, c *emulator.Container, img *emulator.Image) error {
+	if _, err := nspawnArgs(c); err != nil {
+		return err
+	}
+	return images.CopyTree(b.Rootfs(img.ID), filepath.Join(c.Dir, "rootfs"))
+}
+
+// nspawnArgs are the arguments of systemd-nspawn running c.
+//
+// The machines share the network of the host, as there is no network
+// harbour could plug them in without docker. The none network mode gives
+// them a network of their own with a loopback alone.
+func nspawnArgs(c *emulator.Container) ([]string, error) {
+	config, hostConfig := c.Config, c.Config.HostConfig
+	if err := emulator.RefuseTty("nspawn", c); err != nil {
+		return nil, err
+	}
+	if strings.Contains(config.User, ":") {
+		return nil, fmt.Errorf("Bad parameter: invalid user %s, the nspawn runtime takes a user without a group", config.User)
+	}
+	hostname := config.Hostname
+	if hostname == "" {
+		hostname = c.ID[:12]
+	}
+	args := []string{
+		"--quiet",
+		// The machine is the transient service systemd-run made.
+		"--keep-unit",
+		"--register=yes",
+		"--as-pid2",
+		"--console=pipe",
+		"--machine=" + unitName(c),
+		"--directory=" + filepath.Join(c.Dir, "rootfs"),
+		"--hostname=" + hostname,
+	}
+	if config.User != "" {
+		args = append(args, "--user="+config.User)
+	}
+	if config.WorkingDir != "" {
+		args = append(args, "--chdir="+config.WorkingDir)
+	}
+	for _, env := range config.Env {
+		args = append(args, "--setenv="+env)
+	}
+	if hostConfig != nil {
+		if hostConfig.NetworkMode == "none" {
+			args = append(args, "--private-network")
+		}
+		for _, bind := range hostConfig.Binds {
+			b, err := emulator.ParseBind("nspawn", bind)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, bindArg(b))
+		}
+	}
+	return append(append(args, "--"), c.Command()...), nil
+}
+
+// bindArg is the option of systemd-nspawn mounting b.
+func bindArg(b emulator.Bind) string {
+	if b.ReadOnly {
+		return "--bind-ro=" + b.Source + ":" + b.Destination
+	}
+	return "--bind=" + b.Source + ":" + b.Destination
+}
+
+// Start runs systemd-nspawn on c in a transient service, with the output of
+// the container piped back through systemd-run.
+func (b *Backend) Start(ctx context.Context, c *emulator.Container, stdout, stderr io.Writer) (int, error) {
+	args, err := nspawnArgs(c)
+	if err != nil {
+		return 0, err
+	}
+	unit := unitName(c)
+	// The service of a container that failed before stays loaded.
+	b.run(ctx, b.systemctl, "reset-failed", unit+".service")
+
+	runArgs := []string{"--unit=" + unit, "--quiet", "--pipe", "--wait", "--property=KillMode=mixed"}
+	if hostConfig := c.Config.HostConfig; hostConfig != nil {
+		if hostConfig.Memory > 0 {
+			runArgs = append(runArgs, fmt.Sprintf("--property=MemoryMax=%d", hostConfig.Memory))
+		}
+		if hostConfig.CPUShares > 0 {
+			runArgs = append(runArgs, fmt.Sprintf("--property=CPUWeight=%d", cpuWeight(hostConfig.CPUShares)))
+		}
+	}
+	runArgs = append(append(runArgs, "--", b.nspawn), args...)
+
+	logrus.Debugf("The operation for nspawn is : %s %s", b.systemdRun, strings.Join(runArgs, " "))
+	cmd := exec.Command(b.systemdRun, runArgs...)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	emulator.Detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	b.cmds[c.ID] = cmd
+	b.mu.Unlock()
+	return cmd.Process.Pid, nil
+}
+
+// cpuWeight converts the CPU shares of docker, 1024 by default, into the CPU
+// weight of systemd, 100 by default.
+func cpuWeight(shares int64) int64 {
+	weight := shares * 100 / 1024
+	if weight < 1 {
+		return 1
+	}
+	if weight > 10000 {
+		return 10000
+	}
+	return weight
+}
+
+// Wait waits for the systemd-run command of c, which exits with the code of
+// the container.
+func (b *Backend) Wait(c *emulator.Container, pid int) (int, error) {
+	b.mu.Lock()
+	cmd := b.cmds[c.ID]
+	delete(b.cmds, c.ID)
+	b.mu.Unlock()
+	if cmd == nil {
+		return -1, fmt.Errorf("harbour did not start container %s", c.ID)
+	}
+
+	err := cmd.Wait()
+	if err == nil {
+		return 0, nil
+	}
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return -1, err
+	}
+	status := exitErr.Sys().(syscall.WaitStatus)
+	if status.Signaled() {
+		return 128 + int(status.Signal()), nil
+	}
+	return status.ExitStatus(), nil
+}
+
+// Kill signals every process of the machine of c.
+func (b *Backend) Kill(ctx context.Context, c *emulator.Container, sig syscall.Signal) error {
+	_, err := b.run(ctx, b.machinectl, "kill", "--kill-who=all", "--signal="+strconv.Itoa(int(sig)), unitName(c))
+	return err
+}
+
+// Delete forgets the service of c, the emulator removes its rootfs along
+// with its directory.
+func (b *Backend) Delete(ctx context.Context, c *emulator.Container) error {
+	// Only a service that failed is still loaded.
+	b.run(ctx, b.systemctl, "reset-failed", unitName(c)+".service")
+	return nil
+}
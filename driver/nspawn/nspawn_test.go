@@ -0,0 +1,98 @@
+package nspawndrv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/driver/emulator"
+)
+
+// fakeRun records its invocations to calls, prints a line to stdout and one
+// to stderr, and exits with 3.
+const fakeRun = `#!/bin/sh
+echo "$@" >> %s/calls
+echo hello
+echo oops >&2
+exit 3
+`
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harbour-nspawn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	b := New(dir)
+	b.systemdRun = filepath.Join(dir, "systemd-run")
+	b.systemctl = "true"
+	if err := ioutil.WriteFile(b.systemdRun, []byte(fmt.Sprintf(fakeRun, dir)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	img := &emulator.Image{ID: "sha256:0123456789ab"}
+	if err := os.MkdirAll(filepath.Join(b.Rootfs(img.ID), "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(b.Rootfs(img.ID), "bin", "hello"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &emulator.Container{
+		ID:  "abcdef0123456789abcdef0123456789",
+		Dir: filepath.Join(dir, "container"),
+		Config: &types.ContainerConfig{
+			Cmd:        []string{"/bin/hello", "world"},
+			Env:        []string{"FOO=bar"},
+			WorkingDir: "/tmp",
+			HostConfig: &types.HostConfig{
+				NetworkMode: "none",
+				Binds:       []string{"/srv:/data:ro"},
+				Memory:      1 << 20,
+			},
+		},
+	}
+	ctx := context.Background()
+	if err := b.Create(ctx, c, img); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(c.Dir, "rootfs", "bin", "hello")); err != nil {
+		t.Fatalf("expected the image in the directory of the container: %s", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	pid, err := b.Start(ctx, c, &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, err := b.Wait(c, pid); err != nil || code != 3 {
+		t.Fatalf("expected exit code 3, got %d, %v", code, err)
+	}
+	if stdout.String() != "hello\n" || stderr.String() != "oops\n" {
+		t.Fatalf("unexpected output %q, %q", stdout.String(), stderr.String())
+	}
+
+	calls, err := ioutil.ReadFile(filepath.Join(dir, "calls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"--unit=harbour-abcdef012345 --quiet --pipe --wait --property=KillMode=mixed --property=MemoryMax=1048576 --",
+		"systemd-nspawn --quiet --keep-unit --register=yes --as-pid2 --console=pipe --machine=harbour-abcdef012345",
+		"--directory=" + filepath.Join(c.Dir, "rootfs"), "--hostname=abcdef012345 --chdir=/tmp --setenv=FOO=bar",
+		"--private-network --bind-ro=/srv:/data -- /bin/hello world",
+	}, " ")
+	if strings.TrimSpace(string(calls)) != want {
+		t.Fatalf("unexpected invocation\n%s\nexpected\n%s", calls, want)
+	}
+
+	c.Config.User = "1000:1000"
+	if err := b.Create(ctx, c, img); err == nil || !strings.Contains(err.Error(), "Bad parameter") {
+		t.Fatalf("expected a user with a group to be refused, got %v", err)
+	}
+}
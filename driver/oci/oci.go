@@ -0,0 +1,275 @@
+// Package ocidrv drives the runtimes of the Open Container Initiative, runc,
+// crun and the like, through the Docker API harbour emulates on them.
+//
+// Images are pulled from their registry and unpacked under the state root.
+// docker create copies the rootfs of the image into the bundle of the
+// container and writes its config.json, docker start runs the create and
+// start commands of the runtime on it.
+package ocidrv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/huawei-openlab/harbour/driver"
+	"github.com/huawei-openlab/harbour/driver/emulator"
+	"github.com/huawei-openlab/harbour/driver/emulator/images"
+	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/utils"
+)
+
+func init() {
+	driver.Register("oci", func(transport http.RoundTripper) (driver.Driver, error) {
+		return &ociDriver{driver.NewDockerAPI("oci", transport)}, nil
+	})
+	emulator.Register("oci", func(root string) (emulator.Backend, error) {
+		binary, err := lookRuntime()
+		if err != nil {
+			return nil, err
+		}
+		// The containers are reparented to harbour once the runtime
+		// has created them, so that harbour gets their exit code.
+		if err := setSubreaper(); err != nil {
+			logrus.Warnf("Exit codes of the containers will be lost: %s", err)
+		}
+		return New(root, binary), nil
+	})
+}
+
+// lookRuntime finds the binary of engine.OCIRuntime.
+func lookRuntime() (string, error) {
+	path, err := exec.LookPath(engine.OCIRuntime)
+	if err != nil {
+		return "", fmt.Errorf("Can't find the oci runtime %s", engine.OCIRuntime)
+	}
+	return path, nil
+}
+
+type ociDriver struct {
+	*driver.DockerAPI
+}
+
+func (d *ociDriver) Locate() (string, error) {
+	return lookRuntime()
+}
+
+// Info tells the runtime missing apart from the emulator failing.
+func (d *ociDriver) Info(ctx context.Context) *driver.RuntimeInfo {
+	if _, err := lookRuntime(); err != nil {
+		return &driver.RuntimeInfo{Name: d.Name(), Error: err.Error()}
+	}
+	return d.DockerAPI.Info(ctx)
+}
+
+// prSetChildSubreaper is PR_SET_CHILD_SUBREAPER of prctl.
+const prSetChildSubreaper = 36
+
+func setSubreaper() error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Backend runs the containers of an OCI runtime.
+type Backend struct {
+	*images.Store
+	binary string
+
+	mu sync.Mutex
+	// output is closed once the output of a running container is copied
+	// to its log.
+	output map[string]chan struct{}
+}
+
+// New creates the backend of the runtime binary, which keeps its images
+// under root.
+func New(root, binary string) *Backend {
+	return &Backend{
+		Store:  images.New(root),
+		binary: binary,
+		output: make(map[string]chan struct{}),
+	}
+}
+
+func (b *Backend) run(ctx context.Context, args ...string) (string, error) {
+	logrus.Debugf("The operation for oci is : %s %s", b.binary, strings.Join(args, " "))
+	return utils.RunOutput(exec.CommandContext(ctx, b.binary, args...))
+}
+
+// Version reads the version of the runtime, e.g. 1.1.12 out of "runc
+// version 1.1.12".
+func (b *Backend) Version(ctx context.Context) (string, error) {
+	out, err := b.run(ctx, "--version")
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(strings.SplitN(out, "\n", 2)[0])
+	for i, f := range fields {
+		if f == "version" && i+1 < len(fields) {
+			return fields[i+1], nil
+		}
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// Create makes the bundle of c in its directory.
+func (b *Backend) Create(ctx context.Context, c *emulator.Container, img *emulator.Image) error {
+	if err := images.CopyTree(b.Rootfs(img.ID), filepath.Join(c.Dir, "rootfs")); err != nil {
+		return err
+	}
+	s, err := newSpec(c, c.Dir)
+	if err != nil {
+		return err
+	}
+	return writeSpec(c.Dir, s)
+}
+
+// Start creates the container in the runtime and starts it. The container
+// inherits the stdio of the create command, which is how its output gets
+// to its log.
+func (b *Backend) Start(ctx context.Context, c *emulator.Container, stdout, stderr io.Writer) (int, error) {
+	// The runtime still knows the container if it ran before.
+	b.run(ctx, "delete", "--force", c.ID)
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		outR.Close()
+		outW.Close()
+		return 0, err
+	}
+	msg := &errorBuffer{}
+	done := make(chan struct{})
+	var copies sync.WaitGroup
+	copies.Add(2)
+	go func() {
+		io.Copy(stdout, outR)
+		outR.Close()
+		copies.Done()
+	}()
+	go func() {
+		io.Copy(io.MultiWriter(stderr, msg), errR)
+		errR.Close()
+		copies.Done()
+	}()
+	go func() {
+		copies.Wait()
+		close(done)
+	}()
+
+	pidFile := filepath.Join(c.Dir, "pid")
+	os.Remove(pidFile)
+	args := []string{"create", "--bundle", c.Dir, "--pid-file", pidFile, c.ID}
+	logrus.Debugf("The operation for oci is : %s %s", b.binary, strings.Join(args, " "))
+	cmd := exec.Command(b.binary, args...)
+	cmd.Stdout, cmd.Stderr = outW, errW
+	emulator.Detach(cmd)
+	err = cmd.Run()
+	outW.Close()
+	errW.Close()
+	if err != nil {
+		<-done
+		return 0, fmt.Errorf("%s create failed: %s", b.binary, msg.message(err))
+	}
+
+	data, err := ioutil.ReadFile(pidFile)
+	if err == nil {
+		var pid int
+		if pid, err = strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			if _, err = b.run(ctx, "start", c.ID); err == nil {
+				b.mu.Lock()
+				b.output[c.ID] = done
+				b.mu.Unlock()
+				return pid, nil
+			}
+		}
+	}
+	b.run(context.Background(), "delete", "--force", c.ID)
+	return 0, err
+}
+
+// errorBuffer keeps the beginning of the errors of the runtime, which share
+// the stderr of the container.
+type errorBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (e *errorBuffer) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if n := 4096 - e.buf.Len(); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		e.buf.Write(p[:n])
+	}
+	return len(p), nil
+}
+
+func (e *errorBuffer) message(err error) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if msg := strings.TrimSpace(e.buf.String()); msg != "" {
+		return msg
+	}
+	return err.Error()
+}
+
+// Wait waits for pid, which harbour reaps as their subreaper.
+func (b *Backend) Wait(c *emulator.Container, pid int) (int, error) {
+	defer func() {
+		b.mu.Lock()
+		done := b.output[c.ID]
+		delete(b.output, c.ID)
+		b.mu.Unlock()
+		if done != nil {
+			<-done
+		}
+	}()
+
+	var status syscall.WaitStatus
+	for {
+		_, err := syscall.Wait4(pid, &status, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return -1, err
+		}
+		if status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return status.ExitStatus(), nil
+	}
+}
+
+func (b *Backend) Kill(ctx context.Context, c *emulator.Container, sig syscall.Signal) error {
+	_, err := b.run(ctx, "kill", c.ID, strconv.Itoa(int(sig)))
+	return err
+}
+
+// Delete removes the container from the runtime, the emulator removes its
+// bundle along with its directory.
+func (b *Backend) Delete(ctx context.Context, c *emulator.Container) error {
+	if _, err := b.run(ctx, "delete", "--force", c.ID); err != nil && !strings.Contains(err.Error(), "not exist") {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package ocidrv
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huawei-openlab/harbour/api/types"
+	"github.com/huawei-openlab/harbour/client"
+	"github.com/huawei-openlab/harbour/driver/emulator"
+	"github.com/huawei-openlab/harbour/engine/events"
+)
+
+// fakeRuntime records its invocations to calls. Its containers print a line
+// to stdout and one to stderr once started, and exit with 3.
+const fakeRuntime = `#!/bin/sh
+state=%s
+echo "$@" >> $state/calls
+case "$1" in
+--version)
+	echo "fake version 1.0.0"
+	;;
+create)
+	bundle=$3 pidfile=$5 id=$6
+	if [ ! -f $bundle/config.json ]; then
+		echo "no config.json in $bundle" >&2
+		exit 1
+	fi
+	(
+		while [ ! -e $state/$id.started ]; do sleep 0.01; done
+		echo hello
+		echo oops >&2
+		exit 3
+	) &
+	echo $! > $pidfile
+	echo $! > $state/$id.pid
+	;;
+start)
+	touch $state/$2.started
+	;;
+kill)
+	kill -$3 $(cat $state/$2.pid)
+	;;
+state)
+	if kill -0 $(cat $state/$2.pid) 2>/dev/null; then
+		echo '{"status": "running"}'
+	else
+		echo '{"status": "stopped"}'
+	fi
+	;;
+delete)
+	if [ ! -e $state/$3.pid ]; then
+		echo "container $3 does not exist" >&2
+		exit 1
+	fi
+	rm -f $state/$3.pid $state/$3.started
+	;;
+esac
+`
+
+func layer(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(name, "/") {
+			hdr.Typeflag, hdr.Size = tar.TypeDir, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// newRegistry serves test/busybox:1 behind a token, in two layers the second
+// of which removes a file of the first.
+func newRegistry(t *testing.T) *httptest.Server {
+	config := []byte(`{"created": "2016-01-02T03:04:05Z", "config": {"Env": ["FOO=bar"], "Cmd": ["/bin/hello"]}}`)
+	layers := [][]byte{
+		layer(t, map[string]string{"bin/": "", "bin/hello": "#!/bin/sh\n", "gone": "x", "etc/": "", "etc/passwd": "root:x:0:0:root:/root:/bin/sh\n"}),
+		layer(t, map[string]string{".wh.gone": ""}),
+	}
+	blobs := map[string][]byte{digest(config): config}
+	m := map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.docker.distribution.manifest.v2+json",
+		"config":        map[string]interface{}{"digest": digest(config), "size": len(config)},
+	}
+	var descriptors []map[string]interface{}
+	for _, l := range layers {
+		blobs[digest(l)] = l
+		descriptors = append(descriptors, map[string]interface{}{"digest": digest(l), "size": len(l)})
+	}
+	m["layers"] = descriptors
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			fmt.Fprint(w, `{"token": "secret"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("Www-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, ts.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/v2/test/busybox/manifests/1":
+			w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+			json.NewEncoder(w).Encode(m)
+		case strings.HasPrefix(r.URL.Path, "/v2/test/busybox/blobs/"):
+			blob, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/test/busybox/blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(blob)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return ts
+}
+
+func TestRun(t *testing.T) {
+	if err := setSubreaper(); err != nil {
+		t.Skipf("harbour cannot reap the containers: %s", err)
+	}
+	dir, err := ioutil.TempDir("", "harbour-oci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	binary := filepath.Join(dir, "runtime")
+	if err := ioutil.WriteFile(binary, []byte(fmt.Sprintf(fakeRuntime, dir)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	registry := newRegistry(t)
+	defer registry.Close()
+
+	e, err := emulator.New("oci", New(dir, binary), dir, events.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := e.Serve(w, r); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+	c, err := client.New(strings.TrimPrefix(ts.URL, "http://"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ref := strings.TrimPrefix(registry.URL, "http://") + "/test/busybox:1"
+	if err := c.ImagePull(ctx, ref, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.ServerVersion(ctx); err != nil || !strings.Contains(v.Version, "1.0.0") {
+		t.Fatalf("expected the version of the runtime, got %+v, %v", v, err)
+	}
+
+	created, err := c.ContainerCreate(ctx, "test", &types.ContainerConfig{Image: ref})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(dir, "containers", created.ID)
+	if _, err := os.Stat(filepath.Join(bundle, "rootfs", "bin", "hello")); err != nil {
+		t.Fatalf("expected the image in the bundle: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(bundle, "rootfs", "gone")); !os.IsNotExist(err) {
+		t.Fatalf("expected the whiteout to remove gone, got %v", err)
+	}
+	s := &spec{}
+	data, err := ioutil.ReadFile(filepath.Join(bundle, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		t.Fatal(err)
+	}
+	env := strings.Join(s.Process.Env, " ")
+	if strings.Join(s.Process.Args, " ") != "/bin/hello" || !strings.Contains(env, "FOO=bar") || !strings.Contains(env, "HOME=/root") {
+		t.Fatalf("unexpected process %+v", s.Process)
+	}
+
+	if err := c.ContainerStart(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	code, err := c.ContainerWait(ctx, "test")
+	if err != nil || code != 3 {
+		t.Fatalf("expected exit code 3, got %d, %v", code, err)
+	}
+	logs, err := c.ContainerLogs(ctx, "test", client.LogsOptions{Stdout: true, Stderr: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	err = client.StdCopy(&stdout, &stderr, logs)
+	logs.Close()
+	if err != nil || stdout.String() != "hello\n" || stderr.String() != "oops\n" {
+		t.Fatalf("unexpected logs %q, %q, %v", stdout.String(), stderr.String(), err)
+	}
+
+	if err := c.ContainerRemove(ctx, "test", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(bundle); !os.IsNotExist(err) {
+		t.Fatalf("expected the bundle to be removed, got %v", err)
+	}
+	calls, err := ioutil.ReadFile(filepath.Join(dir, "calls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"create --bundle " + bundle + " --pid-file " + filepath.Join(bundle, "pid") + " " + created.ID,
+		"start " + created.ID,
+		"delete --force " + created.ID,
+	} {
+		if !strings.Contains(string(calls), want+"\n") {
+			t.Errorf("expected %q in the calls, got\n%s", want, calls)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package ocidrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/huawei-openlab/harbour/driver/emulator"
+	"github.com/huawei-openlab/harbour/driver/emulator/images"
+	"github.com/opencontainers/runc/libcontainer/user"
+)
+
+// The parts of the runtime specification of OCI harbour fills in.
+type spec struct {
+	Version  string  `json:"ociVersion"`
+	Process  process `json:"process"`
+	Root     root    `json:"root"`
+	Hostname string  `json:"hostname,omitempty"`
+	Mounts   []mount `json:"mounts"`
+	Linux    linux   `json:"linux"`
+}
+
+type process struct {
+	Terminal     bool         `json:"terminal"`
+	User         specUser     `json:"user"`
+	Args         []string     `json:"args"`
+	Env          []string     `json:"env"`
+	Cwd          string       `json:"cwd"`
+	Capabilities capabilities `json:"capabilities"`
+	Rlimits      []rlimit     `json:"rlimits"`
+}
+
+type specUser struct {
+	UID            int   `json:"uid"`
+	GID            int   `json:"gid"`
+	AdditionalGids []int `json:"additionalGids,omitempty"`
+}
+
+type capabilities struct {
+	Bounding  []string `json:"bounding"`
+	Effective []string `json:"effective"`
+	Permitted []string `json:"permitted"`
+}
+
+type rlimit struct {
+	Type string `json:"type"`
+	Hard uint64 `json:"hard"`
+	Soft uint64 `json:"soft"`
+}
+
+type root struct {
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly"`
+}
+
+type mount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Options     []string `json:"options,omitempty"`
+}
+
+type linux struct {
+	CgroupsPath   string      `json:"cgroupsPath"`
+	Namespaces    []namespace `json:"namespaces"`
+	Resources     *resources  `json:"resources,omitempty"`
+	MaskedPaths   []string    `json:"maskedPaths"`
+	ReadonlyPaths []string    `json:"readonlyPaths"`
+}
+
+type namespace struct {
+	Type string `json:"type"`
+}
+
+type resources struct {
+	Memory *memory `json:"memory,omitempty"`
+	CPU    *cpu    `json:"cpu,omitempty"`
+}
+
+type memory struct {
+	Limit int64 `json:"limit"`
+}
+
+type cpu struct {
+	Shares uint64 `json:"shares"`
+}
+
+// defaultCapabilities are those docker leaves to its containers.
+var defaultCapabilities = []string{
+	"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_FSETID", "CAP_FOWNER", "CAP_MKNOD",
+	"CAP_NET_RAW", "CAP_SETGID", "CAP_SETUID", "CAP_SETFCAP", "CAP_SETPCAP",
+	"CAP_NET_BIND_SERVICE", "CAP_SYS_CHROOT", "CAP_KILL", "CAP_AUDIT_WRITE",
+}
+
+const defaultPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// newSpec returns the runtime specification of c, whose rootfs is under dir.
+//
+// There is no network harbour could plug the containers in without docker,
+// so they share the one of the host, and so join each other's with the
+// container network mode. The none mode gives them a network of their own
+// with a loopback alone.
+func newSpec(c *emulator.Container, dir string) (*spec, error) {
+	config, hostConfig := c.Config, c.Config.HostConfig
+	if err := emulator.RefuseTty("oci", c); err != nil {
+		return nil, err
+	}
+	rootfs := filepath.Join(dir, "rootfs")
+
+	u, err := execUser(rootfs, config.User)
+	if err != nil {
+		return nil, err
+	}
+	env := append([]string{}, config.Env...)
+	hasPath, hasHome := false, false
+	for _, v := range env {
+		hasPath = hasPath || strings.HasPrefix(v, "PATH=")
+		hasHome = hasHome || strings.HasPrefix(v, "HOME=")
+	}
+	if !hasPath {
+		env = append([]string{defaultPath}, env...)
+	}
+	if !hasHome && u.Home != "" {
+		env = append(env, "HOME="+u.Home)
+	}
+	hostname := config.Hostname
+	if hostname == "" {
+		hostname = c.ID[:12]
+	}
+	env = append(env, "HOSTNAME="+hostname)
+	cwd := config.WorkingDir
+	if cwd == "" {
+		cwd = "/"
+	}
+
+	s := &spec{
+		Version: "1.0.2",
+		Process: process{
+			User:         specUser{UID: u.Uid, GID: u.Gid, AdditionalGids: u.Sgids},
+			Args:         c.Command(),
+			Env:          env,
+			Cwd:          cwd,
+			Capabilities: capabilities{defaultCapabilities, defaultCapabilities, defaultCapabilities},
+			Rlimits:      []rlimit{{Type: "RLIMIT_NOFILE", Hard: 1048576, Soft: 1048576}},
+		},
+		Root:     root{Path: "rootfs"},
+		Hostname: hostname,
+		Mounts: []mount{
+			{"/proc", "proc", "proc", nil},
+			{"/dev", "tmpfs", "tmpfs", []string{"nosuid", "strictatime", "mode=755", "size=65536k"}},
+			{"/dev/pts", "devpts", "devpts", []string{"nosuid", "noexec", "newinstance", "ptmxmode=0666", "mode=0620", "gid=5"}},
+			{"/dev/shm", "tmpfs", "shm", []string{"nosuid", "noexec", "nodev", "mode=1777", "size=65536k"}},
+			{"/dev/mqueue", "mqueue", "mqueue", []string{"nosuid", "noexec", "nodev"}},
+			{"/sys", "sysfs", "sysfs", []string{"nosuid", "noexec", "nodev", "ro"}},
+			{"/sys/fs/cgroup", "cgroup", "cgroup", []string{"nosuid", "noexec", "nodev", "relatime", "ro"}},
+		},
+		Linux: linux{
+			CgroupsPath: "/harbour/" + c.ID,
+			Namespaces:  []namespace{{"pid"}, {"ipc"}, {"uts"}, {"mount"}},
+			MaskedPaths: []string{
+				"/proc/kcore", "/proc/latency_stats", "/proc/timer_list",
+				"/proc/timer_stats", "/proc/sched_debug", "/sys/firmware",
+			},
+			ReadonlyPaths: []string{
+				"/proc/asound", "/proc/bus", "/proc/fs", "/proc/irq",
+				"/proc/sys", "/proc/sysrq-trigger",
+			},
+		},
+	}
+
+	if hostConfig != nil {
+		if hostConfig.NetworkMode == "none" {
+			s.Linux.Namespaces = append(s.Linux.Namespaces, namespace{"network"})
+		} else if err := copyResolvConf(dir); err == nil {
+			s.Mounts = append(s.Mounts, mount{"/etc/resolv.conf", "bind", filepath.Join(dir, "resolv.conf"), []string{"rbind", "ro"}})
+		}
+		for _, bind := range hostConfig.Binds {
+			b, err := emulator.ParseBind("oci", bind)
+			if err != nil {
+				return nil, err
+			}
+			s.Mounts = append(s.Mounts, bindMount(b))
+		}
+		if hostConfig.Memory > 0 || hostConfig.CPUShares > 0 {
+			s.Linux.Resources = &resources{}
+			if hostConfig.Memory > 0 {
+				s.Linux.Resources.Memory = &memory{hostConfig.Memory}
+			}
+			if hostConfig.CPUShares > 0 {
+				s.Linux.Resources.CPU = &cpu{uint64(hostConfig.CPUShares)}
+			}
+		}
+	}
+	return s, nil
+}
+
+// execUser looks the user of the container up in the files of its image.
+func execUser(rootfs, spec string) (*user.ExecUser, error) {
+	var passwd, group io.Reader
+	if p, err := images.Resolve(rootfs, "/etc/passwd"); err == nil {
+		if f, err := os.Open(p); err == nil {
+			defer f.Close()
+			passwd = f
+		}
+	}
+	if p, err := images.Resolve(rootfs, "/etc/group"); err == nil {
+		if f, err := os.Open(p); err == nil {
+			defer f.Close()
+			group = f
+		}
+	}
+	u, err := user.GetExecUser(spec, &user.ExecUser{Home: "/"}, passwd, group)
+	if err != nil {
+		return nil, fmt.Errorf("Bad parameter: unable to find user %s: %s", spec, err)
+	}
+	return u, nil
+}
+
+// bindMount mounts b the way docker does, recursively.
+func bindMount(b emulator.Bind) mount {
+	options := []string{"rbind", "rw"}
+	if b.ReadOnly {
+		options[1] = "ro"
+	}
+	return mount{b.Destination, "bind", b.Source, options}
+}
+
+// copyResolvConf gives the container the resolvers of the host.
+func copyResolvConf(dir string) error {
+	data, err := ioutil.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "resolv.conf"), data, 0644)
+}
+
+func writeSpec(dir string, s *spec) error {
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "config.json"), data, 0600)
+}
@@ -1 +1,88 @@
+// Package rktdrv drives rkt, through the Docker API emulated by harbour.
 package rktdrv
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/huawei-openlab/harbour/adaptor"
+	"github.com/huawei-openlab/harbour/driver"
+	"github.com/huawei-openlab/harbour/engine"
+	"github.com/huawei-openlab/harbour/utils"
+)
+
+func init() {
+	driver.Register("rkt", New)
+}
+
+type rktDriver struct {
+	*driver.DockerAPI
+}
+
+// New creates the driver of rkt. transport reaches the rkt adaptor.
+func New(transport http.RoundTripper) (driver.Driver, error) {
+	return &rktDriver{driver.NewDockerAPI("rkt", transport)}, nil
+}
+
+func (d *rktDriver) Locate() (string, error) {
+	return exec.LookPath("rkt")
+}
+
+// Info asks rkt itself, the emulated version endpoint prints the version
+// of rkt on the console of harbour.
+func (d *rktDriver) Info(ctx context.Context) *driver.RuntimeInfo {
+	info := &driver.RuntimeInfo{Name: d.Name()}
+	out, err := utils.RunOutput(exec.CommandContext(ctx, "rkt", "version"))
+	if err == nil {
+		_, err = os.Stat(engine.StateRoot)
+	}
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	info.Version = parseVersion(out)
+	info.Healthy = true
+	return info
+}
+
+// parseVersion reads the version out of `rkt version`.
+func parseVersion(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "rkt Version:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "rkt Version:"))
+		}
+	}
+	return ""
+}
+
+// CreateContainer runs the containers of a sandbox in pods of their own, rkt
+// cannot add apps to the running pod of the sandbox.
+func (d *rktDriver) CreateContainer(ctx context.Context, spec *driver.ContainerSpec) (*driver.Container, error) {
+	if spec.Sandbox != "" {
+		s := *spec
+		s.Sandbox = ""
+		spec = &s
+	}
+	return d.DockerAPI.CreateContainer(ctx, spec)
+}
+
+func (d *rktDriver) ListPods(ctx context.Context) ([]*driver.Pod, error) {
+	pods, err := adaptor.Pods()
+	if err != nil {
+		return nil, err
+	}
+	list := []*driver.Pod{}
+	for _, p := range pods {
+		list = append(list, &driver.Pod{
+			ID:        p.UUID,
+			Runtime:   d.Name(),
+			State:     p.State,
+			Image:     p.Image,
+			Container: p.Container,
+		})
+	}
+	return list, nil
+}
@@ -0,0 +1,299 @@
+// Package backend keeps track of the docker daemons harbour forwards the
+// Docker API to. Each one is pinged in the background, and the containers
+// stay with the daemon that runs them.
+package backend
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	dialTimeout = 5 * time.Second
+	pingTimeout = 5 * time.Second
+)
+
+// Config describes a backend daemon.
+type Config struct {
+	// Address of the daemon: the path of its unix socket, or a unix:// or
+	// tcp:// URL.
+	Address string `json:"address"`
+	// TLS secures the connections to a tcp:// daemon. The daemon is
+	// verified against CACert, or the CAs of the host when empty, and
+	// given the client certificate Cert and Key when set.
+	TLS    bool   `json:"tls,omitempty"`
+	CACert string `json:"tlscacert,omitempty"`
+	Cert   string `json:"tlscert,omitempty"`
+	Key    string `json:"tlskey,omitempty"`
+
+	// Command starts the daemon, which harbour then manages: it waits for
+	// the daemon to be ready before forwarding to it, restarts it when it
+	// exits and stops it on shutdown. The daemon is told to listen on
+	// Address unless Args does.
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Ready   *Probe   `json:"ready,omitempty"`
+}
+
+// Backend is a docker daemon.
+type Backend struct {
+	Config
+	proto, addr string
+	tlsConfig   *tls.Config
+	daemon      *daemon
+
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+func newBackend(c Config) (*Backend, error) {
+	b := &Backend{Config: c, proto: "unix", addr: c.Address}
+	if strings.Contains(c.Address, "://") {
+		u, err := url.Parse(c.Address)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid docker address %s: %s", c.Address, err)
+		}
+		switch u.Scheme {
+		case "unix":
+			b.addr = u.Path
+		case "tcp":
+			b.proto, b.addr = "tcp", u.Host
+		default:
+			return nil, fmt.Errorf("Invalid docker address %s: expected unix:// or tcp://", c.Address)
+		}
+	}
+	if b.addr == "" {
+		return nil, fmt.Errorf("Invalid docker address %q", c.Address)
+	}
+	if c.TLS {
+		if err := b.setTLS(); err != nil {
+			return nil, err
+		}
+	}
+	if c.Command != "" {
+		d, err := newDaemon(b)
+		if err != nil {
+			return nil, err
+		}
+		b.daemon = d
+	}
+	return b, nil
+}
+
+func (b *Backend) setTLS() error {
+	c := b.Config
+	if b.proto != "tcp" {
+		return fmt.Errorf("Invalid docker address %s: TLS needs tcp://", c.Address)
+	}
+	host, _, err := net.SplitHostPort(b.addr)
+	if err != nil {
+		return fmt.Errorf("Invalid docker address %s: %s", c.Address, err)
+	}
+	b.tlsConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if c.CACert != "" {
+		pem, err := ioutil.ReadFile(c.CACert)
+		if err != nil {
+			return fmt.Errorf("Couldn't read CA certificate: %s", err)
+		}
+		b.tlsConfig.RootCAs = x509.NewCertPool()
+		if !b.tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("No certificate found in %s", c.CACert)
+		}
+	}
+	if c.Cert != "" || c.Key != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return fmt.Errorf("Couldn't load X509 key pair (%s, %s): %s", c.Cert, c.Key, err)
+		}
+		b.tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return nil
+}
+
+// is tells whether host, an address harbour listens on such as
+// unix:///var/run/docker.sock, is the address of the daemon.
+func (b *Backend) is(host string) bool {
+	parts := strings.SplitN(host, "://", 2)
+	if len(parts) != 2 || parts[0] != b.proto {
+		return false
+	}
+	if b.proto == "unix" {
+		if filepath.Clean(parts[1]) == filepath.Clean(b.addr) {
+			return true
+		}
+		fi1, err1 := os.Stat(parts[1])
+		fi2, err2 := os.Stat(b.addr)
+		return err1 == nil && err2 == nil && os.SameFile(fi1, fi2)
+	}
+	lhost, lport, err1 := net.SplitHostPort(parts[1])
+	bhost, bport, err2 := net.SplitHostPort(b.addr)
+	if err1 != nil || err2 != nil || lport != bport {
+		return false
+	}
+	if lhost == bhost {
+		return true
+	}
+	// Harbour listening on all the addresses listens on the loopback.
+	lip, bip := net.ParseIP(lhost), net.ParseIP(bhost)
+	return (lhost == "" || lip != nil && lip.IsUnspecified()) && (bhost == "localhost" || bip != nil && bip.IsLoopback())
+}
+
+// Dial connects to the daemon. A daemon that cannot be reached is marked
+// down until it answers a ping again.
+func (b *Backend) Dial() (net.Conn, error) {
+	conn, err := b.dial()
+	if err != nil {
+		b.record(err)
+		return nil, b.unavailable(err)
+	}
+	return conn, nil
+}
+
+func (b *Backend) dial() (net.Conn, error) {
+	conn, err := net.DialTimeout(b.proto, b.addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(30 * time.Second)
+	}
+	if b.tlsConfig == nil {
+		return conn, nil
+	}
+	tlsConn := tls.Client(conn, b.tlsConfig)
+	tlsConn.SetDeadline(time.Now().Add(dialTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// stop stops the daemon if harbour manages it.
+func (b *Backend) stop() {
+	if b.daemon != nil {
+		b.daemon.stop()
+	}
+}
+
+// DownError tells that a daemon cannot serve a request.
+type DownError struct {
+	Address string
+	Err     error
+}
+
+func (e *DownError) Error() string {
+	return fmt.Sprintf("Service unavailable: docker at %s is down: %s", e.Address, e.Err)
+}
+
+func (b *Backend) unavailable(err error) error {
+	return &DownError{b.Address, err}
+}
+
+// cause strips err of the request and dial it was returned through.
+func cause(err error) error {
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+	if down, ok := err.(*DownError); ok {
+		err = down.Err
+	}
+	return err
+}
+
+// Transport sends the requests of a client to the daemon, over a new
+// connection each.
+func (b *Backend) Transport() *http.Transport {
+	return &http.Transport{
+		Dial: func(proto, addr string) (net.Conn, error) {
+			return b.Dial()
+		},
+		DisableKeepAlives: true,
+	}
+}
+
+// Health tells whether the daemon answered its last ping, and why not.
+func (b *Backend) Health() (checked time.Time, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.checked.IsZero() {
+		return b.checked, fmt.Errorf("not checked yet")
+	}
+	return b.checked, b.err
+}
+
+func (b *Backend) healthy() bool {
+	_, err := b.Health()
+	return err == nil
+}
+
+// Ping checks that the daemon answers /_ping.
+func (b *Backend) Ping() error {
+	client := &http.Client{Timeout: pingTimeout, Transport: b.Transport()}
+	resp, err := client.Get("http://docker/_ping")
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("docker answered %s", resp.Status)
+		}
+	}
+	if err != nil {
+		err = cause(err)
+	}
+	b.record(err)
+	return err
+}
+
+// record sets the health of the daemon, logging its changes.
+func (b *Backend) record(err error) {
+	b.mu.Lock()
+	first, wasUp := b.checked.IsZero(), !b.checked.IsZero() && b.err == nil
+	b.checked, b.err = time.Now(), err
+	b.mu.Unlock()
+	if err != nil && (first || wasUp) {
+		logrus.Warnf("Docker at %s is down: %s", b.Address, err)
+	} else if err == nil && !wasUp {
+		logrus.Infof("Docker at %s is up", b.Address)
+	}
+}
+
+// lookup asks the daemon for the ID of the object ref of kind, containers
+// or exec. found is false when the daemon does not know it.
+func (b *Backend) lookup(kind, ref string) (id string, found bool, err error) {
+	client := &http.Client{Timeout: pingTimeout, Transport: b.Transport()}
+	resp, err := client.Get("http://docker/" + kind + "/" + url.PathEscape(ref) + "/json")
+	if err != nil {
+		return "", false, b.unavailable(cause(err))
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", false, nil
+	default:
+		return "", false, fmt.Errorf("docker at %s answered %s for %s %s", b.Address, resp.Status, kind, ref)
+	}
+	var object struct {
+		ID string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&object); err != nil {
+		return "", false, err
+	}
+	return object.ID, true, nil
+}
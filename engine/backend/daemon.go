@@ -0,0 +1,271 @@
+// Running the docker daemons harbour manages itself.
+
+package backend
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+	// A daemon that ran for restartResetTime starts its backoff over.
+	restartResetTime = time.Minute
+
+	// stopTimeout is how long a daemon has to exit once asked to, within
+	// the time harbour gives itself to shut down.
+	stopTimeout = 8 * time.Second
+
+	defaultReadyTimeout  = time.Minute
+	defaultReadyInterval = 500 * time.Millisecond
+)
+
+// Probe tells when a managed daemon is ready: once it answers a GET of Path
+// with a 200.
+type Probe struct {
+	// Path is /_ping by default.
+	Path string `json:"path,omitempty"`
+	// Timeout the daemon has to be ready, e.g. "2m", 1m by default.
+	Timeout string `json:"timeout,omitempty"`
+	// Interval between two tries, 500ms by default.
+	Interval string `json:"interval,omitempty"`
+}
+
+// daemon runs the command of a backend.
+type daemon struct {
+	b        *Backend
+	args     []string
+	path     string
+	timeout  time.Duration
+	interval time.Duration
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	started  time.Time
+	exited   chan struct{}
+	err      error
+	stopping bool
+	quit     chan struct{}
+}
+
+func newDaemon(b *Backend) (*daemon, error) {
+	d := &daemon{
+		b:        b,
+		path:     "/_ping",
+		timeout:  defaultReadyTimeout,
+		interval: defaultReadyInterval,
+		quit:     make(chan struct{}),
+	}
+	if p := b.Ready; p != nil {
+		if p.Path != "" {
+			d.path = p.Path
+		}
+		for _, v := range []struct {
+			name  string
+			value string
+			dst   *time.Duration
+		}{
+			{"timeout", p.Timeout, &d.timeout},
+			{"interval", p.Interval, &d.interval},
+		} {
+			if v.value == "" {
+				continue
+			}
+			t, err := time.ParseDuration(v.value)
+			if err != nil || t <= 0 {
+				return nil, fmt.Errorf("Invalid readiness %s %s of docker at %s", v.name, v.value, b.Address)
+			}
+			*v.dst = t
+		}
+	}
+	d.args = append([]string{}, b.Args...)
+	if !listens(d.args) {
+		d.args = append(d.args, "--host="+b.proto+"://"+b.addr)
+	}
+	return d, nil
+}
+
+// listens tells whether args set the sockets of docker.
+func listens(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-H") || arg == "--host" || strings.HasPrefix(arg, "--host=") {
+			return true
+		}
+	}
+	return false
+}
+
+// run starts the command. Its output is logged line by line.
+func (d *daemon) run() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.exited = make(chan struct{})
+	if d.stopping {
+		d.err = fmt.Errorf("stopped")
+		close(d.exited)
+		return
+	}
+	r, w := io.Pipe()
+	d.cmd = exec.Command(d.b.Command, d.args...)
+	d.cmd.Stdout, d.cmd.Stderr = w, w
+	d.started = time.Now()
+	logrus.Infof("Starting docker at %s: %s %s", d.b.Address, d.b.Command, strings.Join(d.args, " "))
+	if err := d.cmd.Start(); err != nil {
+		w.Close()
+		d.err = err
+		close(d.exited)
+		return
+	}
+	go d.log(r)
+	go func(cmd *exec.Cmd, exited chan struct{}) {
+		err := cmd.Wait()
+		w.Close()
+		if err == nil {
+			err = fmt.Errorf("exit status 0")
+		}
+		d.mu.Lock()
+		d.err = err
+		d.mu.Unlock()
+		close(exited)
+	}(d.cmd, d.exited)
+}
+
+func (d *daemon) log(r io.Reader) {
+	log := logrus.WithField("docker", d.b.Address)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		log.Info(scanner.Text())
+	}
+}
+
+// start runs the daemon and waits for it to be ready, then keeps it
+// running.
+func (d *daemon) start() error {
+	d.run()
+	if err := d.waitReady(); err != nil {
+		d.stop()
+		return err
+	}
+	d.b.record(nil)
+	go d.supervise()
+	return nil
+}
+
+func (d *daemon) waitReady() error {
+	d.mu.Lock()
+	exited := d.exited
+	d.mu.Unlock()
+	client := &http.Client{
+		Timeout: d.interval,
+		Transport: &http.Transport{
+			Dial: func(proto, addr string) (net.Conn, error) {
+				return d.b.dial()
+			},
+			DisableKeepAlives: true,
+		},
+	}
+	deadline := time.After(d.timeout)
+	var err error
+	for {
+		var resp *http.Response
+		if resp, err = client.Get("http://docker" + d.path); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("docker answered %s", resp.Status)
+		}
+		select {
+		case <-exited:
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return fmt.Errorf("Docker at %s failed to start: %s", d.b.Address, d.err)
+		case <-deadline:
+			return fmt.Errorf("Docker at %s is not ready after %s: %s", d.b.Address, d.timeout, cause(err))
+		case <-time.After(d.interval):
+		}
+	}
+}
+
+// nextDelay doubles the previous backoff, starting over once the daemon
+// managed to run for a while.
+func nextDelay(prev, ran time.Duration) time.Duration {
+	if prev == 0 || ran >= restartResetTime {
+		return minRestartDelay
+	}
+	if prev *= 2; prev > maxRestartDelay {
+		prev = maxRestartDelay
+	}
+	return prev
+}
+
+// supervise restarts the daemon whenever it exits, until it is stopped. The
+// daemon is down until it answers a ping again.
+func (d *daemon) supervise() {
+	var delay time.Duration
+	for {
+		d.mu.Lock()
+		exited := d.exited
+		d.mu.Unlock()
+		select {
+		case <-exited:
+		case <-d.quit:
+			return
+		}
+
+		d.mu.Lock()
+		err, ran := d.err, time.Since(d.started)
+		d.mu.Unlock()
+		d.b.record(fmt.Errorf("exited: %s", err))
+		delay = nextDelay(delay, ran)
+		logrus.Errorf("Docker at %s exited (%s), restarting it in %s", d.b.Address, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-d.quit:
+			return
+		}
+		d.run()
+	}
+}
+
+// stop stops the daemon for good: it is asked to exit, then killed if it
+// does not in time.
+func (d *daemon) stop() {
+	d.mu.Lock()
+	if d.stopping {
+		d.mu.Unlock()
+		return
+	}
+	d.stopping = true
+	close(d.quit)
+	cmd, exited := d.cmd, d.exited
+	d.mu.Unlock()
+	if exited == nil {
+		return
+	}
+	select {
+	case <-exited:
+		return
+	default:
+	}
+	logrus.Infof("Stopping docker at %s", d.b.Address)
+	cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-exited:
+	case <-time.After(stopTimeout):
+		logrus.Warnf("Docker at %s did not stop in %s, killing it", d.b.Address, stopTimeout)
+		cmd.Process.Kill()
+		<-exited
+	}
+}
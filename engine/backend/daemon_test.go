@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperDaemon is the docker daemon TestManaged runs: it answers pings
+// on the socket it is given, and exits on /crash.
+func TestHelperDaemon(t *testing.T) {
+	if os.Getenv("HARBOUR_TEST_DAEMON") != "1" {
+		return
+	}
+	var path string
+	for _, arg := range os.Args {
+		if strings.HasPrefix(arg, "--host=unix://") {
+			path = strings.TrimPrefix(arg, "--host=unix://")
+		}
+	}
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		os.Exit(2)
+	}
+	http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/crash" {
+			os.Exit(1)
+		}
+		w.Write([]byte("OK"))
+	}))
+}
+
+func TestManaged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harbour-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("HARBOUR_TEST_DAEMON", "1")
+	defer os.Unsetenv("HARBOUR_TEST_DAEMON")
+
+	pool, err := NewPool(nil, []Config{{
+		Address: filepath.Join(dir, "docker.sock"),
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestHelperDaemon", "--"},
+		Ready:   &Probe{Timeout: "10s", Interval: "50ms"},
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Stop()
+	b, err := pool.Primary()
+	if err != nil {
+		t.Fatalf("expected the daemon to be ready, got %v", err)
+	}
+
+	client := &http.Client{Transport: b.Transport()}
+	if resp, err := client.Get("http://docker/crash"); err == nil {
+		resp.Body.Close()
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for b.Ping() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the daemon to be restarted")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	pool.Stop()
+	if err := b.Ping(); err == nil {
+		t.Fatal("expected the daemon to be stopped")
+	}
+}
@@ -0,0 +1,300 @@
+package backend
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pool is the set of daemons harbour forwards to. The first one is the
+// primary: the requests go to it, except those on the containers of the
+// others and those any daemon up can answer.
+type Pool struct {
+	// updating serializes the updates, which start and stop daemons.
+	updating sync.Mutex
+
+	mu       sync.RWMutex
+	static   []Config
+	self     []string
+	backends []*Backend
+	// owners maps the containers and execs, by kind and the ID, name or
+	// prefix they were asked for by, to their ID and the daemon that has
+	// them.
+	owners map[string]owner
+}
+
+type owner struct {
+	id      string
+	backend *Backend
+}
+
+// NewPool creates the pool of the daemons of static followed by those of
+// configs. The static ones stay when the pool is updated. No daemon can be
+// at the addresses of self, which harbour listens on, lest it forwards to
+// itself.
+func NewPool(static, configs []Config, self []string) (*Pool, error) {
+	p := &Pool{static: static, self: self, owners: make(map[string]owner)}
+	if err := p.Update(configs); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Update replaces the daemons that follow the static ones by those of
+// configs. The daemons kept keep their health and containers, the new ones
+// are pinged, or started and waited for when harbour manages them, before
+// they get any request. Removing the primary once its replacement is up
+// moves the API to another daemon without downtime.
+func (p *Pool) Update(configs []Config) error {
+	p.updating.Lock()
+	defer p.updating.Unlock()
+	all := append(append([]Config{}, p.static...), configs...)
+	if len(all) == 0 {
+		return fmt.Errorf("No docker daemon to forward to")
+	}
+	current := make(map[string]*Backend)
+	for _, b := range p.Backends() {
+		current[b.Address] = b
+	}
+
+	backends := make([]*Backend, 0, len(all))
+	added := []*Backend{}
+	seen := make(map[string]bool)
+	for _, c := range all {
+		if seen[c.Address] {
+			return fmt.Errorf("Docker at %s is listed twice", c.Address)
+		}
+		seen[c.Address] = true
+		if err := p.checkSelf(c); err != nil {
+			return err
+		}
+		if b, ok := current[c.Address]; ok && reflect.DeepEqual(b.Config, c) {
+			backends = append(backends, b)
+			continue
+		}
+		b, err := newBackend(c)
+		if err != nil {
+			return err
+		}
+		backends = append(backends, b)
+		added = append(added, b)
+	}
+	// A managed daemon replaced by another on its address makes way for it.
+	for _, b := range added {
+		if old, ok := current[b.Address]; ok {
+			old.stop()
+		}
+	}
+	if err := start(added); err != nil {
+		stop(added)
+		return err
+	}
+
+	p.mu.Lock()
+	p.backends = backends
+	kept := make(map[*Backend]bool)
+	for _, b := range backends {
+		kept[b] = true
+	}
+	for key, o := range p.owners {
+		if !kept[o.backend] {
+			delete(p.owners, key)
+		}
+	}
+	p.mu.Unlock()
+
+	removed := []*Backend{}
+	for _, b := range current {
+		if !kept[b] {
+			removed = append(removed, b)
+		}
+	}
+	stop(removed)
+	return nil
+}
+
+func (p *Pool) checkSelf(c Config) error {
+	b, err := newBackend(Config{Address: c.Address})
+	if err != nil {
+		return err
+	}
+	for _, host := range p.self {
+		if b.is(host) {
+			return fmt.Errorf("Docker at %s is harbour itself, listening on %s", c.Address, host)
+		}
+	}
+	return nil
+}
+
+// Stop stops the daemons harbour manages.
+func (p *Pool) Stop() {
+	p.updating.Lock()
+	defer p.updating.Unlock()
+	stop(p.Backends())
+}
+
+// each runs f on the backends at once.
+func each(backends []*Backend, f func(b *Backend) error) error {
+	errs := make(chan error, len(backends))
+	for _, b := range backends {
+		go func(b *Backend) {
+			errs <- f(b)
+		}(b)
+	}
+	var first error
+	for range backends {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func ping(backends []*Backend) {
+	each(backends, func(b *Backend) error {
+		b.Ping()
+		return nil
+	})
+}
+
+// start starts the managed daemons of backends and pings the others.
+func start(backends []*Backend) error {
+	return each(backends, func(b *Backend) error {
+		if b.daemon != nil {
+			return b.daemon.start()
+		}
+		b.Ping()
+		return nil
+	})
+}
+
+func stop(backends []*Backend) {
+	each(backends, func(b *Backend) error {
+		b.stop()
+		return nil
+	})
+}
+
+// Backends returns the daemons, the primary first.
+func (p *Pool) Backends() []*Backend {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]*Backend{}, p.backends...)
+}
+
+// Check pings the daemons.
+func (p *Pool) Check() {
+	ping(p.Backends())
+}
+
+// Watch checks the daemons every interval.
+func (p *Pool) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		p.Check()
+	}
+}
+
+// Primary returns the primary daemon, unless it is down.
+func (p *Pool) Primary() (*Backend, error) {
+	b := p.Backends()[0]
+	if _, err := b.Health(); err != nil {
+		return nil, b.unavailable(err)
+	}
+	return b, nil
+}
+
+// Any returns a daemon that is up, the primary if it is.
+func (p *Pool) Any() (*Backend, error) {
+	backends := p.Backends()
+	for _, b := range backends {
+		if b.healthy() {
+			return b, nil
+		}
+	}
+	_, err := backends[0].Health()
+	return nil, fmt.Errorf("Service unavailable: all the docker daemons are down, the primary at %s: %s", backends[0].Address, err)
+}
+
+// Up returns the daemons that answered their last ping, the primary first.
+func (p *Pool) Up() []*Backend {
+	var up []*Backend
+	for _, b := range p.Backends() {
+		if b.healthy() {
+			up = append(up, b)
+		}
+	}
+	return up
+}
+
+var kindNames = map[string]string{
+	"containers": "container",
+	"exec":       "exec instance",
+}
+
+// Owner returns the daemon that has the container or exec ref, of kind
+// "containers" or "exec". The daemons up are asked for it the first time. A
+// ref none of them has goes to the primary, which answers it is not found,
+// unless another daemon that might have it is down.
+func (p *Pool) Owner(kind, ref string) (*Backend, error) {
+	p.mu.RLock()
+	o, ok := p.owners[kind+"/"+ref]
+	p.mu.RUnlock()
+	if ok {
+		if _, err := o.backend.Health(); err != nil {
+			return nil, o.backend.unavailable(err)
+		}
+		return o.backend, nil
+	}
+
+	var down *Backend
+	var downErr error
+	for _, b := range p.Backends() {
+		id, found := "", false
+		_, err := b.Health()
+		if err == nil {
+			id, found, err = b.lookup(kind, ref)
+		}
+		if err != nil {
+			if down == nil {
+				down, downErr = b, cause(err)
+			}
+			continue
+		}
+		if found {
+			p.own(kind, ref, id, b)
+			return b, nil
+		}
+	}
+	if down != nil {
+		return nil, fmt.Errorf("Service unavailable: no docker daemon up has %s %s, docker at %s is down: %s", kindNames[kind], ref, down.Address, downErr)
+	}
+	return p.Primary()
+}
+
+func (p *Pool) own(kind, ref, id string, b *Backend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.owners[kind+"/"+ref] = owner{id, b}
+	if id != "" {
+		p.owners[kind+"/"+id] = owner{id, b}
+	}
+}
+
+// Forget drops what the pool knows of the container or exec ref, once it
+// is removed or renamed.
+func (p *Pool) Forget(kind, ref string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	o, ok := p.owners[kind+"/"+ref]
+	if !ok {
+		return
+	}
+	for key, other := range p.owners {
+		if o.id != "" && strings.HasPrefix(key, kind+"/") && other.id == o.id {
+			delete(p.owners, key)
+		}
+	}
+	delete(p.owners, kind+"/"+ref)
+}
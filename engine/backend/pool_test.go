@@ -0,0 +1,15 @@
+package backend
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelf(t *testing.T) {
+	for _, addr := range []string{"/var/run/docker.sock", "unix:///var/run/../run/docker.sock", "tcp://127.0.0.1:2375"} {
+		_, err := NewPool([]Config{{Address: addr}}, nil, []string{"unix:///var/run/docker.sock", "tcp://0.0.0.0:2375"})
+		if err == nil || !strings.Contains(err.Error(), "harbour itself") {
+			t.Fatalf("expected %s to be refused, got %v", addr, err)
+		}
+	}
+}
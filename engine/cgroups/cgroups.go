@@ -0,0 +1,123 @@
+// Package cgroups reads and writes the control groups of the processes
+// harbour runs, on both the legacy and the unified hierarchy.
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Root is where the cgroup hierarchies are mounted.
+var Root = "/sys/fs/cgroup"
+
+// Cgroup is the set of control groups a process belongs to.
+type Cgroup struct {
+	root    string
+	unified bool
+	// paths maps a controller to the directory of the group.
+	paths map[string]string
+}
+
+// ForPid returns the control groups of pid.
+func ForPid(pid int) (*Cgroup, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(Root, f)
+}
+
+// Parse reads a /proc/<pid>/cgroup file against the hierarchies mounted at
+// root.
+func Parse(root string, r io.Reader) (*Cgroup, error) {
+	c := &Cgroup{root: root, paths: map[string]string{}}
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		c.unified = true
+	}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		parts := strings.SplitN(s.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if c.unified {
+			if parts[0] == "0" && parts[1] == "" {
+				c.paths[""] = filepath.Join(root, parts[2])
+			}
+			continue
+		}
+		if parts[1] == "" {
+			continue
+		}
+		dir := filepath.Join(root, strings.TrimPrefix(parts[1], "name="), parts[2])
+		for _, controller := range strings.Split(parts[1], ",") {
+			c.paths[controller] = dir
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(c.paths) == 0 {
+		return nil, fmt.Errorf("no cgroup found")
+	}
+	return c, nil
+}
+
+// Unified tells whether the groups live on the unified hierarchy.
+func (c *Cgroup) Unified() bool {
+	return c.unified
+}
+
+// Path returns the directory of the group of controller.
+func (c *Cgroup) Path(controller string) (string, error) {
+	if c.unified {
+		controller = ""
+	}
+	p, ok := c.paths[controller]
+	if !ok {
+		return "", fmt.Errorf("cgroup controller %s is not mounted", controller)
+	}
+	return p, nil
+}
+
+// Read returns the trimmed content of file in the group of controller.
+func (c *Cgroup) Read(controller, file string) (string, error) {
+	p, err := c.Path(controller)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(p, file))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// ReadInt reads file as a single integer. "max" reads as -1.
+func (c *Cgroup) ReadInt(controller, file string) (int64, error) {
+	s, err := c.Read(controller, file)
+	if err != nil {
+		return 0, err
+	}
+	if s == "max" {
+		return -1, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// Write sets file in the group of controller to value.
+func (c *Cgroup) Write(controller, file, value string) error {
+	p, err := c.Path(controller)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(p, file), []byte(value), 0644)
+}
@@ -0,0 +1,124 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const podScope = `/machine.slice/machine-rkt\x2d4c5e4e8a.scope`
+
+func fakeHierarchy(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "cgroups-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func readFile(t *testing.T, root, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestApplyLegacy(t *testing.T) {
+	root := fakeHierarchy(t, map[string]string{
+		"cpu,cpuacct" + podScope + "/cpu.shares":             "1024\n",
+		"cpuset" + podScope + "/cpuset.cpus":                 "0-3\n",
+		"blkio" + podScope + "/blkio.weight":                 "500\n",
+		"memory" + podScope + "/memory.limit_in_bytes":       "9223372036854771712\n",
+		"memory" + podScope + "/memory.memsw.limit_in_bytes": "9223372036854771712\n",
+	})
+	defer os.RemoveAll(root)
+
+	c, err := Parse(root, strings.NewReader(strings.Join([]string{
+		"11:cpuset:" + podScope,
+		"6:cpu,cpuacct:" + podScope,
+		"5:blkio:" + podScope,
+		"4:memory:" + podScope,
+		"1:name=systemd:" + podScope,
+	}, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Unified() {
+		t.Fatal("expected the legacy hierarchy")
+	}
+
+	failed := c.Apply(&Resources{
+		Memory:      64 << 20,
+		MemorySwap:  128 << 20,
+		CPUShares:   512,
+		CpusetCpus:  "1",
+		BlkioWeight: 300,
+	})
+	if len(failed) != 0 {
+		t.Fatalf("unexpected failures: %v", failed)
+	}
+	for file, want := range map[string]string{
+		"cpu,cpuacct" + podScope + "/cpu.shares":             "512",
+		"cpuset" + podScope + "/cpuset.cpus":                 "1",
+		"blkio" + podScope + "/blkio.weight":                 "300",
+		"memory" + podScope + "/memory.limit_in_bytes":       "67108864",
+		"memory" + podScope + "/memory.memsw.limit_in_bytes": "134217728",
+	} {
+		if got := readFile(t, root, file); got != want {
+			t.Fatalf("%s: expected %s, got %s", file, want, got)
+		}
+	}
+
+	if failed := c.Apply(&Resources{BlkioWeight: 10, CpusetCpus: "0"}); len(failed) != 0 {
+		t.Fatalf("unexpected failures: %v", failed)
+	}
+}
+
+func TestApplyUnified(t *testing.T) {
+	root := fakeHierarchy(t, map[string]string{
+		"cgroup.controllers":             "cpuset cpu io memory pids\n",
+		podScope + "/cpu.weight":         "100\n",
+		podScope + "/memory.swap.max":    "max\n",
+		podScope + "/memory.current":     "4096\n",
+		podScope + "/cgroup.controllers": "cpu io memory\n",
+	})
+	defer os.RemoveAll(root)
+
+	c, err := Parse(root, strings.NewReader("0::"+podScope+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Unified() {
+		t.Fatal("expected the unified hierarchy")
+	}
+
+	failed := c.Apply(&Resources{Memory: 64 << 20, MemorySwap: 96 << 20, CPUShares: 1024})
+	if len(failed) != 0 {
+		t.Fatalf("unexpected failures: %v", failed)
+	}
+	if got := readFile(t, root, podScope+"/cpu.weight"); got != "39" {
+		t.Fatalf("expected a cpu weight of 39, got %s", got)
+	}
+	if got := readFile(t, root, podScope+"/memory.swap.max"); got != "33554432" {
+		t.Fatalf("expected a swap limit of 33554432, got %s", got)
+	}
+	if n, err := c.ReadInt("memory", "memory.current"); err != nil || n != 4096 {
+		t.Fatalf("expected 4096, got %d (%v)", n, err)
+	}
+
+	if failed := c.Apply(&Resources{MemorySwap: 1 << 30}); failed["MemorySwap"] == nil {
+		t.Fatal("expected a swap limit without a memory limit to fail")
+	}
+}
@@ -0,0 +1,92 @@
+package cgroups
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Resources are the limits harbour applies to a group itself, on top of
+// what the runtime handles.
+type Resources struct {
+	// Memory is only written to allow a MemorySwap limit, which the
+	// legacy hierarchy checks against it.
+	Memory      int64
+	MemorySwap  int64
+	CPUShares   int64
+	CpusetCpus  string
+	BlkioWeight uint16
+}
+
+// Apply writes r to the groups of c. It returns the resources that could
+// not be applied, each with the reason.
+func (c *Cgroup) Apply(r *Resources) map[string]error {
+	failed := map[string]error{}
+	if r.CPUShares > 0 {
+		if err := c.applyCPUShares(r.CPUShares); err != nil {
+			failed["CpuShares"] = err
+		}
+	}
+	if r.CpusetCpus != "" {
+		if err := c.Write("cpuset", "cpuset.cpus", r.CpusetCpus); err != nil {
+			failed["CpusetCpus"] = err
+		}
+	}
+	if r.BlkioWeight > 0 {
+		if err := c.applyBlkioWeight(r.BlkioWeight); err != nil {
+			failed["BlkioWeight"] = err
+		}
+	}
+	if r.MemorySwap != 0 {
+		if err := c.applyMemorySwap(r.Memory, r.MemorySwap); err != nil {
+			failed["MemorySwap"] = err
+		}
+	}
+	return failed
+}
+
+func (c *Cgroup) applyCPUShares(shares int64) error {
+	if !c.unified {
+		return c.Write("cpu", "cpu.shares", strconv.FormatInt(shares, 10))
+	}
+	// The same conversion as systemd and runc: shares of 2..262144 onto a
+	// weight of 1..10000.
+	if shares < 2 {
+		shares = 2
+	}
+	if shares > 262144 {
+		shares = 262144
+	}
+	weight := 1 + ((shares-2)*9999)/262142
+	return c.Write("cpu", "cpu.weight", strconv.FormatInt(weight, 10))
+}
+
+func (c *Cgroup) applyBlkioWeight(weight uint16) error {
+	if !c.unified {
+		return c.Write("blkio", "blkio.weight", strconv.Itoa(int(weight)))
+	}
+	// blkio weights go from 10 to 1000, io weights from 1 to 10000.
+	return c.Write("io", "io.weight", "default "+strconv.Itoa(1+(int(weight)-10)*9999/990))
+}
+
+func (c *Cgroup) applyMemorySwap(memory, swap int64) error {
+	if !c.unified {
+		if _, err := c.Read("memory", "memory.memsw.limit_in_bytes"); err != nil {
+			return fmt.Errorf("swap accounting is not enabled in the kernel")
+		}
+		if memory > 0 {
+			if err := c.Write("memory", "memory.limit_in_bytes", strconv.FormatInt(memory, 10)); err != nil {
+				return err
+			}
+		}
+		return c.Write("memory", "memory.memsw.limit_in_bytes", strconv.FormatInt(swap, 10))
+	}
+
+	value := "max"
+	if swap > 0 {
+		if memory <= 0 {
+			return fmt.Errorf("a swap limit needs a memory limit")
+		}
+		value = strconv.FormatInt(swap-memory, 10)
+	}
+	return c.Write("memory", "memory.swap.max", value)
+}
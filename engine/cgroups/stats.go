@@ -0,0 +1,231 @@
+package cgroups
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// UserHZ is the unit of cpuacct.stat and /proc/stat, which the kernel fixes
+// at 100 for userspace.
+const UserHZ = 100
+
+type CPUStats struct {
+	// Usages are in nanoseconds.
+	Total  uint64
+	User   uint64
+	System uint64
+	PerCPU []uint64
+
+	Periods          uint64
+	ThrottledPeriods uint64
+	ThrottledTime    uint64
+}
+
+type MemoryStats struct {
+	Usage    uint64
+	MaxUsage uint64
+	Failcnt  uint64
+	// Limit is 0 when the group is not limited.
+	Limit uint64
+	Stats map[string]uint64
+}
+
+type BlkioEntry struct {
+	Major uint64
+	Minor uint64
+	Op    string
+	Value uint64
+}
+
+// Stats is the resource usage of a group.
+type Stats struct {
+	CPU            CPUStats
+	Memory         MemoryStats
+	IOServiceBytes []BlkioEntry
+	IOServiced     []BlkioEntry
+}
+
+// Stats reads the resource usage of c. Controllers that are not available
+// are left out rather than failing the whole read.
+func (c *Cgroup) Stats() (*Stats, error) {
+	s := &Stats{Memory: MemoryStats{Stats: map[string]uint64{}}}
+	if c.unified {
+		return s, c.unifiedStats(s)
+	}
+	return s, c.legacyStats(s)
+}
+
+func (c *Cgroup) legacyStats(s *Stats) error {
+	if total, err := c.ReadInt("cpuacct", "cpuacct.usage"); err == nil {
+		s.CPU.Total = uint64(total)
+	}
+	if percpu, err := c.Read("cpuacct", "cpuacct.usage_percpu"); err == nil {
+		for _, f := range strings.Fields(percpu) {
+			n, _ := strconv.ParseUint(f, 10, 64)
+			s.CPU.PerCPU = append(s.CPU.PerCPU, n)
+		}
+	}
+	if stat, err := c.readKeyValues("cpuacct", "cpuacct.stat"); err == nil {
+		s.CPU.User = stat["user"] * 1e9 / UserHZ
+		s.CPU.System = stat["system"] * 1e9 / UserHZ
+	}
+	if stat, err := c.readKeyValues("cpu", "cpu.stat"); err == nil {
+		s.CPU.Periods = stat["nr_periods"]
+		s.CPU.ThrottledPeriods = stat["nr_throttled"]
+		s.CPU.ThrottledTime = stat["throttled_time"]
+	}
+
+	m := &s.Memory
+	if n, err := c.ReadInt("memory", "memory.usage_in_bytes"); err == nil {
+		m.Usage = uint64(n)
+	}
+	if n, err := c.ReadInt("memory", "memory.max_usage_in_bytes"); err == nil {
+		m.MaxUsage = uint64(n)
+	}
+	if n, err := c.ReadInt("memory", "memory.failcnt"); err == nil {
+		m.Failcnt = uint64(n)
+	}
+	// An unlimited group reports the largest page aligned value.
+	if n, err := c.ReadInt("memory", "memory.limit_in_bytes"); err == nil && n > 0 && n < 1<<62 {
+		m.Limit = uint64(n)
+	}
+	if stat, err := c.readKeyValues("memory", "memory.stat"); err == nil {
+		m.Stats = stat
+	}
+
+	var err error
+	if s.IOServiceBytes, err = c.readBlkio("blkio.throttle.io_service_bytes"); err != nil {
+		return err
+	}
+	if s.IOServiced, err = c.readBlkio("blkio.throttle.io_serviced"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Cgroup) unifiedStats(s *Stats) error {
+	if stat, err := c.readKeyValues("cpu", "cpu.stat"); err == nil {
+		s.CPU.Total = stat["usage_usec"] * 1000
+		s.CPU.User = stat["user_usec"] * 1000
+		s.CPU.System = stat["system_usec"] * 1000
+		s.CPU.Periods = stat["nr_periods"]
+		s.CPU.ThrottledPeriods = stat["nr_throttled"]
+		s.CPU.ThrottledTime = stat["throttled_usec"] * 1000
+	}
+
+	m := &s.Memory
+	if n, err := c.ReadInt("memory", "memory.current"); err == nil {
+		m.Usage = uint64(n)
+	}
+	if n, err := c.ReadInt("memory", "memory.peak"); err == nil {
+		m.MaxUsage = uint64(n)
+	}
+	if n, err := c.ReadInt("memory", "memory.max"); err == nil && n > 0 {
+		m.Limit = uint64(n)
+	}
+	if events, err := c.readKeyValues("memory", "memory.events"); err == nil {
+		m.Failcnt = events["max"]
+	}
+	if stat, err := c.readKeyValues("memory", "memory.stat"); err == nil {
+		m.Stats = stat
+	}
+
+	p, err := c.Path("io")
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(filepath.Join(p, "io.stat"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	// 8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		major, minor, ok := parseDevice(fields[0])
+		if !ok {
+			continue
+		}
+		values := map[string]uint64{}
+		for _, kv := range fields[1:] {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) == 2 {
+				values[parts[0]], _ = strconv.ParseUint(parts[1], 10, 64)
+			}
+		}
+		s.IOServiceBytes = append(s.IOServiceBytes,
+			BlkioEntry{major, minor, "Read", values["rbytes"]},
+			BlkioEntry{major, minor, "Write", values["wbytes"]})
+		s.IOServiced = append(s.IOServiced,
+			BlkioEntry{major, minor, "Read", values["rios"]},
+			BlkioEntry{major, minor, "Write", values["wios"]})
+	}
+	return sc.Err()
+}
+
+// readKeyValues reads a file of "key value" lines.
+func (c *Cgroup) readKeyValues(controller, file string) (map[string]uint64, error) {
+	content, err := c.Read(controller, file)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]uint64{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = n
+		}
+	}
+	return values, nil
+}
+
+// readBlkio reads a legacy blkio file of "major:minor op value" lines.
+func (c *Cgroup) readBlkio(file string) ([]BlkioEntry, error) {
+	content, err := c.Read("blkio", file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if _, pathErr := c.Path("blkio"); pathErr != nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []BlkioEntry
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		major, minor, ok := parseDevice(fields[0])
+		if !ok {
+			continue
+		}
+		value, _ := strconv.ParseUint(fields[2], 10, 64)
+		entries = append(entries, BlkioEntry{major, minor, fields[1], value})
+	}
+	return entries, nil
+}
+
+func parseDevice(s string) (uint64, uint64, bool) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	major, err1 := strconv.ParseUint(parts[0], 10, 64)
+	minor, err2 := strconv.ParseUint(parts[1], 10, 64)
+	return major, minor, err1 == nil && err2 == nil
+}
@@ -0,0 +1,110 @@
+package cgroups
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLegacyStats(t *testing.T) {
+	root := fakeHierarchy(t, map[string]string{
+		"cpu,cpuacct" + podScope + "/cpuacct.usage":        "2500000000\n",
+		"cpu,cpuacct" + podScope + "/cpuacct.usage_percpu": "1500000000 1000000000 \n",
+		"cpu,cpuacct" + podScope + "/cpuacct.stat":         "user 150\nsystem 50\n",
+		"cpu,cpuacct" + podScope + "/cpu.stat":             "nr_periods 10\nnr_throttled 2\nthrottled_time 3000\n",
+		"memory" + podScope + "/memory.usage_in_bytes":     "1048576\n",
+		"memory" + podScope + "/memory.max_usage_in_bytes": "2097152\n",
+		"memory" + podScope + "/memory.failcnt":            "0\n",
+		"memory" + podScope + "/memory.limit_in_bytes":     "9223372036854771712\n",
+		"memory" + podScope + "/memory.stat":               "cache 4096\nrss 8192\ntotal_rss 8192\n",
+		"blkio" + podScope + "/blkio.throttle.io_service_bytes": "8:0 Read 4096\n8:0 Write 8192\n8:0 Sync 0\n" +
+			"8:0 Async 12288\n8:0 Total 12288\nTotal 12288\n",
+		"blkio" + podScope + "/blkio.throttle.io_serviced": "8:0 Read 1\n8:0 Write 2\nTotal 3\n",
+	})
+	defer os.RemoveAll(root)
+
+	c, err := Parse(root, strings.NewReader(strings.Join([]string{
+		"6:cpu,cpuacct:" + podScope,
+		"5:blkio:" + podScope,
+		"4:memory:" + podScope,
+	}, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpu := CPUStats{
+		Total:            2500000000,
+		User:             1500000000,
+		System:           500000000,
+		PerCPU:           []uint64{1500000000, 1000000000},
+		Periods:          10,
+		ThrottledPeriods: 2,
+		ThrottledTime:    3000,
+	}
+	if !reflect.DeepEqual(s.CPU, cpu) {
+		t.Fatalf("expected %+v, got %+v", cpu, s.CPU)
+	}
+	memory := MemoryStats{
+		Usage:    1048576,
+		MaxUsage: 2097152,
+		Stats:    map[string]uint64{"cache": 4096, "rss": 8192, "total_rss": 8192},
+	}
+	if !reflect.DeepEqual(s.Memory, memory) {
+		t.Fatalf("expected %+v, got %+v", memory, s.Memory)
+	}
+	if len(s.IOServiceBytes) != 5 || s.IOServiceBytes[1] != (BlkioEntry{8, 0, "Write", 8192}) {
+		t.Fatalf("unexpected io service bytes %+v", s.IOServiceBytes)
+	}
+	if len(s.IOServiced) != 2 || s.IOServiced[0] != (BlkioEntry{8, 0, "Read", 1}) {
+		t.Fatalf("unexpected io serviced %+v", s.IOServiced)
+	}
+}
+
+func TestUnifiedStats(t *testing.T) {
+	root := fakeHierarchy(t, map[string]string{
+		"cgroup.controllers":         "cpu io memory\n",
+		podScope + "/cpu.stat":       "usage_usec 2000\nuser_usec 1500\nsystem_usec 500\nnr_periods 4\nnr_throttled 1\nthrottled_usec 7\n",
+		podScope + "/memory.current": "1048576\n",
+		podScope + "/memory.max":     "67108864\n",
+		podScope + "/memory.events":  "low 0\nhigh 0\nmax 3\noom 0\noom_kill 0\n",
+		podScope + "/memory.stat":    "anon 8192\nfile 4096\n",
+		podScope + "/io.stat":        "8:0 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=0 dios=0\n",
+	})
+	defer os.RemoveAll(root)
+
+	c, err := Parse(root, strings.NewReader("0::"+podScope+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpu := CPUStats{Total: 2000000, User: 1500000, System: 500000, Periods: 4, ThrottledPeriods: 1, ThrottledTime: 7000}
+	if !reflect.DeepEqual(s.CPU, cpu) {
+		t.Fatalf("expected %+v, got %+v", cpu, s.CPU)
+	}
+	memory := MemoryStats{
+		Usage:   1048576,
+		Limit:   67108864,
+		Failcnt: 3,
+		Stats:   map[string]uint64{"anon": 8192, "file": 4096},
+	}
+	if !reflect.DeepEqual(s.Memory, memory) {
+		t.Fatalf("expected %+v, got %+v", memory, s.Memory)
+	}
+	bytes := []BlkioEntry{{8, 0, "Read", 4096}, {8, 0, "Write", 8192}}
+	if !reflect.DeepEqual(s.IOServiceBytes, bytes) {
+		t.Fatalf("expected %+v, got %+v", bytes, s.IOServiceBytes)
+	}
+	serviced := []BlkioEntry{{8, 0, "Read", 1}, {8, 0, "Write", 2}}
+	if !reflect.DeepEqual(s.IOServiced, serviced) {
+		t.Fatalf("expected %+v, got %+v", serviced, s.IOServiced)
+	}
+}
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/huawei-openlab/harbour/engine/backend"
+)
+
+// Config is the content of the configuration file of the daemon.
+type Config struct {
+	// Middlewares are run on every API request, in this order.
+	Middlewares []MiddlewareConfig `json:"middlewares"`
+	// Backends are docker daemons to forward to, after those of
+	// --docker-sock.
+	Backends []backend.Config `json:"backends"`
+}
+
+type MiddlewareConfig struct {
+	Name    string          `json:"name"`
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// LoadConfig reads the configuration file at path. A missing file is an
+// empty configuration unless required is set.
+func LoadConfig(path string, required bool) (*Config, error) {
+	config := &Config{}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return config, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(config); err != nil {
+		return nil, fmt.Errorf("Invalid configuration file %s: %s", path, err)
+	}
+	return config, nil
+}
@@ -1,22 +1,78 @@
 package engine
 
+import (
+	"time"
+
+	"github.com/huawei-openlab/harbour/engine/backend"
+	"github.com/huawei-openlab/harbour/engine/events"
+)
+
+// Version of harbour.
+const Version = "0.0.1"
+
 type Engine struct {
 	RuntimeType int
+	Events      *events.Events
+	Started     time.Time
+	// Backends are the docker daemons the docker runtime forwards to.
+	Backends *backend.Pool
 }
 
 var (
-	DockerSock  string
 	SocketGroup string
+	BuildTool   string
+	StateRoot   string
+	GC          GCPolicy
+
+	// CRISocket is the unix socket serving the CRI of Kubernetes, none
+	// when empty. The sandboxes of its pods run PodInfraImage.
+	CRISocket     string
+	PodInfraImage string
+
+	// OCIRuntime is the binary the oci runtime drives, e.g. runc or crun.
+	OCIRuntime string
+	// FakeFixture is the file scripting the fake runtime, if any.
+	FakeFixture string
 )
 
+// GCPolicy tells the runtimes harbour emulates docker on what to clean up
+// in the background.
+type GCPolicy struct {
+	// Interval between two collections, none when 0.
+	Interval time.Duration
+	// GracePeriod keeps exited pods around for a while.
+	GracePeriod time.Duration
+
+	// Unused images are removed once older than ImageMaxAge, then the
+	// oldest ones until at most ImageMaxCount images of at most
+	// ImageMaxSize bytes in total remain. 0 means no limit.
+	ImageMaxAge   time.Duration
+	ImageMaxCount int
+	ImageMaxSize  int64
+}
+
 const (
 	RuntimeDocker = iota
 	RuntimeRkt
+	RuntimeOCI
+	RuntimeNspawn
+	RuntimeFake
 )
 
+// RuntimeNames are the names the runtimes are chosen by.
+var RuntimeNames = map[int]string{
+	RuntimeDocker: "docker",
+	RuntimeRkt:    "rkt",
+	RuntimeOCI:    "oci",
+	RuntimeNspawn: "nspawn",
+	RuntimeFake:   "fake",
+}
+
 func New(RuntimeType int) *Engine {
 	eng := &Engine{}
 	eng.RuntimeType = RuntimeType
+	eng.Events = events.New()
+	eng.Started = time.Now()
 
 	return eng
 }
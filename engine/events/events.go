@@ -0,0 +1,109 @@
+// Package events keeps the event log harbour serves on /events for runtimes
+// that have no event API of their own.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const eventsLimit = 1024
+
+type Actor struct {
+	ID         string
+	Attributes map[string]string
+}
+
+// Message is an event in the Docker remote API format.
+type Message struct {
+	Status   string `json:"status,omitempty"`
+	ID       string `json:"id,omitempty"`
+	From     string `json:"from,omitempty"`
+	Type     string
+	Action   string
+	Actor    Actor
+	Time     int64 `json:"time,omitempty"`
+	TimeNano int64 `json:"timeNano,omitempty"`
+}
+
+// Events records the last events and fans them out to subscribers.
+type Events struct {
+	mu     sync.Mutex
+	events []Message
+	subs   map[chan Message]struct{}
+}
+
+func New() *Events {
+	return &Events{subs: make(map[chan Message]struct{})}
+}
+
+// Log records a container event about id, created from image.
+func (e *Events) Log(action, id, image string) {
+	attributes := map[string]string{}
+	if image != "" {
+		attributes["image"] = image
+	}
+	e.publish("container", action, id, image, attributes)
+}
+
+// LogImage records an image event about ref.
+func (e *Events) LogImage(action, ref string) {
+	e.publish("image", action, ref, "", map[string]string{"name": ref})
+}
+
+// LogVolume records a volume event about name, managed by driver.
+func (e *Events) LogVolume(action, name, driver string) {
+	e.publish("volume", action, name, "", map[string]string{"driver": driver})
+}
+
+func (e *Events) publish(typ, action, id, from string, attributes map[string]string) {
+	now := time.Now()
+	msg := Message{
+		Status:   action,
+		ID:       id,
+		From:     from,
+		Type:     typ,
+		Action:   action,
+		Actor:    Actor{ID: id, Attributes: attributes},
+		Time:     now.Unix(),
+		TimeNano: now.UnixNano(),
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.events) == eventsLimit {
+		copy(e.events, e.events[1:])
+		e.events = e.events[:eventsLimit-1]
+	}
+	e.events = append(e.events, msg)
+	for ch := range e.subs {
+		// A subscriber that does not keep up loses events rather than
+		// blocking the runtime.
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// Subscribe returns the recorded events and a channel carrying the new ones.
+// Evict must be called on the channel once the caller is done with it.
+func (e *Events) Subscribe() ([]Message, chan Message) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	past := make([]Message, len(e.events))
+	copy(past, e.events)
+	ch := make(chan Message, 100)
+	e.subs[ch] = struct{}{}
+	return past, ch
+}
+
+func (e *Events) Evict(ch chan Message) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.subs[ch]; ok {
+		delete(e.subs, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,137 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/huawei-openlab/harbour/api/filters"
+)
+
+// Serve answers a docker events request from e. nameOf gives the name of a
+// container, for the container filter.
+func (e *Events) Serve(w http.ResponseWriter, r *http.Request, nameOf func(id string) string) error {
+	query := r.URL.Query()
+	since, err := ParseTimestamp(query.Get("since"))
+	if err != nil {
+		return err
+	}
+	until, err := ParseTimestamp(query.Get("until"))
+	if err != nil {
+		return err
+	}
+	args, err := filters.FromParam(query.Get("filters"))
+	if err != nil {
+		return err
+	}
+	if err := args.Validate("event", "container", "image", "volume", "type"); err != nil {
+		return err
+	}
+
+	past, ch := e.Subscribe()
+	defer e.Evict(ch)
+
+	w.Header().Set("Content-Type", "application/json")
+	out := ioutils.NewWriteFlusher(w)
+	out.Flush()
+	enc := json.NewEncoder(out)
+
+	inRange := func(m Message) bool {
+		t := time.Unix(0, m.TimeNano)
+		return !t.Before(since) && (until.IsZero() || !t.After(until))
+	}
+
+	// Past events are only replayed when the client asks for them.
+	if !since.IsZero() {
+		for _, m := range past {
+			if inRange(m) && match(args, m, nameOf) {
+				if err := enc.Encode(m); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+
+	var timeout <-chan time.Time
+	if !until.IsZero() {
+		if !until.After(time.Now()) {
+			return nil
+		}
+		timeout = time.After(until.Sub(time.Now()))
+	}
+	var closed <-chan bool
+	if closeNotifier, ok := w.(http.CloseNotifier); ok {
+		closed = closeNotifier.CloseNotify()
+	}
+
+	for {
+		select {
+		case m, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if !inRange(m) || !match(args, m, nameOf) {
+				continue
+			}
+			if err := enc.Encode(m); err != nil {
+				return nil
+			}
+		case <-timeout:
+			return nil
+		case <-closed:
+			return nil
+		}
+	}
+}
+
+func match(args filters.Args, m Message, nameOf func(id string) string) bool {
+	if !args.ExactMatch("event", m.Action) || !args.ExactMatch("type", m.Type) {
+		return false
+	}
+	if m.Type == "image" {
+		return !args.Include("container") && !args.Include("volume") && args.ExactMatch("image", m.ID)
+	}
+	if m.Type == "volume" {
+		return !args.Include("container") && !args.Include("image") && args.ExactMatch("volume", m.ID)
+	}
+	if args.Include("volume") {
+		return false
+	}
+
+	if args.Include("container") {
+		name := nameOf(m.ID)
+		if !args.PrefixMatch("container", m.ID) && !args.ExactMatch("container", name) {
+			return false
+		}
+	}
+	return args.ExactMatch("image", m.From)
+}
+
+// ParseTimestamp accepts the unix timestamps, with an optional fractional
+// part, and the RFC3339 dates docker clients send as since and until.
+func ParseTimestamp(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+
+	parts := strings.SplitN(value, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Bad parameter: invalid timestamp %s", value)
+	}
+	var nsec int64
+	if len(parts) == 2 {
+		frac := (parts[1] + "000000000")[:9]
+		if nsec, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, fmt.Errorf("Bad parameter: invalid timestamp %s", value)
+		}
+	}
+	return time.Unix(sec, nsec), nil
+}
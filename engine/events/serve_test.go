@@ -0,0 +1,129 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// past returns an event log holding the events of actions, one second apart
+// from base.
+func past(base time.Time, actions ...[3]string) *Events {
+	e := New()
+	for i, a := range actions {
+		if a[0] == "pull" {
+			e.LogImage(a[0], a[1])
+		} else {
+			e.Log(a[0], a[1], a[2])
+		}
+		t := base.Add(time.Duration(i) * time.Second)
+		e.events[i].Time, e.events[i].TimeNano = t.Unix(), t.UnixNano()
+	}
+	return e
+}
+
+func serve(e *Events, query url.Values) ([]string, error) {
+	req, _ := http.NewRequest("GET", "/events?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	err := e.Serve(w, req, func(id string) string {
+		return map[string]string{"c1": "web", "c2": "db"}[id]
+	})
+	var got []string
+	dec := json.NewDecoder(w.Body)
+	for dec.More() {
+		var m Message
+		if err := dec.Decode(&m); err != nil {
+			return nil, err
+		}
+		got = append(got, m.Action+" "+m.ID)
+	}
+	return got, err
+}
+
+func TestServe(t *testing.T) {
+	base := time.Unix(1443693600, 0)
+	e := past(base,
+		[3]string{"create", "c1", "nginx"},
+		[3]string{"start", "c1", "nginx"},
+		[3]string{"pull", "redis:3", ""},
+		[3]string{"create", "c2", "redis:3"},
+		[3]string{"die", "c1", "nginx"},
+	)
+	unix := func(sec int) string {
+		return fmt.Sprint(base.Unix() + int64(sec))
+	}
+	until := base.Add(time.Hour).Format(time.RFC3339)
+
+	for _, tc := range []struct {
+		since, until, filters string
+		want                  string
+	}{
+		{"", until, "", ""},
+		{unix(0), until, "", "create c1,start c1,pull redis:3,create c2,die c1"},
+		{unix(1), unix(3), "", "start c1,pull redis:3,create c2"},
+		{unix(1) + ".5", until, "", "pull redis:3,create c2,die c1"},
+		{base.Add(3 * time.Second).Format(time.RFC3339Nano), until, "", "create c2,die c1"},
+		{unix(0), until, `{"event":["create"]}`, "create c1,create c2"},
+		{unix(0), until, `{"container":["web"]}`, "create c1,start c1,die c1"},
+		{unix(0), until, `{"container":{"c2":true}}`, "create c2"},
+		{unix(0), until, `{"image":["redis:3"]}`, "pull redis:3,create c2"},
+		{unix(0), until, `{"type":["image"]}`, "pull redis:3"},
+		{unix(0), until, `{"type":["container"],"event":["die","start"]}`, "start c1,die c1"},
+	} {
+		query := url.Values{"since": {tc.since}, "until": {tc.until}, "filters": {tc.filters}}
+		got, err := serve(e, query)
+		if err != nil {
+			t.Fatalf("%v: %s", query, err)
+		}
+		if strings.Join(got, ",") != tc.want {
+			t.Fatalf("%v: expected %q, got %q", query, tc.want, strings.Join(got, ","))
+		}
+	}
+
+	for _, query := range []url.Values{
+		{"since": {"yesterday"}},
+		{"until": {"1443693600.x"}},
+		{"filters": {`{"label":["a"]}`}},
+		{"filters": {`not json`}},
+	} {
+		if _, err := serve(e, query); err == nil || !strings.HasPrefix(err.Error(), "Bad parameter") {
+			t.Fatalf("%v: expected the request to be refused, got %v", query, err)
+		}
+	}
+}
+
+func TestServeFollow(t *testing.T) {
+	e := New()
+	e.Log("create", "c1", "nginx")
+	go func() {
+		// Wait for the request to subscribe.
+		for {
+			e.mu.Lock()
+			n := len(e.subs)
+			e.mu.Unlock()
+			if n > 0 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		e.Log("start", "c2", "redis")
+		e.Log("start", "c1", "nginx")
+	}()
+
+	until := time.Now().Add(time.Second)
+	got, err := serve(e, url.Values{
+		"until":   {fmt.Sprintf("%d.%09d", until.Unix(), until.Nanosecond())},
+		"filters": {`{"container":["web"]}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "start c1" {
+		t.Fatalf("expected only the new event of c1, got %q", got)
+	}
+}
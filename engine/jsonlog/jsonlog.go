@@ -0,0 +1,264 @@
+// Package jsonlog writes the output of containers in the json-file format of
+// docker and serves it back on docker logs, for the runtimes harbour keeps
+// the logs of.
+package jsonlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/huawei-openlab/harbour/engine/events"
+)
+
+// FileName is the name of the log in the directory of a container.
+const FileName = "container-json.log"
+
+const pollInterval = 200 * time.Millisecond
+
+type entry struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+// Writer writes the streams of a container to its log, one entry per line.
+type Writer struct {
+	sync.Mutex
+	w       io.Writer
+	streams []*stream
+}
+
+type stream struct {
+	log  *Writer
+	name string
+	buf  bytes.Buffer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Stream returns the writer of the stream name, stdout or stderr.
+func (l *Writer) Stream(name string) io.Writer {
+	s := &stream{log: l, name: name}
+	l.streams = append(l.streams, s)
+	return s
+}
+
+// Flush writes the partial lines left once the container is gone.
+func (l *Writer) Flush() {
+	l.Lock()
+	defer l.Unlock()
+	for _, s := range l.streams {
+		if s.buf.Len() > 0 {
+			s.write(s.buf.String())
+			s.buf.Reset()
+		}
+	}
+}
+
+func (s *stream) Write(p []byte) (int, error) {
+	s.log.Lock()
+	defer s.log.Unlock()
+	s.buf.Write(p)
+	for {
+		line, err := s.buf.ReadString('\n')
+		if err != nil {
+			// Keep the partial line until the rest shows up.
+			s.buf.Reset()
+			s.buf.WriteString(line)
+			return len(p), nil
+		}
+		s.write(line)
+	}
+}
+
+func (s *stream) write(line string) {
+	data, err := json.Marshal(map[string]string{
+		"log":    line,
+		"stream": s.name,
+		"time":   time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return
+	}
+	s.log.w.Write(append(data, '\n'))
+}
+
+type options struct {
+	stdout, stderr bool
+	follow         bool
+	timestamps     bool
+	tail           int
+	since          time.Time
+}
+
+func parseOptions(r *http.Request) (*options, error) {
+	q := r.URL.Query()
+	boolParam := func(name string) bool {
+		v := q.Get(name)
+		return v == "1" || v == "true"
+	}
+	opts := &options{
+		stdout:     boolParam("stdout"),
+		stderr:     boolParam("stderr"),
+		follow:     boolParam("follow"),
+		timestamps: boolParam("timestamps"),
+		tail:       -1,
+	}
+	if !opts.stdout && !opts.stderr {
+		return nil, fmt.Errorf("Bad parameter: you must choose at least one stream")
+	}
+	if tail := q.Get("tail"); tail != "" && tail != "all" {
+		n, err := strconv.Atoi(tail)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Bad parameter: invalid tail %s", tail)
+		}
+		opts.tail = n
+	}
+	if since := q.Get("since"); since != "" && since != "0" {
+		t, err := events.ParseTimestamp(since)
+		if err != nil {
+			return nil, err
+		}
+		opts.since = t
+	}
+	return opts, nil
+}
+
+// Serve answers a docker logs request from the log at path. The log is
+// followed until exited is closed, it is nil for a container not running.
+func Serve(w http.ResponseWriter, r *http.Request, path string, tty bool, exited <-chan struct{}) error {
+	opts, err := parseOptions(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+	w.WriteHeader(http.StatusOK)
+	out := ioutils.NewWriteFlusher(w)
+	if f == nil {
+		return nil
+	}
+	defer f.Close()
+
+	reader := &reader{r: bufio.NewReader(f)}
+	var entries []*entry
+	for {
+		e, err := reader.next()
+		if err != nil {
+			break
+		}
+		if opts.keep(e) {
+			entries = append(entries, e)
+		}
+	}
+	if opts.tail >= 0 && len(entries) > opts.tail {
+		entries = entries[len(entries)-opts.tail:]
+	}
+	for _, e := range entries {
+		if err := writeEntry(out, e, tty, opts.timestamps); err != nil {
+			return nil
+		}
+	}
+	if !opts.follow || exited == nil {
+		return nil
+	}
+
+	var closed <-chan bool
+	if closeNotifier, ok := w.(http.CloseNotifier); ok {
+		closed = closeNotifier.CloseNotify()
+	}
+	done := false
+	for {
+		e, err := reader.next()
+		if err == nil {
+			if opts.keep(e) {
+				if err := writeEntry(out, e, tty, opts.timestamps); err != nil {
+					return nil
+				}
+			}
+			continue
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-exited:
+			// Read what the container wrote before it exited.
+			done = true
+		case <-closed:
+			return nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (opts *options) keep(e *entry) bool {
+	if e.Stream == "stdout" && !opts.stdout || e.Stream == "stderr" && !opts.stderr {
+		return false
+	}
+	return opts.since.IsZero() || e.Time.After(opts.since)
+}
+
+// reader reads the entries of a log being written to.
+type reader struct {
+	r       *bufio.Reader
+	partial []byte
+}
+
+// next returns the next complete entry of the log. A partial line is kept
+// until the rest of it is written.
+func (l *reader) next() (*entry, error) {
+	for {
+		line, err := l.r.ReadBytes('\n')
+		l.partial = append(l.partial, line...)
+		if err != nil {
+			return nil, err
+		}
+		line, l.partial = l.partial, nil
+		e := &entry{}
+		if err := json.Unmarshal(line, e); err != nil {
+			continue
+		}
+		return e, nil
+	}
+}
+
+// writeEntry writes e the way docker does: raw for a tty, multiplexed with a
+// header naming the stream otherwise.
+func writeEntry(w io.Writer, e *entry, tty, timestamps bool) error {
+	msg := e.Log
+	if timestamps {
+		msg = e.Time.Format(time.RFC3339Nano) + " " + msg
+	}
+	if tty {
+		_, err := io.WriteString(w, msg)
+		return err
+	}
+	header := make([]byte, 8)
+	header[0] = 1
+	if e.Stream == "stderr" {
+		header[0] = 2
+	}
+	binary.BigEndian.PutUint32(header[4:], uint32(len(msg)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, msg)
+	return err
+}
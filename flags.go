@@ -3,44 +3,61 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
+	"github.com/huawei-openlab/harbour/api/client"
 	"github.com/huawei-openlab/harbour/mflag"
 	"github.com/huawei-openlab/harbour/opts"
 )
 
-type command struct {
-	name        string
-	description string
-}
-
 var (
 	flVersion    = mflag.Bool([]string{"v", "-version"}, false, "Print version information and quit")
 	flDaemon     = mflag.Bool([]string{"d", "-daemon"}, false, "Enable daemon mode")
-	flDockerSock = mflag.String([]string{"-docker-sock"}, opts.DEFAULTDOCKERSOCKET, "Path to docker sock file")
+	flConfig     = mflag.String([]string{"-config-file"}, opts.DEFAULTCONFIGFILE, "Daemon configuration file")
 	flRuntime    = mflag.String([]string{"-container-runtime"}, opts.DEFAULTRUNTIME, "Container runtime to choose")
 	flDebug      = mflag.Bool([]string{"D", "-debug"}, false, "Enable debug mode")
 	flGroup      = mflag.String([]string{"G", "-group"}, "docker", "Group for the unix socket")
+	flOCIRuntime = mflag.String([]string{"-oci-runtime"}, opts.DEFAULTOCIRUNTIME, "OCI runtime binary of the oci container runtime, e.g. runc or crun")
+	flFixture    = mflag.String([]string{"-fake-fixture"}, "", "File scripting the fake container runtime")
+	flBuildTool  = mflag.String([]string{"-build-tool"}, "", "Command used to build images for rkt")
+	flPidFile    = mflag.String([]string{"p", "-pidfile"}, opts.DEFAULTPIDFILE, "Path to use for daemon PID file")
+	flForce      = mflag.Bool([]string{"-force"}, false, "Take over the unix sockets other processes serve")
+	flStateRoot  = mflag.String([]string{"-state-root"}, opts.DEFAULTSTATEROOT, "Root directory of harbour's state")
+	flGCInterval = mflag.String([]string{"-gc-interval"}, "", "Interval of the background garbage collection, e.g. 10m")
+	flGCGrace    = mflag.String([]string{"-gc-grace-period"}, "30m", "Time exited pods are kept before collection")
+	flImageAge   = mflag.String([]string{"-image-max-age"}, "", "Collect unused images older than this, e.g. 720h")
+	flImageCount = mflag.Int([]string{"-image-max-count"}, 0, "Number of images to keep at most")
+	flImageSize  = mflag.String([]string{"-image-max-size"}, "", "Total size of the images to keep at most, e.g. 20g")
+	flMaxProcs   = mflag.Int([]string{"-max-procs"}, 64, "Number of runtime commands run at once at most, 0 for no bound")
+	flTLS        = mflag.Bool([]string{"-tls"}, false, "Use TLS on the TCP sockets; implied by --tlsverify")
+	flTLSVerify  = mflag.Bool([]string{"-tlsverify"}, false, "Use TLS and require client certificates signed by the CA")
+	flCACert     = mflag.String([]string{"-tlscacert"}, filepath.Join(opts.DEFAULTCERTPATH, "ca.pem"), "Trust certs signed only by this CA")
+	flCert       = mflag.String([]string{"-tlscert"}, filepath.Join(opts.DEFAULTCERTPATH, "cert.pem"), "Path to TLS certificate file")
+	flKey        = mflag.String([]string{"-tlskey"}, filepath.Join(opts.DEFAULTCERTPATH, "key.pem"), "Path to TLS key file")
+	flDockerPing = mflag.String([]string{"-docker-ping-interval"}, "5s", "Interval between the health checks of the docker daemons")
+	flCRISocket  = mflag.String([]string{"-cri-socket"}, "", "Unix socket serving the Kubernetes CRI, e.g. /var/run/harbour/cri.sock")
+	flPodInfra   = mflag.String([]string{"-pod-infra-image"}, opts.DEFAULTPODINFRA, "Image of the pause containers of the CRI pod sandboxes")
 	flHelp       = mflag.Bool([]string{"h", "-help"}, false, "Print usage")
 	// these are initialized in init() below
-	flHosts []string
-)
-
-var (
-	commands = []command{}
+	flHosts       []string
+	flAdminHosts  []string
+	flDockerSocks = opts.NewListOpts(nil)
 )
 
 func init() {
 	opts.HostListVar(&flHosts, []string{"H", "-host"}, "Daemon socket(s) to connect to")
+	opts.HostListVar(&flAdminHosts, []string{"-admin-host"}, "Socket(s) serving the admin API alone, instead of next to the docker API")
+	mflag.Var(&flDockerSocks, []string{"-docker-sock"}, "Docker daemon(s) to forward to, the first one is the primary (default "+opts.DEFAULTDOCKERSOCKET+")")
 	mflag.Usage = func() {
-		fmt.Fprint(os.Stdout, "Usage: harbour [OPTIONS] [arg...]\n\nOptions:\n")
+		fmt.Fprint(os.Stdout, "Usage: harbour [OPTIONS] [COMMAND] [arg...]\n\nOptions:\n")
 
 		mflag.CommandLine.SetOutput(os.Stdout)
 		mflag.PrintDefaults()
 
 		help := "\nCommands:\n"
 
-		for _, cmd := range commands {
-			help += fmt.Sprintf("    %-10.10s%s\n", cmd.name, cmd.description)
+		for _, cmd := range client.Commands {
+			help += fmt.Sprintf("    %-10.10s%s\n", cmd.Name, cmd.Description)
 		}
 
 		help += "\nRun 'harbour COMMAND --help' for more information on a command."
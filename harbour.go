@@ -2,10 +2,17 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"strings"
 
+	"github.com/huawei-openlab/harbour/api/client"
+	"github.com/huawei-openlab/harbour/driver/emulator"
+	"github.com/huawei-openlab/harbour/engine"
 	"github.com/huawei-openlab/harbour/mflag"
 	"github.com/huawei-openlab/harbour/opts"
 
@@ -30,7 +37,7 @@ func main() {
 	}
 
 	if len(*flRuntime) != 0 {
-		if *flRuntime != opts.DEFAULTRUNTIME && *flRuntime != opts.RKTRUNTIME {
+		if !validRuntime(*flRuntime) {
 			fmt.Println("Invalid container runtime")
 			return
 		}
@@ -41,12 +48,14 @@ func main() {
 		flHosts = append(flHosts, defaultHost)
 	}
 
-	_, ok := exec.LookPath("docker")
-	if ok != nil {
-		logrus.Fatal("Can't find docker")
-	}
-
 	if *flDaemon {
+		// The emulated runtimes run their containers without docker.
+		if !emulator.Registered(*flRuntime) {
+			_, ok := exec.LookPath("docker")
+			if ok != nil {
+				logrus.Fatal("Can't find docker")
+			}
+		}
 		mainDaemon()
 		return
 	}
@@ -56,10 +65,76 @@ func main() {
 		os.Exit(0)
 	}
 
-	// If no flag specified, print help info.
-	mflag.Usage()
+	// If no command specified, print help info.
+	if mflag.NArg() == 0 {
+		mflag.Usage()
+		return
+	}
+
+	protoAddrParts := strings.SplitN(flHosts[0], "://", 2)
+	var tlsConfig *tls.Config
+	if *flTLS || *flTLSVerify {
+		var err error
+		if tlsConfig, err = newClientTLSConfig(*flTLSVerify); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	cli, err := client.NewHarbourCli(os.Stdin, os.Stdout, os.Stderr, protoAddrParts[0], protoAddrParts[1], tlsConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := cli.Cmd(mflag.Args()...); err != nil {
+		if err == client.ErrHelp {
+			return
+		}
+		if sterr, ok := err.(client.StatusError); ok {
+			if sterr.Status != "" {
+				fmt.Fprintln(os.Stderr, sterr.Status)
+			}
+			os.Exit(sterr.StatusCode)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// newClientTLSConfig uses the certificate of the client if there is one,
+// and checks the daemon against the CA if verify is set.
+func newClientTLSConfig(verify bool) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if verify {
+		pem, err := ioutil.ReadFile(*flCACert)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't read CA certificate: %s", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificate found in %s", *flCACert)
+		}
+	} else {
+		config.InsecureSkipVerify = true
+	}
+	if _, err := os.Stat(*flCert); err == nil {
+		cert, err := tls.LoadX509KeyPair(*flCert, *flKey)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't load X509 key pair (%s, %s): %s", *flCert, *flKey, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func validRuntime(name string) bool {
+	for _, n := range engine.RuntimeNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
 }
 
 func showVersion() {
-	fmt.Printf("harbour version 0.0.1\n")
+	fmt.Printf("harbour version %s\n", engine.Version)
 }
@@ -12,8 +12,15 @@ const (
 	DEFAULTHTTPHOST     = "127.0.0.1"
 	DEFAULTUNIXSOCKET   = "/var/run/docker.sock"
 	DEFAULTDOCKERSOCKET = "/var/run/docker-real.sock"
+	DEFAULTSTATEROOT    = "/var/lib/harbour"
+	DEFAULTPIDFILE      = "/var/run/harbour.pid"
+	DEFAULTCONFIGFILE   = "/etc/harbour/harbour.json"
+	DEFAULTCERTPATH     = "/etc/harbour"
 	DEFAULTRUNTIME      = "docker"
+	DEFAULTPODINFRA     = "registry.k8s.io/pause:3.9"
 	RKTRUNTIME          = "rkt"
+	OCIRUNTIME          = "oci"
+	DEFAULTOCIRUNTIME   = "runc"
 )
 
 type ListOpts struct {
@@ -21,6 +28,17 @@ type ListOpts struct {
 	validator func(val string) (string, error)
 }
 
+// NewListOpts creates the values of a flag that can be repeated.
+func NewListOpts(validator func(val string) (string, error)) ListOpts {
+	var values []string
+	return ListOpts{values: &values, validator: validator}
+}
+
+// GetAll returns the values given to the flag.
+func (opts *ListOpts) GetAll() []string {
+	return *opts.values
+}
+
 func (opts *ListOpts) String() string {
 	return fmt.Sprintf("%v", []string((*opts.values)))
 }
@@ -105,3 +123,27 @@ func ValidateHost(val string) (string, error) {
 func HostListVar(values *[]string, names []string, usage string) {
 	mflag.Var(&ListOpts{values: values, validator: ValidateHost}, names, usage)
 }
+
+// ParseSize reads a size in bytes with an optional binary unit suffix, e.g.
+// "512m" or "20GB".
+func ParseSize(s string) (int64, error) {
+	units := map[string]int64{"": 1, "b": 1, "k": 1 << 10, "m": 1 << 20, "g": 1 << 30, "t": 1 << 40}
+	v := strings.ToLower(strings.TrimSpace(s))
+	i := strings.IndexFunc(v, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(v)
+	}
+	unit := strings.TrimSuffix(strings.TrimSuffix(v[i:], "ib"), "b")
+	if v[i:] == "b" {
+		unit = "b"
+	}
+	mult, ok := units[unit]
+	if i == 0 || !ok {
+		return 0, fmt.Errorf("Invalid size: %s", s)
+	}
+	n, err := strconv.ParseFloat(v[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid size: %s", s)
+	}
+	return int64(n * float64(mult)), nil
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// LockPidFile writes the pid of the process to path, and holds a lock on
+// it until release is called or the process exits, so that only one
+// process can hold it at once.
+func LockPidFile(path string) (release func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	var f *os.File
+	for {
+		if f, err = lockFile(path, os.O_CREATE); err != nil {
+			if err == syscall.EWOULDBLOCK {
+				pid, _ := ioutil.ReadFile(path)
+				return nil, fmt.Errorf("Conflict: harbour is already running with pid %s, %s is locked", strings.TrimSpace(string(pid)), path)
+			}
+			return nil, fmt.Errorf("Couldn't lock %s: %s", path, err)
+		}
+		// The file may have been removed by the process that released
+		// it before we got the lock.
+		if sameFile(f, path) {
+			break
+		}
+		f.Close()
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.WriteString(strconv.Itoa(os.Getpid()) + "\n"); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		removePidFile(f, path)
+	}, nil
+}
+
+func lockFile(path string, flag int) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func sameFile(f *os.File, path string) bool {
+	fi1, err1 := f.Stat()
+	fi2, err2 := os.Stat(path)
+	return err1 == nil && err2 == nil && os.SameFile(fi1, fi2)
+}
+
+// removePidFile unlocks the pidfile f, then removes path if it still is f
+// and holds the pid of the process. The removal happens under a new lock, so
+// that it does not pull the file from under a process that just locked it.
+func removePidFile(f *os.File, path string) {
+	fi, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return
+	}
+	again, err := lockFile(path, 0)
+	if err != nil {
+		return
+	}
+	defer again.Close()
+	current, err := again.Stat()
+	if err != nil || !os.SameFile(fi, current) {
+		return
+	}
+	pid, err := ioutil.ReadAll(again)
+	if err != nil || strings.TrimSpace(string(pid)) != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	os.Remove(path)
+}
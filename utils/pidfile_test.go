@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLockPidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harbour-pidfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "harbour.pid")
+	pid := strconv.Itoa(os.Getpid()) + "\n"
+
+	release, err := LockPidFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != pid {
+		t.Fatalf("expected the pid in the file, got %q", data)
+	}
+	if _, err := LockPidFile(path); err == nil || !strings.Contains(err.Error(), "already running with pid "+strings.TrimSpace(pid)) {
+		t.Fatalf("expected the locked file to be refused, got %v", err)
+	}
+	// Failing to take the lock leaves the file alone.
+	if data, _ := ioutil.ReadFile(path); string(data) != pid {
+		t.Fatalf("expected the pid of the holder in the file, got %q", data)
+	}
+	release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the file to be removed, got %v", err)
+	}
+
+	// A file replaced behind the holder's back is not its to remove.
+	release, err = LockPidFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path)
+	if err := ioutil.WriteFile(path, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if data, _ := ioutil.ReadFile(path); string(data) != "1\n" {
+		t.Fatalf("expected the other file to stay, got %q", data)
+	}
+
+	// Nor is a file that holds another pid.
+	os.Remove(path)
+	release, err = LockPidFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected the file of another pid to stay, got %v", err)
+	}
+}
@@ -3,12 +3,15 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync/atomic"
 )
 
 type Err struct {
@@ -23,20 +26,80 @@ func (e *Err) Error() string {
 	return fmt.Sprintf("[%v:%v] %v", e.File, e.Line, e.Message)
 }
 
+var (
+	// procs holds a token for each command running when their number is
+	// bounded.
+	procs        chan struct{}
+	procsRunning int64
+)
+
+// SetMaxProcs bounds the number of commands Run and RunOutput run at once,
+// the others wait for their turn. n <= 0 lifts the bound. It is meant to be
+// called before the first command.
+func SetMaxProcs(n int) {
+	if n <= 0 {
+		procs = nil
+		return
+	}
+	procs = make(chan struct{}, n)
+}
+
+// Procs returns the number of commands running and their bound, 0 if there
+// is none.
+func Procs() (running, max int) {
+	return int(atomic.LoadInt64(&procsRunning)), cap(procs)
+}
+
+// Acquire waits for the turn of a command that Run and RunOutput do not run,
+// such as one streaming its output, and returns the function ending it.
+func Acquire() func() {
+	if p := procs; p != nil {
+		p <- struct{}{}
+		atomic.AddInt64(&procsRunning, 1)
+		return func() {
+			atomic.AddInt64(&procsRunning, -1)
+			<-p
+		}
+	}
+	atomic.AddInt64(&procsRunning, 1)
+	return func() {
+		atomic.AddInt64(&procsRunning, -1)
+	}
+}
+
 func Run(cmd *exec.Cmd) error {
+	defer Acquire()()
+
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return errorf(err.Error())
+		return errorf("%s", err)
 	}
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return errorf(err.Error())
+		return errorf("%s", err)
 	}
 	go io.Copy(os.Stdout, stdout)
 	go io.Copy(os.Stderr, stderr)
 	return cmd.Run()
 }
 
+// RunOutput runs the command and returns what it wrote to stdout. On failure
+// the returned error carries the command's stderr.
+func RunOutput(cmd *exec.Cmd) (string, error) {
+	defer Acquire()()
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return stdout.String(), errorf("%s", msg)
+	}
+	return stdout.String(), nil
+}
+
 func errorf(format string, args ...interface{}) error {
 	msg := fmt.Sprintf(format, args...)
 	pc, filePath, lineNo, ok := runtime.Caller(1)